@@ -15,6 +15,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	cb "github.com/hyperledger/fabric-protos-go/common"
+	protosbdls "github.com/hyperledger/fabric-protos-go/orderer/bdls"
 	protossmartbft "github.com/hyperledger/fabric-protos-go/orderer/smartbft"
 	"github.com/hyperledger/fabric/common/cauthdsl"
 	"github.com/hyperledger/fabric/common/flogging"
@@ -70,18 +71,32 @@ func (p *policyProvider) NewPolicy(data []byte) (policies.Policy, proto.Message,
 	if err := proto.Unmarshal(data, definition); err != nil {
 		return nil, nil, errors.Wrap(err, "Error unmarshaling to ImplicitOrdererPolicy")
 	}
-	if definition.Rule != cb.ImplicitOrdererPolicy_SMARTBFT {
-		return nil, nil, errors.Errorf("ImplicitOrdererPolicy Rule '%v' not supported", definition.Rule)
-	}
 
-	smartbftMetadata := &protossmartbft.ConfigMetadata{}
-	if err := proto.Unmarshal(p.consensusMetadata, smartbftMetadata); err != nil {
-		return nil, nil, errors.Wrap(err, "failed to unmarshal smartbft metadata configuration")
+	var consenterIdentities [][]byte
+	switch definition.Rule {
+	case cb.ImplicitOrdererPolicy_SMARTBFT:
+		smartbftMetadata := &protossmartbft.ConfigMetadata{}
+		if err := proto.Unmarshal(p.consensusMetadata, smartbftMetadata); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to unmarshal smartbft metadata configuration")
+		}
+		for _, consenter := range smartbftMetadata.Consenters {
+			consenterIdentities = append(consenterIdentities, consenter.Identity)
+		}
+	case cb.ImplicitOrdererPolicy_BDLS:
+		bdlsMetadata := &protosbdls.ConfigMetadata{}
+		if err := proto.Unmarshal(p.consensusMetadata, bdlsMetadata); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to unmarshal bdls metadata configuration")
+		}
+		for _, consenter := range bdlsMetadata.Consenters {
+			consenterIdentities = append(consenterIdentities, consenter.Identity)
+		}
+	default:
+		return nil, nil, errors.Errorf("ImplicitOrdererPolicy Rule '%v' not supported", definition.Rule)
 	}
 
 	var identities [][]byte
-	for _, consenter := range smartbftMetadata.Consenters {
-		id, err := crypto.SanitizeIdentity(consenter.Identity)
+	for _, consenterIdentity := range consenterIdentities {
+		id, err := crypto.SanitizeIdentity(consenterIdentity)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "failed to sanitize identity")
 		}
@@ -89,6 +104,11 @@ func (p *policyProvider) NewPolicy(data []byte) (policies.Policy, proto.Message,
 	}
 
 	q := computeQuorum(len(identities))
+	if definition.Rule == cb.ImplicitOrdererPolicy_BDLS {
+		// A BDLS block is signed by the consenter that wrote it, whereas the
+		// quorum of consenters signs the <decide> proof the block carries.
+		q = 1
+	}
 
 	sigEnv := policydsl.SignedByNOutOfGivenIdentities(int32(q), identities)
 	sigData, err := proto.Marshal(sigEnv)
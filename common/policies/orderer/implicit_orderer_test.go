@@ -17,6 +17,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	cb "github.com/hyperledger/fabric-protos-go/common"
 	protosmsp "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer/bdls"
 	"github.com/hyperledger/fabric-protos-go/orderer/smartbft"
 	"github.com/hyperledger/fabric/common/policies/orderer/mocks"
 	"github.com/hyperledger/fabric/msp"
@@ -55,6 +56,70 @@ func TestPolicyProvider_NewPolicy(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, p.(*implicitBFTPolicy).quorumSize, computeQuorum(4))
 	})
+
+	t.Run("good bdls", func(t *testing.T) {
+		bdlsMetadata, _ := prepareBdlsMetadata(4)
+		provider := NewPolicyProvider(deserializer, "bdls", bdlsMetadata)
+		policyBytes, _ := proto.Marshal(&cb.ImplicitOrdererPolicy{Rule: cb.ImplicitOrdererPolicy_BDLS})
+		p, _, err := provider.NewPolicy(policyBytes)
+		assert.NotNil(t, p)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, p.(*implicitBFTPolicy).quorumSize)
+	})
+
+	t.Run("unknown rule", func(t *testing.T) {
+		policyBytes, _ := proto.Marshal(&cb.ImplicitOrdererPolicy{Rule: cb.ImplicitOrdererPolicy_Rule(7)})
+		p, _, err := provider.NewPolicy(policyBytes)
+		assert.Nil(t, p)
+		assert.EqualError(t, err, "ImplicitOrdererPolicy Rule '7' not supported")
+	})
+}
+
+func TestImplicitBDLSPolicy_Evaluate(t *testing.T) {
+	metadata, identities := prepareBdlsMetadata(4)
+	data := []byte{1, 2, 3}
+	sig := []byte{1, 8, 9}
+	policyBytes, _ := proto.Marshal(&cb.ImplicitOrdererPolicy{Rule: cb.ImplicitOrdererPolicy_BDLS})
+
+	t.Run("no signed data", func(t *testing.T) {
+		provider := NewPolicyProvider(&mocks.IdentityDeserializerMock{}, "bdls", metadata)
+		p, _, err := provider.NewPolicy(policyBytes)
+		assert.NoError(t, err)
+		assert.EqualError(t, p.EvaluateSignedData(nil), "expected at least 1 signatures, but there are only 0")
+	})
+
+	t.Run("signed by a consenter", func(t *testing.T) {
+		deserializer := &mocks.IdentityDeserializerMock{}
+		provider := NewPolicyProvider(deserializer, "bdls", metadata)
+		p, _, err := provider.NewPolicy(policyBytes)
+		assert.NoError(t, err)
+
+		mockID := &mocks.IdentityMock{}
+		deserializer.On("DeserializeIdentity", protoutil.MarshalOrPanic(identities[1])).Return(mockID, nil)
+		mockID.On("GetIdentifier").Return(&msp.IdentityIdentifier{Id: "ID2", Mspid: identities[1].Mspid})
+		mockID.On("SatisfiesPrincipal", mock.Anything).Return(nil)
+		mockID.On("Verify", data, sig).Return(nil)
+
+		signatureSet := []*protoutil.SignedData{{Data: data, Identity: protoutil.MarshalOrPanic(identities[1]), Signature: sig}}
+		assert.NoError(t, p.EvaluateSignedData(signatureSet))
+	})
+
+	t.Run("signed by a non-consenter", func(t *testing.T) {
+		deserializer := &mocks.IdentityDeserializerMock{}
+		provider := NewPolicyProvider(deserializer, "bdls", metadata)
+		p, _, err := provider.NewPolicy(policyBytes)
+		assert.NoError(t, err)
+
+		stranger := protoutil.MarshalOrPanic(&protosmsp.SerializedIdentity{Mspid: "Org1MSP", IdBytes: []byte("stranger")})
+		mockID := &mocks.IdentityMock{}
+		deserializer.On("DeserializeIdentity", stranger).Return(mockID, nil)
+		mockID.On("GetIdentifier").Return(&msp.IdentityIdentifier{Id: "stranger", Mspid: "Org1MSP"})
+		mockID.On("SatisfiesPrincipal", mock.Anything).Return(errors.New("not a consenter"))
+		mockID.On("Verify", data, sig).Return(nil)
+
+		signatureSet := []*protoutil.SignedData{{Data: data, Identity: stranger, Signature: sig}}
+		assert.EqualError(t, p.EvaluateSignedData(signatureSet), "signature set did not satisfy policy")
+	})
 }
 
 func TestImplicitBFTPolicy_Evaluate(t *testing.T) {
@@ -249,3 +314,21 @@ func prepareSmartBFTMetadata(numNodes int) ([]byte, []*smartbft.Consenter, []*pr
 	metadataBytes := protoutil.MarshalOrPanic(metadata)
 	return metadataBytes, consenters, identities
 }
+
+func prepareBdlsMetadata(numNodes int) ([]byte, []*protosmsp.SerializedIdentity) {
+	_, smartbftConsenters, identities := prepareSmartBFTMetadata(numNodes)
+	var consenters []*bdls.Consenter
+	for _, c := range smartbftConsenters {
+		consenters = append(consenters, &bdls.Consenter{
+			ConsenterId:   c.ConsenterId,
+			Host:          c.Host,
+			Port:          c.Port,
+			MspId:         c.MspId,
+			Identity:      c.Identity,
+			ClientTlsCert: c.ClientTlsCert,
+			ServerTlsCert: c.ServerTlsCert,
+		})
+	}
+	metadata := &bdls.ConfigMetadata{Consenters: consenters, Options: &bdls.Options{}}
+	return protoutil.MarshalOrPanic(metadata), identities
+}
@@ -287,29 +287,37 @@ func (p *Peer) SmartBFTId2Identities(cid string) map[uint64][]byte {
 	return res
 }
 
-// BdlsId2Identities get identities from last known configuration.
-func (p *Peer) BdlsId2Identities(cid string) map[uint64][]byte {
+// BdlsIdentities gets the identities of the BDLS consenters from last known
+// configuration, in the order they are listed in the consensus metadata.
+// An error is returned if the channel is ordered by BDLS but its consenters
+// cannot be retrieved.
+func (p *Peer) BdlsIdentities(cid string) ([][]byte, error) {
 	c := p.Channel(cid)
 	if c == nil {
-		return nil
+		return nil, nil
 	}
 
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	oc, ok := c.Resources().OrdererConfig()
-	if !ok {
-		return nil
+	if !ok || oc.ConsensusType() != "bdls" {
+		return nil, nil
 	}
 
 	m := &bdls.ConfigMetadata{}
-	proto.Unmarshal(oc.ConsensusMetadata(), m)
+	if err := proto.Unmarshal(oc.ConsensusMetadata(), m); err != nil {
+		return nil, errors.Wrapf(err, "failed unmarshaling bdls consensus metadata of channel %s", cid)
+	}
+	if len(m.Consenters) == 0 {
+		return nil, errors.Errorf("no bdls consenters in the consensus metadata of channel %s", cid)
+	}
 
-	res := make(map[uint64][]byte)
+	res := make([][]byte, 0, len(m.Consenters))
 	for _, consenter := range m.Consenters {
-		res[consenter.ConsenterId] = consenter.Identity
+		res = append(res, consenter.Identity)
 	}
 
-	return res
+	return res, nil
 }
 
 type IdentityFethcer struct {
@@ -320,8 +328,8 @@ func (i *IdentityFethcer) Id2Identities(cid string) map[uint64][]byte {
 	return i.Adaptee.SmartBFTId2Identities(cid)
 }
 
-func (i *IdentityFethcer) Id2IdentitiesBdls(cid string) map[uint64][]byte {
-	return i.Adaptee.BdlsId2Identities(cid)
+func (i *IdentityFethcer) BdlsIdentities(cid string) ([][]byte, error) {
+	return i.Adaptee.BdlsIdentities(cid)
 }
 
 // createChannel creates a new channel object and insert it into the channels slice.
@@ -5,6 +5,8 @@ go 1.14
 // develop
 replace github.com/hyperledger/fabric => ./
 
+replace github.com/Sperax/bdls => ./orderer/consensus/bdls
+
 replace github.com/hyperledger/fabric-protos-go => github.com/scientificideas/fabric-protos-go v0.0.0-20211020115310-530cb3512535
 
 replace github.com/hyperledger/fabric-config => github.com/scientificideas/fabric-config v0.1.1-0.20211022173806-2db6d2f11301
@@ -20,6 +22,7 @@ require (
 	github.com/Shopify/sarama v1.20.1
 	github.com/Shopify/toxiproxy v2.1.4+incompatible // indirect
 	github.com/SmartBFT-Go/consensus v0.0.0-20211116145419-fe83545244ec
+	github.com/Sperax/bdls v0.0.0-00010101000000-000000000000
 	github.com/VictoriaMetrics/fastcache v1.5.7
 	github.com/VividCortex/gohistogram v1.0.0 // indirect
 	github.com/containerd/continuity v0.0.0-20190426062206-aaeac12a7ffc // indirect
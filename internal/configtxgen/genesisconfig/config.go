@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/SmartBFT-Go/consensus/pkg/types"
+	bdlscore "github.com/Sperax/bdls"
 	"github.com/hyperledger/fabric-protos-go/orderer/bdls"
 	"github.com/hyperledger/fabric-protos-go/orderer/etcdraft"
 	"github.com/hyperledger/fabric-protos-go/orderer/smartbft"
@@ -29,6 +30,9 @@ const (
 
 	// The type key for BFT Smart consensus
 	SmartBFT = "smartbft"
+
+	// The type key for BDLS consensus
+	Bdls = "bdls"
 )
 
 var logger = flogging.MustGetLogger("common.tools.configtxgen.localconfig")
@@ -230,6 +234,8 @@ var genesisDefaults = TopLevel{
 				SpeedUpViewChange:         types.DefaultConfig.SpeedUpViewChange,
 			},
 		},
+		// The timeouts of BDLS rounds default to the durations
+		// the consensus core derives from its default latency.
 		Bdls: &bdls.ConfigMetadata{
 			Options: &bdls.Options{
 				RequestBatchMaxCount:      uint64(types.DefaultConfig.RequestBatchMaxCount),
@@ -240,11 +246,11 @@ var genesisDefaults = TopLevel{
 				RequestForwardTimeout:     types.DefaultConfig.RequestForwardTimeout.String(),
 				RequestComplainTimeout:    types.DefaultConfig.RequestComplainTimeout.String(),
 				RequestAutoRemoveTimeout:  types.DefaultConfig.RequestAutoRemoveTimeout.String(),
-				ViewChangeResendInterval:  types.DefaultConfig.ViewChangeResendInterval.String(),
-				ViewChangeTimeout:         types.DefaultConfig.ViewChangeTimeout.String(),
+				ViewChangeResendInterval:  (2 * bdlscore.DefaultConsensusLatency).String(),
+				ViewChangeTimeout:         bdlscore.MaxConsensusLatency.String(),
 				LeaderHeartbeatTimeout:    types.DefaultConfig.LeaderHeartbeatTimeout.String(),
 				LeaderHeartbeatCount:      uint64(types.DefaultConfig.LeaderHeartbeatCount),
-				CollectTimeout:            types.DefaultConfig.CollectTimeout.String(),
+				CollectTimeout:            (2 * bdlscore.DefaultConsensusLatency).String(),
 				SyncOnStart:               types.DefaultConfig.SyncOnStart,
 				SpeedUpViewChange:         types.DefaultConfig.SpeedUpViewChange,
 			},
@@ -459,9 +465,52 @@ loop:
 			cf.TranslatePathInPlace(configDir, &serverCertPath)
 			c.ServerTlsCert = []byte(serverCertPath)
 		}
-		//TODO: add body for the bdls case
-	case "bdls":
-		// Do nothing
+	case Bdls:
+		if ord.Bdls == nil {
+			logger.Panicf("%s configuration missing", Bdls)
+		}
+		if ord.Bdls.Options == nil {
+			logger.Infof("Orderer.Bdls.Options unset, setting to %v", genesisDefaults.Orderer.Bdls.Options)
+			ord.Bdls.Options = genesisDefaults.Orderer.Bdls.Options
+		}
+
+		if len(ord.Bdls.Consenters) == 0 {
+			logger.Panicf("%s configuration did not specify any consenter", Bdls)
+		}
+
+		for _, c := range ord.Bdls.GetConsenters() {
+			if c.Host == "" {
+				logger.Panicf("consenter info in %s configuration did not specify host", Bdls)
+			}
+			if c.Port == 0 {
+				logger.Panicf("consenter info in %s configuration did not specify port", Bdls)
+			}
+			if c.ClientTlsCert == nil {
+				logger.Panicf("consenter info in %s configuration did not specify client TLS cert", Bdls)
+			}
+			if c.ServerTlsCert == nil {
+				logger.Panicf("consenter info in %s configuration did not specify server TLS cert", Bdls)
+			}
+			if len(c.MspId) == 0 {
+				logger.Panicf("consenter info in %s configuration did not specify MSP ID", Bdls)
+			}
+			if len(c.Identity) == 0 {
+				logger.Panicf("consenter info in %s configuration did not specify identity certificate", Bdls)
+			}
+
+			// Path to the client TLS cert
+			clientCertPath := string(c.GetClientTlsCert())
+			cf.TranslatePathInPlace(configDir, &clientCertPath)
+			c.ClientTlsCert = []byte(clientCertPath)
+			// Path to the server TLS cert
+			serverCertPath := string(c.GetServerTlsCert())
+			cf.TranslatePathInPlace(configDir, &serverCertPath)
+			c.ServerTlsCert = []byte(serverCertPath)
+			// Path to the identity cert
+			identityCertPath := string(c.GetIdentity())
+			cf.TranslatePathInPlace(configDir, &identityCertPath)
+			c.Identity = []byte(identityCertPath)
+		}
 	case SmartBFT:
 		if ord.SmartBFT == nil {
 			logger.Panicf("%s configuration missing", SmartBFT)
@@ -0,0 +1,153 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gossip
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/Sperax/bdls"
+	"github.com/golang/protobuf/proto"
+	pcommon "github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// verifyDecideProof verifies that the <decide> proof embedded in the consenter
+// metadata of the block carries at least 2t+1 <commit> messages of distinct
+// consenters, each backing the header of the block. The identities are in the
+// order of the consenters in the config metadata, which indexes the signers of
+// aggregate proofs.
+func verifyDecideProof(block *pcommon.Block, identities [][]byte) error {
+	consenters := make(map[bdls.Identity]*ecdsa.PublicKey, len(identities))
+	participants := make([]bdls.Identity, 0, len(identities))
+	for i, id := range identities {
+		pk, err := bdlsPublicKey(id)
+		if err != nil {
+			return errors.Wrapf(err, "invalid identity of consenter %d", i)
+		}
+		identity := bdls.DefaultPubKeyToIdentity(pk)
+		consenters[identity] = pk
+		participants = append(participants, identity)
+	}
+
+	consenterMetadata, err := protoutil.GetConsenterMetadataFromBlock(block)
+	if err != nil {
+		return errors.Wrapf(err, "failed extracting consenter metadata of block [%d]", block.Header.Number)
+	}
+
+	decide := &bdls.SignedProto{}
+	if err := decide.Unmarshal(consenterMetadata.Value); err != nil {
+		return errors.Wrapf(err, "failed unmarshaling decide proof of block [%d]", block.Header.Number)
+	}
+	m, _, err := verifyBdlsMessage(decide, consenters)
+	if err != nil {
+		return errors.Wrapf(err, "invalid decide proof of block [%d]", block.Header.Number)
+	}
+	if m.Type != bdls.MessageType_Decide {
+		return errors.Errorf("decide proof of block [%d] is a %s message", block.Header.Number, m.Type)
+	}
+	if m.Height != block.Header.Number {
+		return errors.Errorf("decide proof of block [%d] is for height %d", block.Header.Number, m.Height)
+	}
+
+	headerHash := protoutil.BlockHeaderHash(block.Header)
+	if err := verifyDecidedState(m.State, headerHash); err != nil {
+		return errors.Wrapf(err, "decided state of block [%d]", block.Header.Number)
+	}
+
+	proofs := m.Proof
+	for _, agg := range m.AggregateProof {
+		expanded, err := bdls.ExpandAggregateProof(agg, participants)
+		if err != nil {
+			return errors.Wrapf(err, "invalid aggregate proof in decide proof of block [%d]", block.Header.Number)
+		}
+		proofs = append(proofs, expanded...)
+	}
+
+	commits := make(map[bdls.Identity]struct{})
+	for _, proof := range proofs {
+		mProof, identity, err := verifyBdlsMessage(proof, consenters)
+		if err != nil {
+			return errors.Wrapf(err, "invalid commit in decide proof of block [%d]", block.Header.Number)
+		}
+		if mProof.Type != bdls.MessageType_Commit || mProof.Height != m.Height || mProof.Round != m.Round {
+			continue
+		}
+		if verifyDecidedState(mProof.State, headerHash) != nil {
+			continue
+		}
+		commits[identity] = struct{}{}
+	}
+
+	quorum := 2*((len(consenters)-1)/3) + 1
+	if len(commits) < quorum {
+		return errors.Errorf("decide proof of block [%d] has %d valid commits, but %d are required", block.Header.Number, len(commits), quorum)
+	}
+
+	return nil
+}
+
+// verifyBdlsMessage checks that the signed message is signed by one of the consenters.
+func verifyBdlsMessage(signed *bdls.SignedProto, consenters map[bdls.Identity]*ecdsa.PublicKey) (*bdls.Message, bdls.Identity, error) {
+	var identity bdls.Identity
+	copy(identity[:bdls.SizeAxis], signed.X[:])
+	copy(identity[bdls.SizeAxis:], signed.Y[:])
+
+	pk, exists := consenters[identity]
+	if !exists {
+		return nil, identity, errors.New("message is not signed by a consenter")
+	}
+	if !signed.Verify(pk.Curve) {
+		return nil, identity, errors.New("bad signature")
+	}
+
+	m := &bdls.Message{}
+	if err := m.Unmarshal(signed.Message); err != nil {
+		return nil, identity, errors.Wrap(err, "malformed message")
+	}
+	return m, identity, nil
+}
+
+// verifyDecidedState checks that the state is a block with the given header hash.
+func verifyDecidedState(state bdls.State, headerHash []byte) error {
+	block, err := protoutil.UnmarshalBlock(state)
+	if err != nil {
+		return err
+	}
+	if block.Header == nil {
+		return errors.New("state has no block header")
+	}
+	if !bytes.Equal(protoutil.BlockHeaderHash(block.Header), headerHash) {
+		return errors.New("state does not match the block header")
+	}
+	return nil
+}
+
+// bdlsPublicKey extracts the ECDSA public key of a serialized identity.
+func bdlsPublicKey(identity []byte) (*ecdsa.PublicKey, error) {
+	sID := &mspproto.SerializedIdentity{}
+	if err := proto.Unmarshal(identity, sID); err != nil {
+		return nil, errors.Wrap(err, "failed unmarshaling serialized identity")
+	}
+	bl, _ := pem.Decode(sID.IdBytes)
+	if bl == nil {
+		return nil, errors.Errorf("invalid PEM block in identity of %s", sID.Mspid)
+	}
+	cert, err := x509.ParseCertificate(bl.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing certificate in identity of %s", sID.Mspid)
+	}
+	pk, isECDSA := cert.PublicKey.(*ecdsa.PublicKey)
+	if !isECDSA {
+		return nil, errors.Errorf("identity of %s does not contain an ECDSA public key", sID.Mspid)
+	}
+	return pk, nil
+}
@@ -0,0 +1,204 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gossip
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/Sperax/bdls"
+	"github.com/hyperledger/fabric-protos-go/common"
+	pmsp "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/require"
+)
+
+type bdlsConsenter struct {
+	key      *ecdsa.PrivateKey
+	identity []byte
+}
+
+func newBdlsConsenters(t *testing.T, n int) []*bdlsConsenter {
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+
+	var consenters []*bdlsConsenter
+	for i := 0; i < n; i++ {
+		kp, err := ca.NewServerCertKeyPair("localhost")
+		require.NoError(t, err)
+		bl, _ := pem.Decode(kp.Key)
+		require.NotNil(t, bl)
+		key, err := x509.ParsePKCS8PrivateKey(bl.Bytes)
+		require.NoError(t, err)
+		consenters = append(consenters, &bdlsConsenter{
+			key:      key.(*ecdsa.PrivateKey),
+			identity: protoutil.MarshalOrPanic(&pmsp.SerializedIdentity{Mspid: "OrdererOrg", IdBytes: kp.Cert}),
+		})
+	}
+	return consenters
+}
+
+func bdlsSign(t *testing.T, m *bdls.Message, key *ecdsa.PrivateKey) *bdls.SignedProto {
+	sp := &bdls.SignedProto{}
+	sp.Sign(m, key)
+	return sp
+}
+
+// decidedBlock returns a block carrying a <decide> proof with commits of the given committers.
+func decidedBlock(t *testing.T, leader *bdlsConsenter, committers []*bdlsConsenter) *common.Block {
+	return decidedBlockWithProofs(t, leader, committers, func(decide *bdls.Message) {})
+}
+
+// aggregateDecidedBlock returns a block carrying a <decide> proof with the commits of the
+// given signers combined into an aggregate proof, the i-th signer being set at bits[i].
+func aggregateDecidedBlock(t *testing.T, leader *bdlsConsenter, signers []*bdlsConsenter, bits []int) *common.Block {
+	return decidedBlockWithProofs(t, leader, nil, func(decide *bdls.Message) {
+		agg := &bdls.AggregateProof{Type: bdls.MessageType_Commit, Height: decide.Height, Round: decide.Round, State: decide.State, Signers: []byte{0}}
+		for i, c := range signers {
+			sp := bdlsSign(t, &bdls.Message{Type: bdls.MessageType_Commit, Height: decide.Height, Round: decide.Round, State: decide.State}, c.key)
+			sig := make([]byte, 64)
+			copy(sig[32-len(sp.R):32], sp.R)
+			copy(sig[64-len(sp.S):], sp.S)
+			agg.Signers[0] |= 1 << uint(bits[i])
+			agg.Signatures = append(agg.Signatures, sig)
+		}
+		decide.AggregateProof = []*bdls.AggregateProof{agg}
+	})
+}
+
+func decidedBlockWithProofs(t *testing.T, leader *bdlsConsenter, committers []*bdlsConsenter, addProofs func(decide *bdls.Message)) *common.Block {
+	return decideBlock(t, [][]byte{[]byte("tx")}, leader, committers, addProofs)
+}
+
+// migrationBlock returns the config block migrating a BDLS channel to etcdraft, with
+// the <decide> proof of the given committers the BDLS consenters write it with.
+func migrationBlock(t *testing.T, leader *bdlsConsenter, committers []*bdlsConsenter) *common.Block {
+	config := &common.ConfigEnvelope{
+		Config: &common.Config{
+			ChannelGroup: &common.ConfigGroup{
+				Groups: map[string]*common.ConfigGroup{
+					"Orderer": {
+						Values: map[string]*common.ConfigValue{
+							"ConsensusType": {
+								Value: protoutil.MarshalOrPanic(&orderer.ConsensusType{
+									Type:  "etcdraft",
+									State: orderer.ConsensusType_STATE_MAINTENANCE,
+								}),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	env := &common.Envelope{
+		Payload: protoutil.MarshalOrPanic(&common.Payload{
+			Header: &common.Header{
+				ChannelHeader: protoutil.MarshalOrPanic(&common.ChannelHeader{Type: int32(common.HeaderType_CONFIG), ChannelId: "mychannel"}),
+			},
+			Data: protoutil.MarshalOrPanic(config),
+		}),
+	}
+	return decideBlock(t, [][]byte{protoutil.MarshalOrPanic(env)}, leader, committers, func(decide *bdls.Message) {})
+}
+
+// decideBlock returns a block of the given data, carrying a <decide> proof with commits of the given committers.
+func decideBlock(t *testing.T, data [][]byte, leader *bdlsConsenter, committers []*bdlsConsenter, addProofs func(decide *bdls.Message)) *common.Block {
+	block := protoutil.NewBlock(5, []byte("previous hash"))
+	block.Data.Data = data
+	block.Header.DataHash = protoutil.BlockDataHash(block.Data)
+	state := protoutil.MarshalOrPanic(block)
+
+	decide := &bdls.Message{Type: bdls.MessageType_Decide, Height: 5, Round: 1, State: state}
+	for _, c := range committers {
+		decide.Proof = append(decide.Proof, bdlsSign(t, &bdls.Message{Type: bdls.MessageType_Commit, Height: 5, Round: 1, State: state}, c.key))
+	}
+	addProofs(decide)
+	proof, err := bdlsSign(t, decide, leader.key).Marshal()
+	require.NoError(t, err)
+
+	block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES] = protoutil.MarshalOrPanic(&common.Metadata{
+		Value: protoutil.MarshalOrPanic(&common.OrdererBlockMetadata{
+			ConsenterMetadata: protoutil.MarshalOrPanic(&common.Metadata{Value: proof}),
+		}),
+	})
+	return block
+}
+
+func TestVerifyDecideProof(t *testing.T) {
+	consenters := newBdlsConsenters(t, 4)
+	var identities [][]byte
+	for _, c := range consenters {
+		identities = append(identities, c.identity)
+	}
+
+	t.Run("valid proof", func(t *testing.T) {
+		block := decidedBlock(t, consenters[0], consenters[:3])
+		require.NoError(t, verifyDecideProof(block, identities))
+	})
+
+	t.Run("duplicate commits", func(t *testing.T) {
+		block := decidedBlock(t, consenters[0], []*bdlsConsenter{consenters[0], consenters[1], consenters[1]})
+		require.EqualError(t, verifyDecideProof(block, identities), "decide proof of block [5] has 2 valid commits, but 3 are required")
+	})
+
+	t.Run("forged header", func(t *testing.T) {
+		block := decidedBlock(t, consenters[0], consenters)
+		block.Header.PreviousHash = []byte("forged")
+		require.EqualError(t, verifyDecideProof(block, identities), "decided state of block [5]: state does not match the block header")
+	})
+
+	t.Run("foreign signer", func(t *testing.T) {
+		strangers := newBdlsConsenters(t, 1)
+		block := decidedBlock(t, strangers[0], consenters)
+		require.EqualError(t, verifyDecideProof(block, identities), "invalid decide proof of block [5]: message is not signed by a consenter")
+	})
+
+	t.Run("aggregate proof", func(t *testing.T) {
+		block := aggregateDecidedBlock(t, consenters[0], []*bdlsConsenter{consenters[0], consenters[2], consenters[3]}, []int{0, 2, 3})
+		require.NoError(t, verifyDecideProof(block, identities))
+	})
+
+	t.Run("aggregate proof indexed in the order of the config metadata", func(t *testing.T) {
+		reversed := [][]byte{identities[3], identities[2], identities[1], identities[0]}
+		block := aggregateDecidedBlock(t, consenters[0], []*bdlsConsenter{consenters[3], consenters[1], consenters[0]}, []int{0, 2, 3})
+		require.NoError(t, verifyDecideProof(block, reversed))
+		block = aggregateDecidedBlock(t, consenters[0], []*bdlsConsenter{consenters[0], consenters[2], consenters[3]}, []int{0, 2, 3})
+		require.EqualError(t, verifyDecideProof(block, reversed), "invalid commit in decide proof of block [5]: bad signature")
+	})
+
+	t.Run("aggregate proof with signers out of the consenters", func(t *testing.T) {
+		strangers := newBdlsConsenters(t, 1)
+		block := aggregateDecidedBlock(t, consenters[0], []*bdlsConsenter{consenters[0], consenters[2], strangers[0]}, []int{0, 2, 4})
+		require.EqualError(t, verifyDecideProof(block, identities), "invalid aggregate proof in decide proof of block [5]: the aggregate proof has signers out of the participants")
+	})
+
+	t.Run("consensus-type migration block", func(t *testing.T) {
+		// the block migrating the channel to etcdraft is verified with the
+		// BDLS consenters of the config preceding it
+		block := migrationBlock(t, consenters[0], consenters[:3])
+		require.True(t, protoutil.IsConfigBlock(block))
+		require.NoError(t, verifyDecideProof(block, identities))
+
+		block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES] = protoutil.MarshalOrPanic(&common.Metadata{
+			Value: protoutil.MarshalOrPanic(&common.OrdererBlockMetadata{}),
+		})
+		require.EqualError(t, verifyDecideProof(block, identities), "invalid decide proof of block [5]: message is not signed by a consenter")
+	})
+
+	t.Run("no proof", func(t *testing.T) {
+		block := decidedBlock(t, consenters[0], consenters)
+		block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES] = protoutil.MarshalOrPanic(&common.Metadata{
+			Value: protoutil.MarshalOrPanic(&common.OrdererBlockMetadata{}),
+		})
+		require.EqualError(t, verifyDecideProof(block, identities), "invalid decide proof of block [5]: message is not signed by a consenter")
+	})
+}
@@ -51,6 +51,9 @@ type MSPMessageCryptoService struct {
 // Id2IdentitiesFetcher returns identities from last known configuration for the given channel
 type Id2IdentitiesFetcher interface {
 	Id2Identities(cid string) map[uint64][]byte
+	// BdlsIdentities returns the identities of the BDLS consenters in the order
+	// of the consensus metadata, or nil if the channel is not ordered by BDLS.
+	BdlsIdentities(cid string) ([][]byte, error)
 }
 
 // NewMCS creates a new instance of MSPMessageCryptoService
@@ -189,7 +192,20 @@ func (s *MSPMessageCryptoService) verifyHeaderWithMetadata(channelID string, blo
 		return errors.Wrap(err, "fail getting signatures from block")
 	}
 
-	return policy.EvaluateSignedData(signatureSet)
+	if err := policy.EvaluateSignedData(signatureSet); err != nil {
+		return err
+	}
+
+	// Blocks ordered by BDLS must also carry a <decide> proof of the consenters
+	bdlsIdentities, err := s.id2IdentitiesFetcher.BdlsIdentities(channelID)
+	if err != nil {
+		return errors.WithMessage(err, "failed retrieving bdls consenters")
+	}
+	if len(bdlsIdentities) > 0 && block.Header.Number > 0 {
+		return verifyDecideProof(block, bdlsIdentities)
+	}
+
+	return nil
 }
 
 // VerifyHeader returns nil when the header matches the metadata signature
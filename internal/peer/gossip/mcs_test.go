@@ -318,6 +318,24 @@ func TestVerifyBlock(t *testing.T) {
 		policyManagerGetter.Managers["D"] = managerD
 		policyManagerGetter.Managers["C"].(*mocks.ChannelPolicyManager).Policy.(*mocks.Policy).Deserializer.(*mocks.IdentityDeserializer).Msg = msg
 	})
+
+	t.Run("bdls consenters unavailable", func(t *testing.T) {
+		block, msg := mockBlock(t, "C", 42, aliceSigner, nil)
+		policyManagerGetter.Managers["C"].(*mocks.ChannelPolicyManager).Policy.(*mocks.Policy).Deserializer.(*mocks.IdentityDeserializer).Msg = msg
+
+		bdlsCryptoService := NewMCS(
+			policyManagerGetter,
+			&mocks.Id2IdentitiesFetcherMock{BdlsErr: errors.New("failed unmarshaling bdls consensus metadata of channel C")},
+			aliceSigner,
+			&mocks.DeserializersManager{
+				LocalDeserializer: &mocks.IdentityDeserializer{Identity: []byte("Alice"), Msg: []byte("msg1"), Mock: mock.Mock{}},
+			},
+			cryptoProvider,
+		)
+		err := bdlsCryptoService.VerifyBlock([]byte("C"), 42, block)
+		require.EqualError(t, err, "failed retrieving bdls consenters: failed unmarshaling bdls consensus metadata of channel C")
+		require.NoError(t, msgCryptoService.VerifyBlock([]byte("C"), 42, block))
+	})
 }
 
 func mockBlock(t *testing.T, channel string, seqNum uint64, localSigner *mocks.SignerSerializer, dataHash []byte) (*common.Block, []byte) {
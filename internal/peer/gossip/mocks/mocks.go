@@ -20,6 +20,8 @@ import (
 )
 
 type Id2IdentitiesFetcherMock struct {
+	Bdls    [][]byte
+	BdlsErr error
 }
 
 func (*Id2IdentitiesFetcherMock) Id2Identities(cid string) map[uint64][]byte {
@@ -28,6 +30,10 @@ func (*Id2IdentitiesFetcherMock) Id2Identities(cid string) map[uint64][]byte {
 	}
 }
 
+func (m *Id2IdentitiesFetcherMock) BdlsIdentities(cid string) ([][]byte, error) {
+	return m.Bdls, m.BdlsErr
+}
+
 type ChannelPolicyManagerGetter struct{}
 
 func (c *ChannelPolicyManagerGetter) Manager(channelID string) policies.Manager {
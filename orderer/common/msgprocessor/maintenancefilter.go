@@ -12,6 +12,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	cb "github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/orderer"
+	protobdls "github.com/hyperledger/fabric-protos-go/orderer/bdls"
 	protoetcdraft "github.com/hyperledger/fabric-protos-go/orderer/etcdraft"
 	"github.com/hyperledger/fabric/bccsp"
 	"github.com/hyperledger/fabric/common/channelconfig"
@@ -26,6 +27,9 @@ type MaintenanceFilterSupport interface {
 	OrdererConfig() (channelconfig.Orderer, bool)
 	// ChannelID returns the ChannelID
 	ChannelID() string
+	// VerifyConsensusMetadata verifies the ConsensusMetadata of the given orderer config
+	// with the rules of its consensus type
+	VerifyConsensusMetadata(ordererConfig channelconfig.Orderer) error
 }
 
 // MaintenanceFilter checks whether the orderer config ConsensusType is in maintenance mode, and if it is,
@@ -48,6 +52,7 @@ func NewMaintenanceFilter(support MaintenanceFilterSupport, bccsp bccsp.BCCSP) *
 	mf.permittedTargetConsensusTypes["etcdraft"] = true
 	mf.permittedTargetConsensusTypes["solo"] = true
 	mf.permittedTargetConsensusTypes["kafka"] = true
+	mf.permittedTargetConsensusTypes["bdls"] = true
 	return mf
 }
 
@@ -118,7 +123,7 @@ func (mf *MaintenanceFilter) inspect(configEnvelope *cb.ConfigEnvelope, ordererC
 	}
 
 	// ConsensusType.Type can only change in maintenance-mode, and only within the set of permitted types.
-	// Note: only kafka to etcdraft or solo to etcdraft transitions are actually supported.
+	// Note: only kafka to etcdraft, solo to etcdraft, and etcdraft to bdls and back transitions are actually supported.
 	if ordererConfig.ConsensusType() != nextOrdererConfig.ConsensusType() {
 		if ordererConfig.ConsensusState() == orderer.ConsensusType_STATE_NORMAL {
 			return errors.Errorf("attempted to change consensus type from %s to %s, but current config ConsensusType.State is not in maintenance mode",
@@ -134,11 +139,43 @@ func (mf *MaintenanceFilter) inspect(configEnvelope *cb.ConfigEnvelope, ordererC
 				ordererConfig.ConsensusType(), nextOrdererConfig.ConsensusType())
 		}
 
+		if nextOrdererConfig.ConsensusType() == "bdls" && ordererConfig.ConsensusType() != "etcdraft" {
+			return errors.Errorf("attempted to change consensus type from %s to %s, transition not supported",
+				ordererConfig.ConsensusType(), nextOrdererConfig.ConsensusType())
+		}
+
 		if nextOrdererConfig.ConsensusType() == "etcdraft" {
 			updatedMetadata := &protoetcdraft.ConfigMetadata{}
 			if err := proto.Unmarshal(nextOrdererConfig.ConsensusMetadata(), updatedMetadata); err != nil {
 				return errors.Wrap(err, "failed to unmarshal etcdraft metadata configuration")
 			}
+			if ordererConfig.ConsensusType() == "bdls" {
+				currentMetadata := &protobdls.ConfigMetadata{}
+				if err := proto.Unmarshal(ordererConfig.ConsensusMetadata(), currentMetadata); err != nil {
+					return errors.Wrap(err, "failed to unmarshal bdls metadata configuration")
+				}
+				if err := ensureSameConsenters(updatedMetadata.Consenters, currentMetadata.Consenters); err != nil {
+					return err
+				}
+			}
+		}
+
+		if nextOrdererConfig.ConsensusType() == "bdls" {
+			updatedMetadata := &protobdls.ConfigMetadata{}
+			if err := proto.Unmarshal(nextOrdererConfig.ConsensusMetadata(), updatedMetadata); err != nil {
+				return errors.Wrap(err, "failed to unmarshal bdls metadata configuration")
+			}
+			currentMetadata := &protoetcdraft.ConfigMetadata{}
+			if err := proto.Unmarshal(ordererConfig.ConsensusMetadata(), currentMetadata); err != nil {
+				return errors.Wrap(err, "failed to unmarshal etcdraft metadata configuration")
+			}
+			if err := ensureSameConsenters(currentMetadata.Consenters, updatedMetadata.Consenters); err != nil {
+				return err
+			}
+		}
+
+		if err := mf.support.VerifyConsensusMetadata(nextOrdererConfig); err != nil {
+			return errors.Wrapf(err, "invalid %s metadata configuration", nextOrdererConfig.ConsensusType())
 		}
 
 		logger.Infof("[channel: %s] consensus-type migration: about to change from %s to %s",
@@ -199,3 +236,33 @@ func (mf *MaintenanceFilter) ensureConsensusTypeChangeOnly(configEnvelope *cb.Co
 
 	return nil
 }
+
+// ensureSameConsenters checks that the etcdraft and the bdls consenters of a consensus-type migration between the two
+// are the same set of orderers, as identified by their TLS certificates.
+func ensureSameConsenters(raftConsenters []*protoetcdraft.Consenter, bdlsConsenters []*protobdls.Consenter) error {
+	type tlsCerts struct {
+		client string
+		server string
+	}
+
+	if len(raftConsenters) != len(bdlsConsenters) {
+		return errors.Errorf("bdls metadata has %d consenters, but etcdraft metadata has %d",
+			len(bdlsConsenters), len(raftConsenters))
+	}
+
+	raftCerts := make(map[tlsCerts]bool, len(raftConsenters))
+	for _, consenter := range raftConsenters {
+		raftCerts[tlsCerts{client: string(consenter.ClientTlsCert), server: string(consenter.ServerTlsCert)}] = true
+	}
+
+	for _, consenter := range bdlsConsenters {
+		certs := tlsCerts{client: string(consenter.ClientTlsCert), server: string(consenter.ServerTlsCert)}
+		if !raftCerts[certs] {
+			return errors.Errorf("bdls consenter %d (%s:%d) does not match the TLS certificates of any etcdraft consenter",
+				consenter.ConsenterId, consenter.Host, consenter.Port)
+		}
+		delete(raftCerts, certs)
+	}
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/orderer/bdls"
 	"github.com/hyperledger/fabric-protos-go/orderer/etcdraft"
 	"github.com/hyperledger/fabric/bccsp/sw"
 	"github.com/hyperledger/fabric/common/capabilities"
@@ -21,6 +22,7 @@ import (
 	"github.com/hyperledger/fabric/internal/configtxlator/update"
 	"github.com/hyperledger/fabric/orderer/common/msgprocessor/mocks"
 	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -296,6 +298,122 @@ func TestMaintenanceInspectExit(t *testing.T) {
 	})
 }
 
+func TestMaintenanceInspectBdlsMigration(t *testing.T) {
+	raftMetadata := protoutil.MarshalOrPanic(&etcdraft.ConfigMetadata{
+		Consenters: []*etcdraft.Consenter{
+			{Host: "raft1", Port: 7050, ClientTlsCert: []byte("client1"), ServerTlsCert: []byte("server1")},
+			{Host: "raft2", Port: 7050, ClientTlsCert: []byte("client2"), ServerTlsCert: []byte("server2")},
+		},
+	})
+	bdlsMetadata := protoutil.MarshalOrPanic(&bdls.ConfigMetadata{
+		Consenters: []*bdls.Consenter{
+			{ConsenterId: 1, Host: "bdls1", Port: 7050, ClientTlsCert: []byte("client1"), ServerTlsCert: []byte("server1")},
+			{ConsenterId: 2, Host: "bdls2", Port: 7050, ClientTlsCert: []byte("client2"), ServerTlsCert: []byte("server2")},
+		},
+	})
+	otherBdlsMetadata := protoutil.MarshalOrPanic(&bdls.ConfigMetadata{
+		Consenters: []*bdls.Consenter{
+			{ConsenterId: 1, Host: "bdls1", Port: 7050, ClientTlsCert: []byte("client1"), ServerTlsCert: []byte("server1")},
+			{ConsenterId: 3, Host: "bdls3", Port: 7050, ClientTlsCert: []byte("client3"), ServerTlsCert: []byte("server3")},
+		},
+	})
+	cryptoProvider, err := sw.NewDefaultSecurityLevelWithKeystore(sw.NewDummyKeyStore())
+	require.NoError(t, err)
+
+	newFilterWithVerifyErr := func(ordererType string, metadata []byte, verifyErr error) *MaintenanceFilter {
+		mockOrderer := newMockOrdererConfig(true, orderer.ConsensusType_STATE_MAINTENANCE)
+		mockOrderer.ConsensusTypeReturns(ordererType)
+		mockOrderer.ConsensusMetadataReturns(metadata)
+		mf := NewMaintenanceFilter(&mockSystemChannelFilterSupport{OrdererConfigVal: mockOrderer, VerifyMetadataErr: verifyErr}, cryptoProvider)
+		require.NotNil(t, mf)
+		return mf
+	}
+	newFilter := func(ordererType string, metadata []byte) *MaintenanceFilter {
+		return newFilterWithVerifyErr(ordererType, metadata, nil)
+	}
+
+	t.Run("Good: etcdraft to bdls", func(t *testing.T) {
+		mf := newFilter("etcdraft", raftMetadata)
+		current := consensusTypeInfo{ordererType: "etcdraft", metadata: raftMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next := consensusTypeInfo{ordererType: "bdls", metadata: bdlsMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err := mf.Apply(makeConfigEnvelope(t, current, next))
+		require.NoError(t, err)
+	})
+
+	t.Run("Good: bdls to etcdraft", func(t *testing.T) {
+		mf := newFilter("bdls", bdlsMetadata)
+		current := consensusTypeInfo{ordererType: "bdls", metadata: bdlsMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next := consensusTypeInfo{ordererType: "etcdraft", metadata: raftMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err := mf.Apply(makeConfigEnvelope(t, current, next))
+		require.NoError(t, err)
+	})
+
+	t.Run("Bad: kafka to bdls", func(t *testing.T) {
+		mf := newFilter("kafka", nil)
+		current := consensusTypeInfo{ordererType: "kafka", metadata: nil, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next := consensusTypeInfo{ordererType: "bdls", metadata: bdlsMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err := mf.Apply(makeConfigEnvelope(t, current, next))
+		require.EqualError(t, err,
+			"config transaction inspection failed: attempted to change consensus type from kafka to bdls, transition not supported")
+	})
+
+	t.Run("Bad: bdls metadata", func(t *testing.T) {
+		mf := newFilter("etcdraft", raftMetadata)
+		current := consensusTypeInfo{ordererType: "etcdraft", metadata: raftMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next := consensusTypeInfo{ordererType: "bdls", metadata: []byte{1, 2, 3, 4}, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err := mf.Apply(makeConfigEnvelope(t, current, next))
+		require.Error(t, err)
+		require.Contains(t, err.Error(),
+			"config transaction inspection failed: failed to unmarshal bdls metadata configuration")
+	})
+
+	t.Run("Bad: metadata rejected by the consenter", func(t *testing.T) {
+		mf := newFilterWithVerifyErr("etcdraft", raftMetadata, errors.New("BDLS requires at least 4 consenters, got 2"))
+		current := consensusTypeInfo{ordererType: "etcdraft", metadata: raftMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next := consensusTypeInfo{ordererType: "bdls", metadata: bdlsMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err := mf.Apply(makeConfigEnvelope(t, current, next))
+		require.EqualError(t, err,
+			"config transaction inspection failed: invalid bdls metadata configuration: BDLS requires at least 4 consenters, got 2")
+
+		mf = newFilterWithVerifyErr("bdls", bdlsMetadata, errors.New("empty consenter set"))
+		current = consensusTypeInfo{ordererType: "bdls", metadata: bdlsMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next = consensusTypeInfo{ordererType: "etcdraft", metadata: raftMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err = mf.Apply(makeConfigEnvelope(t, current, next))
+		require.EqualError(t, err,
+			"config transaction inspection failed: invalid etcdraft metadata configuration: empty consenter set")
+	})
+
+	t.Run("Bad: different consenters", func(t *testing.T) {
+		mf := newFilter("etcdraft", raftMetadata)
+		current := consensusTypeInfo{ordererType: "etcdraft", metadata: raftMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next := consensusTypeInfo{ordererType: "bdls", metadata: otherBdlsMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err := mf.Apply(makeConfigEnvelope(t, current, next))
+		require.EqualError(t, err,
+			"config transaction inspection failed: bdls consenter 3 (bdls3:7050) does not match the TLS certificates of any etcdraft consenter")
+
+		mf = newFilter("bdls", otherBdlsMetadata)
+		current = consensusTypeInfo{ordererType: "bdls", metadata: otherBdlsMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next = consensusTypeInfo{ordererType: "etcdraft", metadata: raftMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err = mf.Apply(makeConfigEnvelope(t, current, next))
+		require.EqualError(t, err,
+			"config transaction inspection failed: bdls consenter 3 (bdls3:7050) does not match the TLS certificates of any etcdraft consenter")
+	})
+
+	t.Run("Bad: fewer consenters", func(t *testing.T) {
+		mf := newFilter("etcdraft", raftMetadata)
+		fewerMetadata := protoutil.MarshalOrPanic(&bdls.ConfigMetadata{
+			Consenters: []*bdls.Consenter{
+				{ConsenterId: 1, Host: "bdls1", Port: 7050, ClientTlsCert: []byte("client1"), ServerTlsCert: []byte("server1")},
+			},
+		})
+		current := consensusTypeInfo{ordererType: "etcdraft", metadata: raftMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		next := consensusTypeInfo{ordererType: "bdls", metadata: fewerMetadata, state: orderer.ConsensusType_STATE_MAINTENANCE}
+		err := mf.Apply(makeConfigEnvelope(t, current, next))
+		require.EqualError(t, err,
+			"config transaction inspection failed: bdls metadata has 1 consenters, but etcdraft metadata has 2")
+	})
+}
+
 func TestMaintenanceExtra(t *testing.T) {
 	msActive := &mockSystemChannelFilterSupport{
 		OrdererConfigVal: newMockOrdererConfig(true, orderer.ConsensusType_STATE_MAINTENANCE),
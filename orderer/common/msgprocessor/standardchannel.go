@@ -41,6 +41,10 @@ type StandardChannelSupport interface {
 	ProposeConfigUpdate(configtx *cb.Envelope) (*cb.ConfigEnvelope, error)
 
 	OrdererConfig() (channelconfig.Orderer, bool)
+
+	// VerifyConsensusMetadata verifies the ConsensusMetadata of the given orderer config
+	// with the rules of its consensus type
+	VerifyConsensusMetadata(ordererConfig channelconfig.Orderer) error
 }
 
 // StandardChannel implements the Processor interface for standard extant channels
@@ -27,6 +27,7 @@ type mockSystemChannelFilterSupport struct {
 	ProposeConfigUpdateErr error
 	SequenceVal            uint64
 	OrdererConfigVal       channelconfig.Orderer
+	VerifyMetadataErr      error
 }
 
 func (ms *mockSystemChannelFilterSupport) ProposeConfigUpdate(env *cb.Envelope) (*cb.ConfigEnvelope, error) {
@@ -53,6 +54,10 @@ func (ms *mockSystemChannelFilterSupport) OrdererConfig() (channelconfig.Orderer
 	return ms.OrdererConfigVal, true
 }
 
+func (ms *mockSystemChannelFilterSupport) VerifyConsensusMetadata(ordererConfig channelconfig.Orderer) error {
+	return ms.VerifyMetadataErr
+}
+
 func TestClassifyMsg(t *testing.T) {
 	t.Run("ConfigUpdate", func(t *testing.T) {
 		class := (&StandardChannel{}).ClassifyMsg(&cb.ChannelHeader{Type: int32(cb.HeaderType_CONFIG_UPDATE)})
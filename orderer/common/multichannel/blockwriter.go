@@ -111,6 +111,8 @@ func (bw *BlockWriter) WriteConfigBlock(block *cb.Block, encodedMetadataValue []
 		logger.Panicf("Told to write a config block with an invalid channel header: %s", err)
 	}
 
+	var switchConsensusType bool
+
 	switch chdr.Type {
 	case int32(cb.HeaderType_ORDERER_TRANSACTION):
 		newChannelConfig, err := protoutil.UnmarshalEnvelope(payload.Data)
@@ -143,9 +145,19 @@ func (bw *BlockWriter) WriteConfigBlock(block *cb.Block, encodedMetadataValue []
 		currentType := bw.support.SharedConfig().ConsensusType()
 		nextType := oc.ConsensusType()
 		if currentType != nextType {
-			encodedMetadataValue = nil
-			logger.Debugf("[channel: %s] Consensus-type migration: maintenance mode, change from %s to %s, setting metadata to nil",
-				bw.support.ChannelID(), currentType, nextType)
+			if currentType == "bdls" {
+				// The decide proof is kept, as peers and lagging BDLS consenters verify the block with it,
+				// the consenter migrated to tells the migration from the config preceding the block instead.
+				logger.Debugf("[channel: %s] Consensus-type migration: maintenance mode, change from %s to %s, keeping the decide proof",
+					bw.support.ChannelID(), currentType, nextType)
+			} else {
+				encodedMetadataValue = nil
+				logger.Debugf("[channel: %s] Consensus-type migration: maintenance mode, change from %s to %s, setting metadata to nil",
+					bw.support.ChannelID(), currentType, nextType)
+			}
+			// The chain is restarted under the new consenter right at the migration block when migrating
+			// between etcdraft and bdls, other migrations take effect when the orderer is restarted.
+			switchConsensusType = isBdlsMigration(currentType, nextType)
 		}
 
 		// Avoid Bundle update before the go-routine in WriteBlock() finished writing the previous block.
@@ -159,6 +171,16 @@ func (bw *BlockWriter) WriteConfigBlock(block *cb.Block, encodedMetadataValue []
 	}
 
 	bw.WriteBlock(block, encodedMetadataValue)
+
+	if switchConsensusType {
+		channelID := bw.support.ChannelID()
+		go func() {
+			// Wait for the migration block to be committed, the chain is restarted from the tip of the ledger.
+			bw.committingBlock.Lock()
+			bw.committingBlock.Unlock()
+			bw.registrar.switchConsensusType(channelID)
+		}()
+	}
 }
 
 // WriteBlock should be invoked for blocks which contain normal transactions.
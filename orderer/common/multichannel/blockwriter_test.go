@@ -254,51 +254,70 @@ func TestGoodWriteConfig(t *testing.T) {
 }
 
 func TestMigrationWriteConfig(t *testing.T) {
-	confSys := genesisconfig.Load(genesisconfig.SampleInsecureSoloProfile, configtest.GetDevConfigDir())
-	genesisBlockSys := encoder.New(confSys).GenesisBlock()
-
-	tmpdir, err := ioutil.TempDir("", "file-ledger")
-	require.NoError(t, err)
-	defer os.RemoveAll(tmpdir)
-
-	_, l := newLedgerAndFactory(tmpdir, "testchannelid", genesisBlockSys)
-
-	fakeConfig := &mock.OrdererConfig{}
-	fakeConfig.ConsensusTypeReturns("solo")
-	fakeConfig.ConsensusStateReturns(orderer.ConsensusType_STATE_MAINTENANCE)
-
-	cryptoProvider, err := sw.NewDefaultSecurityLevelWithKeystore(sw.NewDummyKeyStore())
-	require.NoError(t, err)
-
-	mockValidator := &mocks.ConfigTXValidator{}
-	mockValidator.ChannelIDReturns("testchannelid")
-	bw := newBlockWriter(genesisBlockSys, nil,
-		&mockBlockWriterSupport{
-			SignerSerializer:  mockCrypto(),
-			ReadWriter:        l,
-			ConfigTXValidator: mockValidator,
-			fakeConfig:        fakeConfig,
-			bccsp:             cryptoProvider,
-		}, false,
-	)
-
-	ctx := makeConfigTxMig("testchannelid", 1)
-	block := protoutil.NewBlock(1, protoutil.BlockHeaderHash(genesisBlockSys.Header))
-	block.Data.Data = [][]byte{protoutil.MarshalOrPanic(ctx)}
-	consenterMetadata := []byte("foo")
-
-	bw.WriteConfigBlock(block, consenterMetadata)
-
-	// Wait for the commit to complete
-	bw.committingBlock.Lock()
-	bw.committingBlock.Unlock()
-
-	cBlock := blockledger.GetBlock(l, block.Header.Number)
-	require.Equal(t, block.Header, cBlock.Header)
-	require.Equal(t, block.Data, cBlock.Data)
-
-	omd := protoutil.GetMetadataFromBlockOrPanic(block, cb.BlockMetadataIndex_ORDERER)
-	require.Equal(t, []byte(nil), omd.Value)
+	for _, testCase := range []struct {
+		name             string
+		currentType      string
+		expectedMetadata []byte
+	}{
+		{
+			name:        "metadata is dropped",
+			currentType: "solo",
+		},
+		{
+			name:             "decide proof of bdls is kept",
+			currentType:      "bdls",
+			expectedMetadata: []byte("foo"),
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			confSys := genesisconfig.Load(genesisconfig.SampleInsecureSoloProfile, configtest.GetDevConfigDir())
+			genesisBlockSys := encoder.New(confSys).GenesisBlock()
+
+			tmpdir, err := ioutil.TempDir("", "file-ledger")
+			require.NoError(t, err)
+			defer os.RemoveAll(tmpdir)
+
+			_, l := newLedgerAndFactory(tmpdir, "testchannelid", genesisBlockSys)
+
+			fakeConfig := &mock.OrdererConfig{}
+			fakeConfig.ConsensusTypeReturns(testCase.currentType)
+			fakeConfig.ConsensusStateReturns(orderer.ConsensusType_STATE_MAINTENANCE)
+
+			cryptoProvider, err := sw.NewDefaultSecurityLevelWithKeystore(sw.NewDummyKeyStore())
+			require.NoError(t, err)
+
+			mockValidator := &mocks.ConfigTXValidator{}
+			mockValidator.ChannelIDReturns("testchannelid")
+			bw := newBlockWriter(genesisBlockSys, nil,
+				&mockBlockWriterSupport{
+					SignerSerializer:  mockCrypto(),
+					ReadWriter:        l,
+					ConfigTXValidator: mockValidator,
+					fakeConfig:        fakeConfig,
+					bccsp:             cryptoProvider,
+				}, false,
+			)
+
+			ctx := makeConfigTxMig("testchannelid", 1)
+			block := protoutil.NewBlock(1, protoutil.BlockHeaderHash(genesisBlockSys.Header))
+			block.Data.Data = [][]byte{protoutil.MarshalOrPanic(ctx)}
+			consenterMetadata := []byte("foo")
+
+			bw.WriteConfigBlock(block, consenterMetadata)
+
+			// Wait for the commit to complete
+			bw.committingBlock.Lock()
+			bw.committingBlock.Unlock()
+
+			cBlock := blockledger.GetBlock(l, block.Header.Number)
+			require.Equal(t, block.Header, cBlock.Header)
+			require.Equal(t, block.Data, cBlock.Data)
+
+			omd, err := protoutil.GetConsenterMetadataFromBlock(block)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedMetadata, omd.Value)
+		})
+	}
 }
 
 func TestRaceWriteConfig(t *testing.T) {
@@ -35,6 +35,10 @@ type ChainSupport struct {
 	identity.SignerSerializer
 	BCCSP bccsp.BCCSP
 
+	// The consenters of the orderer by consensus type, used to verify the
+	// ConsensusMetadata of a consensus type the channel migrates to.
+	consenters map[string]consensus.Consenter
+
 	// NOTE: It makes sense to add this to the ChainSupport since the design of Registrar does not assume
 	// that there is a single consensus type at this orderer node and therefore the resolution of
 	// the consensus type too happens only at the ChainSupport level.
@@ -72,7 +76,8 @@ func newChainSupport(
 			ledgerResources,
 			blockcutterMetrics,
 		),
-		BCCSP: bccsp,
+		BCCSP:      bccsp,
+		consenters: consenters,
 	}
 
 	// Set up the msgprocessor
@@ -172,12 +177,41 @@ func (cs *ChainSupport) ProposeConfigUpdate(configtx *cb.Envelope) (*cb.ConfigEn
 		return nil, errors.New("new config is missing orderer group")
 	}
 
+	// The chain can only validate the metadata of its own consensus type, so the metadata of a
+	// migration between etcdraft and bdls is validated by the consenter of the type migrated to.
+	if isBdlsMigration(oldOrdererConfig.ConsensusType(), newOrdererConfig.ConsensusType()) {
+		if err = cs.VerifyConsensusMetadata(newOrdererConfig); err != nil {
+			return nil, errors.WithMessage(err, "consensus metadata update for channel config update is invalid")
+		}
+		return env, nil
+	}
+
 	if err = cs.ValidateConsensusMetadata(oldOrdererConfig, newOrdererConfig, false); err != nil {
 		return nil, errors.WithMessage(err, "consensus metadata update for channel config update is invalid")
 	}
 	return env, nil
 }
 
+// VerifyConsensusMetadata verifies the ConsensusMetadata of the given orderer config with the consenter
+// of its consensus type, if the consenter implements consensus.MetadataVerifier.
+func (cs *ChainSupport) VerifyConsensusMetadata(ordererConfig channelconfig.Orderer) error {
+	consenter, ok := cs.consenters[ordererConfig.ConsensusType()]
+	if !ok {
+		return errors.Errorf("consenter of type %s is not available", ordererConfig.ConsensusType())
+	}
+
+	verifier, ok := consenter.(consensus.MetadataVerifier)
+	if !ok {
+		return nil
+	}
+	return verifier.VerifyConsensusMetadata(ordererConfig)
+}
+
+// isBdlsMigration reports whether a change of consensus type is a migration between etcdraft and bdls.
+func isBdlsMigration(currentType, nextType string) bool {
+	return (currentType == "etcdraft" && nextType == "bdls") || (currentType == "bdls" && nextType == "etcdraft")
+}
+
 // ConfigProto passes through to the underlying configtx.Validator
 func (cs *ChainSupport) ConfigProto() *cb.Config {
 	return cs.ConfigtxValidator().ConfigProto()
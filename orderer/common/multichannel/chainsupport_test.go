@@ -9,11 +9,15 @@ package multichannel
 import (
 	"testing"
 
+	"github.com/hyperledger/fabric/common/channelconfig"
 	"github.com/hyperledger/fabric/orderer/common/localconfig"
 	"github.com/hyperledger/fabric/orderer/common/msgprocessor"
 	"github.com/hyperledger/fabric/orderer/common/types"
+	"github.com/hyperledger/fabric/orderer/consensus"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/orderer"
 	"github.com/hyperledger/fabric/bccsp/sw"
 	msgprocessormocks "github.com/hyperledger/fabric/orderer/common/msgprocessor/mocks"
 	"github.com/hyperledger/fabric/orderer/common/multichannel/mocks"
@@ -66,6 +70,71 @@ func TestConsensusMetadataValidation(t *testing.T) {
 	mv.ValidateConsensusMetadataReturns(errors.New("bananas"))
 	_, err = cs.ProposeConfigUpdate(&common.Envelope{})
 	require.EqualError(t, err, "consensus metadata update for channel config update is invalid: bananas")
+
+	// case 3: migration between etcdraft and bdls, the metadata is validated by the consenter migrated to
+	mockOrderer.ConsensusTypeReturns("etcdraft")
+	mockValidator.ProposeConfigUpdateReturns(testConfigEnvelopeOfType(t, "bdls"), nil)
+	bdlsConsenter := &verifyingConsenter{Consenter: &mocks.Consenter{}}
+	cs.consenters = map[string]consensus.Consenter{"bdls": bdlsConsenter}
+	_, err = cs.ProposeConfigUpdate(&common.Envelope{})
+	require.NoError(t, err)
+	require.Equal(t, 2, mv.ValidateConsensusMetadataCallCount())
+
+	bdlsConsenter.verifyErr = errors.New("apples")
+	_, err = cs.ProposeConfigUpdate(&common.Envelope{})
+	require.EqualError(t, err, "consensus metadata update for channel config update is invalid: apples")
+	require.Equal(t, 2, mv.ValidateConsensusMetadataCallCount())
+
+	delete(cs.consenters, "bdls")
+	_, err = cs.ProposeConfigUpdate(&common.Envelope{})
+	require.EqualError(t, err, "consensus metadata update for channel config update is invalid: consenter of type bdls is not available")
+
+	// case 4: any other consensus-type migration, the metadata is validated by the chain
+	mockOrderer.ConsensusTypeReturns("kafka")
+	mockValidator.ProposeConfigUpdateReturns(testConfigEnvelopeOfType(t, "etcdraft"), nil)
+	_, err = cs.ProposeConfigUpdate(&common.Envelope{})
+	require.EqualError(t, err, "consensus metadata update for channel config update is invalid: bananas")
+	require.Equal(t, 3, mv.ValidateConsensusMetadataCallCount())
+}
+
+// testConfigEnvelopeOfType returns the config envelope of testConfigEnvelope, of the given consensus type.
+func testConfigEnvelopeOfType(t *testing.T, consensusType string) *common.ConfigEnvelope {
+	env := testConfigEnvelope(t)
+	value, err := proto.Marshal(&orderer.ConsensusType{
+		Type:     consensusType,
+		Metadata: []byte("new consensus metadata"),
+	})
+	require.NoError(t, err)
+	env.Config.ChannelGroup.Groups["Orderer"].Values["ConsensusType"].Value = value
+	return env
+}
+
+type verifyingConsenter struct {
+	*mocks.Consenter
+	verifyErr error
+}
+
+func (vc *verifyingConsenter) VerifyConsensusMetadata(ordererConfig channelconfig.Orderer) error {
+	return vc.verifyErr
+}
+
+func TestVerifyConsensusMetadata(t *testing.T) {
+	cs := &ChainSupport{
+		consenters: map[string]consensus.Consenter{
+			"solo": &mocks.Consenter{},
+			"bdls": &verifyingConsenter{Consenter: &mocks.Consenter{}, verifyErr: errors.New("bananas")},
+		},
+	}
+
+	mockOrderer := &mocks.OrdererConfig{}
+	mockOrderer.ConsensusTypeReturns("kafka")
+	require.EqualError(t, cs.VerifyConsensusMetadata(mockOrderer), "consenter of type kafka is not available")
+
+	mockOrderer.ConsensusTypeReturns("solo")
+	require.NoError(t, cs.VerifyConsensusMetadata(mockOrderer))
+
+	mockOrderer.ConsensusTypeReturns("bdls")
+	require.EqualError(t, cs.VerifyConsensusMetadata(mockOrderer), "bananas")
 }
 
 func TestNewOnboardingChainSupport(t *testing.T) {
@@ -634,6 +634,19 @@ func (r *Registrar) SwitchChainToFollower(channelName string) {
 	logger.Infof("Created and started a follower.Chain for channel %s", channelName)
 }
 
+// switchConsensusType halts the consensus.Chain of a channel and creates a consensus.Chain of the consensus type
+// the channel migrated to, from the tip of the ledger. It is called after the config block that migrates the channel
+// to another consensus type is committed, and must not be called by the goroutine of the consensus.Chain it halts.
+func (r *Registrar) switchConsensusType(channelID string) {
+	if r.GetChain(channelID) == nil {
+		logger.Infof("Channel %s consenter was removed", channelID)
+		return
+	}
+
+	logger.Infof("Consensus-type migration of channel %s, restarting its chain under the new consenter", channelID)
+	r.CreateChain(channelID)
+}
+
 // ChannelsCount returns the count of the current total number of channels.
 func (r *Registrar) ChannelsCount() int {
 	r.lock.RLock()
@@ -1031,9 +1044,12 @@ func (r *Registrar) removeSystemChannel() error {
 		return errors.Errorf("cannot remove %s system channel: %s", consensusType, systemChannelID)
 	}
 
-	// halt the inactive chain registry
+	// halt the inactive chain registry, which the bdls consenter shares with the etcdraft one
 	consenter := r.consenters["etcdraft"].(consensus.ClusterConsenter)
 	consenter.RemoveInactiveChainRegistry()
+	if bdlsConsenter, ok := r.consenters["bdls"].(consensus.ClusterConsenter); ok {
+		bdlsConsenter.RemoveInactiveChainRegistry()
+	}
 
 	// halt the system channel and remove it from the chains map
 	r.systemChannel.Halt()
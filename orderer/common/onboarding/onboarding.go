@@ -23,6 +23,7 @@ import (
 	"github.com/hyperledger/fabric/internal/pkg/identity"
 	"github.com/hyperledger/fabric/orderer/common/cluster"
 	"github.com/hyperledger/fabric/orderer/common/localconfig"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
 	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
 	"github.com/hyperledger/fabric/orderer/consensus/smartbft"
 	"github.com/hyperledger/fabric/protoutil"
@@ -121,11 +122,17 @@ func (ri *ReplicationInitiator) createReplicator(bootstrapBlock *common.Block, f
 		ri.logger.Panicf("Failed extracting system channel name from bootstrap block: %v", err)
 	}
 
-	if ConsensusType(bootstrapBlock, ri.cryptoProvider) == "smartbft" {
+	switch ConsensusType(bootstrapBlock, ri.cryptoProvider) {
+	case "smartbft":
 		amIPartOfChannel = smartbft.ConsenterCertificate{
 			ConsenterCertificate: ri.secOpts.Certificate,
 			CryptoProvider:       ri.cryptoProvider,
 		}.IsConsenterOfChannel
+	case "bdls":
+		amIPartOfChannel = bdlsbft.ConsenterCertificate{
+			ConsenterCertificate: ri.secOpts.Certificate,
+			CryptoProvider:       ri.cryptoProvider,
+		}.IsConsenterOfChannel
 	}
 
 	pullerConfig := cluster.PullerConfigFromTopLevelConfig(systemChannelName, ri.conf, ri.secOpts.Key, ri.secOpts.Certificate, ri.signer)
@@ -229,6 +236,7 @@ type InactiveChainReplicator struct {
 	replicator                        ChainReplicator
 	scheduleChan                      <-chan time.Time
 	quitChan                          chan struct{}
+	quitOnce                          sync.Once
 	doneChan                          chan struct{}
 	lock                              sync.RWMutex
 	chains2CreationCallbacks          map[string]chainCreation
@@ -333,9 +341,9 @@ func (i *InactiveChainReplicator) replicateDisabledChains() {
 }
 
 // Stop stops the inactive chain replicator. This is used when removing the
-// system channel.
+// system channel. It may be called by each consenter sharing the replicator.
 func (i *InactiveChainReplicator) Stop() {
-	close(i.quitChan)
+	i.quitOnce.Do(func() { close(i.quitChan) })
 	<-i.doneChan
 }
 
@@ -898,6 +898,8 @@ func TestInactiveChainReplicator(t *testing.T) {
 			}()
 			icr.Run()
 			replicatorStopped.Wait()
+			// consenters sharing the replicator stop it as well
+			icr.Stop()
 			close(trackedChains)
 
 			var replicatedChains []string
@@ -1158,7 +1160,7 @@ func TestValidateBootstrapBlock(t *testing.T) {
 				},
 			},
 			expectedError: "failed extracting envelope from block: " +
-				"proto: common.Envelope: illegal tag 0 (wire type 1)",
+				"proto: cannot parse invalid wire-format data",
 		},
 		{
 			description:   "application channel block",
@@ -47,10 +47,10 @@ import (
 	"github.com/hyperledger/fabric/orderer/common/multichannel"
 	"github.com/hyperledger/fabric/orderer/common/onboarding"
 	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
 	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
 	"github.com/hyperledger/fabric/orderer/consensus/kafka"
 	"github.com/hyperledger/fabric/orderer/consensus/smartbft"
-	"github.com/hyperledger/fabric/orderer/consensus/solo"
 	"github.com/hyperledger/fabric/protoutil"
 	"github.com/mitchellh/mapstructure"
 	"go.uber.org/zap/zapcore"
@@ -70,6 +70,7 @@ var (
 	clusterTypes = map[string]struct{}{
 		"etcdraft": {},
 		"smartbft": {},
+		"bdls":     {},
 	}
 )
 
@@ -787,19 +788,18 @@ func initializeMultichannelRegistrar(
 	callbacks = append(callbacks, dpmr.Update)
 	registrar := multichannel.NewRegistrar(*conf, lf, signer, metricsProvider, bccsp, clusterDialer, callbacks...)
 	consenters := map[string]consensus.Consenter{}
-	var icr etcdraft.InactiveChainRegistry
 
 	if conf.General.BootstrapMethod == "file" || conf.General.BootstrapMethod == "none" {
 		if bootstrapBlock != nil && isClusterType(bootstrapBlock, bccsp) {
 			// with a system channel
 			consenterType := onboarding.ConsensusType(bootstrapBlock, bccsp)
 			switch consenterType {
-			case "etcdraft":
-				etcdConsenter := initializeEtcdraftConsenter(consenters, conf, lf, clusterDialer, bootstrapBlock, repInitiator, srvConf, srv, registrar, metricsProvider, bccsp)
-				icr = etcdConsenter.InactiveChainRegistry
+			case "etcdraft", "bdls":
+				// channels migrate between etcdraft and bdls, hence both are available
+				raftConsenter := initializeEtcdraftConsenter(consenters, conf, lf, clusterDialer, bootstrapBlock, repInitiator, srvConf, srv, registrar, metricsProvider, bccsp)
+				initializeBdlsConsenter(signer, consenters, raftConsenter, conf, clusterDialer, srvConf, registrar, metricsProvider, bccsp)
 			case "smartbft":
-				smartBFTConsenter := initializeSmartBFTConsenter(signer, dpmr, consenters, conf, lf, clusterDialer, bootstrapBlock, repInitiator, srvConf, srv, registrar, metricsProvider, bccsp)
-				icr = smartBFTConsenter.InactiveChainRegistry
+				initializeSmartBFTConsenter(signer, dpmr, consenters, conf, lf, clusterDialer, bootstrapBlock, repInitiator, srvConf, srv, registrar, metricsProvider, bccsp)
 			default:
 				logger.Panicf("Unknown cluster type consenter")
 			}
@@ -824,6 +824,10 @@ func initializeMultichannelRegistrar(
 			switch consenterType {
 			//case "etcdraft": consenters["etcdraft"] = etcdraft.New(clusterDialer, conf, srvConf, srv, registrar, nil, metricsProvider, bccsp)
 			//case "smartbft": consenters["smartbft"] = smartbft.New(nil, dpmr.Registry(), signer, clusterDialer, conf, srvConf, srv, registrar, metricsProvider, bccsp)
+			case "etcdraft", "bdls":
+				raftConsenter := etcdraft.New(clusterDialer, conf, srvConf, srv, registrar, nil, metricsProvider, bccsp)
+				consenters["etcdraft"] = raftConsenter
+				initializeBdlsConsenter(signer, consenters, raftConsenter, conf, clusterDialer, srvConf, registrar, metricsProvider, bccsp)
 			default:
 				logger.Panicf("Unknown cluster type consenter '%s'", consenterType)
 			}
@@ -921,6 +925,65 @@ func initializeSmartBFTConsenter(
 	return smartBFTConsenter
 }
 
+// initializeBdlsConsenter creates the bdls consenter alongside the etcdraft one, as channels migrate between the two.
+// It shares the cluster communication and the InactiveChainRegistry of the etcdraft consenter, and the cluster messages
+// of a channel are dispatched to the consenter of its chain.
+func initializeBdlsConsenter(
+	signer identity.SignerSerializer,
+	consenters map[string]consensus.Consenter,
+	raftConsenter *etcdraft.Consenter,
+	conf *localconfig.TopLevel,
+	clusterDialer *cluster.PredicateDialer,
+	srvConf comm.ServerConfig,
+	registrar *multichannel.Registrar,
+	metricsProvider metrics.Provider,
+	bccsp bccsp.BCCSP,
+) *bdlsbft.Consenter {
+	clusterComm := raftConsenter.Communication.(*cluster.Comm)
+
+	bdlsConsenter := bdlsbft.NewWithComm(raftConsenter.InactiveChainRegistry, signer, clusterDialer, conf, srvConf, clusterComm, registrar, metricsProvider, bccsp)
+	clusterComm.H = &clusterHandlerRouter{
+		chains: registrar,
+		raft:   clusterComm.H,
+		bdls: &bdlsbft.Ingress{
+			Logger:        bdlsConsenter.Logger,
+			ChainSelector: bdlsConsenter,
+		},
+	}
+	consenters["bdls"] = bdlsConsenter
+
+	return bdlsConsenter
+}
+
+// clusterHandlerRouter dispatches the cluster messages of a channel to the cluster.Handler
+// of the consenter of its chain, bdls or etcdraft, which share the cluster communication.
+type clusterHandlerRouter struct {
+	chains interface {
+		GetChain(chainID string) *multichannel.ChainSupport
+	}
+	raft cluster.Handler
+	bdls cluster.Handler
+}
+
+func (r *clusterHandlerRouter) handler(channel string) cluster.Handler {
+	if cs := r.chains.GetChain(channel); cs != nil {
+		if _, isBdls := cs.Chain.(*bdlsbft.Chain); isBdls {
+			return r.bdls
+		}
+	}
+	return r.raft
+}
+
+// OnConsensus dispatches the consensus request to the handler of the consenter of the channel.
+func (r *clusterHandlerRouter) OnConsensus(channel string, sender uint64, req *ab.ConsensusRequest) error {
+	return r.handler(channel).OnConsensus(channel, sender, req)
+}
+
+// OnSubmit dispatches the submit request to the handler of the consenter of the channel.
+func (r *clusterHandlerRouter) OnSubmit(channel string, sender uint64, req *ab.SubmitRequest) error {
+	return r.handler(channel).OnSubmit(channel, sender, req)
+}
+
 func newOperationsSystem(ops localconfig.Operations, metrics localconfig.Metrics) *operations.System {
 	return operations.NewSystem(operations.Options{
 		Options: fabhttp.Options{
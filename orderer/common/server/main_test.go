@@ -18,6 +18,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/common"
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
 	"github.com/hyperledger/fabric/bccsp"
 	"github.com/hyperledger/fabric/bccsp/factory"
 	"github.com/hyperledger/fabric/bccsp/sw"
@@ -42,6 +43,8 @@ import (
 	"github.com/hyperledger/fabric/orderer/common/onboarding"
 	server_mocks "github.com/hyperledger/fabric/orderer/common/server/mocks"
 	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
 	"github.com/hyperledger/fabric/protoutil"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
@@ -624,13 +627,28 @@ func TestLoadLocalMSP(t *testing.T) {
 func TestInitializeMultichannelRegistrar(t *testing.T) {
 	cleanup := configtest.SetDevFabricConfigPath(t)
 	defer cleanup()
-	genesisFile := produceGenesisFile(t, genesisconfig.SampleDevModeSoloProfile, "testchannelid")
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	crt, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+
+	genesisFile := produceBdlsGenesisFile(t, ca, crt, "testchannelid")
 	defer os.Remove(genesisFile)
 
-	cryptoProvider, err := sw.NewDefaultSecurityLevelWithKeystore(sw.NewDummyKeyStore())
+	// the BDLS consenter signs with the local MSP key, hence the keystore backed provider
+	mspConf, ledgerDir := genesisConfig(t, genesisFile)
+	os.RemoveAll(ledgerDir)
+	signer, err := loadLocalMSP(mspConf).GetDefaultSigningIdentity()
 	require.NoError(t, err)
+	cryptoProvider := factory.GetDefault()
 
-	signer := &server_mocks.SignerSerializer{}
+	srvConf := comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			Certificate: crt.Cert,
+			Key:         crt.Key,
+			UseTLS:      true,
+		},
+	}
 
 	t.Run("registrar with a system channel", func(t *testing.T) {
 		conf, ledgerDir := genesisConfig(t, genesisFile)
@@ -639,12 +657,14 @@ func TestInitializeMultichannelRegistrar(t *testing.T) {
 		require.NoError(t, err)
 		bootBlock := file.New(genesisFile).GenesisBlock()
 		initializeBootstrapChannel(bootBlock, lf)
+		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+		require.NoError(t, err)
 		registrar := initializeMultichannelRegistrar(
 			bootBlock,
 			onboarding.NewReplicationInitiator(lf, bootBlock, conf, comm.SecureOptions{}, signer, cryptoProvider),
 			&cluster.PredicateDialer{},
-			comm.ServerConfig{},
-			nil,
+			srvConf,
+			srv,
 			conf,
 			signer,
 			&disabled.Provider{},
@@ -654,33 +674,99 @@ func TestInitializeMultichannelRegistrar(t *testing.T) {
 		)
 		require.NotNil(t, registrar)
 		require.Equal(t, "testchannelid", registrar.SystemChannelID())
-	})
 
-	t.Run("registrar without a system channel", func(t *testing.T) {
-		conf, ledgerDir := genesisConfig(t, genesisFile)
-		defer os.RemoveAll(ledgerDir)
-		conf.General.BootstrapMethod = "none"
-		conf.General.GenesisFile = ""
-		srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
-		require.NoError(t, err)
-		lf, err := createLedgerFactory(conf, &disabled.Provider{})
-		require.NoError(t, err)
-		registrar := initializeMultichannelRegistrar(
-			nil,
-			nil,
-			&cluster.PredicateDialer{},
-			comm.ServerConfig{},
-			srv,
-			conf,
-			signer,
-			&disabled.Provider{},
-			&server_mocks.HealthChecker{},
-			lf,
-			cryptoProvider,
-		)
-		require.NotNil(t, registrar)
-		require.Empty(t, registrar.SystemChannelID())
+		// the metadata of a migration of the channel to etcdraft is verified by the etcdraft consenter
+		cs := registrar.GetChain("testchannelid")
+		require.NotNil(t, cs)
+		err = cs.VerifyConsensusMetadata(&migratedOrdererConfig{Orderer: cs.SharedConfig(), consensusType: "etcdraft"})
+		require.EqualError(t, err, "nil Raft config metadata options")
 	})
+
+	for _, consensusType := range []string{"bdls", "etcdraft"} {
+		t.Run("registrar without a system channel of type "+consensusType, func(t *testing.T) {
+			conf, ledgerDir := genesisConfig(t, genesisFile)
+			defer os.RemoveAll(ledgerDir)
+			conf.General.BootstrapMethod = "none"
+			conf.General.GenesisFile = ""
+			conf.Consensus = map[string]interface{}{"Type": consensusType}
+			srv, err := comm.NewGRPCServer("127.0.0.1:0", comm.ServerConfig{})
+			require.NoError(t, err)
+			lf, err := createLedgerFactory(conf, &disabled.Provider{})
+			require.NoError(t, err)
+			registrar := initializeMultichannelRegistrar(
+				nil,
+				nil,
+				&cluster.PredicateDialer{},
+				srvConf,
+				srv,
+				conf,
+				signer,
+				&disabled.Provider{},
+				&server_mocks.HealthChecker{},
+				lf,
+				cryptoProvider,
+			)
+			require.NotNil(t, registrar)
+			require.Empty(t, registrar.SystemChannelID())
+		})
+	}
+}
+
+// migratedOrdererConfig is the orderer config of a channel migrating to another consensus type,
+// whose metadata is left empty.
+type migratedOrdererConfig struct {
+	channelconfig.Orderer
+	consensusType string
+}
+
+func (oc *migratedOrdererConfig) ConsensusType() string {
+	return oc.consensusType
+}
+
+func (oc *migratedOrdererConfig) ConsensusMetadata() []byte {
+	return nil
+}
+
+func TestClusterHandlerRouter(t *testing.T) {
+	bdlsChannel := &multichannel.ChainSupport{Chain: &bdlsbft.Chain{}}
+	raftChannel := &multichannel.ChainSupport{Chain: &etcdraft.Chain{}}
+	chains := &chainGetter{chains: map[string]*multichannel.ChainSupport{"bdls": bdlsChannel, "raft": raftChannel}}
+
+	raft := &recordingClusterHandler{}
+	bdls := &recordingClusterHandler{}
+	router := &clusterHandlerRouter{chains: chains, raft: raft, bdls: bdls}
+
+	require.NoError(t, router.OnConsensus("bdls", 1, &ab.ConsensusRequest{}))
+	require.NoError(t, router.OnSubmit("bdls", 1, &ab.SubmitRequest{}))
+	require.NoError(t, router.OnConsensus("raft", 1, &ab.ConsensusRequest{}))
+	require.NoError(t, router.OnSubmit("raft", 1, &ab.SubmitRequest{}))
+	// the etcdraft consenter reports the channels it does not know
+	require.NoError(t, router.OnSubmit("unknown", 1, &ab.SubmitRequest{}))
+
+	require.Equal(t, []string{"bdls", "bdls"}, bdls.channels)
+	require.Equal(t, []string{"raft", "raft", "unknown"}, raft.channels)
+}
+
+type chainGetter struct {
+	chains map[string]*multichannel.ChainSupport
+}
+
+func (cg *chainGetter) GetChain(chainID string) *multichannel.ChainSupport {
+	return cg.chains[chainID]
+}
+
+type recordingClusterHandler struct {
+	channels []string
+}
+
+func (h *recordingClusterHandler) OnConsensus(channel string, sender uint64, req *ab.ConsensusRequest) error {
+	h.channels = append(h.channels, channel)
+	return nil
+}
+
+func (h *recordingClusterHandler) OnSubmit(channel string, sender uint64, req *ab.SubmitRequest) error {
+	h.channels = append(h.channels, channel)
+	return nil
 }
 
 func TestInitializeGrpcServer(t *testing.T) {
@@ -731,7 +817,19 @@ func TestUpdateTrustedRoots(t *testing.T) {
 	cleanup := configtest.SetDevFabricConfigPath(t)
 	defer cleanup()
 
-	genesisFile := produceGenesisFile(t, genesisconfig.SampleDevModeSoloProfile, "testchannelid")
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	crt, err := ca.NewServerCertKeyPair("127.0.0.1")
+	require.NoError(t, err)
+	srvConf := comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			Certificate: crt.Cert,
+			Key:         crt.Key,
+			UseTLS:      true,
+		},
+	}
+
+	genesisFile := produceBdlsGenesisFile(t, ca, crt, "testchannelid")
 	defer os.Remove(genesisFile)
 
 	cryptoPath := generateCryptoMaterials(t, cryptogen)
@@ -776,20 +874,19 @@ func TestUpdateTrustedRoots(t *testing.T) {
 	require.NoError(t, err)
 	bootBlock := file.New(genesisFile).GenesisBlock()
 	initializeBootstrapChannel(bootBlock, lf)
-	signer := &server_mocks.SignerSerializer{}
-
-	cryptoProvider, err := sw.NewDefaultSecurityLevelWithKeystore(sw.NewDummyKeyStore())
-	require.NoError(t, err)
 
 	genConfig, ledgerDir := genesisConfig(t, genesisFile)
 	defer os.RemoveAll(ledgerDir)
+	signer, err := loadLocalMSP(genConfig).GetDefaultSigningIdentity()
+	require.NoError(t, err)
+	cryptoProvider := factory.GetDefault()
 
 	initializeMultichannelRegistrar(
 		bootBlock,
 		onboarding.NewReplicationInitiator(lf, bootBlock, conf, comm.SecureOptions{}, signer, cryptoProvider),
 		&cluster.PredicateDialer{},
-		comm.ServerConfig{},
-		nil,
+		srvConf,
+		grpcServer,
 		genConfig,
 		signer,
 		&disabled.Provider{},
@@ -842,8 +939,8 @@ func TestUpdateTrustedRoots(t *testing.T) {
 		bootBlock,
 		onboarding.NewReplicationInitiator(lf, bootBlock, conf, comm.SecureOptions{}, signer, cryptoProvider),
 		predDialer,
-		comm.ServerConfig{},
-		nil,
+		srvConf,
+		grpcServer,
 		genConfig2,
 		signer,
 		&disabled.Provider{},
@@ -1222,6 +1319,37 @@ func genesisConfig(t *testing.T, genesisFile string) (*localconfig.TopLevel, str
 	}, ledgerDir
 }
 
+// produceBdlsGenesisFile writes a SampleDevModeBdls genesis block whose
+// consenters carry real TLS certificates, the first one being crt.
+func produceBdlsGenesisFile(t *testing.T, ca tlsgen.CA, crt *tlsgen.CertKeyPair, channelID string) string {
+	certDir, err := ioutil.TempDir("", "bdls-consenters")
+	require.NoError(t, err)
+	defer os.RemoveAll(certDir)
+
+	conf := genesisconfig.Load(genesisconfig.SampleDevModeBdlsProfile, configtest.GetDevConfigDir())
+	for i, consenter := range conf.Orderer.Bdls.Consenters {
+		kp := crt
+		if i > 0 {
+			kp, err = ca.NewServerCertKeyPair("127.0.0.1")
+			require.NoError(t, err)
+		}
+		certPath := filepath.Join(certDir, fmt.Sprintf("consenter%d.pem", i+1))
+		require.NoError(t, ioutil.WriteFile(certPath, kp.Cert, 0o644))
+		consenter.ClientTlsCert = []byte(certPath)
+		consenter.ServerTlsCert = []byte(certPath)
+		consenter.MspId = "SampleOrg"
+		consenter.Identity = []byte(filepath.Join(configtest.GetDevMspDir(), "signcerts", "peer.pem"))
+	}
+
+	f, err := ioutil.TempFile("", fmt.Sprintf("%s-genesis_block-", t.Name()))
+	require.NoError(t, err)
+	_, err = f.Write(protoutil.MarshalOrPanic(encoder.New(conf).GenesisBlockForChannel(channelID)))
+	require.NoError(t, err)
+	err = f.Close()
+	require.NoError(t, err)
+	return f.Name()
+}
+
 func panicMsg(f func()) string {
 	var message interface{}
 	func() {
@@ -0,0 +1,262 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"bytes"
+	"log"
+	"time"
+
+	"github.com/Sperax/bdls"
+)
+
+const (
+	// backoff between failed connection attempts to a peer
+	reconnectMinBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff = 30 * time.Second
+
+	// interval to check whether a connected peer is still connected
+	reconnectCheckInterval = time.Second
+
+	// timeout for dialing a peer
+	dialTimeout = 10 * time.Second
+)
+
+// PeerState is the connection state of a peer in the desired peer set
+type PeerState struct {
+	Identity  bdls.Identity // the participant identity
+	Address   string        // the address to dial
+	Connected bool          // there is an authenticated connection to the participant
+	Attempts  int           // consecutive failed connection attempts
+	LastError error         // the error of the last failed attempt
+}
+
+// dialer keeps a connection to a participant at an address
+type dialer struct {
+	identity  bdls.Identity
+	address   string
+	attempts  int
+	lastError error
+	die       chan struct{}
+}
+
+// SetPeerAddresses sets the desired peer set, as the addresses of participants
+// keyed by their identity derived by bdls.DefaultPubKeyToIdentity. The agent
+// connects to every participant at it's address, and reconnects with backoff
+// whenever there is no authenticated connection to it, while connections
+// accepted from the participant count as well. Participants not in addresses
+// will not be reconnected any more.
+func (agent *TCPAgent) SetPeerAddresses(addresses map[bdls.Identity]string) {
+	agent.Lock()
+	defer agent.Unlock()
+
+	self := bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)
+	for identity, d := range agent.dialers {
+		if address, ok := addresses[identity]; !ok || address != d.address {
+			close(d.die)
+			delete(agent.dialers, identity)
+		}
+	}
+
+	for identity, address := range addresses {
+		if identity == self {
+			continue
+		}
+		if _, ok := agent.dialers[identity]; !ok {
+			d := &dialer{identity: identity, address: address, die: make(chan struct{})}
+			agent.dialers[identity] = d
+			go agent.dial(d)
+		}
+	}
+}
+
+// PeerStates returns the connection states of the desired peer set
+func (agent *TCPAgent) PeerStates() []PeerState {
+	agent.Lock()
+	defer agent.Unlock()
+
+	states := make([]PeerState, 0, len(agent.dialers))
+	for _, d := range agent.dialers {
+		states = append(states, PeerState{
+			Identity:  d.identity,
+			Address:   d.address,
+			Connected: agent.isConnected(d.identity),
+			Attempts:  d.attempts,
+			LastError: d.lastError,
+		})
+	}
+	return states
+}
+
+// isConnected returns true if there is an established connection to the
+// participant, the agent must be locked.
+func (agent *TCPAgent) isConnected(identity bdls.Identity) bool {
+	for _, p := range agent.peers {
+		if peerIdentity, ok := p.establishedIdentity(); ok && peerIdentity == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// dial keeps reconnecting to the participant until the dialer or agent is closed
+func (agent *TCPAgent) dial(d *dialer) {
+	backoff := reconnectMinBackoff
+	wait := func(duration time.Duration) bool {
+		select {
+		case <-time.After(duration):
+			return true
+		case <-d.die:
+		case <-agent.die:
+		}
+		return false
+	}
+
+	// failed records an unsuccessful attempt, and waits with backoff
+	failed := func(err error) bool {
+		agent.Lock()
+		d.attempts++
+		d.lastError = err
+		agent.Unlock()
+
+		if !wait(backoff) {
+			return false
+		}
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+		return true
+	}
+
+	// succeeded resets the failed attempts once connected
+	succeeded := func() {
+		agent.Lock()
+		d.attempts = 0
+		d.lastError = nil
+		agent.Unlock()
+		backoff = reconnectMinBackoff
+	}
+
+	for {
+		agent.Lock()
+		connected := agent.isConnected(d.identity)
+		agent.Unlock()
+
+		// the participant may have connected to us
+		if connected {
+			succeeded()
+			if !wait(reconnectCheckInterval) {
+				return
+			}
+			continue
+		}
+
+		agent.Lock()
+		dial := agent.dialFunc
+		agent.Unlock()
+		conn, err := dial("tcp", d.address, dialTimeout)
+		if err != nil {
+			if !failed(err) {
+				return
+			}
+			continue
+		}
+
+		log.Println("connected to peer:", conn.RemoteAddr())
+		p := newTCPPeer(conn, agent, &d.identity)
+		if !agent.AddPeer(p) {
+			p.Close()
+			return
+		}
+		// prove my identity to this peer
+		p.InitiatePublicKeyAuthentication()
+
+		select {
+		case <-p.established:
+			succeeded()
+
+			// the connection may be lost or deduplicated later
+			select {
+			case <-p.die:
+			case <-d.die:
+				p.Close()
+				return
+			case <-agent.die:
+				return
+			}
+		case <-p.die:
+			if !failed(ErrPeerConnectionLost) {
+				return
+			}
+		case <-d.die:
+			p.Close()
+			return
+		case <-agent.die:
+			return
+		}
+	}
+}
+
+// deduplicate closes one of the established connections to the same participant,
+// which happens when both connect to each other simultaneously. Both sides keep
+// the connection dialed by the participant with the smaller identity, or the
+// earlier connection if both were dialed by the same side.
+func (agent *TCPAgent) deduplicate(p *TCPPeer) {
+	agent.Lock()
+	defer agent.Unlock()
+
+	identity, ok := p.establishedIdentity()
+	if !ok {
+		return
+	}
+	self := bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)
+	dialedBySelf := bytes.Compare(self[:], identity[:]) < 0
+
+	for _, q := range agent.peers {
+		if q == p {
+			continue
+		}
+		if qIdentity, ok := q.establishedIdentity(); !ok || qIdentity != identity {
+			continue
+		}
+
+		switch {
+		case p.outbound() == q.outbound():
+			p.Close()
+		case p.outbound() == dialedBySelf:
+			q.Close()
+		default:
+			p.Close()
+		}
+		return
+	}
+}
@@ -0,0 +1,199 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/stretchr/testify/assert"
+)
+
+// listenAgent accepts connections for the agent at address
+func listenAgent(t *testing.T, agent *TCPAgent, address string) net.Listener {
+	l, err := net.Listen("tcp", address)
+	assert.Nil(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			p := NewTCPPeer(conn, agent)
+			agent.AddPeer(p)
+			p.InitiatePublicKeyAuthentication()
+		}
+	}()
+	return l
+}
+
+func identityOf(agent *TCPAgent) bdls.Identity {
+	return bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)
+}
+
+// connections counts the established connections of agent to the participant
+func connections(agent *TCPAgent, identity bdls.Identity) int {
+	agent.Lock()
+	defer agent.Unlock()
+	var count int
+	for _, p := range agent.peers {
+		if peerIdentity, ok := p.establishedIdentity(); ok && peerIdentity == identity {
+			count++
+		}
+	}
+	return count
+}
+
+// connected returns true if all peers of the agent are connected
+func connected(agent *TCPAgent) bool {
+	for _, state := range agent.PeerStates() {
+		if !state.Connected {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAgentReconnect(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a1 := newTestAgentWithKey(t, key, DefaultLimits())
+	l1 := listenAgent(t, a1, "127.0.0.1:0")
+	address := l1.Addr().String()
+
+	a2 := newTestAgent(t, DefaultLimits())
+	defer a2.Close()
+	a2.SetPeerAddresses(map[bdls.Identity]string{identityOf(a1): address, identityOf(a2): "127.0.0.1:1"})
+
+	// connected, own identity is ignored
+	assert.Eventually(t, func() bool { return connected(a2) }, 5*time.Second, 50*time.Millisecond)
+	states := a2.PeerStates()
+	assert.Len(t, states, 1)
+	assert.Equal(t, identityOf(a1), states[0].Identity)
+	assert.Equal(t, address, states[0].Address)
+
+	// restart
+	l1.Close()
+	a1.Close()
+	assert.Eventually(t, func() bool { return !connected(a2) }, 5*time.Second, 50*time.Millisecond)
+
+	a1 = newTestAgentWithKey(t, key, DefaultLimits())
+	defer a1.Close()
+	l1 = listenAgent(t, a1, address)
+	defer l1.Close()
+	assert.Eventually(t, func() bool { return connected(a2) }, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 0, a2.PeerStates()[0].Attempts)
+
+	// removed from the desired peer set
+	a2.SetPeerAddresses(nil)
+	assert.Empty(t, a2.PeerStates())
+}
+
+func TestAgentDeduplicate(t *testing.T) {
+	a1 := newTestAgent(t, DefaultLimits())
+	defer a1.Close()
+	l1 := listenAgent(t, a1, "127.0.0.1:0")
+	defer l1.Close()
+
+	a2 := newTestAgent(t, DefaultLimits())
+	defer a2.Close()
+	l2 := listenAgent(t, a2, "127.0.0.1:0")
+	defer l2.Close()
+
+	// both dial each other
+	addresses := map[bdls.Identity]string{
+		identityOf(a1): l1.Addr().String(),
+		identityOf(a2): l2.Addr().String(),
+	}
+	a1.SetPeerAddresses(addresses)
+	a2.SetPeerAddresses(addresses)
+
+	assert.Eventually(t, func() bool { return connected(a1) && connected(a2) }, 5*time.Second, 50*time.Millisecond)
+	<-time.After(2 * reconnectCheckInterval)
+	assert.Equal(t, 1, connections(a1, identityOf(a2)))
+	assert.Equal(t, 1, connections(a2, identityOf(a1)))
+}
+
+func TestAgentDialIdentityMismatch(t *testing.T) {
+	a1 := newTestAgent(t, DefaultLimits())
+	defer a1.Close()
+	l1 := listenAgent(t, a1, "127.0.0.1:0")
+	defer l1.Close()
+
+	// another participant is expected at the address
+	a2 := newTestAgent(t, DefaultLimits())
+	defer a2.Close()
+	a3 := newTestAgent(t, DefaultLimits())
+	defer a3.Close()
+	a2.SetPeerAddresses(map[bdls.Identity]string{identityOf(a3): l1.Addr().String()})
+
+	assert.Eventually(t, func() bool { return a2.PeerStates()[0].Attempts > 0 }, 5*time.Second, 50*time.Millisecond)
+	state := a2.PeerStates()[0]
+	assert.False(t, state.Connected)
+	assert.Equal(t, ErrPeerConnectionLost, state.LastError)
+	assert.Equal(t, 0, connections(a2, identityOf(a1)))
+}
+
+func TestAgentDialer(t *testing.T) {
+	a1 := newTestAgent(t, DefaultLimits())
+	defer a1.Close()
+	l1 := listenAgent(t, a1, "127.0.0.1:0")
+	defer l1.Close()
+
+	a2 := newTestAgent(t, DefaultLimits())
+	defer a2.Close()
+	dialed := make(chan string, 1)
+	a2.SetDialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
+		select {
+		case dialed <- address:
+		default:
+		}
+		return net.DialTimeout(network, address, timeout)
+	})
+	a2.SetPeerAddresses(map[bdls.Identity]string{identityOf(a1): l1.Addr().String()})
+	assert.Equal(t, l1.Addr().String(), <-dialed)
+	assert.Eventually(t, func() bool { return connected(a2) }, 5*time.Second, 50*time.Millisecond)
+
+	// consensus messages are counted on both sides
+	a2.Lock()
+	for _, p := range a2.peers {
+		p.Send([]byte("message"))
+	}
+	a2.Unlock()
+	assert.Eventually(t, func() bool { return a1.GetMessageCount() == 1 }, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, int64(len("message")), a1.GetBytesCount())
+	assert.Equal(t, int64(1), a2.GetSentMessageCount())
+	assert.Equal(t, int64(len("message")), a2.GetSentBytesCount())
+}
@@ -1,3 +1,10 @@
 // Package agent-tcp implements a TCP based agent to participate in consensus
 // Challenge-Response scheme has been adopted to do interactive authentication
+//
+// Both ends of a connection authenticate their public keys, then derive session
+// keys from the ECDH secrets of the authentication, all frames thereafter are
+// sealed with AES-256-GCM, keys are rotated periodically and replays rejected.
+//
+// A TCPAgent keeps connections to a desired peer set, reconnecting with backoff,
+// and keeps one connection per participant if both connect simultaneously.
 package agent
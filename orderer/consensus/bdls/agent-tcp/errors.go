@@ -40,4 +40,12 @@ var (
 	ErrPeerKeyAuthChallengeResponse = errors.New("incorrect state for peer KeyAuthChallengeResponse message")
 	ErrPeerAuthenticatedFailed      = errors.New("public key authentication failed for peer")
 	ErrMessageLengthExceed          = errors.New("message size exceeded maximum")
+	ErrFrameNotSealed               = errors.New("frame is not sealed")
+	ErrFrameAuthentication          = errors.New("frame authentication failed")
+	ErrFrameReplayed                = errors.New("frame has been replayed or reordered")
+	ErrFrameEpoch                   = errors.New("frame has an incorrect key epoch")
+	ErrSessionNotEstablished        = errors.New("session keys have not been established")
+	ErrPeerBanned                   = errors.New("the public key of the peer has been banned")
+	ErrPeerIdentityMismatch         = errors.New("the public key of the peer is not of the participant dialed")
+	ErrPeerConnectionLost           = errors.New("the connection was lost before the session has been established")
 )
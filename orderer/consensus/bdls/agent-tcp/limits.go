@@ -0,0 +1,214 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"time"
+
+	"github.com/Sperax/bdls"
+	proto "github.com/gogo/protobuf/proto"
+)
+
+// Limits bounds the resources a peer can consume on a TCPAgent, zero fields
+// default to the values of DefaultLimits.
+type Limits struct {
+	// MaxFrameLength is the maximum length of a frame accepted from a peer,
+	// at most MaxMessageLength.
+	MaxFrameLength int
+
+	// MessageRate is the number of consensus messages per second accepted
+	// from a peer, with bursts up to MessageBurst messages.
+	MessageRate  float64
+	MessageBurst int
+
+	// ByteRate is the number of bytes per second of consensus messages
+	// accepted from a peer, with bursts up to ByteBurst bytes, the burst
+	// is at least MaxFrameLength. Messages exceeding the rates are dropped.
+	ByteRate  float64
+	ByteBurst int
+
+	// MaxQueuedMessages bounds the consensus messages awaiting to be processed,
+	// once reached, the oldest <nop> or <resync> message is dropped for a new
+	// message, or the new message is dropped if there is none.
+	MaxQueuedMessages int
+
+	// MaxVerificationFailures is the number of messages from a peer failing
+	// verification before the peer is disconnected, and it's public key is
+	// refused for BanDuration.
+	MaxVerificationFailures int
+	BanDuration             time.Duration
+}
+
+// DefaultLimits returns the limits a TCPAgent created by NewTCPAgent uses
+func DefaultLimits() Limits {
+	return Limits{
+		MaxFrameLength:          4 * 1024 * 1024,
+		MessageRate:             200,
+		MessageBurst:            400,
+		ByteRate:                4 * 1024 * 1024,
+		ByteBurst:               8 * 1024 * 1024,
+		MaxQueuedMessages:       4096,
+		MaxVerificationFailures: 10,
+		BanDuration:             10 * time.Minute,
+	}
+}
+
+// withDefaults fills zero fields with defaults, and keeps the limits consistent
+func (l Limits) withDefaults() Limits {
+	defaults := DefaultLimits()
+	if l.MaxFrameLength <= 0 {
+		l.MaxFrameLength = defaults.MaxFrameLength
+	}
+	if l.MaxFrameLength > MaxMessageLength {
+		l.MaxFrameLength = MaxMessageLength
+	}
+	if l.MessageRate <= 0 {
+		l.MessageRate = defaults.MessageRate
+	}
+	if l.MessageBurst <= 0 {
+		l.MessageBurst = defaults.MessageBurst
+	}
+	if l.ByteRate <= 0 {
+		l.ByteRate = defaults.ByteRate
+	}
+	if l.ByteBurst <= 0 {
+		l.ByteBurst = defaults.ByteBurst
+	}
+	// a frame of maximum length must be able to pass
+	if l.ByteBurst < l.MaxFrameLength {
+		l.ByteBurst = l.MaxFrameLength
+	}
+	if l.MaxQueuedMessages <= 0 {
+		l.MaxQueuedMessages = defaults.MaxQueuedMessages
+	}
+	if l.MaxVerificationFailures <= 0 {
+		l.MaxVerificationFailures = defaults.MaxVerificationFailures
+	}
+	if l.BanDuration <= 0 {
+		l.BanDuration = defaults.BanDuration
+	}
+	return l
+}
+
+// tokenBucket refills at rate tokens per second up to burst tokens
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full tokenBucket
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// refill adds the tokens accumulated since last time
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// peerLimiter limits the consensus messages from a peer, both in count and bytes
+type peerLimiter struct {
+	messages *tokenBucket
+	bytes    *tokenBucket
+}
+
+// newPeerLimiter creates a peerLimiter with full buckets
+func newPeerLimiter(limits Limits, now time.Time) *peerLimiter {
+	return &peerLimiter{
+		messages: newTokenBucket(limits.MessageRate, limits.MessageBurst, now),
+		bytes:    newTokenBucket(limits.ByteRate, limits.ByteBurst, now),
+	}
+}
+
+// allow takes tokens for a message of size bytes, the tokens are
+// only taken if both buckets have enough.
+func (l *peerLimiter) allow(size int, now time.Time) bool {
+	l.messages.refill(now)
+	l.bytes.refill(now)
+	if l.messages.tokens < 1 || l.bytes.tokens < float64(size) {
+		return false
+	}
+	l.messages.tokens--
+	l.bytes.tokens -= float64(size)
+	return true
+}
+
+// queuedMessage is a consensus message awaiting to be processed
+type queuedMessage struct {
+	peer    *TCPPeer
+	bts     []byte
+	msgType bdls.MessageType
+}
+
+// droppable returns true for messages which can be dropped when the queue is full,
+// a <nop> carries nothing, and a <resync> will be resent by it's sender.
+func (m *queuedMessage) droppable() bool {
+	return m.msgType == bdls.MessageType_Nop || m.msgType == bdls.MessageType_Resync
+}
+
+// decodeMessageType decodes the type of a signed consensus message
+func decodeMessageType(bts []byte) (bdls.MessageType, error) {
+	var signed bdls.SignedProto
+	err := proto.Unmarshal(bts, &signed)
+	if err != nil {
+		return 0, err
+	}
+
+	var m bdls.Message
+	err = proto.Unmarshal(signed.Message, &m)
+	if err != nil {
+		return 0, err
+	}
+	return m.Type, nil
+}
+
+// isVerificationFailure returns true if the consensus core rejected
+// a message for it's format, signer or signature, rather than it's
+// height, round or state.
+func isVerificationFailure(err error) bool {
+	switch err {
+	case bdls.ErrMessageVersion,
+		bdls.ErrMessageIsEmpty,
+		bdls.ErrMessageUnknownMessageType,
+		bdls.ErrMessageSignature,
+		bdls.ErrMessageUnknownParticipant:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsWithDefaults(t *testing.T) {
+	assert.Equal(t, DefaultLimits(), Limits{}.withDefaults())
+
+	limits := Limits{MaxFrameLength: 2 * MaxMessageLength, ByteBurst: 1}.withDefaults()
+	assert.Equal(t, MaxMessageLength, limits.MaxFrameLength)
+	assert.Equal(t, MaxMessageLength, limits.ByteBurst)
+}
+
+func TestPeerLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newPeerLimiter(Limits{MessageRate: 1, MessageBurst: 2, ByteRate: 50, ByteBurst: 100}, now)
+
+	// bursts
+	assert.True(t, limiter.allow(10, now))
+	assert.True(t, limiter.allow(10, now))
+	assert.False(t, limiter.allow(10, now))
+
+	// refills by message rate
+	now = now.Add(time.Second)
+	assert.True(t, limiter.allow(10, now))
+	assert.False(t, limiter.allow(10, now))
+
+	// bytes exceeded, no message token is taken
+	now = now.Add(time.Second)
+	assert.False(t, limiter.allow(101, now))
+	assert.True(t, limiter.allow(80, now))
+
+	// refills by byte rate
+	now = now.Add(time.Second)
+	assert.False(t, limiter.allow(100, now))
+	now = now.Add(time.Second)
+	assert.True(t, limiter.allow(100, now))
+}
+
+func signedMessage(t *testing.T, key *ecdsa.PrivateKey, msgType bdls.MessageType) []byte {
+	var signed bdls.SignedProto
+	signed.Sign(&bdls.Message{Type: msgType}, key)
+	bts, err := proto.Marshal(&signed)
+	assert.Nil(t, err)
+	return bts
+}
+
+func TestAgentQueueDrop(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	// an agent without consumer of the queue
+	agent := new(TCPAgent)
+	agent.limits = Limits{MaxQueuedMessages: 3}.withDefaults()
+	agent.chConsensusMessages = make(chan struct{}, 1)
+	p := &TCPPeer{agent: agent}
+
+	types := func() (ret []bdls.MessageType) {
+		for _, m := range agent.consensusMessages {
+			ret = append(ret, m.msgType)
+		}
+		return
+	}
+
+	agent.handleConsensusMessage(p, signedMessage(t, key, bdls.MessageType_RoundChange))
+	agent.handleConsensusMessage(p, signedMessage(t, key, bdls.MessageType_Resync))
+	agent.handleConsensusMessage(p, signedMessage(t, key, bdls.MessageType_Nop))
+
+	// the oldest droppable message is dropped
+	agent.handleConsensusMessage(p, signedMessage(t, key, bdls.MessageType_Lock))
+	assert.Equal(t, []bdls.MessageType{bdls.MessageType_RoundChange, bdls.MessageType_Nop, bdls.MessageType_Lock}, types())
+	agent.handleConsensusMessage(p, signedMessage(t, key, bdls.MessageType_Select))
+	assert.Equal(t, []bdls.MessageType{bdls.MessageType_RoundChange, bdls.MessageType_Lock, bdls.MessageType_Select}, types())
+
+	// nothing droppable, the new message is dropped
+	agent.handleConsensusMessage(p, signedMessage(t, key, bdls.MessageType_Commit))
+	assert.Equal(t, []bdls.MessageType{bdls.MessageType_RoundChange, bdls.MessageType_Lock, bdls.MessageType_Select}, types())
+
+	// undecodable messages fail verification
+	agent.handleConsensusMessage(p, []byte("garbage"))
+	assert.Equal(t, 1, p.failures)
+	assert.Len(t, agent.consensusMessages, 3)
+}
+
+func TestAgentBanPeer(t *testing.T) {
+	a1 := newTestAgent(t, Limits{MaxVerificationFailures: 3})
+	defer a1.Close()
+	a2 := newTestAgent(t, DefaultLimits())
+	defer a2.Close()
+
+	connect := func() (*TCPPeer, *TCPPeer) {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, a1)
+		p2 := NewTCPPeer(c2, a2)
+		a1.AddPeer(p1)
+		a2.AddPeer(p2)
+		p1.InitiatePublicKeyAuthentication()
+		p2.InitiatePublicKeyAuthentication()
+		return p1, p2
+	}
+
+	p1, p2 := connect()
+	<-time.After(200 * time.Millisecond)
+	assert.NotNil(t, p1.GetPublicKey())
+
+	// messages from unknown participants
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		p2.Send(signedMessage(t, key, bdls.MessageType_RoundChange))
+	}
+
+	select {
+	case <-p1.die:
+	case <-time.After(time.Second):
+		t.Fatal("banned peer has not been disconnected")
+	}
+	assert.True(t, a1.isBanned(&a2.privateKey.PublicKey))
+
+	// the banned key cannot authenticate again
+	p1, _ = connect()
+	select {
+	case <-p1.die:
+	case <-time.After(time.Second):
+		t.Fatal("banned peer has not been disconnected")
+	}
+	assert.Nil(t, p1.GetPublicKey())
+
+	// the ban expires
+	a1.banMu.Lock()
+	a1.banned[bdls.DefaultPubKeyToIdentity(&a2.privateKey.PublicKey)] = time.Now()
+	a1.banMu.Unlock()
+	assert.False(t, a1.isBanned(&a2.privateKey.PublicKey))
+}
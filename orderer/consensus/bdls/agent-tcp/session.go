@@ -0,0 +1,192 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"time"
+
+	"github.com/Sperax/bdls/crypto/blake2b"
+)
+
+const (
+	// Sealed frame format, MessageLength has it's highest bit(frameSealed) set:
+	// |MessageLength(4bytes)| Epoch(4bytes) | Sequence(8bytes) | AES-256-GCM(Message) |
+	//
+	// Epoch and Sequence make the nonce of AES-GCM, and both are authenticated
+	// as additional data.
+	frameSealed = 1 << 31
+
+	// sealedHeaderSize is the size of Epoch and Sequence
+	sealedHeaderSize = 12
+
+	// sealedOverhead is the extra bytes a sealed frame takes
+	sealedOverhead = sealedHeaderSize + 16
+
+	// the keys rotate after rekeyFrames frames, or rekeyInterval has elapsed
+	rekeyFrames   = 1 << 20
+	rekeyInterval = 10 * time.Minute
+
+	// prefixes for deriving keys
+	sessionKeyPrefix = "BDLS_AGENT_SESSION_KEY"
+	rekeyPrefix      = "BDLS_AGENT_REKEY"
+)
+
+// sessionKey derives the key of frames sent by the owner of secret, the secret
+// it authenticated it's public key with, mixed with the other secret.
+func sessionKey(secret []byte, other []byte) []byte {
+	hash, err := blake2b.New256(secret)
+	if err != nil {
+		panic(err)
+	}
+	hash.Write([]byte(sessionKeyPrefix))
+	hash.Write(other)
+	return hash.Sum(nil)
+}
+
+// sessionCipher seals or opens frames in one direction of a connection, the
+// key ratchets forward at each epoch, and the sequence never goes back.
+type sessionCipher struct {
+	key     []byte
+	aead    cipher.AEAD
+	epoch   uint32    // epoch of current key
+	seq     uint64    // sequence of next frame
+	frames  uint64    // frames sealed with current key
+	rotated time.Time // time when current key was installed
+
+	// rotation thresholds for sealing
+	rekeyFrames   uint64
+	rekeyInterval time.Duration
+}
+
+// newSessionCipher creates a sessionCipher at epoch 0 with the key
+func newSessionCipher(key []byte, now time.Time) *sessionCipher {
+	s := new(sessionCipher)
+	s.key = key
+	s.aead = newAEAD(key)
+	s.rotated = now
+	s.rekeyFrames = rekeyFrames
+	s.rekeyInterval = rekeyInterval
+	return s
+}
+
+// newAEAD creates AES-256-GCM with a 32 bytes key
+func newAEAD(key []byte) cipher.AEAD {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// nextKey derives the key of next epoch
+func (s *sessionCipher) nextKey() []byte {
+	hash, err := blake2b.New256(s.key)
+	if err != nil {
+		panic(err)
+	}
+	hash.Write([]byte(rekeyPrefix))
+	return hash.Sum(nil)
+}
+
+// rotate moves to next epoch with the key
+func (s *sessionCipher) rotate(key []byte, aead cipher.AEAD, now time.Time) {
+	// erase the old key
+	for k := range s.key {
+		s.key[k] = 0
+	}
+	s.key = key
+	s.aead = aead
+	s.epoch++
+	s.frames = 0
+	s.rotated = now
+}
+
+// seal encrypts the message into a frame body, the key rotates before
+// sealing when it has been used for too many frames or too long.
+func (s *sessionCipher) seal(message []byte, now time.Time) []byte {
+	if s.frames >= s.rekeyFrames || now.Sub(s.rotated) >= s.rekeyInterval {
+		key := s.nextKey()
+		s.rotate(key, newAEAD(key), now)
+	}
+
+	frame := make([]byte, sealedHeaderSize, sealedHeaderSize+len(message)+s.aead.Overhead())
+	binary.LittleEndian.PutUint32(frame, s.epoch)
+	binary.LittleEndian.PutUint64(frame[4:], s.seq)
+	frame = s.aead.Seal(frame, frame[:sealedHeaderSize], message, frame[:sealedHeaderSize])
+	s.seq++
+	s.frames++
+	return frame
+}
+
+// open decrypts a frame body sealed by the peer, frames must arrive exactly in
+// the order they were sealed, any replayed, reordered or forged frame fails.
+func (s *sessionCipher) open(frame []byte, now time.Time) ([]byte, error) {
+	if len(frame) < sealedOverhead {
+		return nil, ErrFrameAuthentication
+	}
+
+	header := frame[:sealedHeaderSize]
+	epoch := binary.LittleEndian.Uint32(header)
+	seq := binary.LittleEndian.Uint64(header[4:])
+	if seq != s.seq {
+		return nil, ErrFrameReplayed
+	}
+
+	var key []byte
+	aead := s.aead
+	switch epoch {
+	case s.epoch:
+	case s.epoch + 1: // the peer has rotated it's key
+		key = s.nextKey()
+		aead = newAEAD(key)
+	default:
+		return nil, ErrFrameEpoch
+	}
+
+	message, err := aead.Open(nil, header, frame[sealedHeaderSize:], header)
+	if err != nil {
+		return nil, ErrFrameAuthentication
+	}
+
+	if key != nil {
+		s.rotate(key, aead, now)
+	}
+	s.seq++
+	s.frames++
+	return message, nil
+}
@@ -0,0 +1,242 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionCipher(t *testing.T) {
+	now := time.Now()
+	key := sessionKey([]byte("secret"), []byte("other"))
+	assert.NotEqual(t, key, sessionKey([]byte("other"), []byte("secret")))
+
+	sender := newSessionCipher(key, now)
+	receiver := newSessionCipher(append([]byte(nil), key...), now)
+
+	// in order
+	for i := 0; i < 3; i++ {
+		message := []byte{byte(i)}
+		frame := sender.seal(message, now)
+		assert.Equal(t, len(message)+sealedOverhead, len(frame))
+		opened, err := receiver.open(frame, now)
+		assert.Nil(t, err)
+		assert.Equal(t, message, opened)
+	}
+
+	// replay
+	frame := sender.seal([]byte("replay"), now)
+	_, err := receiver.open(frame, now)
+	assert.Nil(t, err)
+	_, err = receiver.open(frame, now)
+	assert.Equal(t, ErrFrameReplayed, err)
+
+	// reorder
+	first := sender.seal([]byte("first"), now)
+	second := sender.seal([]byte("second"), now)
+	_, err = receiver.open(second, now)
+	assert.Equal(t, ErrFrameReplayed, err)
+	_, err = receiver.open(first, now)
+	assert.Nil(t, err)
+	_, err = receiver.open(second, now)
+	assert.Nil(t, err)
+
+	// forged
+	frame = sender.seal([]byte("forged"), now)
+	frame[len(frame)-1] ^= 1
+	_, err = receiver.open(frame, now)
+	assert.Equal(t, ErrFrameAuthentication, err)
+	_, err = receiver.open(frame[:sealedOverhead-1], now)
+	assert.Equal(t, ErrFrameAuthentication, err)
+}
+
+func TestSessionCipherRotation(t *testing.T) {
+	now := time.Now()
+	key := sessionKey([]byte("secret"), []byte("other"))
+	sender := newSessionCipher(key, now)
+	sender.rekeyFrames = 2
+	receiver := newSessionCipher(append([]byte(nil), key...), now)
+
+	// rotates by frames
+	for i := 0; i < 5; i++ {
+		frame := sender.seal([]byte("message"), now)
+		assert.Equal(t, uint32(i/2), binary.LittleEndian.Uint32(frame))
+		_, err := receiver.open(frame, now)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, uint32(2), receiver.epoch)
+	assert.Equal(t, sender.key, receiver.key)
+
+	// rotates by time
+	now = now.Add(rekeyInterval)
+	frame := sender.seal([]byte("message"), now)
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(frame))
+	_, err := receiver.open(frame, now)
+	assert.Nil(t, err)
+
+	// the epoch can only move forward by one
+	frame = sender.seal([]byte("message"), now)
+	binary.LittleEndian.PutUint32(frame, 5)
+	_, err = receiver.open(frame, now)
+	assert.Equal(t, ErrFrameEpoch, err)
+}
+
+func newTestAgent(t *testing.T, limits Limits) *TCPAgent {
+	privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	return newTestAgentWithKey(t, privateKey, limits)
+}
+
+func newTestAgentWithKey(t *testing.T, privateKey *ecdsa.PrivateKey, limits Limits) *TCPAgent {
+	keys := []*ecdsa.PrivateKey{privateKey}
+	coords := []bdls.Identity{bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey)}
+	for i := 1; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = keys[0]
+	config.Participants = coords
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	return NewTCPAgentWithLimits(consensus, keys[0], limits)
+}
+
+// sniffConn records all bytes written to the connection
+type sniffConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *sniffConn) Write(b []byte) (int, error) {
+	c.written.Write(b)
+	return c.Conn.Write(b)
+}
+
+func TestTCPPeerSealed(t *testing.T) {
+	a1 := newTestAgent(t, DefaultLimits())
+	defer a1.Close()
+	a2 := newTestAgent(t, DefaultLimits())
+	defer a2.Close()
+
+	c1, c2 := net.Pipe()
+	sniff := &sniffConn{Conn: c1}
+	p1 := NewTCPPeer(sniff, a1)
+	p2 := NewTCPPeer(c2, a2)
+	a1.AddPeer(p1)
+	a2.AddPeer(p2)
+
+	// consensus messages are held until the session has been established
+	secret := []byte("consensus message in cleartext")
+	p1.Send(secret)
+	p1.InitiatePublicKeyAuthentication()
+	p2.InitiatePublicKeyAuthentication()
+	<-time.After(200 * time.Millisecond)
+
+	for _, p := range []*TCPPeer{p1, p2} {
+		p.Lock()
+		assert.NotNil(t, p.sender)
+		assert.NotNil(t, p.receiver)
+		assert.Nil(t, p.localSecret)
+		assert.Nil(t, p.peerSecret)
+		p.Unlock()
+	}
+
+	// keys of each direction pairs up
+	p1.Lock()
+	p2.Lock()
+	assert.Equal(t, p1.sender.key, p2.receiver.key)
+	assert.Equal(t, p2.sender.key, p1.receiver.key)
+	assert.NotEqual(t, p1.sender.key, p1.receiver.key)
+	p2.Unlock()
+	p1.Unlock()
+
+	// the held message has been sent sealed
+	p1.Lock()
+	assert.Equal(t, uint64(1), p1.sender.seq)
+	p1.Unlock()
+	assert.False(t, bytes.Contains(sniff.written.Bytes(), secret))
+}
+
+func TestTCPPeerRejectCleartext(t *testing.T) {
+	a := newTestAgent(t, DefaultLimits())
+	defer a.Close()
+
+	c1, c2 := net.Pipe()
+	p := NewTCPPeer(c1, a)
+	a.AddPeer(p)
+
+	// a consensus message in cleartext closes the connection
+	out, err := proto.Marshal(&Gossip{Command: CommandType_CONSENSUS, Message: []byte("message")})
+	assert.Nil(t, err)
+	frame := make([]byte, MessageLength+len(out))
+	binary.LittleEndian.PutUint32(frame, uint32(len(out)))
+	copy(frame[MessageLength:], out)
+	_, err = c2.Write(frame)
+	assert.Nil(t, err)
+
+	select {
+	case <-p.die:
+	case <-time.After(time.Second):
+		t.Fatal("connection has not been closed")
+	}
+
+	// a sealed frame before the session has been established
+	c1, c2 = net.Pipe()
+	p = NewTCPPeer(c1, a)
+	a.AddPeer(p)
+	frame = make([]byte, MessageLength+sealedOverhead)
+	binary.LittleEndian.PutUint32(frame, sealedOverhead|frameSealed)
+	_, err = c2.Write(frame)
+	assert.Nil(t, err)
+
+	select {
+	case <-p.die:
+	case <-time.After(time.Second):
+		t.Fatal("connection has not been closed")
+	}
+}
@@ -41,6 +41,7 @@ import (
 	"math/big"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -53,6 +54,9 @@ import (
 const (
 	// Frame format:
 	// |MessageLength(4bytes)| Message(MessageLength) ... |
+	//
+	// Frames are in cleartext only for authentication, once both
+	// public keys have been authenticated, all frames are sealed.
 	MessageLength = 4
 
 	// Message max length(32MB)
@@ -93,11 +97,22 @@ const (
 
 // A TCPAgent binds consensus core to a TCPAgent object, which may have multiple TCPPeer
 type TCPAgent struct {
+	counters // consensus messages counters of all peers
+
 	consensus           *bdls.Consensus   // the consensus core
 	privateKey          *ecdsa.PrivateKey // a private key to sign messages
 	peers               []*TCPPeer        // connected peers
-	consensusMessages   [][]byte          // all consensus message awaiting to be processed
+	consensusMessages   []queuedMessage   // all consensus message awaiting to be processed
 	chConsensusMessages chan struct{}     // notification of new consensus message
+	limits              Limits            // resources limits for peers
+
+	// dialers of the desired peer set, and the function to dial with
+	dialers  map[bdls.Identity]*dialer
+	dialFunc func(network, address string, timeout time.Duration) (net.Conn, error)
+
+	// public keys refused until expiry, for failing verification repeatedly
+	banned map[bdls.Identity]time.Time
+	banMu  sync.Mutex
 
 	die        chan struct{} // tcp agent closing
 	dieOnce    sync.Once
@@ -106,9 +121,19 @@ type TCPAgent struct {
 
 // NewTCPAgent initiate a TCPAgent which talks consensus protocol with peers
 func NewTCPAgent(consensus *bdls.Consensus, privateKey *ecdsa.PrivateKey) *TCPAgent {
+	return NewTCPAgentWithLimits(consensus, privateKey, DefaultLimits())
+}
+
+// NewTCPAgentWithLimits initiate a TCPAgent which limits the resources
+// each peer can consume with limits.
+func NewTCPAgentWithLimits(consensus *bdls.Consensus, privateKey *ecdsa.PrivateKey, limits Limits) *TCPAgent {
 	agent := new(TCPAgent)
 	agent.consensus = consensus
 	agent.privateKey = privateKey
+	agent.limits = limits.withDefaults()
+	agent.banned = make(map[bdls.Identity]time.Time)
+	agent.dialers = make(map[bdls.Identity]*dialer)
+	agent.dialFunc = net.DialTimeout
 	agent.die = make(chan struct{})
 	agent.chConsensusMessages = make(chan struct{}, 1)
 	go agent.inputConsensusMessage()
@@ -187,14 +212,133 @@ func (agent *TCPAgent) GetLatestState() (height uint64, round uint64, data bdls.
 	return agent.consensus.CurrentState()
 }
 
+// GetCurrentStage returns the stage of current round
+func (agent *TCPAgent) GetCurrentStage() string {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.consensus.CurrentStage()
+}
+
+// SetDialer sets the function to connect to peers of the desired peer set,
+// default to net.DialTimeout, it must be set before SetPeerAddresses.
+func (agent *TCPAgent) SetDialer(dial func(network, address string, timeout time.Duration) (net.Conn, error)) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.dialFunc = dial
+}
+
+// counters counts consensus messages received and sent
+type counters struct {
+	msgCount       int64
+	bytesCount     int64
+	sentMsgCount   int64
+	sentBytesCount int64
+}
+
+// received counts a consensus message received
+func (c *counters) received(size int) {
+	atomic.AddInt64(&c.msgCount, 1)
+	atomic.AddInt64(&c.bytesCount, int64(size))
+}
+
+// sent counts a consensus message sent
+func (c *counters) sent(size int) {
+	atomic.AddInt64(&c.sentMsgCount, 1)
+	atomic.AddInt64(&c.sentBytesCount, int64(size))
+}
+
+// GetMessageCount returns consensus messages count received
+func (c *counters) GetMessageCount() int64 { return atomic.LoadInt64(&c.msgCount) }
+
+// GetBytesCount returns consensus messages bytes count received
+func (c *counters) GetBytesCount() int64 { return atomic.LoadInt64(&c.bytesCount) }
+
+// GetSentMessageCount returns consensus messages count sent
+func (c *counters) GetSentMessageCount() int64 { return atomic.LoadInt64(&c.sentMsgCount) }
+
+// GetSentBytesCount returns consensus messages bytes count sent
+func (c *counters) GetSentBytesCount() int64 { return atomic.LoadInt64(&c.sentBytesCount) }
+
 // handleConsensusMessage will be called if TCPPeer received a consensus message
-func (agent *TCPAgent) handleConsensusMessage(bts []byte) {
+func (agent *TCPAgent) handleConsensusMessage(p *TCPPeer, bts []byte) {
+	msgType, err := decodeMessageType(bts)
+
 	agent.Lock()
 	defer agent.Unlock()
-	agent.consensusMessages = append(agent.consensusMessages, bts)
+	if err != nil {
+		agent.reportFailure(p)
+		return
+	}
+
+	// the queue is full, make room by dropping the oldest <nop> or <resync>,
+	// or drop this message if there is none.
+	if len(agent.consensusMessages) >= agent.limits.MaxQueuedMessages {
+		idx := -1
+		for k := range agent.consensusMessages {
+			if agent.consensusMessages[k].droppable() {
+				idx = k
+				break
+			}
+		}
+		if idx < 0 {
+			return
+		}
+		copy(agent.consensusMessages[idx:], agent.consensusMessages[idx+1:])
+		agent.consensusMessages = agent.consensusMessages[:len(agent.consensusMessages)-1]
+	}
+
+	agent.consensusMessages = append(agent.consensusMessages, queuedMessage{peer: p, bts: bts, msgType: msgType})
 	agent.notifyConsensus()
 }
 
+// reportFailure counts a message from the peer failing verification, once
+// the peer reaches MaxVerificationFailures, it's public key is banned and all
+// connections to it closed, the agent must be locked.
+func (agent *TCPAgent) reportFailure(p *TCPPeer) {
+	p.Lock()
+	p.failures++
+	failures := p.failures
+	p.Unlock()
+	if failures < agent.limits.MaxVerificationFailures {
+		return
+	}
+
+	pubkey := p.GetPublicKey()
+	if pubkey == nil {
+		p.Close()
+		return
+	}
+
+	identity := bdls.DefaultPubKeyToIdentity(pubkey)
+	log.Println("banned peer:", p.RemoteAddr(), "failures:", failures)
+	agent.banMu.Lock()
+	agent.banned[identity] = time.Now().Add(agent.limits.BanDuration)
+	agent.banMu.Unlock()
+
+	for _, peer := range agent.peers {
+		if key := peer.GetPublicKey(); key != nil && bdls.DefaultPubKeyToIdentity(key) == identity {
+			peer.Close()
+		}
+	}
+	p.Close()
+}
+
+// isBanned returns true if the public key has been banned and not expired
+func (agent *TCPAgent) isBanned(pubkey *ecdsa.PublicKey) bool {
+	identity := bdls.DefaultPubKeyToIdentity(pubkey)
+	agent.banMu.Lock()
+	defer agent.banMu.Unlock()
+	expiry, ok := agent.banned[identity]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(agent.banned, identity)
+		return false
+	}
+	return true
+}
+
 func (agent *TCPAgent) notifyConsensus() {
 	select {
 	case agent.chConsensusMessages <- struct{}{}:
@@ -212,7 +356,10 @@ func (agent *TCPAgent) inputConsensusMessage() {
 			agent.consensusMessages = nil
 
 			for _, msg := range msgs {
-				agent.consensus.ReceiveMessage(msg, time.Now())
+				err := agent.consensus.ReceiveMessage(msg.bts, time.Now())
+				if isVerificationFailure(err) {
+					agent.reportFailure(msg.peer)
+				}
 			}
 			agent.Unlock()
 		case <-agent.die:
@@ -229,6 +376,8 @@ func (f fakeAddress) String() string { return string(f) }
 
 // TCPPeer represents a peer(endpoint) related to a tcp connection
 type TCPPeer struct {
+	counters // consensus messages counters of this peer
+
 	agent          *TCPAgent           // the agent it belongs to
 	conn           net.Conn            // the connection to this peer
 	peerAuthStatus authenticationState // peer authentication status
@@ -241,6 +390,26 @@ type TCPPeer struct {
 	// the HMAC of the challenge text if peer has requested key authentication
 	hmac []byte
 
+	// limiter of consensus messages from this peer, only used by readLoop
+	limiter *peerLimiter
+
+	// number of messages from this peer failed verification
+	failures int
+
+	// the identity expected for a connection dialed by the agent,
+	// nil for accepted connections.
+	expected *bdls.Identity
+
+	// the ECDH secrets authenticated the public keys of the peer and ours,
+	// both are erased once the session keys have been derived.
+	peerSecret  []byte
+	localSecret []byte
+
+	// session ciphers for frames sent and received, only set after
+	// both the peer and us have been authenticated.
+	sender   *sessionCipher
+	receiver *sessionCipher
+
 	// message queues and their notifications
 	consensusMessages  [][]byte      // all pending outgoing consensus messages to this peer
 	chConsensusMessage chan struct{} // notification on new consensus data
@@ -249,6 +418,9 @@ type TCPPeer struct {
 	agentMessages  [][]byte      // all pending outgoing agent messages to this peer.
 	chAgentMessage chan struct{} // notification on new agent exchange messages
 
+	// closed once the session has been established
+	established chan struct{}
+
 	// peer closing signal
 	die     chan struct{}
 	dieOnce sync.Once
@@ -259,11 +431,20 @@ type TCPPeer struct {
 
 // NewTCPPeer creates a TCPPeer with protocol over this connection
 func NewTCPPeer(conn net.Conn, agent *TCPAgent) *TCPPeer {
+	return newTCPPeer(conn, agent, nil)
+}
+
+// newTCPPeer creates a TCPPeer, the peer must authenticate to
+// the expected identity if it's not nil.
+func newTCPPeer(conn net.Conn, agent *TCPAgent, expected *bdls.Identity) *TCPPeer {
 	p := new(TCPPeer)
+	p.expected = expected
 	p.chConsensusMessage = make(chan struct{}, 1)
 	p.chAgentMessage = make(chan struct{}, 1)
 	p.conn = conn
 	p.agent = agent
+	p.limiter = newPeerLimiter(agent.limits, time.Now())
+	p.established = make(chan struct{})
 	p.die = make(chan struct{})
 	// we start readLoop & sendLoop for each connection
 	go p.readLoop()
@@ -401,8 +582,13 @@ func (p *TCPPeer) handleGossip(msg *Gossip) error {
 		}
 
 	case CommandType_CONSENSUS:
-		// received a consensus message from this peer
-		p.agent.handleConsensusMessage(msg.Message)
+		// received a consensus message from this peer,
+		// messages exceeding the rates of this peer are dropped
+		p.received(len(msg.Message))
+		p.agent.received(len(msg.Message))
+		if p.limiter.allow(len(msg.Message), time.Now()) {
+			p.agent.handleConsensusMessage(p, msg.Message)
+		}
 	default:
 		panic(msg)
 	}
@@ -416,18 +602,32 @@ func (p *TCPPeer) handleKeyAuthInit(authKey *KeyAuthInit) error {
 	// only when in init status, authentication process cannot rollback
 	// to prevent from malicious re-authentication DoS
 	if p.peerAuthStatus == peerNotAuthenticated {
-		peerPublicKey := &ecdsa.PublicKey{Curve: bdls.S256Curve, X: big.NewInt(0).SetBytes(authKey.X), Y: big.NewInt(0).SetBytes(authKey.Y)}
+		// keys are on the curve the consensus is configured with
+		curve := p.agent.consensus.Curve()
+		peerPublicKey := &ecdsa.PublicKey{Curve: curve, X: big.NewInt(0).SetBytes(authKey.X), Y: big.NewInt(0).SetBytes(authKey.Y)}
 
 		// on curve test
-		if !bdls.S256Curve.IsOnCurve(peerPublicKey.X, peerPublicKey.Y) {
+		if !curve.IsOnCurve(peerPublicKey.X, peerPublicKey.Y) {
 			p.peerAuthStatus = peerAuthenticatedFailed
 			return ErrKeyNotOnCurve
 		}
+
+		// the key has been banned for failing verification
+		if p.agent.isBanned(peerPublicKey) {
+			p.peerAuthStatus = peerAuthenticatedFailed
+			return ErrPeerBanned
+		}
+
+		// the key must be of the participant we dialed
+		if p.expected != nil && bdls.DefaultPubKeyToIdentity(peerPublicKey) != *p.expected {
+			p.peerAuthStatus = peerAuthenticatedFailed
+			return ErrPeerIdentityMismatch
+		}
 		// temporarily stored announced key
 		p.peerPublicKey = peerPublicKey
 
 		// create ephermal key for authentication
-		ephemeral, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		ephemeral, err := ecdsa.GenerateKey(curve, rand.Reader)
 		if err != nil {
 			panic(err)
 		}
@@ -451,6 +651,7 @@ func (p *TCPPeer) handleKeyAuthInit(authKey *KeyAuthInit) error {
 		}
 		hmac.Write(challenge.Challenge)
 		p.hmac = hmac.Sum(nil)
+		p.peerSecret = secret.Bytes()
 
 		// proto marshal
 		bts, err := proto.Marshal(&challenge)
@@ -483,7 +684,11 @@ func (p *TCPPeer) handleKeyAuthChallenge(challenge *KeyAuthChallenge) error {
 	defer p.Unlock()
 	if p.localAuthState == localAuthKeySent {
 		// use ECDH to recover shared-key
-		pubkey := &ecdsa.PublicKey{Curve: bdls.S256Curve, X: big.NewInt(0).SetBytes(challenge.X), Y: big.NewInt(0).SetBytes(challenge.Y)}
+		curve := p.agent.consensus.Curve()
+		pubkey := &ecdsa.PublicKey{Curve: curve, X: big.NewInt(0).SetBytes(challenge.X), Y: big.NewInt(0).SetBytes(challenge.Y)}
+		if !curve.IsOnCurve(pubkey.X, pubkey.Y) {
+			return ErrKeyNotOnCurve
+		}
 		// derive secret with my private key
 		secret := ECDH(pubkey, p.agent.privateKey)
 
@@ -515,6 +720,8 @@ func (p *TCPPeer) handleKeyAuthChallenge(challenge *KeyAuthChallenge) error {
 
 		// state shift
 		p.localAuthState = localChallengeAccepted
+		p.localSecret = secret.Bytes()
+		p.establishSession()
 		return nil
 	} else {
 		return ErrPeerKeyAuthChallenge
@@ -529,6 +736,7 @@ func (p *TCPPeer) handleKeyAuthChallengeReply(response *KeyAuthChallengeReply) e
 		if subtle.ConstantTimeCompare(p.hmac, response.HMAC) == 1 {
 			p.hmac = nil
 			p.peerAuthStatus = peerAuthenticated
+			p.establishSession()
 			return nil
 		} else {
 			p.peerAuthStatus = peerAuthenticatedFailed
@@ -539,10 +747,86 @@ func (p *TCPPeer) handleKeyAuthChallengeReply(response *KeyAuthChallengeReply) e
 	}
 }
 
+// establishSession derives the session keys once both the peer and us have
+// been authenticated, the key of each direction is derived from the secret
+// authenticated the sender, mixed with the other secret.
+func (p *TCPPeer) establishSession() {
+	if p.peerAuthStatus != peerAuthenticated || p.localAuthState != localChallengeAccepted || p.sender != nil {
+		return
+	}
+
+	now := time.Now()
+	p.sender = newSessionCipher(sessionKey(p.localSecret, p.peerSecret), now)
+	p.receiver = newSessionCipher(sessionKey(p.peerSecret, p.localSecret), now)
+	p.localSecret = nil
+	p.peerSecret = nil
+	close(p.established)
+
+	// the sendLoop starts sealing after pending authentication messages
+	p.notifyAgentMessage()
+
+	// we may have another connection to this peer
+	go p.agent.deduplicate(p)
+}
+
+// establishedIdentity returns the identity of the peer once the session
+// has been established, and the connection has not been closed.
+func (p *TCPPeer) establishedIdentity() (bdls.Identity, bool) {
+	select {
+	case <-p.die:
+		return bdls.Identity{}, false
+	default:
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if p.sender == nil {
+		return bdls.Identity{}, false
+	}
+	return bdls.DefaultPubKeyToIdentity(p.peerPublicKey), true
+}
+
+// outbound returns true if the connection was dialed by the agent
+func (p *TCPPeer) outbound() bool { return p.expected != nil }
+
+// openFrame decrypts a sealed frame from the peer
+func (p *TCPPeer) openFrame(frame []byte) ([]byte, error) {
+	p.Lock()
+	receiver := p.receiver
+	p.Unlock()
+	if receiver == nil {
+		return nil, ErrSessionNotEstablished
+	}
+	return receiver.open(frame, time.Now())
+}
+
+// writeFrame writes a message to the peer, sealed if sender is not nil
+func (p *TCPPeer) writeFrame(message []byte, sender *sessionCipher) error {
+	if len(message) > MaxMessageLength {
+		return ErrMessageLengthExceed
+	}
+
+	length := uint32(len(message))
+	if sender != nil {
+		message = sender.seal(message, time.Now())
+		length = uint32(len(message)) | frameSealed
+	}
+
+	frame := make([]byte, MessageLength+len(message))
+	binary.LittleEndian.PutUint32(frame, length)
+	copy(frame[MessageLength:], message)
+
+	p.conn.SetWriteDeadline(time.Now().Add(defaultWriteTimeout))
+	_, err := p.conn.Write(frame)
+	return err
+}
+
 // readLoop keeps reading messages from peer
 func (p *TCPPeer) readLoop() {
 	defer p.Close()
 	msgLength := make([]byte, MessageLength)
+	// once a sealed frame has been received, cleartext frames are refused
+	var sealedReceived bool
 
 	for {
 		select {
@@ -558,8 +842,14 @@ func (p *TCPPeer) readLoop() {
 
 			// check length
 			length := binary.LittleEndian.Uint32(msgLength)
-			if length > MaxMessageLength {
-				log.Println(err)
+			sealed := length&frameSealed != 0
+			length &^= frameSealed
+			maxLength := uint32(p.agent.limits.MaxFrameLength)
+			if sealed {
+				maxLength += sealedOverhead
+			}
+			if length > maxLength {
+				log.Println(ErrMessageLengthExceed)
 				return
 			}
 
@@ -576,6 +866,18 @@ func (p *TCPPeer) readLoop() {
 				return
 			}
 
+			if sealed {
+				bts, err = p.openFrame(bts)
+				if err != nil {
+					log.Println(err)
+					return
+				}
+				sealedReceived = true
+			} else if sealedReceived {
+				log.Println(ErrFrameNotSealed)
+				return
+			}
+
 			// unmarshal bytes to message
 			var gossip Gossip
 			err = proto.Unmarshal(bts, &gossip)
@@ -584,6 +886,12 @@ func (p *TCPPeer) readLoop() {
 				return
 			}
 
+			// consensus messages must be sealed
+			if !sealed && gossip.Command == CommandType_CONSENSUS {
+				log.Println(ErrFrameNotSealed)
+				return
+			}
+
 			err = p.handleGossip(&gossip)
 			if err != nil {
 				log.Println(err)
@@ -600,11 +908,17 @@ func (p *TCPPeer) sendLoop() {
 	var pending [][]byte
 	var msg Gossip
 	msg.Command = CommandType_CONSENSUS
-	msgLength := make([]byte, MessageLength)
+	// frames are sealed with sender once the session has been established,
+	// consensus messages are held until then.
+	var sender *sessionCipher
 
 	for {
 		select {
 		case <-p.chConsensusMessage:
+			if sender == nil {
+				continue
+			}
+
 			p.Lock()
 			pending = p.consensusMessages
 			p.consensusMessages = nil
@@ -618,47 +932,34 @@ func (p *TCPPeer) sendLoop() {
 					panic(err)
 				}
 
-				if len(out) > MaxMessageLength {
-					panic("maximum message size exceeded")
-				}
-
-				binary.LittleEndian.PutUint32(msgLength, uint32(len(out)))
-				p.conn.SetWriteDeadline(time.Now().Add(defaultWriteTimeout))
-				// write length
-				_, err = p.conn.Write(msgLength)
-				if err != nil {
-					log.Println(err)
-					return
-				}
-
-				// write message
-				_, err = p.conn.Write(out)
+				err = p.writeFrame(out, sender)
 				if err != nil {
 					log.Println(err)
 					return
 				}
+				p.sent(len(bts))
+				p.agent.sent(len(bts))
 			}
 		case <-p.chAgentMessage:
 			p.Lock()
 			pending = p.agentMessages
 			p.agentMessages = nil
+			established := p.sender
 			p.Unlock()
 
+			// messages enqueued before the session has been established
+			// are for authentication, and must be sent in cleartext.
 			for _, bts := range pending {
-				binary.LittleEndian.PutUint32(msgLength, uint32(len(bts)))
-				// write length
-				_, err := p.conn.Write(msgLength)
+				err := p.writeFrame(bts, sender)
 				if err != nil {
 					log.Println(err)
 					return
 				}
+			}
 
-				// write message
-				_, err = p.conn.Write(bts)
-				if err != nil {
-					log.Println(err)
-					return
-				}
+			if sender == nil && established != nil {
+				sender = established
+				p.notifyConsensusMessage()
 			}
 
 		case <-p.die:
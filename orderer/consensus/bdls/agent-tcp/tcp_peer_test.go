@@ -3,6 +3,7 @@ package agent
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
@@ -33,6 +34,7 @@ type testParam struct {
 	numParticipants int
 	stopHeight      int
 	expectedLatency time.Duration
+	curve           elliptic.Curve
 }
 
 func TestTCPPeer(t *testing.T) {
@@ -67,6 +69,13 @@ func TestTCPPeer(t *testing.T) {
 			stopHeight:      5,
 			expectedLatency: 1000 * time.Millisecond,
 		},
+		{
+			numPeers:        20,
+			numParticipants: 20,
+			stopHeight:      5,
+			expectedLatency: 100 * time.Millisecond,
+			curve:           bdls.P256Curve,
+		},
 	}
 	for i := 0; i < len(params); i++ {
 		t.Logf("-=-=- TESTING CASE: [%v/%v] -=-=-", i+1, len(params))
@@ -78,8 +87,12 @@ func testConsensus(t *testing.T, param *testParam) {
 	t.Logf("PARAMETERS: %+v", spew.Sprintf("%+v", param))
 	var participants []*ecdsa.PrivateKey
 	var coords []bdls.Identity
+	curve := param.curve
+	if curve == nil {
+		curve = bdls.S256Curve
+	}
 	for i := 0; i < param.numParticipants; i++ {
-		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -112,6 +125,7 @@ func testConsensus(t *testing.T, param *testParam) {
 			config.CurrentHeight = currentHeight
 			config.PrivateKey = participants[i] // randomized participants
 			config.Participants = coords        // keep all pubkeys
+			config.Curve = curve
 
 			// should replace with real function
 			config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
@@ -216,3 +230,46 @@ func testConsensus(t *testing.T, param *testParam) {
 
 	t.Logf("consensus stopped at height:%v for %v peers %v participants", param.stopHeight, param.numPeers, param.numParticipants)
 }
+
+func TestTCPPeerCurveMismatch(t *testing.T) {
+	newAgent := func(curve elliptic.Curve) *TCPAgent {
+		var keys []*ecdsa.PrivateKey
+		var coords []bdls.Identity
+		for i := 0; i < 4; i++ {
+			privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+			assert.Nil(t, err)
+			keys = append(keys, privateKey)
+			coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+		}
+
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = keys[0]
+		config.Participants = coords
+		config.Curve = curve
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		return NewTCPAgent(consensus, keys[0])
+	}
+
+	p256 := newAgent(bdls.P256Curve)
+	defer p256.Close()
+	s256 := newAgent(bdls.S256Curve)
+	defer s256.Close()
+
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, p256)
+	p2 := NewTCPPeer(c2, s256)
+	p256.AddPeer(p1)
+	s256.AddPeer(p2)
+	p2.InitiatePublicKeyAuthentication()
+
+	// the secp256k1 key announced is not on P-256
+	<-time.After(100 * time.Millisecond)
+	p1.Lock()
+	assert.NotEqual(t, peerAuthenticated, p1.peerAuthStatus)
+	p1.Unlock()
+	assert.Nil(t, p1.GetPublicKey())
+}
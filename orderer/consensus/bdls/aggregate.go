@@ -0,0 +1,250 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"math/big"
+	"sort"
+
+	proto "github.com/gogo/protobuf/proto"
+)
+
+// Aggregate proofs shrink the <lock>, <select> and <decide> messages, which
+// carry the signed <roundchange> and <commit> messages of at least 2t+1
+// participants. Most of these proofs sign the very same message, so they are
+// combined into one AggregateProof holding the message once, a bitmap of the
+// signers indexed against the participants, and the bare <r,s> signatures of
+// the signers, the public keys being known from the participants.
+//
+// The signatures are still verified one by one, an aggregate proof is
+// a compact encoding of the proofs and not a threshold signature.
+//
+// Messages carrying aggregate proofs are signed with ProtocolVersionAggregate,
+// so that they are rejected, instead of being misread, by the implementations
+// which do not support them.
+//
+// NOTE: the identities of the participants must be the <x,y> coordinates
+// of their public keys, as with DefaultPubKeyToIdentity, for the proofs
+// to be reconstructed from the bitmap of the signers.
+
+// messageVersion returns the protocol version the message is signed with.
+func messageVersion(m *Message) uint32 {
+	if len(m.AggregateProof) > 0 {
+		return ProtocolVersionAggregate
+	}
+	return ProtocolVersion
+}
+
+// supportedVersion tells whether the protocol version is supported.
+func supportedVersion(version uint32) bool {
+	return version == ProtocolVersion || version == ProtocolVersionAggregate
+}
+
+// signatureSize returns the byte size of r or s in a signature on the curve.
+func signatureSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// canonicalInt tells whether b is the minimal big-endian encoding of an
+// integer of at most size bytes, as big.Int.Bytes returns.
+func canonicalInt(b []byte, size int) bool {
+	return len(b) <= size && (len(b) == 0 || b[0] != 0)
+}
+
+// aggregatedMessage encodes the message signed by the proofs of an aggregate proof.
+func aggregatedMessage(msgType MessageType, height uint64, round uint64, state State) []byte {
+	m := Message{Type: msgType, Height: height, Round: round, State: state}
+	bts, err := proto.Marshal(&m)
+	if err != nil {
+		panic(err)
+	}
+	return bts
+}
+
+// aggregateKey identifies the proofs which sign the same message.
+type aggregateKey struct {
+	msgType MessageType
+	height  uint64
+	round   uint64
+	state   string
+}
+
+// aggregateGroup collects the signatures of the proofs signing the same message.
+type aggregateGroup struct {
+	proof      *AggregateProof
+	signatures map[int][]byte // by the index of the signer in participants
+}
+
+// aggregate combines the proofs signing the same message into aggregate
+// proofs, the proofs which can't be reconstructed from an aggregate proof
+// are returned as they are.
+func (c *Consensus) aggregate(proofs []*SignedProto) (rest []*SignedProto, aggs []*AggregateProof) {
+	index := make(map[Identity]int)
+	for i := len(c.participants) - 1; i >= 0; i-- {
+		index[c.participants[i]] = i
+	}
+
+	size := signatureSize(c.curve)
+	var groups []*aggregateGroup
+	byKey := make(map[aggregateKey]*aggregateGroup)
+	for _, proof := range proofs {
+		m, err := DecodeMessage(proof.Message)
+		if err != nil || proof.Version != ProtocolVersion {
+			rest = append(rest, proof)
+			continue
+		}
+
+		// the proof must be exactly the one reconstructed on receiving
+		var id Identity
+		copy(id[:SizeAxis], proof.X[:])
+		copy(id[SizeAxis:], proof.Y[:])
+		i, ok := index[id]
+		if !ok || c.pubKeyToIdentity(proof.PublicKey(c.curve)) != id ||
+			!bytes.Equal(aggregatedMessage(m.Type, m.Height, m.Round, m.State), proof.Message) ||
+			!canonicalInt(proof.R, size) || !canonicalInt(proof.S, size) {
+			rest = append(rest, proof)
+			continue
+		}
+
+		key := aggregateKey{msgType: m.Type, height: m.Height, round: m.Round, state: string(m.State)}
+		group, ok := byKey[key]
+		if !ok {
+			group = &aggregateGroup{
+				proof: &AggregateProof{
+					Type:    m.Type,
+					Height:  m.Height,
+					Round:   m.Round,
+					State:   m.State,
+					Signers: make([]byte, (len(c.participants)+7)/8),
+				},
+				signatures: make(map[int][]byte),
+			}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+
+		if _, exists := group.signatures[i]; exists { // a duplicated proof
+			rest = append(rest, proof)
+			continue
+		}
+
+		// r and s are left padded to the same size
+		sig := make([]byte, 2*size)
+		copy(sig[size-len(proof.R):size], proof.R)
+		copy(sig[2*size-len(proof.S):], proof.S)
+		group.signatures[i] = sig
+	}
+
+	// signatures are in the order of the bitmap
+	for _, group := range groups {
+		signers := make([]int, 0, len(group.signatures))
+		for i := range group.signatures {
+			signers = append(signers, i)
+		}
+		sort.Ints(signers)
+
+		agg := group.proof
+		for _, i := range signers {
+			agg.Signers[i/8] |= 1 << uint(i%8)
+			agg.Signatures = append(agg.Signatures, group.signatures[i])
+		}
+		aggs = append(aggs, agg)
+	}
+	return rest, aggs
+}
+
+// ExpandAggregateProof reconstructs the signed messages combined in an
+// aggregate proof, with the participants the signers bitmap is indexed
+// against. The signatures of the messages are not verified.
+func ExpandAggregateProof(agg *AggregateProof, participants []Identity) ([]*SignedProto, error) {
+	var signers []int
+	for k, bits := range agg.Signers {
+		for j := 0; j < 8; j++ {
+			if bits&(1<<uint(j)) == 0 {
+				continue
+			}
+			i := 8*k + j
+			if i >= len(participants) {
+				return nil, ErrAggregateProofSigners
+			}
+			signers = append(signers, i)
+		}
+	}
+
+	if len(signers) != len(agg.Signatures) {
+		return nil, ErrAggregateProofSignatures
+	}
+
+	msg := aggregatedMessage(agg.Type, agg.Height, agg.Round, agg.State)
+	proofs := make([]*SignedProto, 0, len(signers))
+	for k, i := range signers {
+		sig := agg.Signatures[k]
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return nil, ErrAggregateProofSignatures
+		}
+		half := len(sig) / 2
+
+		sp := new(SignedProto)
+		sp.Version = ProtocolVersion
+		sp.Message = msg
+		copy(sp.X[:], participants[i][:SizeAxis])
+		copy(sp.Y[:], participants[i][SizeAxis:])
+		sp.R = new(big.Int).SetBytes(sig[:half]).Bytes()
+		sp.S = new(big.Int).SetBytes(sig[half:]).Bytes()
+		proofs = append(proofs, sp)
+	}
+	return proofs, nil
+}
+
+// setProofs sets the proofs carried by a message, combined into
+// aggregate proofs if enabled.
+func (c *Consensus) setProofs(m *Message, proofs []*SignedProto) {
+	if !c.enableAggregateProof {
+		m.Proof = proofs
+		return
+	}
+	m.Proof, m.AggregateProof = c.aggregate(proofs)
+}
+
+// expandProofs appends the proofs combined in the aggregate proofs of the
+// message to its proofs, to be verified along with them.
+func (c *Consensus) expandProofs(m *Message) error {
+	for _, agg := range m.AggregateProof {
+		proofs, err := ExpandAggregateProof(agg, c.participants)
+		if err != nil {
+			return err
+		}
+		m.Proof = append(m.Proof, proofs...)
+	}
+	return nil
+}
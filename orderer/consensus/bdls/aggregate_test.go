@@ -0,0 +1,165 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// createAggregateDecideMessage re-signs a <decide> message with its proofs
+// combined into aggregate proofs by the consensus object.
+func createAggregateDecideMessage(t *testing.T, c *Consensus) (*Message, *SignedProto, *ecdsa.PrivateKey, []byte, []byte) {
+	m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 10, 10, 10, 10)
+	for _, key := range proofKeys {
+		c.AddParticipant(key)
+	}
+	c.SetLeader(&privateKey.PublicKey)
+
+	agg := &Message{Type: m.Type, Height: m.Height, Round: m.Round, State: m.State}
+	agg.Proof, agg.AggregateProof = c.aggregate(m.Proof)
+	signed := new(SignedProto)
+	signed.Sign(agg, privateKey)
+
+	plain, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	aggregated, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+	return agg, signed, privateKey, plain, aggregated
+}
+
+func TestAggregateProof(t *testing.T) {
+	consensus := createConsensus(t, 9, 10, nil)
+	m, sp, _, plain, aggregated := createAggregateDecideMessage(t, consensus)
+
+	// the 13 commits to the decided state are combined,
+	// along with the 7 others, each to a random state
+	assert.Empty(t, m.Proof)
+	assert.Len(t, m.AggregateProof, 8)
+	assert.Len(t, m.AggregateProof[0].Signatures, 13)
+	assert.Equal(t, uint32(ProtocolVersionAggregate), sp.Version)
+	assert.Less(t, len(aggregated), len(plain))
+
+	// the proofs are reconstructed exactly
+	decoded, err := DecodeMessage(sp.Message)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.expandProofs(decoded))
+	original, err := DecodeMessage(mustDecodeSigned(t, plain).Message)
+	assert.Nil(t, err)
+	assert.Len(t, decoded.Proof, len(original.Proof))
+	for _, proof := range decoded.Proof {
+		bts, err := proto.Marshal(proof)
+		assert.Nil(t, err)
+		found := false
+		for _, expected := range original.Proof {
+			if out, _ := proto.Marshal(expected); string(out) == string(bts) {
+				found = true
+			}
+		}
+		assert.True(t, found)
+	}
+
+	assert.Nil(t, consensus.ValidateDecideMessage(aggregated, m.State))
+	assert.Nil(t, consensus.ValidateDecideMessage(plain, m.State))
+}
+
+func TestAggregateProofInvalid(t *testing.T) {
+	consensus := createConsensus(t, 9, 10, nil)
+	m, _, privateKey, _, _ := createAggregateDecideMessage(t, consensus)
+
+	for _, testCase := range []struct {
+		name    string
+		tamper  func(m *Message)
+		version uint32
+		err     error
+	}{
+		{
+			name:   "signer out of the participants",
+			tamper: func(m *Message) { m.AggregateProof[0].Signers = append(m.AggregateProof[0].Signers, 0xff) },
+			err:    ErrAggregateProofSigners,
+		},
+		{
+			name: "missing signature",
+			tamper: func(m *Message) {
+				m.AggregateProof[0].Signatures = m.AggregateProof[0].Signatures[1:]
+			},
+			err: ErrAggregateProofSignatures,
+		},
+		{
+			name: "malformed signature",
+			tamper: func(m *Message) {
+				m.AggregateProof[0].Signatures[0] = m.AggregateProof[0].Signatures[0][1:]
+			},
+			err: ErrAggregateProofSignatures,
+		},
+		{
+			name: "forged signature",
+			tamper: func(m *Message) {
+				sig := append([]byte(nil), m.AggregateProof[0].Signatures[0]...)
+				sig[len(sig)-1] ^= 0xff
+				m.AggregateProof[0].Signatures[0] = sig
+			},
+			err: ErrMessageSignature,
+		},
+		{
+			name: "signer replaced",
+			tamper: func(m *Message) {
+				// participants[0] has not signed in place of participants[1]
+				m.AggregateProof[0].Signers[0] ^= 0x03
+			},
+			err: ErrMessageSignature,
+		},
+		{
+			name:    "signed with the plain protocol version",
+			tamper:  func(m *Message) {},
+			version: ProtocolVersion,
+			err:     ErrMessageVersion,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			bts, err := proto.Marshal(m)
+			assert.Nil(t, err)
+			tampered, err := DecodeMessage(bts)
+			assert.Nil(t, err)
+			testCase.tamper(tampered)
+
+			signed := new(SignedProto)
+			signed.Sign(tampered, privateKey)
+			if testCase.version != 0 {
+				signed.Version = testCase.version
+				r, s, err := ecdsa.Sign(rand.Reader, privateKey, signed.Hash())
+				assert.Nil(t, err)
+				signed.R, signed.S = r.Bytes(), s.Bytes()
+			}
+			out, err := proto.Marshal(signed)
+			assert.Nil(t, err)
+			assert.Equal(t, testCase.err, consensus.ValidateDecideMessage(out, m.State))
+		})
+	}
+}
+
+func TestSimulatorAggregateProofs(t *testing.T) {
+	s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 7, Jitter: 20 * time.Millisecond})
+	assert.Nil(t, err)
+	for _, node := range s.nodes {
+		node.c.enableAggregateProof = true
+	}
+	assert.True(t, s.RunUntil(3, time.Minute))
+
+	// the <decide> messages carry aggregate proofs
+	for _, node := range s.nodes {
+		m, err := DecodeMessage(node.c.CurrentProof().Message)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, m.AggregateProof)
+		assert.Empty(t, m.Proof)
+	}
+}
+
+func mustDecodeSigned(t *testing.T, bts []byte) *SignedProto {
+	signed, err := DecodeSignedMessage(bts)
+	assert.Nil(t, err)
+	return signed
+}
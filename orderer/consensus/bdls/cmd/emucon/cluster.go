@@ -0,0 +1,538 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/Sperax/bdls/agent-tcp"
+	"github.com/Sperax/bdls/crypto/blake2b"
+	"github.com/urfave/cli/v2"
+)
+
+// states of a node in cluster
+const (
+	nodeRunning = "running"
+	nodePaused  = "paused"
+	nodeKilled  = "killed"
+)
+
+var (
+	errPartitioned  = errors.New("the nodes are partitioned")
+	errNodeState    = errors.New("the command is not allowed in current state of the node")
+	errNodeNotFound = errors.New("the node does not exist")
+)
+
+// NodeStatus is the status of a node reported by the cluster
+type NodeStatus struct {
+	ID               int          `json:"id"`
+	Address          string       `json:"address"`
+	State            string       `json:"state"`
+	Height           uint64       `json:"height"`
+	Round            uint64       `json:"round"`
+	Stage            string       `json:"stage"`
+	Group            int          `json:"group"`
+	Delay            string       `json:"delay"`
+	Peers            []PeerStatus `json:"peers"`
+	MessagesReceived int64        `json:"messages_received"`
+	BytesReceived    int64        `json:"bytes_received"`
+	MessagesSent     int64        `json:"messages_sent"`
+	BytesSent        int64        `json:"bytes_sent"`
+}
+
+// PeerStatus is the connection status of a node to another
+type PeerStatus struct {
+	ID        int    `json:"id"`
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// cluster runs all participants of a quorum in this process, connected over
+// localhost, faults are injected into the connections of nodes.
+type cluster struct {
+	curve      elliptic.Curve
+	keys       []*ecdsa.PrivateKey
+	identities []bdls.Identity
+	addresses  []string
+	nodes      []*node
+
+	groups     []int                   // nodes in different groups are partitioned
+	delays     []time.Duration         // delay before each write of a node
+	conns      map[*faultConn]struct{} // connections dialed by nodes
+	sync.Mutex                         // fields lock
+}
+
+// node is a participant in cluster
+type node struct {
+	id       int
+	cluster  *cluster
+	state    string
+	agent    *agent.TCPAgent
+	listener net.Listener
+	die      chan struct{}
+
+	// status updated by the proposer, kept while the node is paused
+	height uint64
+	round  uint64
+	stage  string
+	peers  []agent.PeerState
+
+	sync.Mutex // fields lock
+}
+
+// startCluster starts all participants in quorum, and serves the status and commands over HTTP
+func startCluster(c *cli.Context) error {
+	curve, keys, err := loadQuorum(c.String("config"))
+	if err != nil {
+		return err
+	}
+
+	cl := new(cluster)
+	cl.curve = curve
+	cl.keys = keys
+	cl.groups = make([]int, len(keys))
+	cl.delays = make([]time.Duration, len(keys))
+	cl.conns = make(map[*faultConn]struct{})
+	for k := range keys {
+		cl.identities = append(cl.identities, bdls.DefaultPubKeyToIdentity(&keys[k].PublicKey))
+		cl.addresses = append(cl.addresses, fmt.Sprintf("127.0.0.1:%v", c.Int("base-port")+k))
+		cl.nodes = append(cl.nodes, &node{id: k, cluster: cl, state: nodeKilled})
+	}
+
+	for _, n := range cl.nodes {
+		if err := n.start(); err != nil {
+			return err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nodes", cl.handleNodes)
+	mux.HandleFunc("/nodes/", cl.handleNode)
+	mux.HandleFunc("/partition", cl.handlePartition)
+	mux.HandleFunc("/heal", cl.handleHeal)
+	log.Println("cluster status on:", c.String("http"))
+	return http.ListenAndServe(c.String("http"), mux)
+}
+
+// start the node with a new consensus at height 0, it catches up with others by resync
+func (n *node) start() error {
+	n.Lock()
+	defer n.Unlock()
+	if n.state != nodeKilled {
+		return errNodeState
+	}
+
+	cl := n.cluster
+	consensus, err := bdls.NewConsensus(newConfig(cl.curve, cl.keys, n.id))
+	if err != nil {
+		return err
+	}
+	consensus.SetLatency(200 * time.Millisecond)
+
+	l, err := net.Listen("tcp", cl.addresses[n.id])
+	if err != nil {
+		return err
+	}
+
+	tagent := agent.NewTCPAgent(consensus, cl.keys[n.id])
+	tagent.SetDialer(cl.dialer(n.id))
+	tagent.Update()
+
+	// passive connection from peers
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			p := agent.NewTCPPeer(&faultConn{Conn: conn, cluster: cl, local: n.id, remote: -1}, tagent)
+			tagent.AddPeer(p)
+			p.InitiatePublicKeyAuthentication()
+		}
+	}()
+
+	addresses := make(map[bdls.Identity]string)
+	for k := range cl.addresses {
+		addresses[cl.identities[k]] = cl.addresses[k]
+	}
+	tagent.SetPeerAddresses(addresses)
+
+	n.agent = tagent
+	n.listener = l
+	n.die = make(chan struct{})
+	n.state = nodeRunning
+	n.height, n.round, n.stage, n.peers = 0, 0, "", nil
+	go n.propose(tagent, n.die)
+	log.Printf("node %v: started on %v", n.id, cl.addresses[n.id])
+	return nil
+}
+
+// kill stops the node, and closes all it's connections
+func (n *node) kill() error {
+	n.Lock()
+	defer n.Unlock()
+	switch n.state {
+	case nodeKilled:
+		return errNodeState
+	case nodePaused:
+		n.agent.Unlock()
+	}
+
+	close(n.die)
+	n.listener.Close()
+	n.agent.Close()
+	n.state = nodeKilled
+	log.Printf("node %v: killed", n.id)
+	return nil
+}
+
+// pause freezes the node like a stopped process, by holding the lock of it's
+// agent, messages are neither processed nor sent, and connections stall.
+func (n *node) pause() error {
+	n.Lock()
+	defer n.Unlock()
+	if n.state != nodeRunning {
+		return errNodeState
+	}
+
+	n.agent.Lock()
+	n.state = nodePaused
+	log.Printf("node %v: paused", n.id)
+	return nil
+}
+
+// resume a paused node
+func (n *node) resume() error {
+	n.Lock()
+	defer n.Unlock()
+	if n.state != nodePaused {
+		return errNodeState
+	}
+
+	n.agent.Unlock()
+	n.state = nodeRunning
+	log.Printf("node %v: resumed", n.id)
+	return nil
+}
+
+// propose keeps proposing random states, and updates the status of the node
+func (n *node) propose(tagent *agent.TCPAgent, die chan struct{}) {
+	lastHeight := uint64(0)
+
+NEXTHEIGHT:
+	for {
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		tagent.Propose(data)
+
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+			case <-die:
+				return
+			}
+
+			newHeight, newRound, newState := tagent.GetLatestState()
+			stage := tagent.GetCurrentStage()
+			peers := tagent.PeerStates()
+			n.Lock()
+			n.height, n.round, n.stage, n.peers = newHeight, newRound, stage, peers
+			n.Unlock()
+
+			if newHeight > lastHeight {
+				h := blake2b.Sum256(newState)
+				log.Printf("node %v: <decide> at height:%v round:%v hash:%v", n.id, newHeight, newRound, hex.EncodeToString(h[:]))
+				lastHeight = newHeight
+				continue NEXTHEIGHT
+			}
+		}
+	}
+}
+
+// status returns the status of the node
+func (n *node) status() NodeStatus {
+	cl := n.cluster
+	n.Lock()
+	status := NodeStatus{
+		ID:      n.id,
+		Address: cl.addresses[n.id],
+		State:   n.state,
+		Height:  n.height,
+		Round:   n.round,
+		Stage:   n.stage,
+	}
+	peers := n.peers
+	tagent := n.agent
+	n.Unlock()
+
+	status.MessagesReceived = tagent.GetMessageCount()
+	status.BytesReceived = tagent.GetBytesCount()
+	status.MessagesSent = tagent.GetSentMessageCount()
+	status.BytesSent = tagent.GetSentBytesCount()
+
+	for _, peer := range peers {
+		peerStatus := PeerStatus{ID: cl.nodeOf(peer.Address), Address: peer.Address, Connected: peer.Connected, Attempts: peer.Attempts}
+		if peer.LastError != nil {
+			peerStatus.LastError = peer.LastError.Error()
+		}
+		status.Peers = append(status.Peers, peerStatus)
+	}
+	sort.Slice(status.Peers, func(i, j int) bool { return status.Peers[i].ID < status.Peers[j].ID })
+
+	cl.Lock()
+	status.Group = cl.groups[n.id]
+	status.Delay = cl.delays[n.id].String()
+	cl.Unlock()
+	return status
+}
+
+// nodeOf returns the id of the node at address, or -1 if none
+func (cl *cluster) nodeOf(address string) int {
+	for k := range cl.addresses {
+		if cl.addresses[k] == address {
+			return k
+		}
+	}
+	return -1
+}
+
+// dialer returns the function for the node to connect to others
+func (cl *cluster) dialer(local int) func(network, address string, timeout time.Duration) (net.Conn, error) {
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		remote := cl.nodeOf(address)
+		cl.Lock()
+		partitioned := remote >= 0 && cl.groups[local] != cl.groups[remote]
+		cl.Unlock()
+		if partitioned {
+			return nil, errPartitioned
+		}
+
+		conn, err := net.DialTimeout(network, address, timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		fc := &faultConn{Conn: conn, cluster: cl, local: local, remote: remote}
+		cl.Lock()
+		cl.conns[fc] = struct{}{}
+		cl.Unlock()
+		return fc, nil
+	}
+}
+
+// partition isolates the nodes from the others, closing the connections between them
+func (cl *cluster) partition(ids []int) {
+	cl.Lock()
+	defer cl.Unlock()
+	for k := range cl.groups {
+		cl.groups[k] = 0
+	}
+	for _, id := range ids {
+		cl.groups[id] = 1
+	}
+
+	for fc := range cl.conns {
+		if fc.remote >= 0 && cl.groups[fc.local] != cl.groups[fc.remote] {
+			delete(cl.conns, fc)
+			fc.Conn.Close()
+		}
+	}
+	log.Println("partitioned nodes:", ids)
+}
+
+// heal removes all partitions and delays
+func (cl *cluster) heal() {
+	cl.Lock()
+	defer cl.Unlock()
+	for k := range cl.groups {
+		cl.groups[k] = 0
+		cl.delays[k] = 0
+	}
+	log.Println("healed all nodes")
+}
+
+// faultConn injects faults into a connection of local node, remote is the node
+// dialed by local, or -1 for connections accepted.
+type faultConn struct {
+	net.Conn
+	cluster *cluster
+	local   int
+	remote  int
+}
+
+// Write delays the data if the local node is slow
+func (fc *faultConn) Write(b []byte) (int, error) {
+	fc.cluster.Lock()
+	delay := fc.cluster.delays[fc.local]
+	fc.cluster.Unlock()
+	if delay > 0 {
+		<-time.After(delay)
+	}
+	return fc.Conn.Write(b)
+}
+
+// Close closes the connection, and stops tracking it
+func (fc *faultConn) Close() error {
+	fc.cluster.Lock()
+	delete(fc.cluster.conns, fc)
+	fc.cluster.Unlock()
+	return fc.Conn.Close()
+}
+
+// writeJSON responds v in json
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.Encode(v)
+}
+
+// handleNodes responds the status of all nodes
+//
+// GET /nodes
+func (cl *cluster) handleNodes(w http.ResponseWriter, r *http.Request) {
+	var statuses []NodeStatus
+	for _, n := range cl.nodes {
+		statuses = append(statuses, n.status())
+	}
+	writeJSON(w, statuses)
+}
+
+// handleNode responds the status of a node, or executes a command on it
+//
+// GET  /nodes/{id}
+// POST /nodes/{id}/kill
+// POST /nodes/{id}/start
+// POST /nodes/{id}/pause
+// POST /nodes/{id}/resume
+// POST /nodes/{id}/slow?delay=500ms
+func (cl *cluster) handleNode(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/nodes/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id < 0 || id >= len(cl.nodes) {
+		http.Error(w, errNodeNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	n := cl.nodes[id]
+
+	if len(parts) == 1 {
+		writeJSON(w, n.status())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "commands must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch parts[1] {
+	case "kill":
+		err = n.kill()
+	case "start":
+		err = n.start()
+	case "pause":
+		err = n.pause()
+	case "resume":
+		err = n.resume()
+	case "slow":
+		var delay time.Duration
+		delay, err = time.ParseDuration(r.URL.Query().Get("delay"))
+		if err == nil {
+			cl.Lock()
+			cl.delays[id] = delay
+			cl.Unlock()
+			log.Printf("node %v: slowed by %v", id, delay)
+		}
+	default:
+		http.Error(w, "unknown command", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, n.status())
+}
+
+// handlePartition isolates the nodes listed from the others
+//
+// POST /partition?nodes=0,1
+func (cl *cluster) handlePartition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "commands must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var ids []int
+	for _, s := range strings.Split(r.URL.Query().Get("nodes"), ",") {
+		id, err := strconv.Atoi(s)
+		if err != nil || id < 0 || id >= len(cl.nodes) {
+			http.Error(w, errNodeNotFound.Error(), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	cl.partition(ids)
+	cl.handleNodes(w, r)
+}
+
+// handleHeal removes all partitions and delays
+//
+// POST /heal
+func (cl *cluster) handleHeal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "commands must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cl.heal()
+	cl.handleNodes(w, r)
+}
@@ -33,6 +33,7 @@ package main
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -53,7 +54,8 @@ import (
 
 // A quorum set for consenus
 type Quorum struct {
-	Keys []*big.Int `json:"keys"` // pem formatted keys
+	Curve string     `json:"curve,omitempty"` // curve of the keys, secp256k1 if empty
+	Keys  []*big.Int `json:"keys"`            // pem formatted keys
 }
 
 func main() {
@@ -76,13 +78,22 @@ func main() {
 						Value: "./quorum.json",
 						Usage: "output quorum file",
 					},
+					&cli.StringFlag{
+						Name:  "curve",
+						Value: bdls.CurveSecp256k1,
+						Usage: "curve of the keys, secp256k1 or P-256",
+					},
 				},
 				Action: func(c *cli.Context) error {
 					count := c.Int("count")
-					quorum := &Quorum{}
+					curve, err := bdls.CurveByName(c.String("curve"))
+					if err != nil {
+						return err
+					}
+					quorum := &Quorum{Curve: bdls.CurveName(curve)}
 					// generate private keys
 					for i := 0; i < count; i++ {
-						privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+						privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
 						if err != nil {
 							return err
 						}
@@ -102,7 +113,7 @@ func main() {
 					}
 					file.Close()
 
-					log.Println("generate", c.Int("count"), "keys")
+					log.Println("generate", c.Int("count"), quorum.Curve, "keys")
 					return nil
 				},
 			},
@@ -130,54 +141,55 @@ func main() {
 						Value: "./peers.json",
 						Usage: "all peers's ip:port list to connect, as a json array",
 					},
+					&cli.IntFlag{
+						Name:  "max-frame",
+						Value: agent.DefaultLimits().MaxFrameLength,
+						Usage: "the maximum length of a frame accepted from peers",
+					},
 				},
 				Action: func(c *cli.Context) error {
-					// open quorum config
-					file, err := os.Open(c.String("config"))
-					if err != nil {
-						return err
-					}
-					defer file.Close()
-
-					quorum := new(Quorum)
-					err = json.NewDecoder(file).Decode(quorum)
+					curve, keys, err := loadQuorum(c.String("config"))
 					if err != nil {
 						return err
 					}
 
 					id := c.Int("id")
-					if id >= len(quorum.Keys) {
+					if id >= len(keys) {
 						return errors.New(fmt.Sprint("cannot locate private key for id:", id))
 					}
 					log.Println("identity:", id)
 
-					// create configuration
-					config := new(bdls.Config)
-					config.Epoch = time.Now()
-					config.CurrentHeight = 0
-					config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
-					config.StateValidate = func(bdls.State) bool { return true }
-
-					for k := range quorum.Keys {
-						priv := new(ecdsa.PrivateKey)
-						priv.PublicKey.Curve = bdls.S256Curve
-						priv.D = quorum.Keys[k]
-						priv.PublicKey.X, priv.PublicKey.Y = bdls.S256Curve.ScalarBaseMult(priv.D.Bytes())
-						// myself
-						if id == k {
-							config.PrivateKey = priv
-						}
-
-						// set validator sequence
-						config.Participants = append(config.Participants, bdls.DefaultPubKeyToIdentity(&priv.PublicKey))
-					}
-
+					config := newConfig(curve, keys, id)
 					if err := startConsensus(c, config); err != nil {
 						return err
 					}
 					return nil
 				},
 			},
+			{
+				Name:  "cluster",
+				Usage: "start all participants in quorum as a local cluster",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "config",
+						Value: "./quorum.json",
+						Usage: "the shared quorum config file",
+					},
+					&cli.IntFlag{
+						Name:  "base-port",
+						Value: 4680,
+						Usage: "the n-th node listens on localhost at base-port+n",
+					},
+					&cli.StringFlag{
+						Name:  "http",
+						Value: ":8080",
+						Usage: "the address to serve status and commands over HTTP",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return startCluster(c)
+				},
+			},
 		},
 
 		Action: func(c *cli.Context) error {
@@ -193,6 +205,54 @@ func main() {
 
 }
 
+// loadQuorum loads the curve and private keys of participants from the quorum file
+func loadQuorum(path string) (elliptic.Curve, []*ecdsa.PrivateKey, error) {
+	// open quorum config
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	quorum := new(Quorum)
+	err = json.NewDecoder(file).Decode(quorum)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	curve, err := bdls.CurveByName(quorum.Curve)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []*ecdsa.PrivateKey
+	for k := range quorum.Keys {
+		priv := new(ecdsa.PrivateKey)
+		priv.PublicKey.Curve = curve
+		priv.D = quorum.Keys[k]
+		priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(priv.D.Bytes())
+		keys = append(keys, priv)
+	}
+	return curve, keys, nil
+}
+
+// newConfig creates the configuration for the participant with the id-th key
+func newConfig(curve elliptic.Curve, keys []*ecdsa.PrivateKey, id int) *bdls.Config {
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.CurrentHeight = 0
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(bdls.State) bool { return true }
+	config.Curve = curve
+	config.PrivateKey = keys[id]
+
+	// set validator sequence
+	for k := range keys {
+		config.Participants = append(config.Participants, bdls.DefaultPubKeyToIdentity(&keys[k].PublicKey))
+	}
+	return config
+}
+
 // consensus for one round with full procedure
 func startConsensus(c *cli.Context, config *bdls.Config) error {
 	// create consensus
@@ -229,7 +289,9 @@ func startConsensus(c *cli.Context, config *bdls.Config) error {
 	log.Println("listening on:", c.String("listen"))
 
 	// initiate tcp agent
-	tagent := agent.NewTCPAgent(consensus, config.PrivateKey)
+	limits := agent.DefaultLimits()
+	limits.MaxFrameLength = c.Int("max-frame")
+	tagent := agent.NewTCPAgentWithLimits(consensus, config.PrivateKey, limits)
 	if err != nil {
 		return err
 	}
@@ -253,24 +315,16 @@ func startConsensus(c *cli.Context, config *bdls.Config) error {
 		}
 	}()
 
-	// active connections to peers
+	// the i-th peer is the participant of the i-th key in quorum, the agent
+	// keeps connections to them, and reconnects to those restarted.
+	if len(peers) != len(config.Participants) {
+		return errors.New(fmt.Sprint("peers count:", len(peers), " mismatches participants count:", len(config.Participants)))
+	}
+	addresses := make(map[bdls.Identity]string)
 	for k := range peers {
-		go func(raddr string) {
-			for {
-				conn, err := net.Dial("tcp", raddr)
-				if err == nil {
-					log.Println("connected to peer:", conn.RemoteAddr())
-					// peer endpoint created
-					p := agent.NewTCPPeer(conn, tagent)
-					tagent.AddPeer(p)
-					// prove my identity to this peer
-					p.InitiatePublicKeyAuthentication()
-					return
-				}
-				<-time.After(time.Second)
-			}
-		}(peers[k])
+		addresses[config.Participants[k]] = peers[k]
 	}
+	tagent.SetPeerAddresses(addresses)
 
 	lastHeight := uint64(0)
 
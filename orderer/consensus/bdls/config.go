@@ -31,7 +31,9 @@
 package bdls
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"time"
 )
 
@@ -46,13 +48,27 @@ type Config struct {
 	Epoch time.Time
 	// CurrentHeight
 	CurrentHeight uint64
+	// CurrentState is the state decided at CurrentHeight, it seeds
+	// the election of the leaders at the next height.
+	CurrentState State
 	// PrivateKey
 	PrivateKey *ecdsa.PrivateKey
+	// Signer signs messages in place of PrivateKey if set, this allows
+	// the private key to be kept out of memory, e.g. in an HSM.
+	// The public key of the signer must be an *ecdsa.PublicKey.
+	Signer crypto.Signer
 	// Consensus Group
 	Participants []Identity
 	// EnableCommitUnicast sets to true to enable <commit> message to be delivered via unicast
 	// if not(by default), <commit> message will be broadcasted
 	EnableCommitUnicast bool
+	// EnableAggregateProof sets to true to combine the proofs carried by <lock>, <select>
+	// and <decide> messages into aggregate proofs, messages with aggregate proofs are
+	// signed with ProtocolVersionAggregate
+	EnableAggregateProof bool
+	// EnablePipelining sets to true to start the height after next while the next height
+	// is being committed, with the states proposed by Consensus.ProposeNext
+	EnablePipelining bool
 
 	// StateCompare is a function from user to compare states,
 	// The result will be 0 if a==b, -1 if a < b, and +1 if a > b.
@@ -70,9 +86,38 @@ type Config struct {
 	// MessageOutCallback will be called if not nil before a message send out
 	MessageOutCallback func(m *Message, signed *SignedProto)
 
+	// EvidenceCallback will be called if not nil with the evidence of
+	// a participant which has signed conflicting messages
+	EvidenceCallback func(e *Evidence)
+
 	// Identity derviation from ecdsa.PublicKey
 	// (optional). Default to DefaultPubKeyToIdentity
 	PubKeyToIdentity func(pubkey *ecdsa.PublicKey) (ret Identity)
+
+	// LeaderElection elects the leader of each round
+	// (optional). Default to RoundRobinLeader
+	LeaderElection LeaderElection
+
+	// Curve is the elliptic curve of the keys of participants, either S256Curve
+	// or P256Curve (optional). Default to the curve of PrivateKey or Signer.
+	// Once set, the key and the participants must be on this curve
+	Curve elliptic.Curve
+
+	// VerifyCacheSize is the number of verified signatures remembered
+	// (optional). Default to DefaultVerifyCacheSize, negative disables the cache
+	VerifyCacheSize int
+
+	// Timeouts are the base durations of the stages of rounds and their cap
+	// (optional). Default to durations derived from the latency
+	Timeouts Timeouts
+
+	// EnableAdaptiveLatency sets to true to adjust the latency to the latency
+	// estimated from the delays of <roundchange> quorums, see Consensus.EstimatedLatency
+	EnableAdaptiveLatency bool
+	// MinLatency and MaxLatency bound the latency estimated (optional).
+	// Default to DefaultMinLatency and DefaultMaxLatency
+	MinLatency time.Duration
+	MaxLatency time.Duration
 }
 
 // VerifyConfig verifies the integrity of this config when creating new consensus object
@@ -89,13 +134,35 @@ func VerifyConfig(c *Config) error {
 		return ErrConfigStateValidate
 	}
 
-	if c.PrivateKey == nil {
+	if c.PrivateKey == nil && c.Signer == nil {
 		return ErrConfigPrivateKey
 	}
 
+	var publicKey *ecdsa.PublicKey
+	if c.Signer != nil {
+		pubkey, ok := c.Signer.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return ErrConfigSigner
+		}
+		publicKey = pubkey
+	} else {
+		publicKey = &c.PrivateKey.PublicKey
+	}
+
 	if len(c.Participants) < ConfigMinimumParticipants {
 		return ErrConfigParticipants
 	}
 
+	if err := VerifyTimeouts(&c.Timeouts); err != nil {
+		return err
+	}
+
+	if err := verifyLatencyBounds(c); err != nil {
+		return err
+	}
+
+	if c.Curve != nil {
+		return verifyCurve(c, publicKey)
+	}
 	return nil
 }
@@ -1,7 +1,9 @@
 package bdls
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"testing"
 	"time"
@@ -43,3 +45,99 @@ func TestVerifyConfig(t *testing.T) {
 	err = VerifyConfig(config)
 	assert.Nil(t, err)
 }
+
+type rsaLikeSigner struct{ crypto.Signer }
+
+func (rsaLikeSigner) Public() crypto.PublicKey { return "not an ecdsa key" }
+
+func TestVerifyConfigSigner(t *testing.T) {
+	config := new(Config)
+	config.Epoch = time.Now()
+	config.StateCompare = func(State, State) int { return 0 }
+	config.StateValidate = func(State) bool { return true }
+	for i := 0; i < ConfigMinimumParticipants; i++ {
+		randKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&randKey.PublicKey))
+	}
+
+	config.Signer = rsaLikeSigner{}
+	assert.Equal(t, ErrConfigSigner, VerifyConfig(config))
+
+	randKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	config.Signer = randKey
+	assert.Nil(t, VerifyConfig(config))
+
+	c, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPubKeyToIdentity(&randKey.PublicKey), c.identity)
+	assert.Equal(t, elliptic.P256(), c.curve)
+}
+
+func TestVerifyConfigCurve(t *testing.T) {
+	newConfig := func(curve elliptic.Curve) *Config {
+		config := new(Config)
+		config.Epoch = time.Now()
+		config.StateCompare = func(State, State) int { return 0 }
+		config.StateValidate = func(State) bool { return true }
+		for i := 0; i < ConfigMinimumParticipants; i++ {
+			randKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+			assert.Nil(t, err)
+			config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&randKey.PublicKey))
+			config.PrivateKey = randKey
+		}
+		config.Curve = curve
+		return config
+	}
+
+	for _, curve := range []elliptic.Curve{S256Curve, P256Curve} {
+		config := newConfig(curve)
+		assert.Nil(t, VerifyConfig(config))
+		c, err := NewConsensus(config)
+		assert.Nil(t, err)
+		assert.Equal(t, curve, c.Curve())
+	}
+
+	// unsupported curve
+	config := newConfig(P256Curve)
+	config.Curve = elliptic.P384()
+	assert.Equal(t, ErrConfigCurve, VerifyConfig(config))
+
+	// the private key is on another curve
+	config = newConfig(P256Curve)
+	config.Curve = S256Curve
+	assert.Equal(t, ErrConfigCurveMismatch, VerifyConfig(config))
+
+	// a participant is on another curve
+	config = newConfig(P256Curve)
+	randKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	config.Participants[0] = DefaultPubKeyToIdentity(&randKey.PublicKey)
+	assert.Equal(t, ErrConfigParticipantCurve, VerifyConfig(config))
+
+	// identities derived by PubKeyToIdentity may not be coordinates
+	config.PubKeyToIdentity = DefaultPubKeyToIdentity
+	assert.Nil(t, VerifyConfig(config))
+}
+
+func TestCurveByName(t *testing.T) {
+	for _, testCase := range []struct {
+		name  string
+		curve elliptic.Curve
+	}{
+		{name: "", curve: S256Curve},
+		{name: CurveSecp256k1, curve: S256Curve},
+		{name: CurveP256, curve: P256Curve},
+	} {
+		curve, err := CurveByName(testCase.name)
+		assert.Nil(t, err)
+		assert.Equal(t, testCase.curve, curve)
+		assert.NotEmpty(t, CurveName(curve))
+	}
+
+	_, err := CurveByName("P-384")
+	assert.Equal(t, ErrConfigCurve, err)
+	assert.Empty(t, CurveName(elliptic.P384()))
+	assert.Empty(t, CurveName(nil))
+}
@@ -33,6 +33,7 @@ package bdls
 import (
 	"bytes"
 	"container/list"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"net"
@@ -47,6 +48,9 @@ const (
 	// ProtocolVersion is the current BDLS protocol implementation version,
 	// version wil be sent along with messages for protocol upgrading.
 	ProtocolVersion = 1
+	// ProtocolVersionAggregate is the version of the messages carrying
+	// aggregate proofs, see AggregateProof.
+	ProtocolVersionAggregate = 2
 	// DefaultConsensusLatency is the default propagation latency setting for
 	// consensus protocol, user can adjust consensus object's latency setting
 	// via Consensus.SetLatency()
@@ -80,6 +84,21 @@ const (
 	stageLockRelease
 )
 
+// String returns the name of the stage
+func (s consensusStage) String() string {
+	switch s {
+	case stageRoundChanging:
+		return "roundchange"
+	case stageLock:
+		return "lock"
+	case stageCommit:
+		return "commit"
+	case stageLockRelease:
+		return "lockrelease"
+	}
+	return "unknown"
+}
+
 // messageTuple contains a state hash, a decoded incoming message
 // and it's encoded raw message with a signature.
 type messageTuple struct {
@@ -112,6 +131,7 @@ type consensusRound struct {
 	LockedStateHash StateHash      // hash of the leaders's locked state
 	RoundChangeSent bool           // mark if the <roundchange> message of this round has sent
 	CommitSent      bool           // mark if this round has sent commit message once
+	Withheld        bool           // mark if a pipelined <roundchange> of this round became invalid
 
 	// NOTE: we MUST keep the original message, to re-marshal the message may
 	// result in different BITS LAYOUT, and different hash of course.
@@ -300,6 +320,13 @@ type Consensus struct {
 	messageValidator func(c *Consensus, m *Message, sp *SignedProto) bool
 	// message out callback
 	messageOutCallback func(m *Message, sp *SignedProto)
+	// evidence callback
+	evidenceCallback func(e *Evidence)
+	// signatures verified before
+	verifyCache *verifyCache
+	// the latest messages signed by participants at next height,
+	// to detect equivocations
+	signedRecords map[signedKey]*signedRecord
 	// public key to identity function
 	pubKeyToIdentity func(pubkey *ecdsa.PublicKey) Identity
 
@@ -308,6 +335,10 @@ type Consensus struct {
 
 	// private key
 	privateKey *ecdsa.PrivateKey
+	// signer to use in place of private key
+	signer crypto.Signer
+	// my public key
+	publicKey *ecdsa.PublicKey
 	// my publickey coodinate
 	identity Identity
 	// curve retrieved from private key
@@ -315,19 +346,43 @@ type Consensus struct {
 
 	// transmission delay
 	latency time.Duration
+	// base durations of the stages of rounds
+	timeouts Timeouts
+	// estimates the latency from the delays of <roundchange> quorums,
+	// since heightStart, and adjusts latency if enabled
+	latencyEstimator      latencyEstimator
+	heightStart           time.Time
+	enableAdaptiveLatency bool
 
 	// all connected peers
 	peers []PeerInterface
 
-	// participants is the consensus group, current leader is r % quorum
+	// participants is the consensus group, the leader of each round is
+	// elected among them
 	participants []Identity
 
+	// the leader election of rounds, seeded with the hash of latestState
+	leaderElection LeaderElection
+	leaderSeed     StateHash
+
 	// count num of individual identities
 	numIdentities int
 
 	// set to true to enable <commit> message unicast
 	enableCommitUnicast bool
 
+	// set to true to combine proofs into aggregate proofs
+	enableAggregateProof bool
+
+	// set to true to pipeline the <roundchange> messages of the height after next
+	enablePipelining bool
+	// data awaiting to be confirmed at the height after next
+	nextUnconfirmed []State
+	// <roundchange> messages received for the height after next
+	pipelined []pipelinedMessage
+	// mark if the <roundchange> message of the height after next has been sent
+	nextRoundChangeSent bool
+
 	// NOTE: fixed leader for testing purpose
 	fixedLeader *Identity
 
@@ -353,29 +408,92 @@ func NewConsensus(config *Config) (*Consensus, error) {
 	return c, nil
 }
 
+// RestoreConsensus creates a BDLS consensus object like NewConsensus does, and
+// replays the signed messages logged before a restart, in their logged order,
+// to restore the locks it had at the next height. Logged messages which are no
+// longer valid, e.g. for heights already confirmed, are skipped.
+// The consensus resumes from the given round if the replay does not reach it.
+func RestoreConsensus(config *Config, round uint64, logged [][]byte, now time.Time) (*Consensus, error) {
+	c, err := NewConsensus(config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bts := range logged {
+		// NOTE: stale messages are expected to be rejected.
+		_ = c.ReceiveMessage(bts, now)
+	}
+
+	// never go back to a round prior to the restart
+	if round > c.currentRound.RoundNumber {
+		c.switchRound(round)
+		c.currentRound.Stage = stageRoundChanging
+		c.broadcastRoundChange()
+		c.rcTimeout = now.Add(c.roundchangeDuration(round))
+	}
+	return c, nil
+}
+
 // init consensus with config
 func (c *Consensus) init(config *Config) {
 	// setting current state & height
 	c.latestHeight = config.CurrentHeight
+	c.latestState = config.CurrentState
 	c.participants = config.Participants
 	c.stateCompare = config.StateCompare
 	c.stateValidate = config.StateValidate
 	c.messageValidator = config.MessageValidator
 	c.messageOutCallback = config.MessageOutCallback
+	c.evidenceCallback = config.EvidenceCallback
 	c.privateKey = config.PrivateKey
+	c.signer = config.Signer
 	c.pubKeyToIdentity = config.PubKeyToIdentity
 	c.enableCommitUnicast = config.EnableCommitUnicast
+	c.enableAggregateProof = config.EnableAggregateProof
+	c.enablePipelining = config.EnablePipelining
+	c.leaderElection = config.LeaderElection
+	c.timeouts = config.Timeouts
+	c.enableAdaptiveLatency = config.EnableAdaptiveLatency
+	c.latencyEstimator.min = config.MinLatency
+	if c.latencyEstimator.min == 0 {
+		c.latencyEstimator.min = DefaultMinLatency
+	}
+	c.latencyEstimator.max = config.MaxLatency
+	if c.latencyEstimator.max == 0 {
+		c.latencyEstimator.max = DefaultMaxLatency
+	}
+
+	switch {
+	case config.VerifyCacheSize == 0:
+		c.verifyCache = newVerifyCache(DefaultVerifyCacheSize)
+	case config.VerifyCacheSize > 0:
+		c.verifyCache = newVerifyCache(config.VerifyCacheSize)
+	}
 
 	// if config has not set hash function, use the default
 	if c.stateHash == nil {
 		c.stateHash = defaultHash
 	}
+	// if config has not set leader election, use the default
+	if c.leaderElection == nil {
+		c.leaderElection = RoundRobinLeader{}
+	}
+	c.leaderSeed = c.stateHash(c.latestState)
 	// if config has not set public key to identity function, use the default
 	if c.pubKeyToIdentity == nil {
 		c.pubKeyToIdentity = DefaultPubKeyToIdentity
 	}
-	c.identity = c.pubKeyToIdentity(&c.privateKey.PublicKey)
-	c.curve = c.privateKey.Curve
+	// signer takes precedence over private key
+	if c.signer != nil {
+		c.publicKey = c.signer.Public().(*ecdsa.PublicKey)
+	} else {
+		c.publicKey = &c.privateKey.PublicKey
+	}
+	c.identity = c.pubKeyToIdentity(c.publicKey)
+	c.curve = config.Curve
+	if c.curve == nil {
+		c.curve = c.publicKey.Curve
+	}
 
 	// initial default parameters settings
 	c.latency = DefaultConsensusLatency
@@ -397,47 +515,27 @@ func (c *Consensus) init(config *Config) {
 
 //  calculates roundchangeDuration
 func (c *Consensus) roundchangeDuration(round uint64) time.Duration {
-	d := 2 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
-	}
-	return d
+	return c.stageDuration(c.timeouts.RoundChange, 2, round)
 }
 
 //  calculates collectDuration
 func (c *Consensus) collectDuration(round uint64) time.Duration {
-	d := 2 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
-	}
-	return d
+	return c.stageDuration(c.timeouts.Collect, 2, round)
 }
 
 //  calculates lockDuration
 func (c *Consensus) lockDuration(round uint64) time.Duration {
-	d := 4 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
-	}
-	return d
+	return c.stageDuration(c.timeouts.Lock, 4, round)
 }
 
 // calculates commitDuration
 func (c *Consensus) commitDuration(round uint64) time.Duration {
-	d := 2 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
-	}
-	return d
+	return c.stageDuration(c.timeouts.Commit, 2, round)
 }
 
 // calculates lockReleaseDuration
 func (c *Consensus) lockReleaseDuration(round uint64) time.Duration {
-	d := 2 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
-	}
-	return d
+	return c.stageDuration(c.timeouts.LockRelease, 2, round)
 }
 
 // maximalLocked finds the maximum locked data in this round,
@@ -507,7 +605,7 @@ func (c *Consensus) verifyMessage(signed *SignedProto) (*Message, error) {
 	*/
 
 	// as public key is proven , we don't have to verify the public key
-	if !signed.Verify(c.curve) {
+	if !c.verifySignature(signed) {
 		return nil, ErrMessageSignature
 	}
 
@@ -517,6 +615,16 @@ func (c *Consensus) verifyMessage(signed *SignedProto) (*Message, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// the version signed must match the proofs carried
+	if signed.Version != messageVersion(m) {
+		return nil, ErrMessageVersion
+	}
+
+	// proofs in aggregate proofs are verified as the others
+	if err := c.expandProofs(m); err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
@@ -826,7 +934,7 @@ func DecodeMessage(bts []byte) (*Message, error) {
 // the consensus core must be correctly initialized to validate.
 func (c *Consensus) validateDecideMessage(signed *SignedProto, targetState []byte) error {
 	// check message version
-	if signed.Version != ProtocolVersion {
+	if !supportedVersion(signed.Version) {
 		return ErrMessageVersion
 	}
 
@@ -854,6 +962,8 @@ func (c *Consensus) validateDecideMessage(signed *SignedProto, targetState []byt
 
 // verifyDecideMessage verifies proofs from <decide> message, which MUST
 // contain at least 2t+1 individual <commit> messages to B'.
+// The proofs combined in aggregate proofs have been expanded into m.Proof
+// by verifyMessage, and are counted as the others.
 func (c *Consensus) verifyDecideMessage(m *Message, signed *SignedProto) error {
 	// a <decide> message from leader MUST include data along with the message
 	if m.State == nil {
@@ -870,10 +980,14 @@ func (c *Consensus) verifyDecideMessage(m *Message, signed *SignedProto) error {
 		return ErrDecideHeightLower
 	}
 
-	// make sure this message has been signed by the leader
-	leaderKey := c.roundLeader(m.Round)
-	if c.pubKeyToIdentity(signed.PublicKey(c.curve)) != leaderKey {
-		return ErrDecideNotSignedByLeader
+	// make sure this message has been signed by the leader, the leaders of
+	// the heights beyond the next one are elected from states not decided
+	// here yet, so only the <commit> proofs can be verified for them.
+	if m.Height == c.latestHeight+1 || c.fixedLeader != nil {
+		leaderKey := c.roundLeader(m.Round)
+		if c.pubKeyToIdentity(signed.PublicKey(c.curve)) != leaderKey {
+			return ErrDecideNotSignedByLeader
+		}
 	}
 
 	commits := make(map[Identity]State)
@@ -939,6 +1053,23 @@ func (c *Consensus) broadcastRoundChange() {
 		return
 	}
 
+	// a pipelined <roundchange> has been signed for this round already,
+	// signing another one would be an equivocation.
+	if c.currentRound.Withheld {
+		return
+	}
+
+	// a <roundchange> is signed once per round, even if the locked or
+	// unconfirmed data has changed since, the one sent is sent again.
+	if signed := c.sentRoundChange(); signed != nil {
+		bts, err := proto.Marshal(signed)
+		if err != nil {
+			panic(err)
+		}
+		c.propagate(bts)
+		return
+	}
+
 	// first we need to check if there is any locked data,
 	// locked data must be sent if there is any.
 	data := c.maximalLocked()
@@ -961,6 +1092,18 @@ func (c *Consensus) broadcastRoundChange() {
 	//log.Println("broadcast:<roundchange>")
 }
 
+// sentRoundChange returns the <roundchange> this participant has
+// signed in current round, or nil if there is none.
+func (c *Consensus) sentRoundChange() *SignedProto {
+	for k := range c.currentRound.roundChanges {
+		signed := c.currentRound.roundChanges[k].Signed
+		if c.pubKeyToIdentity(signed.PublicKey(c.curve)) == c.identity {
+			return signed
+		}
+	}
+	return nil
+}
+
 // broadcastLock will broadcast <lock> messages on current round,
 // the currentRound should have a chosen data in this round.
 func (c *Consensus) broadcastLock() {
@@ -969,7 +1112,7 @@ func (c *Consensus) broadcastLock() {
 	m.Height = c.latestHeight + 1
 	m.Round = c.currentRound.RoundNumber
 	m.State = c.currentRound.LockedState
-	m.Proof = c.currentRound.SignedRoundChanges()
+	c.setProofs(&m, c.currentRound.SignedRoundChanges())
 	c.broadcast(&m)
 	//log.Println("broadcast:<lock>")
 }
@@ -993,7 +1136,7 @@ func (c *Consensus) broadcastSelect() {
 	m.Height = c.latestHeight + 1
 	m.Round = c.currentRound.RoundNumber
 	m.State = c.maximalUnconfirmed() // B' may be NULL
-	m.Proof = c.currentRound.SignedRoundChanges()
+	c.setProofs(&m, c.currentRound.SignedRoundChanges())
 	c.broadcast(&m)
 	//log.Println("broadcast:<select>", m.State)
 }
@@ -1006,7 +1149,7 @@ func (c *Consensus) broadcastDecide() *SignedProto {
 	m.Height = c.latestHeight + 1
 	m.Round = c.currentRound.RoundNumber
 	m.State = c.currentRound.LockedState
-	m.Proof = c.currentRound.SignedCommits()
+	c.setProofs(&m, c.currentRound.SignedCommits())
 	return c.broadcast(&m)
 	//log.Println("broadcast:<decide>")
 }
@@ -1047,12 +1190,24 @@ func (c *Consensus) sendCommit(msgLock *Message) {
 	//log.Println("send:<commit>")
 }
 
+// sign signs the message with the signer if set, or with the private key.
+func (c *Consensus) sign(m *Message) *SignedProto {
+	sp := new(SignedProto)
+	sp.Version = messageVersion(m)
+	if c.signer != nil {
+		if err := sp.SignWithSigner(m, c.signer); err != nil {
+			panic(err)
+		}
+		return sp
+	}
+	sp.Sign(m, c.privateKey)
+	return sp
+}
+
 // broadcast signs the message with private key before broadcasting to all peers.
 func (c *Consensus) broadcast(m *Message) *SignedProto {
 	// sign
-	sp := new(SignedProto)
-	sp.Version = ProtocolVersion
-	sp.Sign(m, c.privateKey)
+	sp := c.sign(m)
 
 	// message callback
 	if c.messageOutCallback != nil {
@@ -1077,9 +1232,7 @@ func (c *Consensus) broadcast(m *Message) *SignedProto {
 // sendTo signs the message with private key before transmitting to the peer.
 func (c *Consensus) sendTo(m *Message, leader Identity) {
 	// sign
-	sp := new(SignedProto)
-	sp.Version = ProtocolVersion
-	sp.Sign(m, c.privateKey)
+	sp := c.sign(m)
 
 	// message callback
 	if c.messageOutCallback != nil {
@@ -1172,13 +1325,13 @@ func (c *Consensus) lockRelease() {
 // and all lower rounds will be cleared while switching.
 func (c *Consensus) switchRound(round uint64) { c.currentRound = c.getRound(round, true) }
 
-// roundLeader returns leader's identity for a given round
+// roundLeader returns leader's identity for a given round at next height
 func (c *Consensus) roundLeader(round uint64) Identity {
 	// NOTE: fixed leader is for testing
 	if c.fixedLeader != nil {
 		return *c.fixedLeader
 	}
-	return c.participants[int(round)%len(c.participants)]
+	return c.leaderElection.Leader(c.participants, c.latestHeight+1, round, c.leaderSeed)
 }
 
 // heightSync changes current height to the given height with state
@@ -1187,14 +1340,27 @@ func (c *Consensus) heightSync(height uint64, round uint64, s State, now time.Ti
 	c.latestHeight = height // set height
 	c.latestRound = round   // set round
 	c.latestState = s       // set state
+	c.leaderSeed = c.stateHash(s) // seed leader election
 
 	c.currentRound = nil         // clean current round pointer
 	c.lastRoundChangeProof = nil // clean round change proof
 	c.rounds.Init()              // clean all round
 	c.locks = nil                // clean locks
 	c.unconfirmed = nil          // clean all unconfirmed states from previous heights
+	c.signedRecords = nil        // clean messages signed at previous heights
 	c.switchRound(0)             // start new round at new height
 	c.currentRound.Stage = stageRoundChanging
+
+	// replay what was pipelined for the new height
+	pipelined := len(c.pipelined) > 0
+	c.shiftPipeline(now)
+
+	// the latency is sampled unless messages of this height
+	// were received ahead of it
+	c.heightStart = time.Time{}
+	if !pipelined {
+		c.heightStart = now
+	}
 }
 
 // t calculates (n-1)/3
@@ -1243,7 +1409,7 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 	}
 
 	// check message version
-	if signed.Version != ProtocolVersion {
+	if !supportedVersion(signed.Version) {
 		return ErrMessageVersion
 	}
 
@@ -1260,6 +1426,16 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		}
 	}
 
+	// any validly signed message may conflict with another
+	c.detectEquivocation(m, signed)
+
+	// <roundchange> messages of the height after next are replayed once
+	// the next height is decided
+	if c.isPipelined(m) {
+		c.keepPipelined(signed, m, bts)
+		return nil
+	}
+
 	// message switch
 	switch m.Type {
 	case MessageType_Nop:
@@ -1326,6 +1502,11 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 			// Example: P sends r+1 to remove from r, and sends to r again to trigger 2t+1 once
 			// more to reset timeout.
 			if round.NumRoundChanges() == 2*c.t()+1 && round.Stage < stageLock {
+				// the delay of the quorum at round 0 samples the latency
+				if m.Round == 0 {
+					c.observeLatency(now)
+				}
+
 				// switch to this round
 				c.switchRound(m.Round)
 				// record this round change proof for resyncing
@@ -1420,6 +1601,8 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		// for any incoming <lock,h,r,B'> message with r=r', sendCommit will send
 		// <commit,h,r',B'> once.
 		c.sendCommit(m)
+		// with pipelining, the height after next starts along with the commit
+		c.broadcastNextRoundChange()
 
 	case MessageType_LockRelease:
 		// verifies the LockRelease field in message.
@@ -1598,6 +1781,9 @@ func (c *Consensus) Update(now time.Time) error {
 			panic("commit stage entered, but commitTimout not set")
 		}
 
+		// states may be proposed for the height after next meanwhile
+		c.broadcastNextRoundChange()
+
 		if now.After(c.commitTimeout) {
 			c.currentRound.Stage = stageLockRelease
 			c.lockReleaseTimeout = now.Add(c.lockReleaseDuration(c.currentRound.RoundNumber))
@@ -1629,6 +1815,79 @@ func (c *Consensus) CurrentState() (height uint64, round uint64, data State) {
 // CurrentProof returns current <decide> message for current height
 func (c *Consensus) CurrentProof() *SignedProto { return c.latestProof }
 
+// CurrentRound returns the round the consensus is working on at the next height.
+func (c *Consensus) CurrentRound() uint64 { return c.currentRound.RoundNumber }
+
+// Curve returns the elliptic curve the messages are signed with.
+func (c *Consensus) Curve() elliptic.Curve { return c.curve }
+
+// CurrentStage returns the name of the stage of the current round, one of
+// roundchange, lock, commit and lockrelease.
+func (c *Consensus) CurrentStage() string { return c.currentRound.Stage.String() }
+
+// SetParticipants changes the consensus group at a decided height boundary,
+// the height must be the latest confirmed height, so that every participant
+// switches to the new group from the same height on. The next height restarts
+// at round 0 with the new group, discarding the messages collected from the
+// previous group, and the <roundchange> of this participant is sent again.
+func (c *Consensus) SetParticipants(height uint64, participants []Identity, now time.Time) error {
+	if height != c.latestHeight {
+		return ErrParticipantsHeight
+	}
+	if len(participants) < ConfigMinimumParticipants {
+		return ErrConfigParticipants
+	}
+
+	c.participants = participants
+	// count number of individual identites
+	ids := make(map[Identity]bool)
+	for _, id := range c.participants {
+		ids[id] = true
+	}
+	c.numIdentities = len(ids)
+
+	c.lastRoundChangeProof = nil
+	c.rounds.Init()
+	c.locks = nil
+	c.pipelined = nil
+	c.switchRound(0)
+	c.currentRound.Stage = stageRoundChanging
+	c.broadcastRoundChange()
+	c.rcTimeout = now.Add(c.roundchangeDuration(0))
+	return nil
+}
+
+// SetLeaderElection changes the leader election of rounds, every participant
+// must change it at the same decided height, before the next height is decided.
+func (c *Consensus) SetLeaderElection(e LeaderElection) { c.leaderElection = e }
+
+// SyncDecided moves the consensus to the height decided by a <decide> message
+// obtained out of band, e.g. along with a decided block fetched from other
+// participants by a participant which lagged behind. The message is validated
+// by ValidateDecideMessage against the state it carries, then the participant
+// rejoins at the next height with a new <roundchange>.
+func (c *Consensus) SyncDecided(bts []byte, now time.Time) error {
+	signed, err := DecodeSignedMessage(bts)
+	if err != nil {
+		return err
+	}
+	m, err := DecodeMessage(signed.Message)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ValidateDecideMessage(bts, m.State); err != nil {
+		return err
+	}
+
+	// record this proof for chaining
+	c.latestProof = signed
+	c.heightSync(m.Height, m.Round, m.State, now)
+	c.rcTimeout = now.Add(c.roundchangeDuration(0))
+	c.broadcastRoundChange()
+	return nil
+}
+
 // SetLatency sets participants expected latency for consensus core
 func (c *Consensus) SetLatency(latency time.Duration) { c.latency = latency }
 
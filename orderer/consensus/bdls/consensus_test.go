@@ -1110,3 +1110,114 @@ func testConsensus(t *testing.T, param *testParam) []string {
 	}
 
 }
+
+func TestRestoreConsensus(t *testing.T) {
+	m, sp, leaderKey, proofKeys := createLockMessage(t, 4, 1, 5, 1, 5)
+	lock, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	config := new(Config)
+	config.Epoch = time.Now()
+	config.CurrentHeight = 0
+	config.PrivateKey = privateKey
+	config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a State) bool { return true }
+	// the leader of round 5 is participants[0]
+	config.Participants = []Identity{DefaultPubKeyToIdentity(&leaderKey.PublicKey)}
+	for _, pubkey := range proofKeys[1:] {
+		config.Participants = append(config.Participants, DefaultPubKeyToIdentity(pubkey))
+	}
+	config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+
+	// stale or malformed messages are skipped
+	_, staleCommit, _ := createCommitMessage(t, 0, 0, m.State)
+	stale, err := proto.Marshal(staleCommit)
+	assert.Nil(t, err)
+
+	consensus, err := RestoreConsensus(config, 2, [][]byte{[]byte("malformed"), stale, lock}, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), consensus.currentRound.RoundNumber)
+	assert.Equal(t, 1, len(consensus.locks))
+	assert.Equal(t, State(m.State), consensus.maximalLocked())
+	assert.True(t, consensus.currentRound.CommitSent)
+
+	// resumes from the logged round
+	consensus, err = RestoreConsensus(config, 7, nil, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), consensus.CurrentRound())
+	assert.Equal(t, stageRoundChanging, consensus.currentRound.Stage)
+	assert.Equal(t, 0, len(consensus.locks))
+
+	_, err = RestoreConsensus(new(Config), 0, nil, time.Now())
+	assert.Equal(t, ErrConfigEpoch, err)
+}
+
+func TestSetParticipants(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var quorum []*ecdsa.PublicKey
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		quorum = append(quorum, &privateKey.PublicKey)
+	}
+	consensus := createConsensus(t, 1, 3, quorum)
+
+	// a <roundchange> of a participant being removed
+	_, rc, _ := createRoundChangeMessageSigner(t, 2, 3, nil, keys[3])
+	bts, err := proto.Marshal(rc)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+
+	participants := consensus.participants[:4]
+	assert.Equal(t, ErrParticipantsHeight, consensus.SetParticipants(2, participants, time.Now()))
+	assert.Equal(t, ErrConfigParticipants, consensus.SetParticipants(1, participants[:3], time.Now()))
+
+	now := time.Now()
+	assert.Nil(t, consensus.SetParticipants(1, participants, now))
+	assert.Equal(t, 4, consensus.numIdentities)
+	assert.Equal(t, uint64(0), consensus.CurrentRound())
+	assert.Equal(t, stageRoundChanging, consensus.currentRound.Stage)
+	assert.Equal(t, 1, consensus.rounds.Len())
+	assert.Equal(t, now.Add(consensus.roundchangeDuration(0)), consensus.rcTimeout)
+
+	// the removed participant is no longer accepted
+	assert.Equal(t, ErrMessageUnknownParticipant, consensus.ReceiveMessage(bts, time.Now()))
+}
+
+func TestSyncDecided(t *testing.T) {
+	m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 10, 2, 10, 2)
+	consensus := createConsensus(t, 7, 1, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+
+	// a tampered <decide> is rejected
+	tampered := &Message{Type: m.Type, Height: m.Height, Round: m.Round, State: m.State, Proof: m.Proof[:1]}
+	forged := new(SignedProto)
+	forged.Sign(tampered, privateKey)
+	forgedBts, err := proto.Marshal(forged)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDecideProofInsufficient, consensus.SyncDecided(forgedBts, time.Now()))
+	height, _, _ := consensus.CurrentState()
+	assert.Equal(t, uint64(7), height)
+
+	now := time.Now()
+	assert.Nil(t, consensus.SyncDecided(bts, now))
+	height, round, state := consensus.CurrentState()
+	assert.Equal(t, uint64(10), height)
+	assert.Equal(t, uint64(2), round)
+	assert.Equal(t, State(m.State), state)
+	assert.Equal(t, sp.Message, consensus.CurrentProof().Message)
+	assert.Equal(t, uint64(0), consensus.CurrentRound())
+	assert.Equal(t, stageRoundChanging, consensus.currentRound.Stage)
+	assert.Equal(t, "roundchange", consensus.CurrentStage())
+	assert.Equal(t, now.Add(consensus.roundchangeDuration(0)), consensus.rcTimeout)
+
+	// the same height cannot be synced twice
+	assert.Equal(t, ErrDecideHeightLower, consensus.SyncDecided(bts, time.Now()))
+}
@@ -0,0 +1,100 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+)
+
+const (
+	// CurveSecp256k1 names the secp256k1 elliptic curve, the default curve of BDLS
+	CurveSecp256k1 = "secp256k1"
+	// CurveP256 names the NIST P-256 elliptic curve, the curve of most Fabric MSP identities
+	CurveP256 = "P-256"
+)
+
+// P256Curve is the NIST P-256 elliptic curve
+var P256Curve elliptic.Curve = elliptic.P256()
+
+// CurveByName returns the supported elliptic curve with the given name,
+// secp256k1 if the name is empty.
+func CurveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case "", CurveSecp256k1:
+		return S256Curve, nil
+	case CurveP256:
+		return P256Curve, nil
+	}
+	return nil, ErrConfigCurve
+}
+
+// CurveName returns the name of a supported elliptic curve,
+// or an empty string if the curve is not supported.
+func CurveName(curve elliptic.Curve) string {
+	if curve == nil {
+		return ""
+	}
+	// the parameters of secp256k1 are not named
+	switch params := curve.Params(); {
+	case params == S256Curve.Params():
+		return CurveSecp256k1
+	case params.Name == P256Curve.Params().Name:
+		return CurveP256
+	}
+	return ""
+}
+
+// verifyCurve checks that the curve is supported, that the key of this
+// participant is on it, and that the participants are, as long as their
+// identities are the coordinates of their public keys.
+func verifyCurve(config *Config, publicKey *ecdsa.PublicKey) error {
+	name := CurveName(config.Curve)
+	if name == "" {
+		return ErrConfigCurve
+	}
+	if CurveName(publicKey.Curve) != name {
+		return ErrConfigCurveMismatch
+	}
+
+	if config.PubKeyToIdentity != nil {
+		return nil
+	}
+	for _, id := range config.Participants {
+		x := new(big.Int).SetBytes(id[:SizeAxis])
+		y := new(big.Int).SetBytes(id[SizeAxis:])
+		if !config.Curve.IsOnCurve(x, y) {
+			return ErrConfigParticipantCurve
+		}
+	}
+	return nil
+}
@@ -39,8 +39,25 @@ var (
 	ErrConfigStateCompare       = errors.New("Config.StateCompare function has not set")
 	ErrConfigStateValidate      = errors.New("Config.StateValidate function has not set")
 	ErrConfigPrivateKey         = errors.New("Config.PrivateKey has not set")
+	ErrConfigSigner             = errors.New("Config.Signer must have an ecdsa public key")
 	ErrConfigParticipants       = errors.New("Config.Participants must contain at least 4 participants")
 	ErrConfigPubKeyToCoordinate = errors.New("Config.must contain at least 4 participants")
+	ErrConfigCurve              = errors.New("Config.Curve is not a supported curve")
+	ErrConfigCurveMismatch      = errors.New("Config.Curve differs from the curve of the private key")
+	ErrConfigParticipantCurve   = errors.New("Config.Participants contains a public key not on Config.Curve")
+	ErrConfigTimeouts           = errors.New("Config.Timeouts has a negative duration or a duration above MaxBackoff")
+	ErrConfigLatencyBounds      = errors.New("Config.MinLatency and Config.MaxLatency must be within 0 and MaxConsensusLatency, in order")
+
+	// membership related
+	ErrParticipantsHeight = errors.New("participants can only be changed at the latest confirmed height")
+
+	// evidence related
+	ErrEvidenceIncomplete = errors.New("the evidence does not contain two signed messages")
+	ErrEvidenceSigners    = errors.New("the messages of the evidence are signed by different participants")
+	ErrEvidenceSignature  = errors.New("cannot verify the signatures of the evidence")
+	ErrEvidenceMismatch   = errors.New("the messages of the evidence differ in type, height or round")
+	ErrEvidenceType       = errors.New("the messages of the evidence are of a type which cannot conflict")
+	ErrEvidenceNoConflict = errors.New("the messages of the evidence have the same state")
 
 	// common errors related to every message
 	ErrMessageVersion            = errors.New("the message has different version")
@@ -108,4 +125,12 @@ var (
 
 	// <decide> verification
 	ErrMismatchedTargetState = errors.New("the state in <decide> message does not match the provided target state")
+
+	// snapshot related
+	ErrSnapshotIdentity     = errors.New("the snapshot was taken by another participant")
+	ErrSnapshotCurrentRound = errors.New("the current round is missing in the snapshot")
+
+	// aggregate proofs related
+	ErrAggregateProofSigners    = errors.New("the aggregate proof has signers out of the participants")
+	ErrAggregateProofSignatures = errors.New("the aggregate proof has mismatched signatures to its signers")
 )
@@ -0,0 +1,194 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/json"
+)
+
+// Evidence proves that a participant has equivocated, by carrying two messages
+// it signed for the same height and round, of the same type but with different
+// states. Only conflicting <roundchange>, <lock> and <commit> messages are
+// evidence, as these are signed once per round by a correct participant.
+//
+// Evidence is self-contained, anyone can verify it from the signed messages.
+type Evidence struct {
+	First  *SignedProto
+	Second *SignedProto
+}
+
+// evidenceJSON is the serialized form of Evidence, the signed
+// messages are kept in their original encoding.
+type evidenceJSON struct {
+	First  []byte
+	Second []byte
+}
+
+// Marshal serializes the evidence.
+func (e *Evidence) Marshal() ([]byte, error) {
+	var ej evidenceJSON
+	var err error
+	if ej.First, err = e.First.Marshal(); err != nil {
+		return nil, err
+	}
+	if ej.Second, err = e.Second.Marshal(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(&ej)
+}
+
+// DecodeEvidence decodes the evidence serialized by Evidence.Marshal.
+func DecodeEvidence(bts []byte) (*Evidence, error) {
+	var ej evidenceJSON
+	if err := json.Unmarshal(bts, &ej); err != nil {
+		return nil, err
+	}
+	first, err := DecodeSignedMessage(ej.First)
+	if err != nil {
+		return nil, err
+	}
+	second, err := DecodeSignedMessage(ej.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &Evidence{First: first, Second: second}, nil
+}
+
+// Verify verifies that the messages of the evidence are signed by the same
+// participant with the given curve, and that they conflict with each other.
+// It returns the first message of the evidence.
+func (e *Evidence) Verify(curve elliptic.Curve) (*Message, error) {
+	if e.First == nil || e.Second == nil {
+		return nil, ErrEvidenceIncomplete
+	}
+	if e.First.X != e.Second.X || e.First.Y != e.Second.Y {
+		return nil, ErrEvidenceSigners
+	}
+	if !e.First.Verify(curve) || !e.Second.Verify(curve) {
+		return nil, ErrEvidenceSignature
+	}
+
+	first, err := DecodeMessage(e.First.Message)
+	if err != nil {
+		return nil, err
+	}
+	second, err := DecodeMessage(e.Second.Message)
+	if err != nil {
+		return nil, err
+	}
+	if first.Type != second.Type || first.Height != second.Height || first.Round != second.Round {
+		return nil, ErrEvidenceMismatch
+	}
+	if !canEquivocate(first.Type) {
+		return nil, ErrEvidenceType
+	}
+	if bytes.Equal(first.State, second.State) {
+		return nil, ErrEvidenceNoConflict
+	}
+	return first, nil
+}
+
+// canEquivocate checks if a message of the given type is signed
+// only once per round by a correct participant.
+func canEquivocate(t MessageType) bool {
+	switch t {
+	case MessageType_RoundChange, MessageType_Lock, MessageType_Commit:
+		return true
+	}
+	return false
+}
+
+// signedKey identifies the messages of a type signed by a participant.
+type signedKey struct {
+	identity Identity
+	msgType  MessageType
+}
+
+// signedRecord is the latest message of a type signed by a participant.
+type signedRecord struct {
+	tuple    messageTuple
+	reported bool // set once an evidence of this round has been reported
+}
+
+// detectEquivocation keeps the latest <roundchange>, <lock> and <commit> messages
+// signed by each participant at next height, and reports an evidence the first
+// time a participant signs another message of the same type for the same round
+// with a different state. Messages of lower rounds are not compared, so that
+// the records are bounded by the number of participants.
+//
+// The proofs carried by a message are compared too, as an equivocating
+// participant may send different states to different participants.
+func (c *Consensus) detectEquivocation(m *Message, signed *SignedProto) {
+	if c.evidenceCallback == nil {
+		return
+	}
+
+	c.compareSigned(m, signed, true)
+	for _, proof := range m.Proof {
+		if mProof, err := DecodeMessage(proof.Message); err == nil {
+			c.compareSigned(mProof, proof, false)
+		}
+	}
+}
+
+// compareSigned compares a signed message with the record of its signer,
+// unverified messages are only verified when they conflict with the record,
+// and they never replace it.
+func (c *Consensus) compareSigned(m *Message, signed *SignedProto, verified bool) {
+	if m.Height != c.latestHeight+1 || !canEquivocate(m.Type) {
+		return
+	}
+
+	key := signedKey{identity: c.pubKeyToIdentity(signed.PublicKey(c.curve)), msgType: m.Type}
+	stateHash := c.stateHash(m.State)
+	record, exists := c.signedRecords[key]
+	if !exists || m.Round > record.tuple.Message.Round {
+		if !verified {
+			return
+		}
+		if c.signedRecords == nil {
+			c.signedRecords = make(map[signedKey]*signedRecord)
+		}
+		c.signedRecords[key] = &signedRecord{tuple: messageTuple{StateHash: stateHash, Message: m, Signed: signed}}
+		return
+	}
+
+	if m.Round != record.tuple.Message.Round || stateHash == record.tuple.StateHash || record.reported {
+		return
+	}
+	if !verified && !c.verifySignature(signed) {
+		return
+	}
+	record.reported = true
+	c.evidenceCallback(&Evidence{First: record.tuple.Signed, Second: signed})
+}
@@ -0,0 +1,160 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// signMessage signs a message of the given type with the key.
+func signMessage(msgType MessageType, height uint64, round uint64, state State, privateKey *ecdsa.PrivateKey) *SignedProto {
+	m := &Message{Type: msgType, Height: height, Round: round, State: state}
+	sp := new(SignedProto)
+	sp.Sign(m, privateKey)
+	return sp
+}
+
+func TestEvidenceVerify(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	otherKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	first := signMessage(MessageType_Lock, 10, 2, State("first"), privateKey)
+	second := signMessage(MessageType_Lock, 10, 2, State("second"), privateKey)
+
+	evidence := &Evidence{First: first, Second: second}
+	m, err := evidence.Verify(S256Curve)
+	assert.Nil(t, err)
+	assert.Equal(t, MessageType_Lock, m.Type)
+	assert.Equal(t, uint64(10), m.Height)
+	assert.Equal(t, uint64(2), m.Round)
+
+	bts, err := evidence.Marshal()
+	assert.Nil(t, err)
+	decoded, err := DecodeEvidence(bts)
+	assert.Nil(t, err)
+	assert.Equal(t, evidence, decoded)
+	_, err = decoded.Verify(S256Curve)
+	assert.Nil(t, err)
+
+	_, err = DecodeEvidence([]byte("garbage"))
+	assert.NotNil(t, err)
+
+	corrupted := *second
+	corrupted.S = append([]byte(nil), second.S...)
+	corrupted.S[0] ^= 0xff
+
+	for _, testCase := range []struct {
+		name     string
+		evidence *Evidence
+		err      error
+	}{
+		{"incomplete", &Evidence{First: first}, ErrEvidenceIncomplete},
+		{"signers", &Evidence{First: first, Second: signMessage(MessageType_Lock, 10, 2, State("second"), otherKey)}, ErrEvidenceSigners},
+		{"signature", &Evidence{First: first, Second: &corrupted}, ErrEvidenceSignature},
+		{"height", &Evidence{First: first, Second: signMessage(MessageType_Lock, 11, 2, State("second"), privateKey)}, ErrEvidenceMismatch},
+		{"round", &Evidence{First: first, Second: signMessage(MessageType_Lock, 10, 3, State("second"), privateKey)}, ErrEvidenceMismatch},
+		{"type", &Evidence{First: first, Second: signMessage(MessageType_Commit, 10, 2, State("second"), privateKey)}, ErrEvidenceMismatch},
+		{"select", &Evidence{
+			First:  signMessage(MessageType_Select, 10, 2, State("first"), privateKey),
+			Second: signMessage(MessageType_Select, 10, 2, State("second"), privateKey),
+		}, ErrEvidenceType},
+		{"no conflict", &Evidence{First: first, Second: signMessage(MessageType_Lock, 10, 2, State("first"), privateKey)}, ErrEvidenceNoConflict},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := testCase.evidence.Verify(S256Curve)
+			assert.Equal(t, testCase.err, err)
+		})
+	}
+}
+
+func TestDetectEquivocation(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	consensus := createConsensus(t, 1, 0, []*ecdsa.PublicKey{&privateKey.PublicKey})
+
+	var reported []*Evidence
+	consensus.evidenceCallback = func(e *Evidence) { reported = append(reported, e) }
+	receive := func(sp *SignedProto) {
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		_ = consensus.ReceiveMessage(bts, time.Now())
+	}
+
+	first := signMessage(MessageType_RoundChange, 2, 0, State("first"), privateKey)
+	receive(first)
+	receive(first)
+	assert.Empty(t, reported)
+
+	second := signMessage(MessageType_RoundChange, 2, 0, State("second"), privateKey)
+	receive(second)
+	assert.Equal(t, []*Evidence{{First: first, Second: second}}, reported)
+
+	// an equivocation is reported once per round
+	receive(signMessage(MessageType_RoundChange, 2, 0, State("third"), privateKey))
+	assert.Len(t, reported, 1)
+
+	// messages of other heights, other types and higher rounds do not conflict
+	receive(signMessage(MessageType_RoundChange, 3, 0, State("third"), privateKey))
+	receive(signMessage(MessageType_Commit, 2, 0, State("third"), privateKey))
+	receive(signMessage(MessageType_RoundChange, 2, 1, State("third"), privateKey))
+	assert.Len(t, reported, 1)
+
+	// and messages of lower rounds are not compared
+	receive(signMessage(MessageType_RoundChange, 2, 0, State("fourth"), privateKey))
+	assert.Len(t, reported, 1)
+
+	// the records are cleared on a new height
+	consensus.heightSync(2, 1, State("third"), time.Now())
+	assert.Empty(t, consensus.signedRecords)
+}
+
+func TestDetectEquivocationInProofs(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var quorum []*ecdsa.PublicKey
+	for i := 0; i < 3; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		quorum = append(quorum, &privateKey.PublicKey)
+	}
+	consensus := createConsensus(t, 1, 0, quorum)
+
+	var reported []*Evidence
+	consensus.evidenceCallback = func(e *Evidence) { reported = append(reported, e) }
+	receive := func(m *Message, privateKey *ecdsa.PrivateKey) {
+		sp := new(SignedProto)
+		sp.Sign(m, privateKey)
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		_ = consensus.ReceiveMessage(bts, time.Now())
+	}
+
+	// the <roundchange> sent by a participant
+	sent := signMessage(MessageType_RoundChange, 2, 0, State("sent"), keys[1])
+	receive(&Message{Type: MessageType_RoundChange, Height: 2, Round: 0, State: State("sent")}, keys[1])
+
+	// conflicts with the one it sent to the leader
+	forged := signMessage(MessageType_RoundChange, 2, 0, State("forged"), keys[2])
+	forged.X, forged.Y = sent.X, sent.Y
+	receive(&Message{Type: MessageType_Lock, Height: 2, Round: 0, State: State("locked"), Proof: []*SignedProto{forged}}, keys[0])
+	assert.Empty(t, reported, "proofs with invalid signatures are not evidence")
+
+	locked := signMessage(MessageType_RoundChange, 2, 0, State("locked"), keys[1])
+	receive(&Message{Type: MessageType_Lock, Height: 2, Round: 0, State: State("locked"), Proof: []*SignedProto{locked}}, keys[0])
+	if assert.Len(t, reported, 1) {
+		assert.Equal(t, locked, reported[0].Second)
+		_, err := reported[0].Verify(S256Curve)
+		assert.Nil(t, err)
+	}
+
+	// proofs never replace the records
+	receive(&Message{Type: MessageType_Lock, Height: 2, Round: 1, State: State("locked"),
+		Proof: []*SignedProto{signMessage(MessageType_RoundChange, 2, 1, State("locked"), keys[2])}}, keys[0])
+	assert.NotContains(t, consensus.signedRecords, signedKey{identity: DefaultPubKeyToIdentity(quorum[2]), msgType: MessageType_RoundChange})
+}
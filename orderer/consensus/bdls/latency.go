@@ -0,0 +1,125 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import "time"
+
+const (
+	// DefaultMinLatency is the default lower bound of the latency estimated
+	DefaultMinLatency = 50 * time.Millisecond
+	// DefaultMaxLatency is the default upper bound of the latency estimated,
+	// the duration of the lock stage reaches MaxConsensusLatency at this latency
+	DefaultMaxLatency = MaxConsensusLatency / 4
+
+	// latencySmoothing is the weight of the estimate against a new sample,
+	// the estimate moves by 1/latencySmoothing of the difference.
+	latencySmoothing = 8
+)
+
+// latencyEstimator estimates the propagation latency between participants
+// from the delays until quorums of <roundchange> messages are collected.
+type latencyEstimator struct {
+	min, max time.Duration
+	estimate time.Duration // smoothed
+	samples  int
+}
+
+// observe adds a sample of the latency to the estimate.
+func (e *latencyEstimator) observe(d time.Duration) {
+	if e.samples == 0 {
+		e.estimate = d
+	} else {
+		e.estimate += (d - e.estimate) / latencySmoothing
+	}
+	e.samples++
+}
+
+// bounded returns the latency bounded by the estimator.
+func (e *latencyEstimator) bounded(d time.Duration) time.Duration {
+	if d < e.min {
+		return e.min
+	}
+	if d > e.max {
+		return e.max
+	}
+	return d
+}
+
+// verifyLatencyBounds checks that the latency bounds are within
+// 0 and MaxConsensusLatency, and that the lower one is not above
+// the upper one, unset bounds are the defaults.
+func verifyLatencyBounds(config *Config) error {
+	min, max := config.MinLatency, config.MaxLatency
+	if min == 0 {
+		min = DefaultMinLatency
+	}
+	if max == 0 {
+		max = DefaultMaxLatency
+	}
+	if min < 0 || max > MaxConsensusLatency || min > max {
+		return ErrConfigLatencyBounds
+	}
+	return nil
+}
+
+// observeLatency samples the delay from the start of the height until a
+// quorum of <roundchange> messages of round 0 has been collected. The first
+// height, and heights started with messages pipelined, are not sampled.
+func (c *Consensus) observeLatency(now time.Time) {
+	if c.heightStart.IsZero() || now.Before(c.heightStart) {
+		return
+	}
+	c.latencyEstimator.observe(now.Sub(c.heightStart))
+	c.heightStart = time.Time{}
+
+	if c.enableAdaptiveLatency {
+		c.latency = c.EstimatedLatency()
+	}
+}
+
+// Latency returns the propagation latency the durations of stages derive from.
+func (c *Consensus) Latency() time.Duration { return c.latency }
+
+// EstimatedLatency returns the propagation latency estimated from the delays
+// until quorums of <roundchange> messages are collected at new heights,
+// within the latency bounds of the config. It is the current latency until
+// a delay has been observed.
+func (c *Consensus) EstimatedLatency() time.Duration {
+	if c.latencyEstimator.samples == 0 {
+		return c.latency
+	}
+	return c.latencyEstimator.bounded(c.latencyEstimator.estimate)
+}
+
+// BoundedLatency returns the latency within the latency bounds of the config.
+func (c *Consensus) BoundedLatency(d time.Duration) time.Duration {
+	return c.latencyEstimator.bounded(d)
+}
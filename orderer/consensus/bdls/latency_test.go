@@ -0,0 +1,99 @@
+package bdls
+
+import (
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyEstimator(t *testing.T) {
+	e := latencyEstimator{min: 50 * time.Millisecond, max: time.Second}
+
+	e.observe(400 * time.Millisecond)
+	assert.Equal(t, 400*time.Millisecond, e.estimate)
+	// new samples move the estimate by 1/8 of the difference
+	e.observe(1200 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, e.estimate)
+	e.observe(100 * time.Millisecond)
+	assert.Equal(t, 450*time.Millisecond, e.estimate)
+
+	assert.Equal(t, 50*time.Millisecond, e.bounded(time.Millisecond))
+	assert.Equal(t, time.Second, e.bounded(time.Minute))
+	assert.Equal(t, 450*time.Millisecond, e.bounded(e.estimate))
+}
+
+// receiveRoundChangeQuorum feeds the consensus with a <roundchange> quorum of
+// round 0 at the next height, the delay after the start of the height.
+func receiveRoundChangeQuorum(t *testing.T, c *Consensus, delay time.Duration) {
+	start := time.Now()
+	c.heightStart = start
+	_, signed, priv := createRoundChangeMessage(t, c.latestHeight+1, 0)
+	c.AddParticipant(&priv.PublicKey)
+	bts, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+	assert.Nil(t, c.ReceiveMessage(bts, start.Add(delay)))
+	assert.Equal(t, stageLock, c.currentRound.Stage)
+}
+
+func TestEstimatedLatency(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+	assert.Equal(t, DefaultConsensusLatency, consensus.EstimatedLatency())
+
+	receiveRoundChangeQuorum(t, consensus, 120*time.Millisecond)
+	assert.Equal(t, 120*time.Millisecond, consensus.EstimatedLatency())
+	assert.True(t, consensus.heightStart.IsZero())
+	// the latency is not adjusted unless enabled
+	assert.Equal(t, DefaultConsensusLatency, consensus.Latency())
+
+	// the estimate is bounded
+	consensus = createConsensus(t, 0, 0, nil)
+	receiveRoundChangeQuorum(t, consensus, time.Millisecond)
+	assert.Equal(t, DefaultMinLatency, consensus.EstimatedLatency())
+	assert.Equal(t, DefaultMaxLatency, consensus.BoundedLatency(time.Minute))
+}
+
+func TestAdaptiveLatency(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+	consensus.enableAdaptiveLatency = true
+
+	receiveRoundChangeQuorum(t, consensus, 800*time.Millisecond)
+	assert.Equal(t, 800*time.Millisecond, consensus.Latency())
+	assert.Equal(t, 1600*time.Millisecond, consensus.roundchangeDuration(0))
+
+	// the next height is sampled from its start
+	consensus.heightSync(1, 0, []byte("decided"), time.Now())
+	assert.False(t, consensus.heightStart.IsZero())
+	receiveRoundChangeQuorum(t, consensus, 0)
+	assert.Equal(t, 700*time.Millisecond, consensus.Latency())
+}
+
+func TestVerifyConfigLatencyBounds(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+	config := &Config{
+		Epoch:         time.Now(),
+		PrivateKey:    consensus.privateKey,
+		Participants:  createIdentities(ConfigMinimumParticipants),
+		StateCompare:  func(State, State) int { return 0 },
+		StateValidate: func(State) bool { return true },
+	}
+	assert.Nil(t, VerifyConfig(config))
+
+	for _, bounds := range [][2]time.Duration{
+		{-time.Millisecond, 0},
+		{0, 2 * MaxConsensusLatency},
+		{time.Second, 500 * time.Millisecond},
+		{DefaultMaxLatency + time.Millisecond, 0},
+	} {
+		config.MinLatency, config.MaxLatency = bounds[0], bounds[1]
+		assert.Equal(t, ErrConfigLatencyBounds, VerifyConfig(config))
+	}
+
+	config.EnableAdaptiveLatency = true
+	config.MinLatency, config.MaxLatency = 10*time.Millisecond, time.Second
+	c, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Millisecond, c.BoundedLatency(0))
+	assert.Equal(t, time.Second, c.BoundedLatency(time.Minute))
+}
@@ -0,0 +1,83 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"encoding/binary"
+
+	"github.com/Sperax/bdls/crypto/blake2b"
+)
+
+// LeaderElection elects the leader of a round, every participant runs the same
+// election to verify that the <lock>, <select> and <decide> messages of a round
+// are signed by its leader, so an election MUST be deterministic.
+type LeaderElection interface {
+	// Leader returns the leader of the round at the given height, seed is
+	// the hash of the state decided at the previous height.
+	Leader(participants []Identity, height uint64, round uint64, seed StateHash) Identity
+}
+
+// RoundRobinLeader elects the participants in turn.
+//
+// With DecisionsPerLeader set to 0, the leader only changes along with the
+// round, which is the behavior of the original BDLS protocol. Otherwise, the
+// leadership is also passed on after every DecisionsPerLeader heights.
+type RoundRobinLeader struct {
+	DecisionsPerLeader uint64
+}
+
+// Leader implements LeaderElection
+func (e RoundRobinLeader) Leader(participants []Identity, height uint64, round uint64, seed StateHash) Identity {
+	turn := round
+	if e.DecisionsPerLeader > 0 {
+		turn += height / e.DecisionsPerLeader
+	}
+	return participants[turn%uint64(len(participants))]
+}
+
+// RandomLeader elects the leader of a height from a random beacon, which is
+// derived from the state decided at the previous height. The leader cannot be
+// predicted before the previous height is decided, while anyone holding its
+// <decide> proof can verify the election. Following rounds of a height are led
+// by the next participants in turn.
+type RandomLeader struct{}
+
+// Leader implements LeaderElection
+func (e RandomLeader) Leader(participants []Identity, height uint64, round uint64, seed StateHash) Identity {
+	var buf [len(seed) + 8]byte
+	copy(buf[:], seed[:])
+	binary.LittleEndian.PutUint64(buf[len(seed):], height)
+	beacon := blake2b.Sum256(buf[:])
+
+	n := uint64(len(participants))
+	offset := binary.LittleEndian.Uint64(beacon[:8]) % n
+	return participants[(offset+round%n)%n]
+}
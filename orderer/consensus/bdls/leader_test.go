@@ -0,0 +1,132 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createIdentities(n int) []Identity {
+	ids := make([]Identity, n)
+	for i := range ids {
+		ids[i][0] = byte(i)
+	}
+	return ids
+}
+
+func TestRoundRobinLeader(t *testing.T) {
+	ids := createIdentities(4)
+
+	// the leader only changes with rounds
+	election := RoundRobinLeader{}
+	assert.Equal(t, ids[1], election.Leader(ids, 1, 1, StateHash{}))
+	assert.Equal(t, ids[1], election.Leader(ids, 7, 1, StateHash{}))
+	assert.Equal(t, ids[2], election.Leader(ids, 7, 6, StateHash{}))
+
+	// the leader also changes every 2 decisions
+	election = RoundRobinLeader{DecisionsPerLeader: 2}
+	assert.Equal(t, ids[0], election.Leader(ids, 0, 0, StateHash{}))
+	assert.Equal(t, ids[0], election.Leader(ids, 1, 0, StateHash{}))
+	assert.Equal(t, ids[1], election.Leader(ids, 2, 0, StateHash{}))
+	assert.Equal(t, ids[2], election.Leader(ids, 3, 1, StateHash{}))
+	assert.Equal(t, ids[0], election.Leader(ids, 7, 1, StateHash{}))
+}
+
+func TestRandomLeader(t *testing.T) {
+	ids := createIdentities(7)
+	election := RandomLeader{}
+
+	// elections are deterministic
+	seed := defaultHash([]byte("decided"))
+	leader := election.Leader(ids, 10, 0, seed)
+	assert.Equal(t, leader, election.Leader(ids, 10, 0, seed))
+
+	// consecutive rounds are led by every participant in turn
+	led := make(map[Identity]bool)
+	for round := uint64(0); round < uint64(len(ids)); round++ {
+		led[election.Leader(ids, 10, round, seed)] = true
+	}
+	assert.Equal(t, len(ids), len(led))
+	assert.Equal(t, leader, election.Leader(ids, 10, uint64(len(ids)), seed))
+
+	// the leaders of heights depend on the states decided before
+	elected := make(map[Identity]bool)
+	for i := 0; i < 100; i++ {
+		elected[election.Leader(ids, 10, 0, defaultHash([]byte{byte(i)}))] = true
+	}
+	assert.Equal(t, len(ids), len(elected))
+}
+
+// electLeader seeds the random leader election of the consensus with
+// a decided state which elects the given leader for the round.
+func electLeader(t *testing.T, c *Consensus, round uint64, leader *ecdsa.PublicKey) {
+	c.leaderElection = RandomLeader{}
+	for i := 0; i < 1024; i++ {
+		c.leaderSeed = c.stateHash([]byte{byte(i), byte(i >> 8)})
+		if c.roundLeader(round) == DefaultPubKeyToIdentity(leader) {
+			return
+		}
+	}
+	t.Fatal("no state elects the leader")
+}
+
+func TestVerifyMessagesRandomLeader(t *testing.T) {
+	t.Run("lock", func(t *testing.T) {
+		m, sp, privateKey, proofKeys := createLockMessage(t, 20, 10, 10, 10, 10)
+		consensus := createConsensus(t, 9, 10, proofKeys)
+		consensus.AddParticipant(&privateKey.PublicKey)
+
+		electLeader(t, consensus, 10, &privateKey.PublicKey)
+		assert.Nil(t, consensus.verifyLockMessage(m, sp))
+
+		electLeader(t, consensus, 11, &privateKey.PublicKey)
+		assert.Equal(t, ErrLockNotSignedByLeader, consensus.verifyLockMessage(m, sp))
+	})
+
+	t.Run("select", func(t *testing.T) {
+		m, sp, privateKey, proofKeys := createSelectMessage(t, 20, 10, 10, 10, 10)
+		consensus := createConsensus(t, 9, 10, proofKeys)
+		consensus.AddParticipant(&privateKey.PublicKey)
+
+		electLeader(t, consensus, 10, &privateKey.PublicKey)
+		assert.Nil(t, consensus.verifySelectMessage(m, sp))
+
+		electLeader(t, consensus, 11, &privateKey.PublicKey)
+		assert.Equal(t, ErrSelectNotSignedByLeader, consensus.verifySelectMessage(m, sp))
+	})
+
+	t.Run("decide", func(t *testing.T) {
+		m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 10, 10, 10, 10)
+		consensus := createConsensus(t, 9, 10, proofKeys)
+		consensus.AddParticipant(&privateKey.PublicKey)
+
+		electLeader(t, consensus, 10, &privateKey.PublicKey)
+		assert.Nil(t, consensus.verifyDecideMessage(m, sp))
+
+		electLeader(t, consensus, 11, &privateKey.PublicKey)
+		assert.Equal(t, ErrDecideNotSignedByLeader, consensus.verifyDecideMessage(m, sp))
+
+		// the leaders beyond the next height are not known yet
+		consensus.latestHeight = 8
+		assert.Nil(t, consensus.verifyDecideMessage(m, sp))
+	})
+}
+
+func TestLeaderSeed(t *testing.T) {
+	m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 10, 10, 10, 10)
+	consensus := createConsensus(t, 9, 10, proofKeys)
+	assert.Equal(t, defaultHash(nil), consensus.leaderSeed)
+
+	consensus.SetLeader(&privateKey.PublicKey)
+	assert.Nil(t, consensus.verifyDecideMessage(m, sp))
+	consensus.heightSync(m.Height, m.Round, m.State, consensus.rcTimeout)
+	// the decided state seeds the election of the next height
+	assert.Equal(t, defaultHash(m.State), consensus.leaderSeed)
+
+	snapshot, err := consensus.Marshal(consensus.rcTimeout)
+	assert.Nil(t, err)
+	consensus.leaderSeed = StateHash{}
+	assert.Nil(t, consensus.Unmarshal(snapshot, consensus.rcTimeout))
+	assert.Equal(t, defaultHash(m.State), consensus.leaderSeed)
+}
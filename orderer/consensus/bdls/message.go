@@ -31,9 +31,11 @@
 package bdls
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/asn1"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -172,7 +174,7 @@ func (sp *SignedProto) Sign(m *Message, privateKey *ecdsa.PrivateKey) {
 		panic(err)
 	}
 	// hash message
-	sp.Version = ProtocolVersion
+	sp.Version = messageVersion(m)
 	sp.Message = bts
 
 	err = sp.X.Unmarshal(privateKey.PublicKey.X.Bytes())
@@ -194,10 +196,53 @@ func (sp *SignedProto) Sign(m *Message, privateKey *ecdsa.PrivateKey) {
 	sp.S = s.Bytes()
 }
 
+// SignWithSigner signs the message with a crypto.Signer holding an ecdsa key,
+// the signer is expected to return an ASN.1 DER encoded signature.
+func (sp *SignedProto) SignWithSigner(m *Message, signer crypto.Signer) error {
+	pubkey, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return ErrConfigSigner
+	}
+
+	bts, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	sp.Version = messageVersion(m)
+	sp.Message = bts
+
+	err = sp.X.Unmarshal(pubkey.X.Bytes())
+	if err != nil {
+		return err
+	}
+	err = sp.Y.Unmarshal(pubkey.Y.Bytes())
+	if err != nil {
+		return err
+	}
+	hash := sp.Hash()
+
+	// sign the message
+	der, err := signer.Sign(rand.Reader, hash, nil)
+	if err != nil {
+		return err
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return err
+	}
+	sp.R = sig.R.Bytes()
+	sp.S = sig.S.Bytes()
+	return nil
+}
+
 // Verify the signature of this signed message
 func (sp *SignedProto) Verify(curve elliptic.Curve) bool {
+	return sp.verifyHash(curve, sp.Hash())
+}
+
+// verifyHash verifies the signature against the hash of this signed message
+func (sp *SignedProto) verifyHash(curve elliptic.Curve, hash []byte) bool {
 	var X, Y, R, S big.Int
-	hash := sp.Hash()
 	// verify against public key and r, s
 	pubkey := ecdsa.PublicKey{}
 	pubkey.Curve = curve
@@ -208,6 +253,10 @@ func (sp *SignedProto) Verify(curve elliptic.Curve) bool {
 	R.SetBytes(sp.R[:])
 	S.SetBytes(sp.S[:])
 
+	// the public key must be on the curve of the participants
+	if !curve.IsOnCurve(&X, &Y) {
+		return false
+	}
 	return ecdsa.Verify(&pubkey, hash, &R, &S)
 }
 
@@ -165,10 +165,13 @@ type Message struct {
 	// Proofs related
 	Proof []*SignedProto `protobuf:"bytes,5,rep,name=Proof,proto3" json:"Proof,omitempty"`
 	// for lock-release, it's an embeded <lock> message
-	LockRelease          *SignedProto `protobuf:"bytes,6,opt,name=LockRelease,proto3" json:"LockRelease,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
-	XXX_unrecognized     []byte       `json:"-"`
-	XXX_sizecache        int32        `json:"-"`
+	LockRelease *SignedProto `protobuf:"bytes,6,opt,name=LockRelease,proto3" json:"LockRelease,omitempty"`
+	// Proofs of participants on a same message, in messages
+	// signed with the aggregate proofs protocol version
+	AggregateProof       []*AggregateProof `protobuf:"bytes,7,rep,name=AggregateProof,proto3" json:"AggregateProof,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *Message) Reset()         { *m = Message{} }
@@ -246,40 +249,147 @@ func (m *Message) GetLockRelease() *SignedProto {
 	return nil
 }
 
+func (m *Message) GetAggregateProof() []*AggregateProof {
+	if m != nil {
+		return m.AggregateProof
+	}
+	return nil
+}
+
+// AggregateProof combines the proofs of participants which have
+// signed the same message, with a bitmap of the signers
+type AggregateProof struct {
+	// Type of the message signed
+	Type MessageType `protobuf:"varint,1,opt,name=Type,proto3,enum=bdls.MessageType" json:"Type,omitempty"`
+	// Height of the message signed
+	Height uint64 `protobuf:"varint,2,opt,name=Height,proto3" json:"Height,omitempty"`
+	// Round of the message signed
+	Round uint64 `protobuf:"varint,3,opt,name=Round,proto3" json:"Round,omitempty"`
+	// State of the message signed
+	State []byte `protobuf:"bytes,4,opt,name=State,proto3" json:"State,omitempty"`
+	// Bitmap of the signers, indexed against the participants
+	Signers []byte `protobuf:"bytes,5,opt,name=Signers,proto3" json:"Signers,omitempty"`
+	// Signatures r,s of the signers, in the order of the bitmap
+	Signatures           [][]byte `protobuf:"bytes,6,rep,name=Signatures,proto3" json:"Signatures,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AggregateProof) Reset()         { *m = AggregateProof{} }
+func (m *AggregateProof) String() string { return proto.CompactTextString(m) }
+func (*AggregateProof) ProtoMessage()    {}
+func (*AggregateProof) Descriptor() ([]byte, []int) {
+	return fileDescriptor_33c57e4bae7b9afd, []int{2}
+}
+func (m *AggregateProof) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *AggregateProof) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_AggregateProof.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *AggregateProof) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AggregateProof.Merge(m, src)
+}
+func (m *AggregateProof) XXX_Size() int {
+	return m.Size()
+}
+func (m *AggregateProof) XXX_DiscardUnknown() {
+	xxx_messageInfo_AggregateProof.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AggregateProof proto.InternalMessageInfo
+
+func (m *AggregateProof) GetType() MessageType {
+	if m != nil {
+		return m.Type
+	}
+	return MessageType_Nop
+}
+
+func (m *AggregateProof) GetHeight() uint64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *AggregateProof) GetRound() uint64 {
+	if m != nil {
+		return m.Round
+	}
+	return 0
+}
+
+func (m *AggregateProof) GetState() []byte {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
+func (m *AggregateProof) GetSigners() []byte {
+	if m != nil {
+		return m.Signers
+	}
+	return nil
+}
+
+func (m *AggregateProof) GetSignatures() [][]byte {
+	if m != nil {
+		return m.Signatures
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("bdls.MessageType", MessageType_name, MessageType_value)
 	proto.RegisterType((*SignedProto)(nil), "bdls.SignedProto")
 	proto.RegisterType((*Message)(nil), "bdls.Message")
+	proto.RegisterType((*AggregateProof)(nil), "bdls.AggregateProof")
 }
 
 func init() { proto.RegisterFile("message.proto", fileDescriptor_33c57e4bae7b9afd) }
 
 var fileDescriptor_33c57e4bae7b9afd = []byte{
-	// 381 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xcd, 0xaa, 0xda, 0x40,
-	0x14, 0xc7, 0x1d, 0xf3, 0x61, 0x39, 0xd1, 0x76, 0x3a, 0x94, 0x32, 0x74, 0xa1, 0x41, 0x28, 0x95,
-	0x42, 0x23, 0xd4, 0x27, 0xa8, 0x76, 0x51, 0xe8, 0x07, 0x32, 0xf6, 0x05, 0xf2, 0x71, 0x8c, 0xa1,
-	0x26, 0x23, 0x99, 0xa4, 0x98, 0xc7, 0xe9, 0xdb, 0xb8, 0x2c, 0x5d, 0x76, 0x21, 0x17, 0x9f, 0xe4,
-	0x32, 0x13, 0xbd, 0x64, 0x71, 0xef, 0xee, 0xfc, 0xce, 0xff, 0x7f, 0xce, 0xf9, 0x27, 0x0c, 0x8c,
-	0x72, 0x54, 0x2a, 0x4c, 0x31, 0x38, 0x94, 0xb2, 0x92, 0xcc, 0x8e, 0x92, 0xbd, 0x7a, 0xf3, 0x21,
-	0xcd, 0xaa, 0x5d, 0x1d, 0x05, 0xb1, 0xcc, 0xe7, 0xa9, 0x4c, 0xe5, 0xdc, 0x88, 0x51, 0xbd, 0x35,
-	0x64, 0xc0, 0x54, 0xed, 0xd0, 0xf4, 0x0f, 0x01, 0x6f, 0x93, 0xa5, 0x05, 0x26, 0x6b, 0xb3, 0x84,
-	0xc3, 0xe0, 0x37, 0x96, 0x2a, 0x93, 0x05, 0x27, 0x3e, 0x99, 0x8d, 0xc4, 0x0d, 0xb5, 0xf2, 0xbd,
-	0xbd, 0xc7, 0xfb, 0x3e, 0x99, 0x0d, 0xc5, 0x0d, 0x99, 0x0f, 0xe4, 0xc8, 0x2d, 0xdd, 0x5b, 0xb2,
-	0xd3, 0x79, 0xd2, 0xfb, 0x7f, 0x9e, 0xc0, 0xba, 0x8e, 0xbe, 0x62, 0xf3, 0xe9, 0x98, 0x29, 0x41,
-	0x8e, 0xda, 0xd1, 0x70, 0xfb, 0x69, 0x47, 0xc3, 0x86, 0x40, 0x4a, 0xee, 0x98, 0xbd, 0xa4, 0xd4,
-	0xa4, 0xb8, 0xdb, 0x92, 0x9a, 0xfe, 0x23, 0x0f, 0xa7, 0xd9, 0x5b, 0xb0, 0x7f, 0x36, 0x07, 0x34,
-	0xe1, 0x9e, 0x7f, 0x7c, 0x19, 0xe8, 0x6f, 0x0e, 0xae, 0xa2, 0x16, 0x84, 0x91, 0xd9, 0x6b, 0x70,
-	0xbf, 0x60, 0x96, 0xee, 0x2a, 0x93, 0xd5, 0x16, 0x57, 0x62, 0xaf, 0xc0, 0x11, 0xb2, 0x2e, 0x12,
-	0x13, 0xd7, 0x16, 0x2d, 0xe8, 0xee, 0xa6, 0x0a, 0x2b, 0x6c, 0x23, 0x8a, 0x16, 0xd8, 0x3b, 0x70,
-	0xd6, 0xa5, 0x94, 0x5b, 0xee, 0xf8, 0xd6, 0xcc, 0xbb, 0xdd, 0xea, 0xfc, 0x2c, 0xd1, 0xea, 0x6c,
-	0x01, 0xde, 0x37, 0x19, 0xff, 0x12, 0xb8, 0xc7, 0x50, 0xa1, 0xc9, 0xfd, 0xa8, 0xbd, 0xeb, 0x7a,
-	0x5f, 0x82, 0xd7, 0x89, 0xcd, 0x06, 0x60, 0xfd, 0x90, 0x07, 0xda, 0x63, 0x2f, 0xc0, 0x33, 0xa1,
-	0x56, 0xbb, 0xb0, 0x48, 0x91, 0x12, 0xf6, 0x0c, 0x6c, 0x3d, 0x47, 0xfb, 0x0c, 0xc0, 0xdd, 0xe0,
-	0x1e, 0xe3, 0x8a, 0x5a, 0xba, 0x5e, 0xc9, 0x3c, 0xcf, 0x2a, 0x6a, 0xeb, 0x91, 0xce, 0x66, 0xea,
-	0x68, 0xf1, 0x33, 0xc6, 0x59, 0x82, 0xd4, 0xd5, 0xb5, 0x40, 0xd5, 0x14, 0x31, 0x1d, 0x2c, 0x87,
-	0xa7, 0xcb, 0x98, 0xfc, 0xbd, 0x8c, 0xc9, 0xdd, 0x65, 0x4c, 0x22, 0xd7, 0xbc, 0x80, 0xc5, 0x7d,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x43, 0xc3, 0x64, 0x6c, 0x47, 0x02, 0x00, 0x00,
+	// 436 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x52, 0xcb, 0x6e, 0x13, 0x31,
+	0x14, 0xad, 0x33, 0x2f, 0x74, 0x27, 0x2d, 0x83, 0x55, 0x21, 0x8b, 0x45, 0x1a, 0x45, 0x42, 0x44,
+	0x48, 0xa4, 0x12, 0xdd, 0xb2, 0x69, 0xcb, 0x02, 0x89, 0x87, 0x22, 0x87, 0x1f, 0x98, 0x99, 0xdc,
+	0x3a, 0x23, 0x92, 0x71, 0x64, 0x7b, 0x50, 0xe6, 0x2f, 0xf8, 0x05, 0x3e, 0x82, 0x7f, 0xe8, 0x92,
+	0x35, 0x8b, 0x0a, 0xe5, 0x4b, 0x90, 0xed, 0x0c, 0x1a, 0x2a, 0xd8, 0xb2, 0xbb, 0xe7, 0x9e, 0x73,
+	0x7d, 0x8e, 0xaf, 0x0d, 0xc7, 0x1b, 0xd4, 0x3a, 0x17, 0x38, 0xdb, 0x2a, 0x69, 0x24, 0x0d, 0x8b,
+	0xe5, 0x5a, 0x3f, 0x79, 0x21, 0x2a, 0xb3, 0x6a, 0x8a, 0x59, 0x29, 0x37, 0xe7, 0x42, 0x0a, 0x79,
+	0xee, 0xc8, 0xa2, 0xb9, 0x71, 0xc8, 0x01, 0x57, 0xf9, 0xa1, 0xc9, 0x57, 0x02, 0xe9, 0xa2, 0x12,
+	0x35, 0x2e, 0xe7, 0xee, 0x10, 0x06, 0xc9, 0x67, 0x54, 0xba, 0x92, 0x35, 0x23, 0x63, 0x32, 0x3d,
+	0xe6, 0x1d, 0xb4, 0xcc, 0x7b, 0xef, 0xc7, 0x06, 0x63, 0x32, 0x1d, 0xf2, 0x0e, 0xd2, 0x31, 0x90,
+	0x1d, 0x0b, 0x6c, 0xef, 0x8a, 0xde, 0xde, 0x9d, 0x1d, 0xfd, 0xb8, 0x3b, 0x83, 0x79, 0x53, 0xbc,
+	0xc5, 0xf6, 0x72, 0x57, 0x69, 0x4e, 0x76, 0x56, 0xd1, 0xb2, 0xf0, 0xdf, 0x8a, 0x96, 0x0e, 0x81,
+	0x28, 0x16, 0xb9, 0x73, 0x89, 0xb2, 0x48, 0xb3, 0xd8, 0x23, 0x3d, 0xf9, 0x32, 0xf8, 0x6d, 0x4d,
+	0x9f, 0x42, 0xf8, 0xb1, 0xdd, 0xa2, 0x0b, 0x77, 0xf2, 0xf2, 0xd1, 0xcc, 0xde, 0x79, 0x76, 0x20,
+	0x2d, 0xc1, 0x1d, 0x4d, 0x1f, 0x43, 0xfc, 0x06, 0x2b, 0xb1, 0x32, 0x2e, 0x6b, 0xc8, 0x0f, 0x88,
+	0x9e, 0x42, 0xc4, 0x65, 0x53, 0x2f, 0x5d, 0xdc, 0x90, 0x7b, 0x60, 0xbb, 0x0b, 0x93, 0x1b, 0xf4,
+	0x11, 0xb9, 0x07, 0xf4, 0x19, 0x44, 0x73, 0x25, 0xe5, 0x0d, 0x8b, 0xc6, 0xc1, 0x34, 0xed, 0xbc,
+	0x7a, 0xcb, 0xe2, 0x9e, 0xa7, 0x17, 0x90, 0xbe, 0x93, 0xe5, 0x27, 0x8e, 0x6b, 0xcc, 0x35, 0xba,
+	0xdc, 0x7f, 0x95, 0xf7, 0x55, 0xf4, 0x15, 0x9c, 0x5c, 0x0a, 0xa1, 0x50, 0xe4, 0x06, 0xbd, 0x4d,
+	0xe2, 0x6c, 0x4e, 0xfd, 0xdc, 0x9f, 0x1c, 0xbf, 0xa7, 0x9d, 0x7c, 0x23, 0xf7, 0xc7, 0xff, 0xe7,
+	0x66, 0x18, 0x24, 0xee, 0x5e, 0x4a, 0x1f, 0x9e, 0xac, 0x83, 0x74, 0x04, 0x60, 0xcb, 0xdc, 0x34,
+	0x0a, 0xed, 0x0b, 0x06, 0xd3, 0x21, 0xef, 0x75, 0x9e, 0x2b, 0x48, 0x7b, 0x91, 0x68, 0x02, 0xc1,
+	0x07, 0xb9, 0xcd, 0x8e, 0xe8, 0x43, 0x48, 0x9d, 0xe1, 0xf5, 0x2a, 0xaf, 0x05, 0x66, 0x84, 0x3e,
+	0x80, 0xd0, 0x6e, 0x2b, 0x1b, 0x50, 0x80, 0x78, 0x81, 0x6b, 0x2c, 0x4d, 0x16, 0xd8, 0xfa, 0x5a,
+	0x6e, 0x36, 0x95, 0xc9, 0x42, 0x3b, 0xd2, 0xdb, 0x67, 0x16, 0x59, 0xf2, 0x35, 0x96, 0xd5, 0x12,
+	0xb3, 0xd8, 0xd6, 0x1c, 0x75, 0x5b, 0x97, 0x59, 0x72, 0x35, 0xbc, 0xdd, 0x8f, 0xc8, 0xf7, 0xfd,
+	0x88, 0xfc, 0xdc, 0x8f, 0x48, 0x11, 0xbb, 0x7f, 0x7f, 0xf1, 0x6b, 0x00, 0x17, 0x8c, 0x57, 0x47,
+	0x3d, 0x03, 0x00, 0x00,
 }
 
 func (m *SignedProto) Marshal() (dAtA []byte, err error) {
@@ -379,6 +489,20 @@ func (m *Message) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if len(m.AggregateProof) > 0 {
+		for iNdEx := len(m.AggregateProof) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.AggregateProof[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintMessage(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x3a
+		}
+	}
 	if m.LockRelease != nil {
 		{
 			size, err := m.LockRelease.MarshalToSizedBuffer(dAtA[:i])
@@ -430,6 +554,71 @@ func (m *Message) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *AggregateProof) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *AggregateProof) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *AggregateProof) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Signatures) > 0 {
+		for iNdEx := len(m.Signatures) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Signatures[iNdEx])
+			copy(dAtA[i:], m.Signatures[iNdEx])
+			i = encodeVarintMessage(dAtA, i, uint64(len(m.Signatures[iNdEx])))
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if len(m.Signers) > 0 {
+		i -= len(m.Signers)
+		copy(dAtA[i:], m.Signers)
+		i = encodeVarintMessage(dAtA, i, uint64(len(m.Signers)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	if len(m.State) > 0 {
+		i -= len(m.State)
+		copy(dAtA[i:], m.State)
+		i = encodeVarintMessage(dAtA, i, uint64(len(m.State)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if m.Round != 0 {
+		i = encodeVarintMessage(dAtA, i, uint64(m.Round))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.Height != 0 {
+		i = encodeVarintMessage(dAtA, i, uint64(m.Height))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.Type != 0 {
+		i = encodeVarintMessage(dAtA, i, uint64(m.Type))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintMessage(dAtA []byte, offset int, v uint64) int {
 	offset -= sovMessage(v)
 	base := offset
@@ -501,6 +690,47 @@ func (m *Message) Size() (n int) {
 		l = m.LockRelease.Size()
 		n += 1 + l + sovMessage(uint64(l))
 	}
+	if len(m.AggregateProof) > 0 {
+		for _, e := range m.AggregateProof {
+			l = e.Size()
+			n += 1 + l + sovMessage(uint64(l))
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *AggregateProof) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Type != 0 {
+		n += 1 + sovMessage(uint64(m.Type))
+	}
+	if m.Height != 0 {
+		n += 1 + sovMessage(uint64(m.Height))
+	}
+	if m.Round != 0 {
+		n += 1 + sovMessage(uint64(m.Round))
+	}
+	l = len(m.State)
+	if l > 0 {
+		n += 1 + l + sovMessage(uint64(l))
+	}
+	l = len(m.Signers)
+	if l > 0 {
+		n += 1 + l + sovMessage(uint64(l))
+	}
+	if len(m.Signatures) > 0 {
+		for _, b := range m.Signatures {
+			l = len(b)
+			n += 1 + l + sovMessage(uint64(l))
+		}
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -944,6 +1174,251 @@ func (m *Message) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AggregateProof", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.AggregateProof = append(m.AggregateProof, &AggregateProof{})
+			if err := m.AggregateProof[len(m.AggregateProof)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipMessage(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *AggregateProof) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowMessage
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: AggregateProof: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: AggregateProof: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Type", wireType)
+			}
+			m.Type = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Type |= MessageType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Height", wireType)
+			}
+			m.Height = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Height |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Round", wireType)
+			}
+			m.Round = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Round |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.State = append(m.State[:0], dAtA[iNdEx:postIndex]...)
+			if m.State == nil {
+				m.State = []byte{}
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Signers", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Signers = append(m.Signers[:0], dAtA[iNdEx:postIndex]...)
+			if m.Signers == nil {
+				m.Signers = []byte{}
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Signatures", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Signatures = append(m.Signatures, make([]byte, postIndex-iNdEx))
+			copy(m.Signatures[len(m.Signatures)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMessage(dAtA[iNdEx:])
@@ -3,6 +3,7 @@ package bdls
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/json"
 	"io"
@@ -1113,3 +1114,24 @@ func TestMessageMarshalJson(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, sp, sp2)
 }
+
+func TestSignWithSigner(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	m := new(Message)
+	m.Type = MessageType_RoundChange
+	m.Height = 1
+	m.Round = 1
+	m.State = []byte("state")
+
+	sp := new(SignedProto)
+	err = sp.SignWithSigner(m, privateKey)
+	assert.Nil(t, err)
+	assert.True(t, sp.Verify(elliptic.P256()))
+	assert.Equal(t, DefaultPubKeyToIdentity(&privateKey.PublicKey), DefaultPubKeyToIdentity(sp.PublicKey(elliptic.P256())))
+
+	// tampered message
+	sp.Message = append(sp.Message, 0)
+	assert.False(t, sp.Verify(elliptic.P256()))
+}
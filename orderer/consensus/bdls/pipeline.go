@@ -0,0 +1,166 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import "time"
+
+// Pipelining overlaps two heights: with Config.EnablePipelining, a participant
+// which commits to the <lock> of the next height h broadcasts at once its
+// <roundchange> for round 0 of height h+1, carrying the maximal state proposed
+// by ProposeNext, instead of waiting for h to be decided.
+//
+// The <roundchange> messages of h+1 can't be validated before h is decided, as
+// the states of h+1 usually depend on the state decided at h, so they are kept
+// aside, at most one per participant, and replayed at height h+1 right after h
+// is decided. Round 0 of h+1 then usually enters the lock stage at once,
+// instead of after a full exchange of <roundchange> messages.
+//
+// Only <roundchange> messages are pipelined, locks, proofs and timeouts remain
+// scoped to the next height, hence the safety of consensus is not affected. If
+// another state than the locked one is decided at h, the pipelined states may
+// turn invalid: a participant whose own <roundchange> is rejected then withholds
+// round 0 of h+1 instead of signing another <roundchange> for it.
+
+// pipelinedMessage is a <roundchange> message kept for the height after next.
+type pipelinedMessage struct {
+	identity Identity
+	height   uint64
+	bts      []byte
+}
+
+// ProposeNext adds a state to propose at the height after the next one,
+// it is only used if pipelining is enabled.
+func (c *Consensus) ProposeNext(s State) {
+	if s == nil {
+		return
+	}
+
+	sHash := c.stateHash(s)
+	for k := range c.nextUnconfirmed {
+		if c.stateHash(c.nextUnconfirmed[k]) == sHash {
+			return
+		}
+	}
+	c.nextUnconfirmed = append(c.nextUnconfirmed, s)
+}
+
+// CurrentLock returns the state locked in the current round at the next
+// height, or nil if no <lock> has been received in this round. It is the state
+// the states proposed by ProposeNext most likely follow.
+func (c *Consensus) CurrentLock() State {
+	for k := range c.locks {
+		if c.locks[k].Message.Height == c.latestHeight+1 && c.locks[k].Message.Round == c.currentRound.RoundNumber {
+			return c.locks[k].Message.State
+		}
+	}
+	return nil
+}
+
+// isPipelined tells whether the <roundchange> message is to be kept for the height after next.
+func (c *Consensus) isPipelined(m *Message) bool {
+	return c.enablePipelining && m.Type == MessageType_RoundChange && m.Height == c.latestHeight+2 && m.Round == 0
+}
+
+// keepPipelined keeps a <roundchange> message of the height after next,
+// only the first message of each participant is kept.
+func (c *Consensus) keepPipelined(signed *SignedProto, m *Message, bts []byte) {
+	identity := c.pubKeyToIdentity(signed.PublicKey(c.curve))
+	for k := range c.pipelined {
+		if c.pipelined[k].identity == identity {
+			return
+		}
+	}
+	c.pipelined = append(c.pipelined, pipelinedMessage{identity: identity, height: m.Height, bts: bts})
+}
+
+// broadcastNextRoundChange broadcasts the <roundchange> message of round 0 at the
+// height after next once, after a <lock> has been received in the current round.
+func (c *Consensus) broadcastNextRoundChange() {
+	if !c.enablePipelining || c.nextRoundChangeSent || c.CurrentLock() == nil {
+		return
+	}
+
+	data := c.maximalNextUnconfirmed()
+	if data == nil {
+		return
+	}
+
+	var m Message
+	m.Type = MessageType_RoundChange
+	m.Height = c.latestHeight + 2
+	m.Round = 0
+	m.State = data
+	c.broadcast(&m)
+	c.nextRoundChangeSent = true
+}
+
+// maximalNextUnconfirmed returns the maximal state proposed for the height after next.
+func (c *Consensus) maximalNextUnconfirmed() State {
+	if len(c.nextUnconfirmed) > 0 {
+		maxState := c.nextUnconfirmed[0]
+		for i := 1; i < len(c.nextUnconfirmed); i++ {
+			if c.stateCompare(maxState, c.nextUnconfirmed[i]) < 0 {
+				maxState = c.nextUnconfirmed[i]
+			}
+		}
+		return maxState
+	}
+	return nil
+}
+
+// shiftPipeline moves the states and the <roundchange> messages kept for the
+// height after next to the next height, once the height before is decided.
+// States which are no longer valid are dropped, and the messages are replayed
+// as if they were just received.
+func (c *Consensus) shiftPipeline(now time.Time) {
+	unconfirmed := c.nextUnconfirmed
+	pipelined := c.pipelined
+	c.nextUnconfirmed = nil
+	c.pipelined = nil
+	c.nextRoundChangeSent = false
+
+	for _, s := range unconfirmed {
+		if c.stateValidate(s) {
+			c.Propose(s)
+		}
+	}
+
+	for _, p := range pipelined {
+		if p.height != c.latestHeight+1 {
+			continue
+		}
+		// NOTE: invalid messages are expected to be rejected.
+		err := c.receiveMessage(p.bts, now)
+		if err != nil && p.identity == c.identity {
+			c.currentRound.Withheld = true
+		}
+	}
+}
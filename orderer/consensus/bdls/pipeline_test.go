@@ -0,0 +1,180 @@
+package bdls
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/stretchr/testify/assert"
+)
+
+// simulateHeights runs a simulation until the given height,
+// and returns the virtual time it took along with the stats.
+func simulateHeights(t *testing.T, config SimulatorConfig, height uint64, faults ...Fault) (time.Duration, SimStats) {
+	s, err := NewSimulator(&config)
+	assert.Nil(t, err)
+	for _, f := range faults {
+		s.AddFault(f)
+	}
+	assert.True(t, s.RunUntil(height, 10*time.Minute))
+	assert.Nil(t, s.Safety())
+	assert.Empty(t, s.Evidence())
+	return s.Now(), s.Stats()
+}
+
+func TestSimulatorPipelining(t *testing.T) {
+	config := SimulatorConfig{Seed: 1, Participants: 7, Jitter: 20 * time.Millisecond}
+	normal, _ := simulateHeights(t, config, 10)
+	config.Pipelining = true
+	pipelined, _ := simulateHeights(t, config, 10)
+	t.Logf("10 heights decided in %v, %v pipelined", normal, pipelined)
+	assert.True(t, pipelined < normal)
+}
+
+func TestSimulatorPipeliningFaults(t *testing.T) {
+	for _, testCase := range []struct {
+		name   string
+		faults []Fault
+	}{
+		{name: "dropped messages", faults: []Fault{DropMessages(0.1)}},
+		{name: "reordered messages", faults: []Fault{DelayMessages(200 * time.Millisecond)}},
+		{name: "duplicated messages", faults: []Fault{DuplicateMessages(0.3, time.Second)}},
+		{name: "partitioned participant", faults: []Fault{Partition(0, 5*time.Second, []int{0, 1, 2, 3, 4}, []int{5, 6})}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			simulateHeights(t, SimulatorConfig{Seed: 1, Participants: 7, Jitter: 20 * time.Millisecond, Pipelining: true}, 5, testCase.faults...)
+		})
+	}
+}
+
+func TestSimulatorPipeliningCrashRestart(t *testing.T) {
+	s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 4, Pipelining: true})
+	assert.Nil(t, err)
+	assert.True(t, s.RunUntil(1, time.Minute))
+
+	// a participant crashing with a pipelined <roundchange> signs no other one
+	for s.nodes[3].c.CurrentLock() == nil || !s.nodes[3].c.nextRoundChangeSent {
+		s.Run(10 * time.Millisecond)
+	}
+	s.Crash(3, s.Now())
+	s.Restart(3, s.Now()+time.Second)
+	assert.True(t, s.RunUntil(s.Height(0)+3, 2*time.Minute))
+	assert.Nil(t, s.Safety())
+	assert.Empty(t, s.Evidence())
+}
+
+func TestSimulatorPipeliningInvalidated(t *testing.T) {
+	s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 4, Pipelining: true})
+	assert.Nil(t, err)
+	assert.True(t, s.RunUntil(1, time.Minute))
+	for !s.nodes[0].c.nextRoundChangeSent {
+		s.Run(10 * time.Millisecond)
+	}
+
+	// the state pipelined by participant 0 turns invalid, as if another
+	// state than the locked one was decided, it withholds round 0 instead
+	// of signing another <roundchange>
+	invalid := s.nodes[0].c.maximalNextUnconfirmed()
+	s.nodes[0].c.stateValidate = func(a State) bool { return !bytes.Equal(a, invalid) }
+	s.nodes[0].c.ProposeNext(State("another state"))
+	height := s.Height(0)
+	for s.Height(0) == height {
+		s.Run(10 * time.Millisecond)
+	}
+	assert.True(t, s.nodes[0].c.rounds.Front().Value.(*consensusRound).Withheld)
+
+	assert.True(t, s.RunUntil(height+3, 2*time.Minute))
+	assert.Nil(t, s.Safety())
+	assert.Empty(t, s.Evidence())
+}
+
+func TestPipelinedSnapshot(t *testing.T) {
+	s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 4, Pipelining: true})
+	assert.Nil(t, err)
+	for len(s.nodes[0].c.pipelined) == 0 {
+		s.Run(10 * time.Millisecond)
+	}
+
+	c := s.nodes[0].c
+	epoch := s.epoch.Add(s.Now())
+	bts, err := c.Marshal(epoch)
+	assert.Nil(t, err)
+
+	config := new(Config)
+	config.Epoch = epoch
+	config.PrivateKey = s.PrivateKey(0)
+	config.Participants = s.participants
+	config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a State) bool { return true }
+	config.EnablePipelining = true
+	restored, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Nil(t, restored.Unmarshal(bts, epoch))
+	assert.Equal(t, c.nextUnconfirmed, restored.nextUnconfirmed)
+	assert.Equal(t, c.pipelined, restored.pipelined)
+	assert.Equal(t, c.nextRoundChangeSent, restored.nextRoundChangeSent)
+}
+
+func TestSimulatorPipeliningTable(t *testing.T) {
+	const heights = 10
+	table := tablewriter.NewWriter(os.Stderr)
+	table.SetHeader([]string{"MODE", "DECIDE.AVG", "HEIGHTS", "PJ.NUM", "NET.MSGS", "NET.BYTES", "MSG.AVGSIZE", "NET.MSGRATE", "DELAY.MIN", "DELAY.MAX", "DELAY.EXP", "SPEEDUP"})
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, latency := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 500 * time.Millisecond, time.Second} {
+		config := SimulatorConfig{
+			Seed:         1,
+			Participants: 20,
+			Latency:      latency * 7 / 10,
+			Jitter:       latency * 6 / 10,
+			Propose: func(participant int, height uint64) State {
+				// 1KB states, as in the other benchmarks
+				s := make([]byte, 1024)
+				copy(s, fmt.Sprintf("state of participant %d at height %d", participant, height))
+				return s
+			},
+		}
+
+		var normal time.Duration
+		for _, pipelining := range []bool{false, true} {
+			config.Pipelining = pipelining
+			// the size of signed messages depends on the keys generated
+			sent := 0
+			countBytes := func(s *Simulator, m *SimMessage) []*SimMessage {
+				sent += len(m.Bytes)
+				return []*SimMessage{m}
+			}
+			elapsed, stats := simulateHeights(t, config, heights, countBytes)
+			mode, speedup := "NORMAL", "-"
+			if pipelining {
+				mode = "PIPELINED"
+				speedup = fmt.Sprintf("%.2fx", float64(normal)/float64(elapsed))
+			} else {
+				normal = elapsed
+			}
+			table.Append([]string{
+				mode,
+				fmt.Sprint((elapsed / heights).Truncate(10 * time.Millisecond)),
+				fmt.Sprint(heights),
+				fmt.Sprint(config.Participants),
+				fmt.Sprint(stats.Sent),
+				bytefmt.ByteSize(uint64(sent)),
+				bytefmt.ByteSize(uint64(sent / stats.Sent)),
+				fmt.Sprintf("%.2f/s", float64(stats.Sent)/elapsed.Seconds()),
+				fmt.Sprint(config.Latency),
+				fmt.Sprint(config.Latency + config.Jitter),
+				fmt.Sprint(latency),
+				speedup,
+			})
+			if pipelining {
+				assert.True(t, elapsed < normal)
+			}
+		}
+	}
+	table.Render()
+}
@@ -0,0 +1,658 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	mrand "math/rand"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultSimulatorLatency is the default delay of messages between participants
+	DefaultSimulatorLatency = 100 * time.Millisecond
+	// DefaultSimulatorUpdateInterval is the default interval of updates of participants
+	DefaultSimulatorUpdateInterval = 20 * time.Millisecond
+)
+
+// SimulatorConfig is to config a Simulator
+type SimulatorConfig struct {
+	// Seed of the pseudo random source of the simulation, simulations with
+	// the same seed and the same faults run the same way.
+	Seed int64
+	// Participants is the number of participants in consensus
+	Participants int
+	// Latency is the minimum delay of messages, DefaultSimulatorLatency if not set
+	Latency time.Duration
+	// Jitter is the maximum extra delay randomly added to messages
+	Jitter time.Duration
+	// UpdateInterval is the interval the participants are updated with,
+	// DefaultSimulatorUpdateInterval if not set
+	UpdateInterval time.Duration
+	// LeaderElection of the participants (optional)
+	LeaderElection LeaderElection
+	// Propose returns the state a participant proposes at a height
+	// (optional). Default to a state naming the participant and height.
+	Propose func(participant int, height uint64) State
+	// Pipelining enables the pipelining of heights, participants propose
+	// their state for the height after next too.
+	Pipelining bool
+	// Curve of the keys of participants, S256Curve if not set
+	Curve elliptic.Curve
+}
+
+// SimMessage is a message in flight from one participant to another.
+type SimMessage struct {
+	From    int
+	To      int
+	Bytes   []byte
+	Deliver time.Duration // the delivery time since the start of simulation
+}
+
+// Fault is applied to every message sent in a simulation, and returns the
+// messages to be delivered in place of it: none to drop the message, the
+// message with a later delivery time to delay it, or more to duplicate it.
+type Fault func(s *Simulator, m *SimMessage) []*SimMessage
+
+// SimStats counts the messages of a simulation.
+type SimStats struct {
+	Sent      int // messages sent by participants
+	Delivered int // messages delivered to participants
+	Dropped   int // messages dropped by faults, or sent to crashed participants
+	Rejected  int // messages delivered but rejected by participants
+}
+
+// Simulator runs a group of participants deterministically against a virtual
+// clock. Messages are delivered through the faults injected, and participants
+// may crash and restart, while the decisions of participants are recorded to
+// check the safety and liveness of consensus.
+//
+// A Simulator is single threaded, time only passes in Run and RunUntil.
+type Simulator struct {
+	config SimulatorConfig
+	rand   *mrand.Rand
+	epoch  time.Time
+	now    time.Duration
+	events eventQueue
+	seq    uint64
+	faults []Fault
+	stats  SimStats
+
+	nodes        []*simNode
+	participants []Identity
+
+	// decided states and their <decide> proofs of each height
+	decided map[uint64]*simDecision
+	// the first safety violation observed
+	violation error
+	// the evidence of equivocations reported by participants
+	evidence []*Evidence
+}
+
+type simDecision struct {
+	state       State
+	participant int
+	proof       []byte
+	at          time.Duration
+}
+
+// simNode is a participant in simulation.
+type simNode struct {
+	index      int
+	privateKey *ecdsa.PrivateKey
+	c          *Consensus
+	crashed    bool
+	generation int // increases on every restart
+
+	height uint64
+	state  State
+	// messages sent and accepted at the next height, replayed on restart
+	logged [][]byte
+}
+
+// simPeer delivers messages of a participant to another via the simulator.
+type simPeer struct {
+	s        *Simulator
+	from, to int
+}
+
+// GetPublicKey implements PeerInterface.GetPublicKey
+func (p *simPeer) GetPublicKey() *ecdsa.PublicKey { return &p.s.nodes[p.to].privateKey.PublicKey }
+
+// RemoteAddr implements PeerInterface.RemoteAddr
+func (p *simPeer) RemoteAddr() net.Addr { return fakeAddress(fmt.Sprint("sim:", p.to)) }
+
+// Send implements PeerInterface.Send
+func (p *simPeer) Send(msg []byte) error {
+	p.s.send(p.from, p.to, msg)
+	return nil
+}
+
+// NewSimulator creates a simulation of the consensus with the given config,
+// all participants propose their state for the first height.
+func NewSimulator(config *SimulatorConfig) (*Simulator, error) {
+	if config.Participants < ConfigMinimumParticipants {
+		return nil, ErrConfigParticipants
+	}
+
+	s := new(Simulator)
+	s.config = *config
+	if s.config.Latency == 0 {
+		s.config.Latency = DefaultSimulatorLatency
+	}
+	if s.config.UpdateInterval == 0 {
+		s.config.UpdateInterval = DefaultSimulatorUpdateInterval
+	}
+	if s.config.Curve == nil {
+		s.config.Curve = S256Curve
+	}
+	if s.config.Propose == nil {
+		s.config.Propose = func(participant int, height uint64) State {
+			return State(fmt.Sprintf("state of participant %d at height %d", participant, height))
+		}
+	}
+	s.rand = mrand.New(mrand.NewSource(config.Seed))
+	s.epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.decided = make(map[uint64]*simDecision)
+
+	for i := 0; i < config.Participants; i++ {
+		privateKey, err := ecdsa.GenerateKey(s.config.Curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		s.nodes = append(s.nodes, &simNode{index: i, privateKey: privateKey})
+		s.participants = append(s.participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	for _, node := range s.nodes {
+		c, err := s.newConsensus(node, 0)
+		if err != nil {
+			return nil, err
+		}
+		s.start(node, c)
+	}
+	return s, nil
+}
+
+// AddFault injects a fault to the messages sent from now on,
+// faults are applied in the order they are added.
+func (s *Simulator) AddFault(f Fault) { s.faults = append(s.faults, f) }
+
+// Rand returns the pseudo random source of the simulation,
+// faults must only use this source to keep simulations deterministic.
+func (s *Simulator) Rand() *mrand.Rand { return s.rand }
+
+// Now returns the virtual time elapsed since the start of simulation.
+func (s *Simulator) Now() time.Duration { return s.now }
+
+// Stats returns the message counters of the simulation.
+func (s *Simulator) Stats() SimStats { return s.stats }
+
+// PrivateKey returns the private key of a participant,
+// so that faults can forge the messages of a Byzantine participant.
+func (s *Simulator) PrivateKey(participant int) *ecdsa.PrivateKey {
+	return s.nodes[participant].privateKey
+}
+
+// Height returns the latest height a participant has decided.
+func (s *Simulator) Height(participant int) uint64 { return s.nodes[participant].height }
+
+// Decided returns the state decided at a height and the virtual time
+// it was first decided at, the state is nil if none decided it yet.
+func (s *Simulator) Decided(height uint64) (state State, at time.Duration) {
+	if d, exists := s.decided[height]; exists {
+		return d.state, d.at
+	}
+	return nil, 0
+}
+
+// Crash stops a participant at the given time, it neither receives
+// nor sends messages until it is restarted.
+func (s *Simulator) Crash(participant int, at time.Duration) {
+	s.schedule(at, func() {
+		node := s.nodes[participant]
+		if node.crashed {
+			return
+		}
+		node.crashed = true
+		node.generation++
+	})
+}
+
+// Restart restarts a crashed participant at the given time, it restores
+// its consensus from the messages it logged at the height it crashed at,
+// and then catches up with the heights decided meanwhile.
+func (s *Simulator) Restart(participant int, at time.Duration) {
+	s.schedule(at, func() {
+		node := s.nodes[participant]
+		if !node.crashed {
+			return
+		}
+		s.restart(node)
+	})
+}
+
+// Run advances the virtual clock by d, processing all events till then.
+func (s *Simulator) Run(d time.Duration) {
+	until := s.now + d
+	for s.events.Len() > 0 && s.events[0].at <= until {
+		e := heap.Pop(&s.events).(*simEvent)
+		s.now = e.at
+		e.fn()
+	}
+	s.now = until
+}
+
+// RunUntil runs the simulation until every running participant has decided
+// the given height, or the limit of virtual time has passed. It returns false
+// if the height was not reached in time, or if safety was violated.
+func (s *Simulator) RunUntil(height uint64, limit time.Duration) bool {
+	until := s.now + limit
+	for s.violation == nil && !s.reached(height) {
+		if s.events.Len() == 0 || s.events[0].at > until {
+			s.now = until
+			return false
+		}
+		e := heap.Pop(&s.events).(*simEvent)
+		s.now = e.at
+		e.fn()
+	}
+	return s.violation == nil
+}
+
+// Safety returns an error if participants have decided different
+// states at the same height, or if a <decide> proof was invalid.
+func (s *Simulator) Safety() error { return s.violation }
+
+// Evidence returns the evidence of equivocations reported by the participants.
+func (s *Simulator) Evidence() []*Evidence { return s.evidence }
+
+// reached checks if all running participants have decided the height.
+func (s *Simulator) reached(height uint64) bool {
+	for _, node := range s.nodes {
+		if !node.crashed && node.height < height {
+			return false
+		}
+	}
+	return true
+}
+
+// newConsensus creates the consensus of a participant at the height it has
+// decided, restored from the messages it logged at the next height.
+func (s *Simulator) newConsensus(node *simNode, round uint64) (*Consensus, error) {
+	config := new(Config)
+	config.Epoch = s.epoch.Add(s.now)
+	config.CurrentHeight = node.height
+	config.CurrentState = node.state
+	config.PrivateKey = node.privateKey
+	config.Participants = s.participants
+	config.LeaderElection = s.config.LeaderElection
+	config.EnablePipelining = s.config.Pipelining
+	config.Curve = s.config.Curve
+	config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a State) bool { return true }
+	config.EvidenceCallback = func(e *Evidence) { s.evidence = append(s.evidence, e) }
+	config.MessageOutCallback = func(m *Message, signed *SignedProto) {
+		if bts, err := signed.Marshal(); err == nil {
+			node.logged = append(node.logged, bts)
+		}
+	}
+
+	logged := node.logged
+	node.logged = nil
+	c, err := RestoreConsensus(config, round, logged, s.epoch.Add(s.now))
+	if err != nil {
+		return nil, err
+	}
+	node.logged = append(logged, node.logged...)
+	c.SetLatency(s.config.Latency)
+	return c, nil
+}
+
+// start joins the consensus of a participant with the others, proposes
+// its state, and schedules its updates.
+func (s *Simulator) start(node *simNode, c *Consensus) {
+	node.c = c
+	node.crashed = false
+	for i := range s.nodes {
+		if i != node.index {
+			c.Join(&simPeer{s: s, from: node.index, to: i})
+		}
+	}
+	s.propose(node)
+	s.update(node, node.generation)
+}
+
+// restart restores a crashed participant, and catches it up
+// with the <decide> proofs of the heights it missed.
+func (s *Simulator) restart(node *simNode) {
+	c, err := s.newConsensus(node, node.c.CurrentRound())
+	if err != nil {
+		panic(err)
+	}
+	node.c = c
+	for h := node.height + 1; s.decided[h] != nil; h++ {
+		if err := c.SyncDecided(s.decided[h].proof, s.epoch.Add(s.now)); err != nil {
+			s.violate(fmt.Errorf("participant %d cannot sync height %d: %v", node.index, h, err))
+			return
+		}
+		s.observe(node)
+	}
+	s.start(node, c)
+}
+
+// update updates the consensus of a participant periodically,
+// until the participant crashes.
+func (s *Simulator) update(node *simNode, generation int) {
+	if node.crashed || node.generation != generation {
+		return
+	}
+	_ = node.c.Update(s.epoch.Add(s.now))
+	s.observe(node)
+	s.schedule(s.now+s.config.UpdateInterval, func() { s.update(node, generation) })
+}
+
+// send passes a message through the faults, and schedules its delivery.
+func (s *Simulator) send(from int, to int, msg []byte) {
+	s.stats.Sent++
+	delay := s.config.Latency
+	if s.config.Jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(s.config.Jitter)))
+	}
+
+	msgs := []*SimMessage{{From: from, To: to, Bytes: msg, Deliver: s.now + delay}}
+	for _, f := range s.faults {
+		var out []*SimMessage
+		for _, m := range msgs {
+			out = append(out, f(s, m)...)
+		}
+		msgs = out
+	}
+	if len(msgs) == 0 {
+		s.stats.Dropped++
+	}
+
+	for _, m := range msgs {
+		m := m
+		if m.Deliver < s.now {
+			m.Deliver = s.now
+		}
+		s.schedule(m.Deliver, func() { s.deliver(m) })
+	}
+}
+
+// deliver delivers a message to a running participant.
+func (s *Simulator) deliver(m *SimMessage) {
+	node := s.nodes[m.To]
+	if node.crashed {
+		s.stats.Dropped++
+		return
+	}
+	s.stats.Delivered++
+	if err := node.c.ReceiveMessage(m.Bytes, s.epoch.Add(s.now)); err != nil {
+		s.stats.Rejected++
+	} else {
+		node.logged = append(node.logged, m.Bytes)
+	}
+	s.observe(node)
+}
+
+// observe records the decision of a participant if it has moved to a new
+// height, checks it against the decisions of others, and proposes the state
+// of the participant for the next height.
+func (s *Simulator) observe(node *simNode) {
+	height, _, state := node.c.CurrentState()
+	if height == node.height {
+		return
+	}
+	node.height = height
+	node.state = state
+	node.logged = pipelinedLog(node.logged, height)
+
+	if d, exists := s.decided[height]; exists {
+		if !bytes.Equal(d.state, state) && s.violation == nil {
+			s.violate(fmt.Errorf("participant %d decided %q at height %d, but participant %d decided %q", node.index, state, height, d.participant, d.state))
+		}
+	} else {
+		proof, err := node.c.CurrentProof().Marshal()
+		if err != nil {
+			panic(err)
+		}
+		s.decided[height] = &simDecision{state: state, participant: node.index, proof: proof, at: s.now}
+	}
+	s.propose(node)
+}
+
+// propose proposes the state of a participant for the next height,
+// and for the height after next if pipelining is enabled.
+func (s *Simulator) propose(node *simNode) {
+	node.c.Propose(s.config.Propose(node.index, node.height+1))
+	if s.config.Pipelining {
+		node.c.ProposeNext(s.config.Propose(node.index, node.height+2))
+	}
+}
+
+// pipelinedLog keeps the logged messages of the heights after the next one,
+// as they are still to be replayed on restart once the height is decided.
+func pipelinedLog(logged [][]byte, height uint64) [][]byte {
+	var kept [][]byte
+	for _, bts := range logged {
+		sp, err := DecodeSignedMessage(bts)
+		if err != nil {
+			continue
+		}
+		m, err := DecodeMessage(sp.Message)
+		if err != nil {
+			continue
+		}
+		if m.Height > height+1 {
+			kept = append(kept, bts)
+		}
+	}
+	return kept
+}
+
+// violate records the first safety violation.
+func (s *Simulator) violate(err error) {
+	if s.violation == nil {
+		s.violation = err
+	}
+}
+
+// schedule runs fn at the given time since the start of simulation.
+func (s *Simulator) schedule(at time.Duration, fn func()) {
+	s.seq++
+	heap.Push(&s.events, &simEvent{at: at, seq: s.seq, fn: fn})
+}
+
+// DropMessages drops messages with probability p.
+func DropMessages(p float64) Fault {
+	return func(s *Simulator, m *SimMessage) []*SimMessage {
+		if s.Rand().Float64() < p {
+			return nil
+		}
+		return []*SimMessage{m}
+	}
+}
+
+// DelayMessages delays messages randomly up to max, so that messages are
+// delivered in another order than they were sent.
+func DelayMessages(max time.Duration) Fault {
+	return func(s *Simulator, m *SimMessage) []*SimMessage {
+		m.Deliver += time.Duration(s.Rand().Int63n(int64(max)))
+		return []*SimMessage{m}
+	}
+}
+
+// DuplicateMessages delivers messages twice with probability p,
+// the duplicate is delivered randomly up to max later.
+func DuplicateMessages(p float64, max time.Duration) Fault {
+	return func(s *Simulator, m *SimMessage) []*SimMessage {
+		if s.Rand().Float64() < p {
+			dup := *m
+			dup.Deliver += time.Duration(s.Rand().Int63n(int64(max)))
+			return []*SimMessage{m, &dup}
+		}
+		return []*SimMessage{m}
+	}
+}
+
+// ReplayMessages delivers along with a message, with probability p,
+// a message sent before by the same participant, to the same recipient.
+func ReplayMessages(p float64) Fault {
+	sent := make(map[[2]int][][]byte)
+	return func(s *Simulator, m *SimMessage) []*SimMessage {
+		msgs := []*SimMessage{m}
+		key := [2]int{m.From, m.To}
+		if history := sent[key]; len(history) > 0 && s.Rand().Float64() < p {
+			replayed := *m
+			replayed.Bytes = history[s.Rand().Intn(len(history))]
+			msgs = append(msgs, &replayed)
+		}
+		sent[key] = append(sent[key], m.Bytes)
+		return msgs
+	}
+}
+
+// Partition drops the messages between participants of different groups
+// from the given time until the partition heals. Participants not in any
+// group are not partitioned.
+func Partition(from time.Duration, until time.Duration, groups ...[]int) Fault {
+	group := make(map[int]int)
+	for i, g := range groups {
+		for _, participant := range g {
+			group[participant] = i
+		}
+	}
+	return func(s *Simulator, m *SimMessage) []*SimMessage {
+		if s.Now() < from || s.Now() >= until {
+			return []*SimMessage{m}
+		}
+		gFrom, fromExists := group[m.From]
+		gTo, toExists := group[m.To]
+		if fromExists && toExists && gFrom != gTo {
+			return nil
+		}
+		return []*SimMessage{m}
+	}
+}
+
+// ForgeMessages makes a participant Byzantine, forge tampers with the messages
+// it sends to each recipient, which are then signed with its key again.
+func ForgeMessages(participant int, forge func(m *Message, to int)) Fault {
+	return func(s *Simulator, m *SimMessage) []*SimMessage {
+		if m.From != participant {
+			return []*SimMessage{m}
+		}
+		signed, err := DecodeSignedMessage(m.Bytes)
+		if err != nil {
+			return []*SimMessage{m}
+		}
+		msg, err := DecodeMessage(signed.Message)
+		if err != nil {
+			return []*SimMessage{m}
+		}
+		forge(msg, m.To)
+
+		forged := new(SignedProto)
+		forged.Sign(msg, s.PrivateKey(participant))
+		bts, err := forged.Marshal()
+		if err != nil {
+			panic(err)
+		}
+		m.Bytes = bts
+		return []*SimMessage{m}
+	}
+}
+
+// Equivocate makes a participant Byzantine, it sends conflicting states
+// to half of the others, in all its messages carrying a state.
+func Equivocate(participant int) Fault {
+	return ForgeMessages(participant, func(m *Message, to int) {
+		if m.State != nil && to%2 == 1 {
+			m.State = append(State("equivocated "), m.State...)
+		}
+	})
+}
+
+// CorruptSignatures corrupts the signatures of the messages a participant
+// sends with probability p, as if they were forged by someone else.
+func CorruptSignatures(participant int, p float64) Fault {
+	return func(s *Simulator, m *SimMessage) []*SimMessage {
+		if m.From != participant || s.Rand().Float64() >= p {
+			return []*SimMessage{m}
+		}
+		signed, err := DecodeSignedMessage(m.Bytes)
+		if err != nil || len(signed.S) == 0 {
+			return []*SimMessage{m}
+		}
+		signed.S = append([]byte(nil), signed.S...)
+		signed.S[0] ^= 0xff
+		bts, err := signed.Marshal()
+		if err != nil {
+			panic(err)
+		}
+		m.Bytes = bts
+		return []*SimMessage{m}
+	}
+}
+
+// simEvent is a function to be run at a virtual time.
+type simEvent struct {
+	at  time.Duration
+	seq uint64 // events at the same time run in the order they were scheduled
+	fn  func()
+}
+
+type eventQueue []*simEvent
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*simEvent)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	*q = old[:n-1]
+	return e
+}
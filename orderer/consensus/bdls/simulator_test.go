@@ -0,0 +1,188 @@
+package bdls
+
+import (
+	"crypto/elliptic"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorFaults(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		config       SimulatorConfig
+		faults       []Fault
+		equivocators []int
+	}{
+		{
+			name:   "no faults",
+			config: SimulatorConfig{Participants: 4},
+		},
+		{
+			name:   "dropped messages",
+			config: SimulatorConfig{Participants: 7, Jitter: 20 * time.Millisecond},
+			faults: []Fault{DropMessages(0.1)},
+		},
+		{
+			name:   "reordered messages",
+			config: SimulatorConfig{Participants: 7},
+			faults: []Fault{DelayMessages(200 * time.Millisecond)},
+		},
+		{
+			name:   "duplicated messages",
+			config: SimulatorConfig{Participants: 4, Jitter: 20 * time.Millisecond},
+			faults: []Fault{DuplicateMessages(0.3, time.Second)},
+		},
+		{
+			name:   "replayed messages",
+			config: SimulatorConfig{Participants: 4, Jitter: 20 * time.Millisecond},
+			faults: []Fault{ReplayMessages(0.3)},
+		},
+		{
+			name:   "partitioned participant",
+			config: SimulatorConfig{Participants: 4},
+			faults: []Fault{Partition(0, 5*time.Second, []int{0, 1, 2}, []int{3})},
+		},
+		{
+			name:         "equivocating participant",
+			config:       SimulatorConfig{Participants: 4, Jitter: 20 * time.Millisecond},
+			faults:       []Fault{Equivocate(0)},
+			equivocators: []int{0},
+		},
+		{
+			name:   "forged signatures",
+			config: SimulatorConfig{Participants: 4},
+			faults: []Fault{CorruptSignatures(1, 0.5)},
+		},
+		{
+			name:   "random leaders",
+			config: SimulatorConfig{Participants: 7, Jitter: 20 * time.Millisecond, LeaderElection: RandomLeader{}},
+			faults: []Fault{DropMessages(0.05), DelayMessages(50 * time.Millisecond)},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.config.Seed = 1
+			s, err := NewSimulator(&testCase.config)
+			assert.Nil(t, err)
+			for _, f := range testCase.faults {
+				s.AddFault(f)
+			}
+
+			assert.True(t, s.RunUntil(3, 2*time.Minute), "height 3 not decided by %v", s.Now())
+			assert.Nil(t, s.Safety())
+			for i := 0; i < testCase.config.Participants; i++ {
+				assert.True(t, s.Height(i) >= 3)
+			}
+
+			// only the equivocating participants are reported
+			reported := make(map[Identity]bool)
+			for _, e := range s.Evidence() {
+				_, err := e.Verify(S256Curve)
+				assert.Nil(t, err)
+				reported[DefaultPubKeyToIdentity(e.First.PublicKey(S256Curve))] = true
+			}
+			assert.Equal(t, len(testCase.equivocators), len(reported))
+			for _, i := range testCase.equivocators {
+				assert.True(t, reported[DefaultPubKeyToIdentity(&s.PrivateKey(i).PublicKey)])
+			}
+		})
+	}
+}
+
+func TestSimulatorCurves(t *testing.T) {
+	for _, curve := range []elliptic.Curve{S256Curve, P256Curve} {
+		t.Run(CurveName(curve), func(t *testing.T) {
+			s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 4, Curve: curve})
+			assert.Nil(t, err)
+			assert.True(t, s.RunUntil(3, time.Minute))
+			assert.Nil(t, s.Safety())
+			assert.Equal(t, curve, s.nodes[0].c.Curve())
+		})
+	}
+}
+
+func TestSimulatorDeterministic(t *testing.T) {
+	run := func() ([]string, SimStats) {
+		s, err := NewSimulator(&SimulatorConfig{Seed: 42, Participants: 7, Jitter: 50 * time.Millisecond})
+		assert.Nil(t, err)
+		s.AddFault(DropMessages(0.1))
+		s.AddFault(DuplicateMessages(0.1, 100*time.Millisecond))
+		assert.True(t, s.RunUntil(4, 2*time.Minute))
+
+		var decisions []string
+		for h := uint64(1); h <= 4; h++ {
+			state, at := s.Decided(h)
+			decisions = append(decisions, fmt.Sprintf("%s at %v", state, at))
+		}
+		return decisions, s.Stats()
+	}
+
+	decisions, stats := run()
+	otherDecisions, otherStats := run()
+	assert.Equal(t, decisions, otherDecisions)
+	assert.Equal(t, stats, otherStats)
+}
+
+func TestSimulatorCrashRestart(t *testing.T) {
+	s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 4})
+	assert.Nil(t, err)
+
+	// a participant crashing after it has locked a state restores its lock
+	s.Run(1250 * time.Millisecond)
+	assert.Equal(t, 1, len(s.nodes[3].c.locks))
+	s.Crash(3, s.Now())
+	s.Restart(3, s.Now()+10*time.Millisecond)
+	s.Run(20 * time.Millisecond)
+	assert.Equal(t, 1, len(s.nodes[3].c.locks))
+	assert.True(t, s.RunUntil(1, time.Minute))
+
+	// the others keep on deciding while a participant is down
+	s.Crash(3, s.Now())
+	s.Restart(3, s.Now()+10*time.Second)
+	s.Run(5 * time.Second)
+	assert.Equal(t, uint64(1), s.Height(3))
+	assert.True(t, s.Height(0) > 2)
+
+	// and the restarted participant catches up with them
+	assert.True(t, s.RunUntil(s.Height(0)+2, 2*time.Minute))
+	assert.Nil(t, s.Safety())
+}
+
+func TestSimulatorPartitionWithoutQuorum(t *testing.T) {
+	s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 4})
+	assert.Nil(t, err)
+	s.AddFault(Partition(0, 20*time.Second, []int{0, 1}, []int{2, 3}))
+
+	// neither side has a quorum to decide with
+	assert.False(t, s.RunUntil(1, 20*time.Second))
+	assert.Nil(t, s.Safety())
+	state, _ := s.Decided(1)
+	assert.Nil(t, state)
+	assert.True(t, s.Stats().Dropped > 0)
+
+	// until the partition heals
+	assert.True(t, s.RunUntil(2, 2*time.Minute))
+	assert.Nil(t, s.Safety())
+	_, at := s.Decided(1)
+	assert.True(t, at >= 20*time.Second)
+}
+
+func TestSimulatorSafety(t *testing.T) {
+	_, err := NewSimulator(&SimulatorConfig{Participants: 3})
+	assert.Equal(t, ErrConfigParticipants, err)
+
+	s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 4})
+	assert.Nil(t, err)
+	assert.True(t, s.RunUntil(1, time.Minute))
+	assert.Nil(t, s.Safety())
+
+	// a participant deciding another state than the one decided violates safety
+	height := s.Height(2) + 1
+	s.decided[height] = &simDecision{state: State("decided"), participant: 0}
+	s.nodes[2].c.heightSync(height, 0, State("conflicting"), s.epoch)
+	s.observe(s.nodes[2])
+	assert.EqualError(t, s.Safety(), fmt.Sprintf(`participant 2 decided "conflicting" at height %d, but participant 0 decided "decided"`, height))
+	assert.False(t, s.RunUntil(10, time.Minute))
+}
@@ -0,0 +1,307 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// consensusSnapshot is the serialized form of the deterministic state of a
+// Consensus object. Signed messages are kept in their original encoding, and
+// timeouts are kept relative to an epoch, unset timeouts are nil.
+type consensusSnapshot struct {
+	Identity             Identity
+	Participants         []Identity
+	Latency              time.Duration
+	LatestState          State
+	LatestHeight         uint64
+	LatestRound          uint64
+	LatestProof          []byte
+	Unconfirmed          []State
+	NextUnconfirmed      []State
+	Pipelined            [][]byte
+	NextRoundChangeSent  bool
+	Rounds               []roundSnapshot
+	CurrentRound         uint64
+	RoundChangeTimeout   *time.Duration
+	LockTimeout          *time.Duration
+	CommitTimeout        *time.Duration
+	LockReleaseTimeout   *time.Duration
+	Locks                [][]byte
+	LastRoundChangeProof [][]byte
+	Loopback             [][]byte
+}
+
+// roundSnapshot is the serialized form of a consensusRound.
+type roundSnapshot struct {
+	Stage            consensusStage
+	RoundNumber      uint64
+	LockedState      State
+	LockedStateHash  StateHash
+	RoundChangeSent  bool
+	CommitSent       bool
+	Withheld         bool
+	RoundChanges     [][]byte
+	Commits          [][]byte
+	MaxProposedState State
+	MaxProposedCount int
+}
+
+// Marshal serializes the deterministic state of the consensus object: the
+// participants, the latest decision, the unconfirmed states, the rounds at
+// the next height along with their messages, the locks and the timeouts.
+// Timeouts are serialized relative to the given epoch.
+//
+// Functions and keys set by Config are not serialized.
+func (c *Consensus) Marshal(epoch time.Time) ([]byte, error) {
+	s := consensusSnapshot{
+		Identity:            c.identity,
+		Participants:        c.participants,
+		Latency:             c.latency,
+		LatestState:         c.latestState,
+		LatestHeight:        c.latestHeight,
+		LatestRound:         c.latestRound,
+		Unconfirmed:         c.unconfirmed,
+		NextUnconfirmed:     c.nextUnconfirmed,
+		NextRoundChangeSent: c.nextRoundChangeSent,
+		CurrentRound:        c.currentRound.RoundNumber,
+		RoundChangeTimeout:  relativeTimeout(c.rcTimeout, epoch),
+		LockTimeout:         relativeTimeout(c.lockTimeout, epoch),
+		CommitTimeout:       relativeTimeout(c.commitTimeout, epoch),
+		LockReleaseTimeout:  relativeTimeout(c.lockReleaseTimeout, epoch),
+		Loopback:            c.loopback,
+	}
+
+	var err error
+	if c.latestProof != nil {
+		if s.LatestProof, err = c.latestProof.Marshal(); err != nil {
+			return nil, err
+		}
+	}
+
+	for elem := c.rounds.Front(); elem != nil; elem = elem.Next() {
+		r := elem.Value.(*consensusRound)
+		rs := roundSnapshot{
+			Stage:            r.Stage,
+			RoundNumber:      r.RoundNumber,
+			LockedState:      r.LockedState,
+			LockedStateHash:  r.LockedStateHash,
+			RoundChangeSent:  r.RoundChangeSent,
+			CommitSent:       r.CommitSent,
+			Withheld:         r.Withheld,
+			MaxProposedState: r.MaxProposedState,
+			MaxProposedCount: r.MaxProposedCount,
+		}
+		if rs.RoundChanges, err = marshalTuples(r.roundChanges); err != nil {
+			return nil, err
+		}
+		if rs.Commits, err = marshalTuples(r.commits); err != nil {
+			return nil, err
+		}
+		s.Rounds = append(s.Rounds, rs)
+	}
+
+	if s.Locks, err = marshalTuples(c.locks); err != nil {
+		return nil, err
+	}
+
+	for k := range c.pipelined {
+		s.Pipelined = append(s.Pipelined, c.pipelined[k].bts)
+	}
+
+	for _, sp := range c.lastRoundChangeProof {
+		bts, err := sp.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		s.LastRoundChangeProof = append(s.LastRoundChangeProof, bts)
+	}
+
+	return json.Marshal(&s)
+}
+
+// Unmarshal restores the state serialized by Marshal into the consensus object,
+// with the timeouts relative to the given epoch. The consensus object must have
+// been created by the same participant the state was serialized from, the functions
+// and keys set by Config are kept. The state is left untouched on error.
+func (c *Consensus) Unmarshal(bts []byte, epoch time.Time) error {
+	var s consensusSnapshot
+	if err := json.Unmarshal(bts, &s); err != nil {
+		return err
+	}
+
+	if s.Identity != c.identity {
+		return ErrSnapshotIdentity
+	}
+
+	var latestProof *SignedProto
+	if s.LatestProof != nil {
+		latestProof = new(SignedProto)
+		if err := latestProof.Unmarshal(s.LatestProof); err != nil {
+			return err
+		}
+	}
+
+	var rounds []*consensusRound
+	var currentRound *consensusRound
+	for _, rs := range s.Rounds {
+		r := newConsensusRound(rs.RoundNumber, c)
+		r.Stage = rs.Stage
+		r.LockedState = rs.LockedState
+		r.LockedStateHash = rs.LockedStateHash
+		r.RoundChangeSent = rs.RoundChangeSent
+		r.CommitSent = rs.CommitSent
+		r.Withheld = rs.Withheld
+		r.MaxProposedState = rs.MaxProposedState
+		r.MaxProposedCount = rs.MaxProposedCount
+
+		var err error
+		if r.roundChanges, err = c.unmarshalTuples(rs.RoundChanges); err != nil {
+			return err
+		}
+		if r.commits, err = c.unmarshalTuples(rs.Commits); err != nil {
+			return err
+		}
+
+		if r.RoundNumber == s.CurrentRound {
+			currentRound = r
+		}
+		rounds = append(rounds, r)
+	}
+	if currentRound == nil {
+		return ErrSnapshotCurrentRound
+	}
+
+	locks, err := c.unmarshalTuples(s.Locks)
+	if err != nil {
+		return err
+	}
+
+	var lastRoundChangeProof []*SignedProto
+	for _, bts := range s.LastRoundChangeProof {
+		sp := new(SignedProto)
+		if err := sp.Unmarshal(bts); err != nil {
+			return err
+		}
+		lastRoundChangeProof = append(lastRoundChangeProof, sp)
+	}
+
+	var pipelined []pipelinedMessage
+	for _, bts := range s.Pipelined {
+		sp := new(SignedProto)
+		if err := sp.Unmarshal(bts); err != nil {
+			return err
+		}
+		m := new(Message)
+		if err := m.Unmarshal(sp.Message); err != nil {
+			return err
+		}
+		pipelined = append(pipelined, pipelinedMessage{identity: c.pubKeyToIdentity(sp.PublicKey(c.curve)), height: m.Height, bts: bts})
+	}
+
+	c.participants = s.Participants
+	c.latency = s.Latency
+	c.latestState = s.LatestState
+	c.leaderSeed = c.stateHash(s.LatestState)
+	c.latestHeight = s.LatestHeight
+	c.latestRound = s.LatestRound
+	c.latestProof = latestProof
+	c.unconfirmed = s.Unconfirmed
+	c.nextUnconfirmed = s.NextUnconfirmed
+	c.pipelined = pipelined
+	c.nextRoundChangeSent = s.NextRoundChangeSent
+	c.rounds.Init()
+	for _, r := range rounds {
+		c.rounds.PushBack(r)
+	}
+	c.currentRound = currentRound
+	c.rcTimeout = absoluteTimeout(s.RoundChangeTimeout, epoch)
+	c.lockTimeout = absoluteTimeout(s.LockTimeout, epoch)
+	c.commitTimeout = absoluteTimeout(s.CommitTimeout, epoch)
+	c.lockReleaseTimeout = absoluteTimeout(s.LockReleaseTimeout, epoch)
+	c.locks = locks
+	c.lastRoundChangeProof = lastRoundChangeProof
+	c.loopback = s.Loopback
+
+	// count number of individual identites
+	ids := make(map[Identity]bool)
+	for _, id := range c.participants {
+		ids[id] = true
+	}
+	c.numIdentities = len(ids)
+	return nil
+}
+
+// marshalTuples serializes the original signed messages of the tuples.
+func marshalTuples(tuples []messageTuple) ([][]byte, error) {
+	var out [][]byte
+	for k := range tuples {
+		bts, err := tuples[k].Signed.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, bts)
+	}
+	return out, nil
+}
+
+// unmarshalTuples rebuilds the tuples of the serialized signed messages.
+func (c *Consensus) unmarshalTuples(signed [][]byte) ([]messageTuple, error) {
+	var tuples []messageTuple
+	for _, bts := range signed {
+		sp := new(SignedProto)
+		if err := sp.Unmarshal(bts); err != nil {
+			return nil, err
+		}
+		m := new(Message)
+		if err := m.Unmarshal(sp.Message); err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, messageTuple{StateHash: c.stateHash(m.State), Message: m, Signed: sp})
+	}
+	return tuples, nil
+}
+
+func relativeTimeout(timeout time.Time, epoch time.Time) *time.Duration {
+	if timeout.IsZero() {
+		return nil
+	}
+	d := timeout.Sub(epoch)
+	return &d
+}
+
+func absoluteTimeout(d *time.Duration, epoch time.Time) time.Time {
+	if d == nil {
+		return time.Time{}
+	}
+	return epoch.Add(*d)
+}
@@ -0,0 +1,115 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsensusMarshal(t *testing.T) {
+	m, sp, leaderKey, proofKeys := createLockMessage(t, 4, 1, 5, 1, 5)
+	lock, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	epoch := time.Now()
+	config := new(Config)
+	config.Epoch = epoch
+	config.PrivateKey = privateKey
+	config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a State) bool { return true }
+	// the leader of round 5 is participants[0]
+	config.Participants = []Identity{DefaultPubKeyToIdentity(&leaderKey.PublicKey)}
+	for _, pubkey := range proofKeys[1:] {
+		config.Participants = append(config.Participants, DefaultPubKeyToIdentity(pubkey))
+	}
+	config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+
+	consensus, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(lock, epoch))
+	consensus.SetLatency(time.Second)
+
+	bts, err := consensus.Marshal(epoch)
+	assert.Nil(t, err)
+
+	// restored at the same epoch
+	restored, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Nil(t, restored.Unmarshal(bts, epoch))
+	assert.Equal(t, uint64(5), restored.CurrentRound())
+	assert.Equal(t, stageCommit, restored.currentRound.Stage)
+	assert.True(t, restored.currentRound.CommitSent)
+	assert.Equal(t, 1, len(restored.locks))
+	assert.Equal(t, State(m.State), restored.maximalLocked())
+	assert.Equal(t, consensus.rounds.Len(), restored.rounds.Len())
+	assert.Equal(t, consensus.commitTimeout, restored.commitTimeout)
+	assert.True(t, restored.lockTimeout.IsZero())
+	assert.Equal(t, time.Second, restored.latency)
+	assert.Equal(t, consensus.numIdentities, restored.numIdentities)
+
+	// the serialization is deterministic
+	again, err := restored.Marshal(epoch)
+	assert.Nil(t, err)
+	assert.Equal(t, bts, again)
+
+	// restored at another epoch
+	later := epoch.Add(time.Hour)
+	restored, err = NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Nil(t, restored.Unmarshal(bts, later))
+	assert.Equal(t, consensus.commitTimeout.Add(time.Hour), restored.commitTimeout)
+	assert.Equal(t, consensus.rcTimeout.Add(time.Hour), restored.rcTimeout)
+
+	// the restored consensus keeps on working
+	assert.Nil(t, restored.Update(later))
+
+	// the state is untouched on error
+	assert.NotNil(t, restored.Unmarshal([]byte("malformed"), epoch))
+	assert.Equal(t, 1, len(restored.locks))
+
+	// restored by another participant
+	otherKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	config.PrivateKey = otherKey
+	other, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrSnapshotIdentity, other.Unmarshal(bts, epoch))
+}
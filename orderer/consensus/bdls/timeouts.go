@@ -0,0 +1,118 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import "time"
+
+// Timeouts are the base durations of the stages of a round, the durations
+// at round 0, which double with every round up to MaxBackoff. A duration
+// left zero is derived from the latency of the consensus, which is
+// DefaultConsensusLatency unless changed by Consensus.SetLatency.
+type Timeouts struct {
+	// RoundChange is the time a participant waits for the round to be locked
+	// after sending <roundchange>, before it moves to the next round.
+	// (optional). Default to 2 * latency
+	RoundChange time.Duration
+	// Collect is the time the leader collects <roundchange> messages once
+	// 2t+1 of them have been received, before it sends <lock> or <select>.
+	// (optional). Default to 2 * latency
+	Collect time.Duration
+	// Lock is the time a participant waits for the <lock> or <select> of
+	// the leader once 2t+1 <roundchange> messages have been received.
+	// (optional). Default to 4 * latency
+	Lock time.Duration
+	// Commit is the time a participant collects <commit> messages
+	// after a <lock>. (optional). Default to 2 * latency
+	Commit time.Duration
+	// LockRelease is the time a participant waits for a <decide>
+	// while releasing locks. (optional). Default to 2 * latency
+	LockRelease time.Duration
+	// MaxBackoff caps the durations of the stages as they grow
+	// with rounds. (optional). Default to MaxConsensusLatency
+	MaxBackoff time.Duration
+}
+
+// VerifyTimeouts verifies that no duration of the timeouts is negative,
+// and that none of the base durations exceeds MaxBackoff.
+func VerifyTimeouts(t *Timeouts) error {
+	maxBackoff := t.MaxBackoff
+	if maxBackoff < 0 {
+		return ErrConfigTimeouts
+	}
+	if maxBackoff == 0 {
+		maxBackoff = MaxConsensusLatency
+	}
+
+	for _, d := range []time.Duration{t.RoundChange, t.Collect, t.Lock, t.Commit, t.LockRelease} {
+		if d < 0 || d > maxBackoff {
+			return ErrConfigTimeouts
+		}
+	}
+	return nil
+}
+
+// backoff doubles the base duration with each round, up to the maximum.
+func backoff(base time.Duration, round uint64, max time.Duration) time.Duration {
+	d := base
+	for i := uint64(0); i < round && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// stageDuration returns the duration of a stage in the given round, from
+// the base duration of the stage, or from the latency if it is unset.
+func (c *Consensus) stageDuration(base time.Duration, factor time.Duration, round uint64) time.Duration {
+	if base == 0 {
+		base = factor * c.latency
+	}
+	max := c.timeouts.MaxBackoff
+	if max == 0 {
+		max = MaxConsensusLatency
+	}
+	return backoff(base, round, max)
+}
+
+// Timeouts returns the base durations of the stages of rounds.
+func (c *Consensus) Timeouts() Timeouts { return c.timeouts }
+
+// SetTimeouts changes the base durations of the stages of rounds, the
+// stages which have already started keep on their current timeouts.
+func (c *Consensus) SetTimeouts(t Timeouts) error {
+	if err := VerifyTimeouts(&t); err != nil {
+		return err
+	}
+	c.timeouts = t
+	return nil
+}
@@ -0,0 +1,70 @@
+package bdls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyTimeouts(t *testing.T) {
+	assert.Nil(t, VerifyTimeouts(&Timeouts{}))
+	assert.Nil(t, VerifyTimeouts(&Timeouts{RoundChange: time.Second, Lock: MaxConsensusLatency}))
+	assert.Nil(t, VerifyTimeouts(&Timeouts{Collect: 30 * time.Second, MaxBackoff: time.Minute}))
+
+	assert.Equal(t, ErrConfigTimeouts, VerifyTimeouts(&Timeouts{Commit: -time.Second}))
+	assert.Equal(t, ErrConfigTimeouts, VerifyTimeouts(&Timeouts{MaxBackoff: -time.Second}))
+	assert.Equal(t, ErrConfigTimeouts, VerifyTimeouts(&Timeouts{LockRelease: 2 * MaxConsensusLatency}))
+	assert.Equal(t, ErrConfigTimeouts, VerifyTimeouts(&Timeouts{RoundChange: 2 * time.Second, MaxBackoff: time.Second}))
+}
+
+func TestStageDurations(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+
+	// derived from the latency by default
+	assert.Equal(t, 2*DefaultConsensusLatency, consensus.roundchangeDuration(0))
+	assert.Equal(t, 2*DefaultConsensusLatency, consensus.collectDuration(0))
+	assert.Equal(t, 4*DefaultConsensusLatency, consensus.lockDuration(0))
+	assert.Equal(t, 8*DefaultConsensusLatency, consensus.commitDuration(2))
+	assert.Equal(t, MaxConsensusLatency, consensus.lockReleaseDuration(10))
+	assert.Equal(t, MaxConsensusLatency, consensus.roundchangeDuration(1000))
+
+	consensus.SetLatency(time.Second)
+	assert.Equal(t, 2*time.Second, consensus.roundchangeDuration(0))
+
+	assert.Equal(t, ErrConfigTimeouts, consensus.SetTimeouts(Timeouts{Lock: -time.Second}))
+	assert.Nil(t, consensus.SetTimeouts(Timeouts{
+		RoundChange: 500 * time.Millisecond,
+		Collect:     100 * time.Millisecond,
+		MaxBackoff:  20 * time.Second,
+	}))
+	assert.Equal(t, 100*time.Millisecond, consensus.Timeouts().Collect)
+
+	assert.Equal(t, 500*time.Millisecond, consensus.roundchangeDuration(0))
+	assert.Equal(t, 4*time.Second, consensus.roundchangeDuration(3))
+	assert.Equal(t, 20*time.Second, consensus.roundchangeDuration(6))
+	assert.Equal(t, 20*time.Second, consensus.roundchangeDuration(1<<40))
+	assert.Equal(t, 200*time.Millisecond, consensus.collectDuration(1))
+	// the stages without base durations are still derived from the latency
+	assert.Equal(t, 4*time.Second, consensus.lockDuration(0))
+	assert.Equal(t, 16*time.Second, consensus.lockDuration(2))
+}
+
+func TestVerifyConfigTimeouts(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+	config := &Config{
+		Epoch:         time.Now(),
+		PrivateKey:    consensus.privateKey,
+		Participants:  createIdentities(ConfigMinimumParticipants),
+		StateCompare:  func(State, State) int { return 0 },
+		StateValidate: func(State) bool { return true },
+		Timeouts:      Timeouts{Collect: time.Second, MaxBackoff: 500 * time.Millisecond},
+	}
+	assert.Equal(t, ErrConfigTimeouts, VerifyConfig(config))
+
+	config.Timeouts.MaxBackoff = 5 * time.Second
+	c, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, c.collectDuration(0))
+	assert.Equal(t, 5*time.Second, c.collectDuration(4))
+}
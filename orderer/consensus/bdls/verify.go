@@ -0,0 +1,204 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"runtime"
+	"sync"
+)
+
+// DefaultVerifyCacheSize is the default number of verified signatures
+// a consensus object remembers.
+const DefaultVerifyCacheSize = 8192
+
+// verifyCache remembers the signatures which have been verified, keyed by
+// SignedProto.Hash, so that the proofs carried by <lock>, <select> and <decide>
+// messages are not verified again once seen as standalone messages, and the
+// other way around. The oldest signatures are evicted first.
+//
+// A verifyCache is safe for concurrent use, a nil verifyCache caches nothing.
+type verifyCache struct {
+	sync.Mutex
+	capacity int
+	entries  map[[32]byte]verifiedSignature
+	order    [][32]byte // ring of the hashes, in insertion order
+	next     int
+}
+
+// verifiedSignature is the <r,s> of a verified signature, as the
+// hash of a signed message does not cover its signature.
+type verifiedSignature struct {
+	R []byte
+	S []byte
+}
+
+func newVerifyCache(capacity int) *verifyCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &verifyCache{
+		capacity: capacity,
+		entries:  make(map[[32]byte]verifiedSignature, capacity),
+	}
+}
+
+// verify verifies the signature of the signed message,
+// signatures verified before are not verified again.
+func (vc *verifyCache) verify(curve elliptic.Curve, sp *SignedProto) bool {
+	if vc == nil {
+		return sp.Verify(curve)
+	}
+
+	var key [32]byte
+	hash := sp.Hash()
+	copy(key[:], hash)
+
+	vc.Lock()
+	sig, exists := vc.entries[key]
+	vc.Unlock()
+	if exists && bytes.Equal(sig.R, sp.R) && bytes.Equal(sig.S, sp.S) {
+		return true
+	}
+
+	if !sp.verifyHash(curve, hash) {
+		return false
+	}
+
+	vc.Lock()
+	defer vc.Unlock()
+	if _, exists := vc.entries[key]; !exists {
+		if len(vc.order) < vc.capacity {
+			vc.order = append(vc.order, key)
+		} else {
+			delete(vc.entries, vc.order[vc.next])
+			vc.order[vc.next] = key
+			vc.next = (vc.next + 1) % vc.capacity
+		}
+	}
+	vc.entries[key] = verifiedSignature{R: append([]byte(nil), sp.R...), S: append([]byte(nil), sp.S...)}
+	return true
+}
+
+// verifySignature verifies the signature of a signed message
+// with the signatures cache of the consensus object.
+func (c *Consensus) verifySignature(sp *SignedProto) bool {
+	return c.verifyCache.verify(c.curve, sp)
+}
+
+// VerifyPool pre-verifies the signatures of incoming messages, and of the
+// proofs they carry, with a pool of workers ahead of ReceiveMessage.
+//
+// The signatures verified by the pool are remembered in the signatures cache
+// of the consensus object, so ReceiveMessage finds them there instead of
+// verifying them on the consensus goroutine. Pre-verification has no other
+// effect, the consensus object processes the messages exactly as it would
+// have otherwise, hence the core remains deterministic.
+//
+// The methods of a VerifyPool may be called concurrently with the methods of
+// the consensus object it was created for.
+type VerifyPool struct {
+	curve elliptic.Curve
+	cache *verifyCache
+	jobs  chan verifyJob
+	once  sync.Once
+}
+
+type verifyJob struct {
+	signed *SignedProto
+	done   *sync.WaitGroup
+}
+
+// NewVerifyPool creates a pool of workers which pre-verify messages for the
+// consensus object, it defaults to one worker per CPU if workers is not positive.
+// The pool is of no use if the signatures cache of the consensus is disabled.
+func NewVerifyPool(c *Consensus, workers int) *VerifyPool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	p := &VerifyPool{
+		curve: c.curve,
+		cache: c.verifyCache,
+		jobs:  make(chan verifyJob),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *VerifyPool) work() {
+	for job := range p.jobs {
+		p.cache.verify(p.curve, job.signed)
+		job.done.Done()
+	}
+}
+
+// PreVerify verifies the signatures of the encoded messages and of the proofs
+// they carry concurrently, and returns once all of them are verified. Malformed
+// messages are skipped, ReceiveMessage rejects them as usual.
+func (p *VerifyPool) PreVerify(msgs ...[]byte) {
+	var done sync.WaitGroup
+	for _, bts := range msgs {
+		signed, err := DecodeSignedMessage(bts)
+		if err != nil {
+			continue
+		}
+		for _, sp := range signedMessages(signed) {
+			done.Add(1)
+			p.jobs <- verifyJob{signed: sp, done: &done}
+		}
+	}
+	done.Wait()
+}
+
+// Close stops the workers of the pool, PreVerify must not be called afterwards.
+func (p *VerifyPool) Close() {
+	p.once.Do(func() { close(p.jobs) })
+}
+
+// signedMessages returns the signed message along with the signed
+// messages it carries, the <lock> of a <lock-release> included.
+// The proofs combined in aggregate proofs are not included, as the
+// participants they are reconstructed with are not known to the pool.
+func signedMessages(signed *SignedProto) []*SignedProto {
+	all := []*SignedProto{signed}
+	m, err := DecodeMessage(signed.Message)
+	if err != nil {
+		return all
+	}
+	all = append(all, m.Proof...)
+	if m.LockRelease != nil {
+		all = append(all, signedMessages(m.LockRelease)...)
+	}
+	return all
+}
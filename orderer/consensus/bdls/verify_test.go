@@ -0,0 +1,174 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyCache(t *testing.T) {
+	var signed []*SignedProto
+	for i := 0; i < 3; i++ {
+		_, sp, _ := createRoundChangeMessage(t, 1, uint64(i))
+		signed = append(signed, sp)
+	}
+
+	cache := newVerifyCache(2)
+	for _, sp := range signed {
+		assert.True(t, cache.verify(S256Curve, sp))
+	}
+	// the oldest signature has been evicted
+	assert.Len(t, cache.entries, 2)
+	assert.NotContains(t, cache.entries, hashKey(signed[0]))
+	assert.Contains(t, cache.entries, hashKey(signed[2]))
+	assert.True(t, cache.verify(S256Curve, signed[2]))
+
+	// the signature is checked, not only the message
+	forged := *signed[2]
+	forged.S = append([]byte(nil), forged.S...)
+	forged.S[0] ^= 0xff
+	assert.False(t, cache.verify(S256Curve, &forged))
+
+	// a nil cache verifies every time
+	var nocache *verifyCache
+	assert.True(t, nocache.verify(S256Curve, signed[0]))
+	assert.False(t, nocache.verify(S256Curve, &forged))
+	assert.Nil(t, newVerifyCache(-1))
+}
+
+func hashKey(sp *SignedProto) (key [32]byte) {
+	copy(key[:], sp.Hash())
+	return
+}
+
+func TestVerifyPool(t *testing.T) {
+	m, sp, privateKey, proofKeys := createLockMessage(t, 20, 10, 10, 10, 10)
+	consensus := createConsensus(t, 9, 10, proofKeys)
+	consensus.AddParticipant(&privateKey.PublicKey)
+	consensus.SetLeader(&privateKey.PublicKey)
+
+	pool := NewVerifyPool(consensus, 4)
+	defer pool.Close()
+
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	pool.PreVerify(bts, []byte("garbage"))
+
+	// the <lock> and its proofs are verified
+	assert.Len(t, consensus.verifyCache.entries, len(m.Proof)+1)
+	for _, proof := range m.Proof {
+		assert.Contains(t, consensus.verifyCache.entries, hashKey(proof))
+	}
+	assert.Nil(t, consensus.verifyLockMessage(m, sp))
+
+	// the <lock> carried by a <lock-release> is verified along with its proofs
+	release := &Message{Type: MessageType_LockRelease, Height: 10, Round: 11, LockRelease: sp}
+	signedRelease := new(SignedProto)
+	signedRelease.Sign(release, privateKey)
+	assert.Len(t, signedMessages(signedRelease), len(m.Proof)+2)
+}
+
+func TestVerifyDeterministic(t *testing.T) {
+	// a consensus object processes the messages the same whether
+	// they are pre-verified, cached or not
+	run := func(cacheSize int, preVerify bool) []byte {
+		s, err := NewSimulator(&SimulatorConfig{Seed: 1, Participants: 4})
+		assert.Nil(t, err)
+		for _, node := range s.nodes {
+			node.c.verifyCache = newVerifyCache(cacheSize)
+		}
+		if preVerify {
+			s.AddFault(func(s *Simulator, m *SimMessage) []*SimMessage {
+				pool := NewVerifyPool(s.nodes[m.To].c, 2)
+				pool.PreVerify(m.Bytes)
+				pool.Close()
+				return []*SimMessage{m}
+			})
+		}
+		assert.True(t, s.RunUntil(3, time.Minute))
+		state, at := s.Decided(3)
+		return append(state, []byte(at.String())...)
+	}
+
+	expected := run(-1, false)
+	assert.Equal(t, expected, run(DefaultVerifyCacheSize, false))
+	assert.Equal(t, expected, run(DefaultVerifyCacheSize, true))
+}
+
+// createLockMessageKeys creates a <lock> signed by the leader, with the
+// <roundchange> proofs of all the given keys.
+func createLockMessageKeys(tb testing.TB, leader *ecdsa.PrivateKey, keys []*ecdsa.PrivateKey, height uint64, round uint64, state State) (*Message, *SignedProto) {
+	m := &Message{Type: MessageType_Lock, Height: height, Round: round, State: state}
+	for _, key := range keys {
+		_, proof, _ := createRoundChangeMessageSigner(tb, height, round, state, key)
+		m.Proof = append(m.Proof, proof)
+	}
+	signed := new(SignedProto)
+	signed.Sign(m, leader)
+	return m, signed
+}
+
+func BenchmarkVerifyLockMessage(b *testing.B) {
+	for _, participants := range []int{50, 100} {
+		var keys []*ecdsa.PrivateKey
+		var ids []Identity
+		for i := 0; i < participants; i++ {
+			key, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+			if err != nil {
+				b.Fatal(err)
+			}
+			keys = append(keys, key)
+			ids = append(ids, DefaultPubKeyToIdentity(&key.PublicKey))
+		}
+		m, signed := createLockMessageKeys(b, keys[0], keys[:2*((participants-1)/3)+1], 1, 0, State("locked"))
+
+		for _, bench := range []struct {
+			name      string
+			cacheSize int
+			// the proofs were seen as standalone messages before
+			seenProofs bool
+		}{
+			{"uncached", -1, false},
+			{"cached", DefaultVerifyCacheSize, false},
+			{"seen-proofs", DefaultVerifyCacheSize, true},
+		} {
+			b.Run(fmt.Sprintf("%d/%s", participants, bench.name), func(b *testing.B) {
+				config := &Config{
+					Epoch:           time.Now(),
+					PrivateKey:      keys[1],
+					Participants:    ids,
+					StateCompare:    func(a State, b State) int { return bytes.Compare(a, b) },
+					StateValidate:   func(a State) bool { return true },
+					VerifyCacheSize: bench.cacheSize,
+				}
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					consensus, err := NewConsensus(config)
+					if err != nil {
+						b.Fatal(err)
+					}
+					consensus.SetLeader(&keys[0].PublicKey)
+					if bench.seenProofs {
+						for _, proof := range m.Proof {
+							consensus.verifySignature(proof)
+						}
+					}
+					b.StartTimer()
+
+					if _, err := consensus.verifyMessage(signed); err != nil {
+						b.Fatal(err)
+					}
+					if err := consensus.verifyLockMessage(m, signed); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
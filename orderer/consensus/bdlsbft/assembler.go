@@ -0,0 +1,154 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/Sperax/bdls"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric/common/channelconfig"
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/orderer/common/blockcutter"
+	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/protoutil"
+)
+
+// Assembler assembles the candidate blocks proposed to the BDLS consensus core.
+// Envelopes are batched by a block cutter, bounded by the request batch options
+// of the BDLS config metadata, and by the channel's batch size where these are unset.
+type Assembler struct {
+	support     consensus.ConsenterSupport
+	cutter      blockcutter.Receiver
+	maxInterval time.Duration
+}
+
+// NewAssembler creates an Assembler for the channel of the given support.
+func NewAssembler(support consensus.ConsenterSupport, opts Options) *Assembler {
+	fetcher := &batchConfigFetcher{
+		support:  support,
+		maxCount: opts.RequestBatchMaxCount,
+		maxBytes: opts.RequestBatchMaxBytes,
+	}
+	return &Assembler{
+		support: support,
+		// Every consenter cuts candidate blocks repeatedly until one is decided,
+		// hence the block fill duration is not reported.
+		cutter:      blockcutter.NewReceiverImpl(support.ChannelID(), fetcher, blockcutter.NewMetrics(&disabled.Provider{})),
+		maxInterval: opts.RequestBatchMaxInterval,
+	}
+}
+
+// NextBatch returns the envelopes of the next candidate block, or nil if the
+// pending envelopes should keep accumulating. A batch is returned once the
+// block cutter cuts one, or once the oldest pending envelope has waited for the
+// maximal batch interval.
+func (a *Assembler) NextBatch(pending []*cb.Envelope, pendingSince time.Time, now time.Time) []*cb.Envelope {
+	// Candidates are cut from scratch, as the pending envelopes
+	// are kept until they are included in a decided block.
+	a.cutter.Cut()
+	defer a.cutter.Cut()
+
+	for _, env := range pending {
+		if batches, _ := a.cutter.Ordered(env); len(batches) > 0 {
+			return batches[0]
+		}
+	}
+
+	if now.Sub(pendingSince) < a.batchInterval() {
+		return nil
+	}
+	return a.cutter.Cut()
+}
+
+// Assemble creates the candidate block of the given batch, chained to the last block.
+func (a *Assembler) Assemble(batch []*cb.Envelope) *cb.Block {
+	return a.support.CreateNextBlock(batch)
+}
+
+// AssembleOn creates the candidate block of the given batch, chained to the
+// given parent block, which may not be written to the ledger yet.
+func (a *Assembler) AssembleOn(parent *cb.Block, batch []*cb.Envelope) *cb.Block {
+	data := &cb.BlockData{Data: make([][]byte, len(batch))}
+	for i, env := range batch {
+		data.Data[i] = protoutil.MarshalOrPanic(env)
+	}
+
+	block := protoutil.NewBlock(parent.Header.Number+1, protoutil.BlockHeaderHash(parent.Header))
+	block.Header.DataHash = protoutil.BlockDataHash(data)
+	block.Data = data
+	return block
+}
+
+func (a *Assembler) batchInterval() time.Duration {
+	if a.maxInterval > 0 {
+		return a.maxInterval
+	}
+	return a.support.SharedConfig().BatchTimeout()
+}
+
+// CompareStates orders candidate blocks deterministically by block number,
+// then by block header hash. Malformed candidates are ordered first.
+func CompareStates(a, b bdls.State) int {
+	blockA, errA := protoutil.UnmarshalBlock(a)
+	blockB, errB := protoutil.UnmarshalBlock(b)
+	switch {
+	case (errA != nil || blockA.Header == nil) && (errB != nil || blockB.Header == nil):
+		return bytes.Compare(a, b)
+	case errA != nil || blockA.Header == nil:
+		return -1
+	case errB != nil || blockB.Header == nil:
+		return 1
+	}
+
+	if blockA.Header.Number != blockB.Header.Number {
+		if blockA.Header.Number < blockB.Header.Number {
+			return -1
+		}
+		return 1
+	}
+
+	if cmp := bytes.Compare(protoutil.BlockHeaderHash(blockA.Header), protoutil.BlockHeaderHash(blockB.Header)); cmp != 0 {
+		return cmp
+	}
+	return bytes.Compare(a, b)
+}
+
+// batchConfigFetcher overrides the batch size of the channel
+// with the request batch options of the BDLS config metadata.
+type batchConfigFetcher struct {
+	support  consensus.ConsenterSupport
+	maxCount uint64
+	maxBytes uint64
+}
+
+func (f *batchConfigFetcher) OrdererConfig() (channelconfig.Orderer, bool) {
+	oc := f.support.SharedConfig()
+	batchSize := &ab.BatchSize{
+		MaxMessageCount:   oc.BatchSize().MaxMessageCount,
+		AbsoluteMaxBytes:  oc.BatchSize().AbsoluteMaxBytes,
+		PreferredMaxBytes: oc.BatchSize().PreferredMaxBytes,
+	}
+	if f.maxCount > 0 {
+		batchSize.MaxMessageCount = uint32(f.maxCount)
+	}
+	if f.maxBytes > 0 {
+		batchSize.PreferredMaxBytes = uint32(f.maxBytes)
+	}
+	return &batchConfig{Orderer: oc, batchSize: batchSize}, true
+}
+
+type batchConfig struct {
+	channelconfig.Orderer
+	batchSize *ab.BatchSize
+}
+
+func (bc *batchConfig) BatchSize() *ab.BatchSize {
+	return bc.batchSize
+}
@@ -0,0 +1,121 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"testing"
+	"time"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft/mocks"
+	consensusmocks "github.com/hyperledger/fabric/orderer/consensus/mocks"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssemblerNextBatch(t *testing.T) {
+	sharedConfig := &mocks.OrdererConfig{}
+	sharedConfig.BatchSizeReturns(&ab.BatchSize{MaxMessageCount: 3, PreferredMaxBytes: 1024 * 1024})
+	sharedConfig.BatchTimeoutReturns(time.Second)
+	support := &consensusmocks.FakeConsenterSupport{}
+	support.ChannelIDReturns(testChannel)
+	support.SharedConfigReturns(sharedConfig)
+
+	var envs []*cb.Envelope
+	for i := 0; i < 4; i++ {
+		envs = append(envs, makeEnvelope(i))
+	}
+	now := time.Now()
+
+	for _, testCase := range []struct {
+		name         string
+		opts         bdlsbft.Options
+		pending      []*cb.Envelope
+		pendingSince time.Time
+		expected     []*cb.Envelope
+	}{
+		{
+			name:         "accumulating",
+			pending:      envs[:2],
+			pendingSince: now,
+		},
+		{
+			name:         "channel batch size reached",
+			pending:      envs,
+			pendingSince: now,
+			expected:     envs[:3],
+		},
+		{
+			name:         "channel batch timeout expired",
+			pending:      envs[:2],
+			pendingSince: now.Add(-time.Second),
+			expected:     envs[:2],
+		},
+		{
+			name:         "request batch max count reached",
+			opts:         bdlsbft.Options{RequestBatchMaxCount: 2},
+			pending:      envs,
+			pendingSince: now,
+			expected:     envs[:2],
+		},
+		{
+			name:         "request batch max bytes reached",
+			opts:         bdlsbft.Options{RequestBatchMaxBytes: uint64(len(envs[0].Payload) + len(envs[1].Payload))},
+			pending:      envs,
+			pendingSince: now,
+			expected:     envs[:2],
+		},
+		{
+			name:         "request batch max interval expired",
+			opts:         bdlsbft.Options{RequestBatchMaxInterval: time.Millisecond},
+			pending:      envs[:1],
+			pendingSince: now.Add(-time.Millisecond),
+			expected:     envs[:1],
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assembler := bdlsbft.NewAssembler(support, testCase.opts)
+			assert.Equal(t, testCase.expected, assembler.NextBatch(testCase.pending, testCase.pendingSince, now))
+			// The assembler does not keep envelopes between batches
+			assert.Equal(t, testCase.expected, assembler.NextBatch(testCase.pending, testCase.pendingSince, now))
+		})
+	}
+}
+
+func TestCompareStates(t *testing.T) {
+	block1 := protoutil.MarshalOrPanic(protoutil.NewBlock(1, []byte("previous")))
+	block2a := protoutil.MarshalOrPanic(protoutil.NewBlock(2, []byte("previous a")))
+	block2b := protoutil.MarshalOrPanic(protoutil.NewBlock(2, []byte("previous b")))
+	malformed := []byte("malformed")
+
+	assert.Equal(t, 0, bdlsbft.CompareStates(block1, block1))
+	assert.Equal(t, -1, bdlsbft.CompareStates(block1, block2a))
+	assert.Equal(t, 1, bdlsbft.CompareStates(block2b, block1))
+	assert.Equal(t, -bdlsbft.CompareStates(block2a, block2b), bdlsbft.CompareStates(block2b, block2a))
+	assert.NotEqual(t, 0, bdlsbft.CompareStates(block2a, block2b))
+	assert.Equal(t, -1, bdlsbft.CompareStates(malformed, block1))
+	assert.Equal(t, 1, bdlsbft.CompareStates(block1, malformed))
+}
+
+func TestAssemblerAssembleOn(t *testing.T) {
+	support := &consensusmocks.FakeConsenterSupport{}
+	support.ChannelIDReturns(testChannel)
+	assembler := bdlsbft.NewAssembler(support, bdlsbft.Options{})
+
+	parent := protoutil.NewBlock(5, []byte("previous"))
+	parent.Data.Data = [][]byte{protoutil.MarshalOrPanic(makeEnvelope(0))}
+	parent.Header.DataHash = protoutil.BlockDataHash(parent.Data)
+
+	batch := []*cb.Envelope{makeEnvelope(1), makeEnvelope(2)}
+	block := assembler.AssembleOn(parent, batch)
+	assert.Equal(t, uint64(6), block.Header.Number)
+	assert.Equal(t, protoutil.BlockHeaderHash(parent.Header), block.Header.PreviousHash)
+	assert.Equal(t, protoutil.BlockDataHash(block.Data), block.Header.DataHash)
+	assert.Equal(t, [][]byte{protoutil.MarshalOrPanic(batch[0]), protoutil.MarshalOrPanic(batch[1])}, block.Data.Data)
+}
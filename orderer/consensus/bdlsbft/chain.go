@@ -0,0 +1,1100 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	bdlspb "github.com/hyperledger/fabric-protos-go/orderer/bdls"
+	"github.com/hyperledger/fabric/common/channelconfig"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/orderer/common/cluster"
+	"github.com/hyperledger/fabric/orderer/common/msgprocessor"
+	types2 "github.com/hyperledger/fabric/orderer/common/types"
+	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// DefaultTickInterval is the interval at which the consensus core is
+// driven forward when no messages arrive.
+const DefaultTickInterval = 20 * time.Millisecond
+
+// MaxMessageBatch is the maximum number of messages
+// whose signatures are verified in parallel.
+const MaxMessageBatch = 64
+
+// Configurator is used to configure the communication layer
+// when the chain starts.
+type Configurator interface {
+	Configure(channel string, newNodes []cluster.RemoteNode)
+}
+
+// Options contains all the configurations relevant to the chain.
+type Options struct {
+	SelfID       uint64
+	Signer       crypto.Signer
+	Participants []bdls.Identity
+	RemoteNodes  []cluster.RemoteNode
+	PublicKeys   map[uint64]*ecdsa.PublicKey
+	TickInterval time.Duration
+	Logger       *flogging.FabricLogger
+
+	// Limits of the envelopes batched into a block, the channel's
+	// batch size and batch timeout apply to the ones which are unset.
+	RequestBatchMaxCount    uint64
+	RequestBatchMaxBytes    uint64
+	RequestBatchMaxInterval time.Duration
+
+	// The consensus state is persisted in these directories,
+	// and is not persisted at all when WALDir is empty.
+	WALDir  string
+	SnapDir string
+
+	// Curve is the elliptic curve of the keys of consenters, which
+	// is the curve of the Signer, usually P-256, when it is unset.
+	Curve elliptic.Curve
+
+	// LeaderElection elects the leaders of rounds,
+	// leaders are elected randomly when it is unset.
+	LeaderElection bdls.LeaderElection
+
+	// Timeouts are the base durations of the stages of rounds,
+	// the durations derive from the latency when they are unset.
+	Timeouts bdls.Timeouts
+
+	// The latency the durations derive from is estimated by the consensus
+	// core when AdaptiveLatency is set, within MinLatency and MaxLatency.
+	// The estimate is recorded in the blocks this consenter proposes, and
+	// the latency recorded in each block decided is adopted, so that the
+	// timeouts of the consenters adapting their latency converge.
+	AdaptiveLatency bool
+	MinLatency      time.Duration
+	MaxLatency      time.Duration
+
+	// The evidence of consenters which have signed conflicting messages
+	// is recorded in the orderer metadata of the blocks this consenter
+	// proposes when RecordEvidence is set, and only logged otherwise.
+	RecordEvidence bool
+
+	// The signatures of the messages received are verified by VerifyWorkers
+	// workers ahead of the consensus core, one per CPU when it is unset.
+	VerifyWorkers int
+
+	// The proofs carried by the <lock>, <select> and <decide> messages this
+	// consenter signs are combined into aggregate proofs when AggregateProofs
+	// is set, consenters verify messages with either kind of proofs.
+	AggregateProofs bool
+
+	// The <roundchange> of the block after next is sent while the next block
+	// is being committed when Pipelining is set, built on the block locked.
+	Pipelining bool
+
+	Metrics *Metrics
+}
+
+type submission struct {
+	env      *cb.Envelope
+	key      string
+	isConfig bool
+}
+
+type message struct {
+	sender  uint64
+	payload []byte
+}
+
+type receivedLock struct {
+	m      *bdls.Message
+	signed *bdls.SignedProto
+}
+
+// Chain implements consensus.Chain interface on top of the BDLS consensus core.
+type Chain struct {
+	Channel string
+	Comm    Configurator
+
+	opts    Options
+	support consensus.ConsenterSupport
+	logger  *flogging.FabricLogger
+	metrics *Metrics
+
+	consensus  *bdls.Consensus
+	rpc        RPC
+	identities Identities
+	assembler  *Assembler
+	verifier   *Verifier
+	storage    *Storage
+
+	createPuller CreateBlockPuller
+
+	// haltCallback is called after the chain halts when this consenter
+	// is removed from the channel, so that a follower takes over.
+	haltCallback func()
+
+	egressesLock sync.RWMutex
+	egresses     []*Egress
+
+	submitC chan *submission
+	msgC    chan *message
+	haltC   chan struct{} // Signals to goroutines that the chain is halting
+	doneC   chan struct{} // Closes when the chain halts
+	startC  chan struct{} // Closes when the node is started
+
+	// The fields below are only accessed by the run goroutine.
+	lastBlock     *cb.Block
+	decidedHeight uint64
+	pending       []*submission
+	pendingSince  time.Time
+	proposed      bool
+	proposedNext  bool
+	receivedLocks []receivedLock
+	evidence      map[equivocation][]byte // not yet recorded in a block
+	removed       bool
+	migrated      bool // the channel migrated to another consensus type
+	syncHeight    uint64
+	proposedAt    time.Time
+
+	// the stage of the consensus core, as last observed
+	stage       string
+	stageHeight uint64
+	stageRound  uint64
+	stageSince  time.Time
+}
+
+// NewChain constructs a chain object.
+func NewChain(support consensus.ConsenterSupport, opts Options, conf Configurator, rpc RPC, f CreateBlockPuller, haltCallback func()) (*Chain, error) {
+	lastBlock := support.Block(support.Height() - 1)
+	if lastBlock == nil {
+		return nil, errors.Errorf("failed to retrieve block [%d]", support.Height()-1)
+	}
+
+	if opts.TickInterval == 0 {
+		opts.TickInterval = DefaultTickInterval
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = NewMetrics(&disabled.Provider{})
+	}
+	if opts.LeaderElection == nil {
+		opts.LeaderElection = bdls.RandomLeader{}
+	}
+
+	logger := opts.Logger.With("channel", support.ChannelID(), "node", opts.SelfID)
+
+	c := &Chain{
+		Channel:       support.ChannelID(),
+		Comm:          conf,
+		egresses:      NewEgresses(support.ChannelID(), opts.RemoteNodes, opts.PublicKeys, rpc, logger),
+		rpc:           rpc,
+		identities:    NewIdentities(opts.PublicKeys),
+		assembler:     NewAssembler(support, opts),
+		verifier:      &Verifier{Support: support},
+		createPuller:  f,
+		haltCallback:  haltCallback,
+		opts:          opts,
+		support:       support,
+		logger:        logger,
+		submitC:       make(chan *submission),
+		msgC:          make(chan *message),
+		haltC:         make(chan struct{}),
+		doneC:         make(chan struct{}),
+		startC:        make(chan struct{}),
+		lastBlock:     lastBlock,
+		decidedHeight: lastBlock.Header.Number,
+		evidence:      make(map[equivocation][]byte),
+	}
+
+	c.metrics = &Metrics{
+		Height:               opts.Metrics.Height.With("channel", support.ChannelID()),
+		Round:                opts.Metrics.Round.With("channel", support.ChannelID()),
+		RoundsPerDecision:    opts.Metrics.RoundsPerDecision.With("channel", support.ChannelID()),
+		StageDuration:        opts.Metrics.StageDuration.With("channel", support.ChannelID()),
+		MessagesReceived:     opts.Metrics.MessagesReceived.With("channel", support.ChannelID()),
+		MessagesSent:         opts.Metrics.MessagesSent.With("channel", support.ChannelID()),
+		VerificationFailures: opts.Metrics.VerificationFailures.With("channel", support.ChannelID()),
+		DecideLatency:        opts.Metrics.DecideLatency.With("channel", support.ChannelID()),
+		Latency:              opts.Metrics.Latency.With("channel", support.ChannelID()),
+		EstimatedLatency:     opts.Metrics.EstimatedLatency.With("channel", support.ChannelID()),
+	}
+
+	var storage *Storage
+	var round uint64
+	var logged [][]byte
+	if opts.WALDir != "" {
+		var err error
+		storage, logged, err = CreateStorage(logger, opts.WALDir, opts.SnapDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to restore persisted BDLS consensus state")
+		}
+		// The ledger may be ahead of the persisted
+		// state if blocks were pulled from others.
+		if storage.Height() == lastBlock.Header.Number {
+			round = storage.Round()
+		}
+	}
+
+	config := &bdls.Config{
+		Epoch:                time.Now(),
+		CurrentHeight:        lastBlock.Header.Number,
+		CurrentState:         decidedState(lastBlock),
+		Signer:               opts.Signer,
+		Curve:                opts.Curve,
+		Participants:         opts.Participants,
+		EnableCommitUnicast:  true,
+		EnableAggregateProof: opts.AggregateProofs,
+		EnablePipelining:     opts.Pipelining,
+		StateCompare:         CompareStates,
+		StateValidate:        c.validateState,
+		MessageValidator:     c.validateMessage,
+		MessageOutCallback:   c.messageOut,
+		EvidenceCallback:     c.onEvidence,
+		PubKeyToIdentity:     c.identities.PubKeyToIdentity,
+		LeaderElection:       opts.LeaderElection,
+		Timeouts:             opts.Timeouts,
+		MinLatency:           opts.MinLatency,
+		MaxLatency:           opts.MaxLatency,
+	}
+
+	// The messages replayed are already persisted,
+	// hence the storage is attached only afterwards.
+	cons, err := bdls.RestoreConsensus(config, round, logged, time.Now())
+	if err != nil {
+		if storage != nil {
+			storage.Close()
+		}
+		return nil, errors.Wrap(err, "failed creating BDLS consensus")
+	}
+	for _, e := range c.egresses {
+		cons.Join(e)
+	}
+	c.consensus = cons
+	c.storage = storage
+
+	return c, nil
+}
+
+// Start instructs the orderer to begin serving the chain and keep it current.
+func (c *Chain) Start() {
+	c.logger.Infof("Starting BDLS node")
+	c.Comm.Configure(c.Channel, c.opts.RemoteNodes)
+	close(c.startC)
+	go c.run()
+}
+
+// Order submits normal type transactions for ordering.
+func (c *Chain) Order(env *cb.Envelope, configSeq uint64) error {
+	seq := c.support.Sequence()
+	if configSeq < seq {
+		c.logger.Warnf("Normal message was validated against %d, although current config seq has advanced (%d)", configSeq, seq)
+		if _, err := c.support.ProcessNormalMsg(env); err != nil {
+			return errors.Errorf("bad normal message: %s", err)
+		}
+	}
+
+	if err := c.submit(env, false); err != nil {
+		return err
+	}
+	c.forward(env)
+	return nil
+}
+
+// Configure submits config type transactions for ordering.
+func (c *Chain) Configure(env *cb.Envelope, configSeq uint64) error {
+	seq := c.support.Sequence()
+	if configSeq < seq {
+		c.logger.Warnf("Config message was validated against %d, although current config seq has advanced (%d)", configSeq, seq)
+		configEnv, _, err := c.support.ProcessConfigMsg(env)
+		if err != nil {
+			return errors.Errorf("bad config message: %s", err)
+		}
+		env = configEnv
+	}
+
+	if err := c.submit(env, true); err != nil {
+		return err
+	}
+	c.forward(env)
+	return nil
+}
+
+// HandleMessage handles a BDLS consensus message sent by another consenter.
+func (c *Chain) HandleMessage(sender uint64, m []byte) {
+	select {
+	case c.msgC <- &message{sender: sender, payload: m}:
+	case <-c.doneC:
+	}
+}
+
+// HandleRequest handles an envelope forwarded by another consenter.
+func (c *Chain) HandleRequest(sender uint64, req []byte) {
+	env, err := protoutil.UnmarshalEnvelope(req)
+	if err != nil {
+		c.logger.Warnf("Malformed request from %d: %v", sender, err)
+		return
+	}
+	chdr, err := protoutil.ChannelHeader(env)
+	if err != nil {
+		c.logger.Warnf("Request from %d has a malformed channel header: %v", sender, err)
+		return
+	}
+
+	isConfig := c.support.ClassifyMsg(chdr) != msgprocessor.NormalMsg
+	if isConfig {
+		// The config is validated as Configure does, but the forwarded envelope
+		// is the one queued, so that it matches the one the sender proposes.
+		_, _, err = c.support.ProcessConfigMsg(env)
+	} else {
+		_, err = c.support.ProcessNormalMsg(env)
+	}
+	if err != nil {
+		c.logger.Warnf("Discarding bad request from %d: %v", sender, err)
+		return
+	}
+
+	if err := c.submit(env, isConfig); err != nil {
+		c.logger.Warnf("Failed enqueueing request from %d: %v", sender, err)
+	}
+}
+
+// forward sends the envelope to all remote consenters, so that every
+// consenter can propose it.
+func (c *Chain) forward(env *cb.Envelope) {
+	c.egressesLock.RLock()
+	defer c.egressesLock.RUnlock()
+
+	for _, e := range c.egresses {
+		e.SendTransaction(env)
+	}
+}
+
+func (c *Chain) submit(env *cb.Envelope, isConfig bool) error {
+	s := &submission{
+		env:      env,
+		key:      string(protoutil.MarshalOrPanic(env)),
+		isConfig: isConfig,
+	}
+	select {
+	case c.submitC <- s:
+		return nil
+	case <-c.doneC:
+		return errors.Errorf("chain is stopped")
+	}
+}
+
+// WaitReady returns an error if the chain has been halted, and nil otherwise.
+func (c *Chain) WaitReady() error {
+	select {
+	case <-c.doneC:
+		return errors.Errorf("chain is stopped")
+	default:
+		return nil
+	}
+}
+
+// Errored returns a channel that closes when the chain stops.
+func (c *Chain) Errored() <-chan struct{} {
+	return c.doneC
+}
+
+// Halt stops the chain.
+func (c *Chain) Halt() {
+	select {
+	case <-c.startC:
+	default:
+		c.logger.Warnf("Attempted to halt a chain that has not started")
+		return
+	}
+
+	select {
+	case c.haltC <- struct{}{}:
+	case <-c.doneC:
+		return
+	}
+	<-c.doneC
+}
+
+// ValidateConsensusMetadata determines the validity of a
+// ConsensusMetadata update during config updates on the channel.
+func (c *Chain) ValidateConsensusMetadata(oldOrdererConfig, newOrdererConfig channelconfig.Orderer, newChannel bool) error {
+	if newOrdererConfig == nil {
+		c.logger.Panic("Programming Error: ValidateConsensusMetadata called with nil new channel config")
+		return nil
+	}
+
+	// metadata was not updated
+	if newOrdererConfig.ConsensusMetadata() == nil {
+		return nil
+	}
+
+	if oldOrdererConfig == nil {
+		c.logger.Panic("Programming Error: ValidateConsensusMetadata called with nil old channel config")
+		return nil
+	}
+
+	if oldOrdererConfig.ConsensusMetadata() == nil {
+		c.logger.Panic("Programming Error: ValidateConsensusMetadata called with nil old metadata")
+		return nil
+	}
+
+	oldMetadata := &bdlspb.ConfigMetadata{}
+	if err := proto.Unmarshal(oldOrdererConfig.ConsensusMetadata(), oldMetadata); err != nil {
+		c.logger.Panicf("Programming Error: Failed to unmarshal old BDLS consensus metadata: %v", err)
+	}
+
+	newMetadata := &bdlspb.ConfigMetadata{}
+	if err := proto.Unmarshal(newOrdererConfig.ConsensusMetadata(), newMetadata); err != nil {
+		return errors.Wrap(err, "failed to unmarshal new BDLS metadata configuration")
+	}
+
+	verifyOpts, err := etcdraft.CreateX509VerifyOptions(newOrdererConfig)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create x509 verify options from old and new orderer config")
+	}
+
+	if err := VerifyConfigMetadata(newMetadata, verifyOpts); err != nil {
+		return errors.Wrap(err, "invalid new config metadata")
+	}
+
+	if newChannel {
+		// check if the consenters are a subset of the existing consenters (system channel consenters)
+		existing := make(map[string]struct{}, len(oldMetadata.Consenters))
+		for _, consenter := range oldMetadata.Consenters {
+			existing[string(consenter.Identity)] = struct{}{}
+		}
+		for _, consenter := range newMetadata.Consenters {
+			if _, exists := existing[string(consenter.Identity)]; !exists {
+				return errors.New("new channel has consenter that is not part of system consenter set")
+			}
+		}
+		return nil
+	}
+
+	return ValidateConsenterChanges(oldMetadata.Consenters, newMetadata.Consenters)
+}
+
+// StatusReport returns the ConsensusRelation & Status
+func (c *Chain) StatusReport() (types2.ConsensusRelation, types2.Status) {
+	return types2.ConsensusRelationConsenter, types2.StatusActive
+}
+
+func (c *Chain) run() {
+	ticker := time.NewTicker(c.opts.TickInterval)
+	defer ticker.Stop()
+	defer c.halted()
+	defer close(c.doneC)
+	defer c.closeStorage()
+	c.reportMetrics(time.Now())
+
+	verifyPool := bdls.NewVerifyPool(c.consensus, c.opts.VerifyWorkers)
+	defer verifyPool.Close()
+
+	for {
+		select {
+		case s := <-c.submitC:
+			c.enqueue(s, time.Now())
+
+		case m := <-c.msgC:
+			// The messages are still received one by one, in order.
+			batch := c.nextMessages(m)
+			payloads := make([][]byte, len(batch))
+			for i, m := range batch {
+				payloads[i] = m.payload
+			}
+			verifyPool.PreVerify(payloads...)
+
+			for _, m := range batch {
+				now := time.Now()
+				if err := c.consensus.ReceiveMessage(m.payload, now); err != nil {
+					c.logger.Debugf("Rejected message from %d: %v", m.sender, err)
+					c.metrics.VerificationFailures.With("reason", failureReason(err)).Add(1)
+				}
+				c.commitDecided()
+				if c.migrated {
+					return
+				}
+				c.persistState()
+				c.reportMetrics(now)
+				if c.removed {
+					return
+				}
+			}
+
+		case now := <-ticker.C:
+			if err := c.consensus.Update(now); err != nil {
+				c.logger.Warnf("Failed updating consensus: %v", err)
+			}
+			c.commitDecided()
+			if c.migrated {
+				return
+			}
+			c.persistState()
+			c.reportMetrics(now)
+			if c.removed {
+				return
+			}
+			c.catchUp()
+			if c.removed || c.migrated {
+				return
+			}
+			c.propose(now)
+			c.proposeNext(now)
+
+		case <-c.haltC:
+			c.logger.Infof("Stop serving requests")
+			return
+		}
+	}
+}
+
+// halted calls the haltCallback once the chain has stopped,
+// if it stopped because this consenter was removed from the channel.
+func (c *Chain) halted() {
+	if c.removed && c.haltCallback != nil {
+		c.haltCallback() // Must be invoked after doneC is closed
+	}
+}
+
+// nextMessages returns the message received along with the messages already
+// waiting to be received, so that their signatures are verified in parallel.
+func (c *Chain) nextMessages(m *message) []*message {
+	batch := []*message{m}
+	for len(batch) < MaxMessageBatch {
+		select {
+		case m := <-c.msgC:
+			batch = append(batch, m)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (c *Chain) enqueue(s *submission, now time.Time) {
+	for _, p := range c.pending {
+		if p.key == s.key {
+			return
+		}
+	}
+	if len(c.pending) == 0 {
+		c.pendingSince = now
+	}
+	c.pending = append(c.pending, s)
+}
+
+// propose hands a candidate block for the next height to the consensus core,
+// once enough envelopes have accumulated or the batch timeout has expired.
+// Config envelopes are always proposed in a block of their own.
+func (c *Chain) propose(now time.Time) {
+	if c.proposed || len(c.pending) == 0 {
+		return
+	}
+
+	batch := c.nextBatch(now)
+	if len(batch) == 0 {
+		return
+	}
+
+	block := c.assembler.Assemble(batch)
+	metadata := &OrdererMetadata{}
+	recordEvidence(metadata, c.evidence)
+	c.recordLatency(metadata)
+	recordOrdererMetadata(block, metadata)
+	c.logger.Debugf("Proposing block [%d] with %d transactions", block.Header.Number, len(batch))
+	c.consensus.Propose(protoutil.MarshalOrPanic(block))
+	c.proposed = true
+	c.proposedAt = now
+}
+
+// proposeNext hands a candidate block for the height after next to the consensus
+// core when pipelining, chained to the block locked at the next height. It holds
+// the pending envelopes the locked block does not include. Config envelopes are
+// not pipelined, nor are blocks chained to a config block.
+func (c *Chain) proposeNext(now time.Time) {
+	if !c.opts.Pipelining || c.proposedNext || len(c.pending) == 0 {
+		return
+	}
+
+	locked := c.consensus.CurrentLock()
+	if locked == nil {
+		return
+	}
+	parent, err := protoutil.UnmarshalBlock(locked)
+	if err != nil || parent.Header == nil || protoutil.IsConfigBlock(parent) {
+		return
+	}
+
+	included := make(map[string]struct{}, len(parent.Data.Data))
+	for _, data := range parent.Data.Data {
+		included[string(data)] = struct{}{}
+	}
+	envs := make([]*cb.Envelope, 0, len(c.pending))
+	for _, p := range c.pending {
+		if p.isConfig {
+			return
+		}
+		if _, exists := included[p.key]; !exists {
+			envs = append(envs, p.env)
+		}
+	}
+	if len(envs) == 0 {
+		return
+	}
+
+	batch := c.assembler.NextBatch(envs, c.pendingSince, now)
+	if len(batch) == 0 {
+		return
+	}
+
+	block := c.assembler.AssembleOn(parent, batch)
+	metadata := &OrdererMetadata{}
+	c.recordLatency(metadata)
+	recordOrdererMetadata(block, metadata)
+	c.logger.Debugf("Proposing block [%d] with %d transactions ahead", block.Header.Number, len(batch))
+	c.consensus.ProposeNext(protoutil.MarshalOrPanic(block))
+	c.proposedNext = true
+}
+
+func (c *Chain) nextBatch(now time.Time) []*cb.Envelope {
+	for _, p := range c.pending {
+		if p.isConfig {
+			return []*cb.Envelope{p.env}
+		}
+	}
+
+	envs := make([]*cb.Envelope, 0, len(c.pending))
+	for _, p := range c.pending {
+		envs = append(envs, p.env)
+	}
+	return c.assembler.NextBatch(envs, c.pendingSince, now)
+}
+
+// commitDecided writes the block decided by the consensus core to the ledger.
+func (c *Chain) commitDecided() {
+	height, round, state := c.consensus.CurrentState()
+	if height == c.decidedHeight {
+		return
+	}
+	c.decidedHeight = height
+	c.receivedLocks = nil
+
+	c.metrics.RoundsPerDecision.Observe(float64(round + 1))
+	if c.proposed {
+		c.metrics.DecideLatency.Observe(time.Since(c.proposedAt).Seconds())
+	}
+
+	expected := c.lastBlock.Header.Number + 1
+	if height != expected {
+		c.logger.Warnf("Decided height %d is ahead of the next block to be written [%d]", height, expected)
+		return
+	}
+
+	block, err := protoutil.UnmarshalBlock(state)
+	if err != nil {
+		c.logger.Panicf("Failed unmarshaling decided block [%d]: %v", height, err)
+	}
+
+	c.removeIncluded(block)
+	c.removeRecordedEvidence(block)
+	c.adoptLatency(block)
+	c.proposed = false
+	c.proposedNext = false
+
+	// The <decide> proof is embedded in the block metadata,
+	// so that the block can be verified by anyone who knows the consenters.
+	proof, err := c.consensus.CurrentProof().Marshal()
+	if err != nil {
+		c.logger.Panicf("Failed marshaling the decide proof of block [%d]: %v", height, err)
+	}
+
+	if protoutil.IsConfigBlock(block) {
+		c.logger.Infof("Writing config block [%d] to the ledger", block.Header.Number)
+		c.support.WriteConfigBlock(block, proof)
+		c.lastBlock = block
+		c.reconfigure(block)
+		return
+	}
+
+	c.logger.Debugf("Writing block [%d] with %d transactions to the ledger", block.Header.Number, len(block.Data.Data))
+	c.support.WriteBlock(block, proof)
+	c.lastBlock = block
+}
+
+// reconfigure switches the BDLS participants to the consenters of the config
+// block just written, from the height of the block on. Every consenter switches
+// at the same height, as the switch only depends on the decided blocks.
+func (c *Chain) reconfigure(block *cb.Block) {
+	// The chain is restarted under the new consenter once the block that
+	// migrates the channel to another consensus type is committed. Until then,
+	// this chain stops, as it must neither order nor persist anything past it.
+	if consensusType := c.support.SharedConfig().ConsensusType(); consensusType != "bdls" {
+		c.logger.Infof("Config block [%d] migrates the channel to consensus type %s, stopping", block.Header.Number, consensusType)
+		c.migrated = true
+		return
+	}
+
+	m := &bdlspb.ConfigMetadata{}
+	if err := proto.Unmarshal(c.support.SharedConfig().ConsensusMetadata(), m); err != nil {
+		c.logger.Panicf("Failed to unmarshal consensus metadata of config block [%d]: %v", block.Header.Number, err)
+	}
+
+	// The leaders of the next heights are elected as the new options call for.
+	c.opts.LeaderElection = LeaderElection(m.Options)
+	c.consensus.SetLeaderElection(c.opts.LeaderElection)
+
+	// The timeouts were validated along with the options by VerifyConfigMetadata,
+	// they apply from the stages the consensus enters next.
+	timeouts, err := Timeouts(m.Options)
+	if err != nil {
+		c.logger.Panicf("Failed deriving BDLS timeouts of config block [%d]: %v", block.Header.Number, err)
+	}
+	if err := c.consensus.SetTimeouts(timeouts); err != nil {
+		c.logger.Panicf("Failed setting BDLS timeouts of config block [%d]: %v", block.Header.Number, err)
+	}
+	c.opts.Timeouts = timeouts
+
+	// The consenters were validated by ValidateConsensusMetadata
+	// before the config transaction was ordered.
+	participants, err := Participants(m.Consenters)
+	if err != nil {
+		c.logger.Panicf("Failed deriving BDLS participants of config block [%d]: %v", block.Header.Number, err)
+	}
+	if reflect.DeepEqual(participants, c.opts.Participants) {
+		return
+	}
+
+	publicKeys, err := PublicKeysFromConsenters(m.Consenters)
+	if err != nil {
+		c.logger.Panicf("Failed extracting consenter public keys of config block [%d]: %v", block.Header.Number, err)
+	}
+	if _, exists := publicKeys[c.opts.SelfID]; !exists {
+		c.logger.Warningf("This node was removed from the consenters in config block [%d], halting", block.Header.Number)
+		c.removed = true
+		return
+	}
+
+	remoteNodes, err := RemoteNodesFromConsenters(m.Consenters, c.opts.SelfID, c.logger)
+	if err != nil {
+		c.logger.Panicf("Failed computing remote nodes of config block [%d]: %v", block.Header.Number, err)
+	}
+
+	c.egressesLock.Lock()
+	for _, e := range c.egresses {
+		c.consensus.Leave(e.RemoteAddr())
+	}
+	c.egresses = NewEgresses(c.Channel, remoteNodes, publicKeys, c.rpc, c.logger)
+	for _, e := range c.egresses {
+		c.consensus.Join(e)
+	}
+	c.egressesLock.Unlock()
+
+	c.identities = NewIdentities(publicKeys)
+	// the evidence against consenters removed would not be accepted anymore
+	for key := range c.evidence {
+		if _, exists := c.identities[key.identity]; !exists {
+			delete(c.evidence, key)
+		}
+	}
+	c.opts.Participants = participants
+	c.opts.RemoteNodes = remoteNodes
+	c.opts.PublicKeys = publicKeys
+	c.Comm.Configure(c.Channel, remoteNodes)
+
+	if err := c.consensus.SetParticipants(block.Header.Number, participants, time.Now()); err != nil {
+		c.logger.Panicf("Failed switching BDLS participants at block [%d]: %v", block.Header.Number, err)
+	}
+	c.logger.Infof("Switched to %d BDLS participants from block [%d] on", len(participants), block.Header.Number)
+}
+
+// catchUp pulls the blocks decided by the other consenters while this consenter
+// lagged behind, and rejoins the consensus at the height of the last of them.
+func (c *Chain) catchUp() {
+	if c.syncHeight <= c.decidedHeight || c.createPuller == nil {
+		return
+	}
+	c.logger.Infof("Consenters have decided block [%d], catching up from block [%d]", c.syncHeight, c.lastBlock.Header.Number)
+	c.syncHeight = 0
+
+	puller, err := c.createPuller()
+	if err != nil {
+		c.logger.Errorf("Failed creating a block puller: %v", err)
+		return
+	}
+
+	sync := &Synchronizer{
+		Support:     c.support,
+		BlockPuller: puller,
+		ClusterSize: uint64(len(c.opts.Participants)),
+		Logger:      c.logger,
+		VerifyBlock: c.verifyDecided,
+		OnCommit:    c.onSynced,
+		Done:        func() bool { return c.migrated },
+	}
+	if _, err := sync.Sync(); err != nil {
+		c.logger.Warnf("Could not synchronize with remote consenters: %v", err)
+	}
+	if c.migrated {
+		return
+	}
+	c.persistState()
+}
+
+// verifyDecided verifies the <decide> proof embedded in a pulled block, and
+// moves the consensus core to the height of the block.
+func (c *Chain) verifyDecided(block *cb.Block) ([]byte, error) {
+	proof, m, err := decideProof(block)
+	if err != nil {
+		return nil, err
+	}
+	if m.Height != block.Header.Number {
+		return nil, errors.Errorf("decide proof is for height %d", m.Height)
+	}
+
+	decided, err := protoutil.UnmarshalBlock(m.State)
+	if err != nil || decided.Header == nil {
+		return nil, errors.New("decided state is not a block")
+	}
+	if !bytes.Equal(protoutil.BlockHeaderHash(decided.Header), protoutil.BlockHeaderHash(block.Header)) {
+		return nil, errors.New("decided state does not match the block header")
+	}
+
+	if err := c.consensus.SyncDecided(proof, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "invalid decide proof")
+	}
+	return proof, nil
+}
+
+// decideProof extracts the <decide> proof embedded in the block metadata,
+// along with the <decide> message it carries.
+func decideProof(block *cb.Block) ([]byte, *bdls.Message, error) {
+	consenterMetadata, err := protoutil.GetConsenterMetadataFromBlock(block)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed extracting consenter metadata")
+	}
+	decide, err := bdls.DecodeSignedMessage(consenterMetadata.Value)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed unmarshaling decide proof")
+	}
+	m, err := bdls.DecodeMessage(decide.Message)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed unmarshaling decide message")
+	}
+	return consenterMetadata.Value, m, nil
+}
+
+// decidedState returns the state decided for the block, which seeds the election
+// of the leaders at the next height. Blocks without a <decide> proof, such as the
+// genesis block, have no decided state.
+func decidedState(block *cb.Block) bdls.State {
+	_, m, err := decideProof(block)
+	if err != nil || m.Height != block.Header.Number {
+		return nil
+	}
+	return m.State
+}
+
+// onSynced keeps track of a pulled block written to the ledger.
+func (c *Chain) onSynced(block *cb.Block) {
+	c.decidedHeight = block.Header.Number
+	c.receivedLocks = nil
+	c.lastBlock = block
+	c.removeIncluded(block)
+	c.removeRecordedEvidence(block)
+	c.adoptLatency(block)
+	c.proposed = false
+	c.proposedNext = false
+
+	if protoutil.IsConfigBlock(block) {
+		c.reconfigure(block)
+	}
+}
+
+// removeIncluded drops the pending envelopes included in the given block.
+func (c *Chain) removeIncluded(block *cb.Block) {
+	included := make(map[string]struct{}, len(block.Data.Data))
+	for _, data := range block.Data.Data {
+		included[string(data)] = struct{}{}
+	}
+
+	remaining := c.pending[:0]
+	for _, p := range c.pending {
+		if _, exists := included[p.key]; !exists {
+			remaining = append(remaining, p)
+		}
+	}
+	for i := len(remaining); i < len(c.pending); i++ {
+		c.pending[i] = nil
+	}
+	c.pending = remaining
+	c.pendingSince = time.Now()
+}
+
+// validateState checks that the state is a valid candidate block
+// for the next height.
+func (c *Chain) validateState(s bdls.State) bool {
+	block, err := protoutil.UnmarshalBlock(s)
+	if err != nil {
+		c.logger.Debugf("Rejecting malformed state: %v", err)
+		return false
+	}
+	parent := c.parentBlock()
+	if parent != c.lastBlock && protoutil.IsConfigBlock(parent) {
+		c.logger.Debugf("Rejecting state chained to config block [%d] not yet written", parent.Header.Number)
+		return false
+	}
+	if err := c.verifier.VerifyBlock(block, parent); err != nil {
+		c.logger.Debugf("Rejecting invalid state: %v", err)
+		return false
+	}
+	if err := c.verifyEvidence(block); err != nil {
+		c.logger.Debugf("Rejecting state with invalid evidence: %v", err)
+		return false
+	}
+	if err := verifyLatency(block); err != nil {
+		c.logger.Debugf("Rejecting state with invalid latency: %v", err)
+		return false
+	}
+	return true
+}
+
+// parentBlock returns the block the candidate blocks for the next height of the
+// consensus core are chained to. When pipelining, the core validates the states
+// pipelined for its next height before the block it decided is written.
+func (c *Chain) parentBlock() *cb.Block {
+	if c.consensus == nil {
+		return c.lastBlock
+	}
+	height, _, state := c.consensus.CurrentState()
+	if height != c.lastBlock.Header.Number+1 {
+		return c.lastBlock
+	}
+	block, err := protoutil.UnmarshalBlock(state)
+	if err != nil || block.Header == nil {
+		return c.lastBlock
+	}
+	return block
+}
+
+// validateMessage accepts only messages of consenters, and keeps the <lock>
+// messages received for the next height, so that the one this consenter
+// commits to can be persisted along with its <commit>.
+func (c *Chain) validateMessage(cons *bdls.Consensus, m *bdls.Message, signed *bdls.SignedProto) bool {
+	if !c.identities.MessageValidator(cons, m, signed) {
+		return false
+	}
+
+	// messages sent to itself are looped back
+	id, _ := c.identities.ConsenterID(signed)
+	if id != c.opts.SelfID {
+		c.metrics.MessagesReceived.With("type", m.Type.String()).Add(1)
+	}
+
+	// A message beyond the next height reveals that this consenter
+	// lags behind, hence the blocks it missed are pulled on the next tick.
+	// The <roundchange> messages of the height after next are sent ahead by
+	// pipelining consenters, they are kept by the core only when pipelining.
+	if m.Type == bdls.MessageType_RoundChange && m.Height == c.decidedHeight+2 && m.Round == 0 {
+		return c.opts.Pipelining
+	}
+	if m.Height > c.decidedHeight+1 {
+		if m.Height-1 > c.syncHeight {
+			c.syncHeight = m.Height - 1
+		}
+		return false
+	}
+
+	// the locks sent by this consenter are persisted when sent
+	if c.storage != nil && m.Type == bdls.MessageType_Lock && m.Height == c.decidedHeight+1 && id != c.opts.SelfID {
+		c.receivedLocks = append(c.receivedLocks, receivedLock{m: m, signed: signed})
+	}
+	return true
+}
+
+// messageOut is called with every message the consensus core sends.
+func (c *Chain) messageOut(m *bdls.Message, signed *bdls.SignedProto) {
+	c.metrics.MessagesSent.With("type", m.Type.String()).Add(1)
+	c.persistMessage(m, signed)
+}
+
+// persistMessage persists the <roundchange>, <lock>, <commit> and <decide> messages
+// before they are sent. A <commit> is preceded by the <lock> it commits to. As the
+// <roundchange> of a round is restored, a restarted consenter does not sign another.
+func (c *Chain) persistMessage(m *bdls.Message, signed *bdls.SignedProto) {
+	if c.storage == nil {
+		return
+	}
+
+	switch m.Type {
+	case bdls.MessageType_Commit:
+		for _, lock := range c.receivedLocks {
+			if lock.m.Round == m.Round && bytes.Equal(lock.m.State, m.State) {
+				c.storeMessage(lock.m, lock.signed)
+				break
+			}
+		}
+		c.storeMessage(m, signed)
+	case bdls.MessageType_RoundChange, bdls.MessageType_Lock, bdls.MessageType_Decide:
+		c.storeMessage(m, signed)
+	}
+}
+
+func (c *Chain) storeMessage(m *bdls.Message, signed *bdls.SignedProto) {
+	if err := c.storage.Store(m, signed); err != nil {
+		c.logger.Panicf("Failed persisting %s message of height %d and round %d: %v", m.Type, m.Height, m.Round, err)
+	}
+}
+
+// persistState persists the height and round of the consensus core.
+func (c *Chain) persistState() {
+	if c.storage == nil {
+		return
+	}
+
+	height, _, _ := c.consensus.CurrentState()
+	if err := c.storage.SetState(height, c.consensus.CurrentRound()); err != nil {
+		c.logger.Panicf("Failed persisting height %d and round %d: %v", height, c.consensus.CurrentRound(), err)
+	}
+}
+
+// reportMetrics reports the height, round and latency of the consensus core,
+// and the time spent in the stage it leaves, if any.
+func (c *Chain) reportMetrics(now time.Time) {
+	height, _, _ := c.consensus.CurrentState()
+	round, stage := c.consensus.CurrentRound(), c.consensus.CurrentStage()
+	c.metrics.Height.Set(float64(height))
+	c.metrics.Round.Set(float64(round))
+	c.metrics.Latency.Set(c.consensus.Latency().Seconds())
+	c.metrics.EstimatedLatency.Set(c.consensus.EstimatedLatency().Seconds())
+
+	if stage == c.stage && height == c.stageHeight && round == c.stageRound {
+		return
+	}
+	if !c.stageSince.IsZero() {
+		c.metrics.StageDuration.With("stage", c.stage).Observe(now.Sub(c.stageSince).Seconds())
+	}
+	c.stage, c.stageHeight, c.stageRound, c.stageSince = stage, height, round, now
+}
+
+func (c *Chain) closeStorage() {
+	if c.storage == nil {
+		return
+	}
+
+	if err := c.storage.Close(); err != nil {
+		c.logger.Errorf("Failed closing the BDLS consensus storage: %v", err)
+	}
+}
@@ -0,0 +1,700 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/Sperax/bdls/crypto/blake2b"
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
+	bdlspb "github.com/hyperledger/fabric-protos-go/orderer/bdls"
+	"github.com/hyperledger/fabric/common/channelconfig"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/orderer/common/cluster"
+	"github.com/hyperledger/fabric/orderer/common/msgprocessor"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft/mocks"
+	consensusmocks "github.com/hyperledger/fabric/orderer/consensus/mocks"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChannel = "testchannel"
+
+// network routes messages between chains in memory.
+type network struct {
+	lock   sync.RWMutex
+	chains map[uint64]*bdlsbft.Chain
+	missed map[uint64][]missedMessage // consensus messages sent to disconnected nodes
+}
+
+type missedMessage struct {
+	from    uint64
+	payload []byte
+}
+
+func (n *network) chain(id uint64) *bdlsbft.Chain {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.chains[id]
+}
+
+type rpc struct {
+	from uint64
+	net  *network
+}
+
+func (r *rpc) SendConsensus(dest uint64, msg *ab.ConsensusRequest) error {
+	c := r.net.chain(dest)
+	if c == nil {
+		r.net.lock.Lock()
+		r.net.missed[dest] = append(r.net.missed[dest], missedMessage{from: r.from, payload: msg.Payload})
+		r.net.lock.Unlock()
+		return fmt.Errorf("node %d not found", dest)
+	}
+	go c.HandleMessage(r.from, msg.Payload)
+	return nil
+}
+
+func (r *rpc) SendSubmit(dest uint64, request *ab.SubmitRequest) error {
+	c := r.net.chain(dest)
+	if c == nil {
+		return fmt.Errorf("node %d not found", dest)
+	}
+	go c.HandleRequest(r.from, protoutil.MarshalOrPanic(request.Payload))
+	return nil
+}
+
+type noopConfigurator struct{}
+
+func (noopConfigurator) Configure(channel string, newNodes []cluster.RemoteNode) {}
+
+// ledger is an in-memory ledger backing a fake consenter support.
+type ledger struct {
+	lock     sync.Mutex
+	blocks   []*cb.Block
+	last     *cb.Block
+	metadata map[uint64][]byte
+}
+
+func (l *ledger) height() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return uint64(len(l.blocks))
+}
+
+func (l *ledger) block(number uint64) *cb.Block {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if number >= uint64(len(l.blocks)) {
+		return nil
+	}
+	return l.blocks[number]
+}
+
+func (l *ledger) createNextBlock(envs []*cb.Envelope) *cb.Block {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	data := &cb.BlockData{}
+	for _, env := range envs {
+		data.Data = append(data.Data, protoutil.MarshalOrPanic(env))
+	}
+	block := protoutil.NewBlock(l.last.Header.Number+1, protoutil.BlockHeaderHash(l.last.Header))
+	block.Header.DataHash = protoutil.BlockDataHash(data)
+	block.Data = data
+	return block
+}
+
+// write appends the block, embedding the consenter metadata
+// in its signatures metadata as the block writer does.
+func (l *ledger) write(block *cb.Block, encodedMetadataValue []byte) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	block.Metadata.Metadata[cb.BlockMetadataIndex_SIGNATURES] = protoutil.MarshalOrPanic(&cb.Metadata{
+		Value: protoutil.MarshalOrPanic(&cb.OrdererBlockMetadata{
+			ConsenterMetadata: protoutil.MarshalOrPanic(&cb.Metadata{Value: encodedMetadataValue}),
+		}),
+	})
+	l.blocks = append(l.blocks, block)
+	l.last = block
+	l.metadata[block.Header.Number] = encodedMetadataValue
+}
+
+func (l *ledger) consenterMetadata(number uint64) []byte {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.metadata[number]
+}
+
+// puller pulls blocks from the ledgers of other nodes.
+type puller struct {
+	ledgers []*ledger
+}
+
+func (p *puller) PullBlock(seq uint64) *cb.Block {
+	for _, l := range p.ledgers {
+		if block := l.block(seq); block != nil {
+			return proto.Clone(block).(*cb.Block)
+		}
+	}
+	return nil
+}
+
+func (p *puller) HeightsByEndpoints() (map[string]uint64, error) {
+	heights := make(map[string]uint64, len(p.ledgers))
+	for i, l := range p.ledgers {
+		heights[fmt.Sprintf("node%d", i)] = l.height()
+	}
+	return heights, nil
+}
+
+func (p *puller) Close() {}
+
+// newSupport creates a consenter support on top of an in-memory ledger, with
+// the given consensus metadata. Config blocks carry the consensus metadata
+// they change to as the data of their envelope.
+func newSupport(genesis *cb.Block, consensusMetadata []byte) (*consensusmocks.FakeConsenterSupport, *ledger) {
+	l := &ledger{blocks: []*cb.Block{genesis}, last: genesis, metadata: make(map[uint64][]byte)}
+
+	sharedConfig := &mocks.OrdererConfig{}
+	sharedConfig.BatchSizeReturns(&ab.BatchSize{MaxMessageCount: 10, PreferredMaxBytes: 1024 * 1024})
+	sharedConfig.BatchTimeoutReturns(100 * time.Millisecond)
+	sharedConfig.ConsensusTypeReturns("bdls")
+	sharedConfig.ConsensusMetadataReturns(consensusMetadata)
+
+	support := &consensusmocks.FakeConsenterSupport{}
+	support.ChannelIDReturns(testChannel)
+	support.SharedConfigReturns(sharedConfig)
+	support.HeightStub = l.height
+	support.BlockStub = l.block
+	support.CreateNextBlockStub = l.createNextBlock
+	support.WriteBlockStub = l.write
+	support.WriteConfigBlockStub = func(block *cb.Block, encodedMetadataValue []byte) {
+		l.write(block, encodedMetadataValue)
+		sharedConfig.ConsensusMetadataReturns(consensusMetadataOf(protoutil.ExtractEnvelopeOrPanic(block, 0)))
+	}
+	support.ClassifyMsgStub = func(chdr *cb.ChannelHeader) msgprocessor.Classification {
+		if chdr.Type == int32(cb.HeaderType_CONFIG) {
+			return msgprocessor.ConfigMsg
+		}
+		return msgprocessor.NormalMsg
+	}
+	// re-processing a config envelope yields the same config
+	support.ProcessConfigMsgStub = func(env *cb.Envelope) (*cb.Envelope, uint64, error) {
+		return env, 0, nil
+	}
+	return support, l
+}
+
+// makeConfigEnvelope creates a config envelope whose config changes
+// the consensus metadata of the orderer to the given one.
+func makeConfigEnvelope(consensusMetadata *bdlspb.ConfigMetadata) *cb.Envelope {
+	consensusType := &ab.ConsensusType{Type: "bdls", Metadata: protoutil.MarshalOrPanic(consensusMetadata)}
+	config := &cb.Config{
+		ChannelGroup: &cb.ConfigGroup{
+			Groups: map[string]*cb.ConfigGroup{
+				channelconfig.OrdererGroupKey: {
+					Values: map[string]*cb.ConfigValue{
+						channelconfig.ConsensusTypeKey: {Value: protoutil.MarshalOrPanic(consensusType)},
+					},
+				},
+			},
+		},
+	}
+	return &cb.Envelope{
+		Payload: protoutil.MarshalOrPanic(&cb.Payload{
+			Header: &cb.Header{
+				ChannelHeader: protoutil.MarshalOrPanic(&cb.ChannelHeader{
+					Type:      int32(cb.HeaderType_CONFIG),
+					ChannelId: testChannel,
+					TxId:      "config",
+				}),
+			},
+			Data: protoutil.MarshalOrPanic(&cb.ConfigEnvelope{Config: config}),
+		}),
+	}
+}
+
+// consensusMetadataOf returns the consensus metadata in the config of an
+// envelope created by makeConfigEnvelope.
+func consensusMetadataOf(env *cb.Envelope) []byte {
+	configEnvelope := &cb.ConfigEnvelope{}
+	if _, err := protoutil.UnmarshalEnvelopeOfType(env, cb.HeaderType_CONFIG, configEnvelope); err != nil {
+		panic(err)
+	}
+	value := configEnvelope.Config.ChannelGroup.Groups[channelconfig.OrdererGroupKey].Values[channelconfig.ConsensusTypeKey]
+	consensusType := &ab.ConsensusType{}
+	if err := proto.Unmarshal(value.Value, consensusType); err != nil {
+		panic(err)
+	}
+	return consensusType.Metadata
+}
+
+func makeEnvelope(i int) *cb.Envelope {
+	return &cb.Envelope{
+		Payload: protoutil.MarshalOrPanic(&cb.Payload{
+			Header: &cb.Header{
+				ChannelHeader: protoutil.MarshalOrPanic(&cb.ChannelHeader{
+					Type:      int32(cb.HeaderType_ENDORSER_TRANSACTION),
+					ChannelId: testChannel,
+					TxId:      fmt.Sprintf("tx%d", i),
+				}),
+			},
+			Data: []byte(fmt.Sprintf("data %d", i)),
+		}),
+	}
+}
+
+type testNode struct {
+	chain   *bdlsbft.Chain
+	ledger  *ledger
+	support *consensusmocks.FakeConsenterSupport
+	opts    bdlsbft.Options
+	net     *network
+	puller  bdlsbft.CreateBlockPuller
+	removed chan struct{} // signaled when the chain halts after the node is removed
+}
+
+// haltCallback signals that the chain of the node halted after it was removed.
+func (n *testNode) haltCallback() {
+	select {
+	case n.removed <- struct{}{}:
+	default:
+	}
+}
+
+// restart halts the chain of the node, and replaces it with
+// a new chain on top of the same ledger and options.
+func (n *testNode) restart(t *testing.T) {
+	n.chain.Halt()
+	chain, err := bdlsbft.NewChain(n.support, n.opts, noopConfigurator{}, &rpc{from: n.opts.SelfID, net: n.net}, n.puller, n.haltCallback)
+	require.NoError(t, err)
+
+	n.net.lock.Lock()
+	n.net.chains[n.opts.SelfID] = chain
+	n.net.lock.Unlock()
+	n.chain = chain
+	n.chain.Start()
+}
+
+// newTestNetwork creates the chains of a network of the given size.
+// The consensus state of the chains is persisted under walDir, unless it is empty.
+func newTestNetwork(t *testing.T, size int, walDir string) []*testNode {
+	consenters, keys := makeConsentersWithKeys(t, size)
+	metadata := &bdlspb.ConfigMetadata{Consenters: consenters, Options: &bdlspb.Options{}}
+	participants, err := bdlsbft.Participants(consenters)
+	require.NoError(t, err)
+	publicKeys, err := bdlsbft.PublicKeysFromConsenters(consenters)
+	require.NoError(t, err)
+
+	genesis := protoutil.NewBlock(0, nil)
+	genesis.Data.Data = [][]byte{protoutil.MarshalOrPanic(makeEnvelope(-1))}
+	genesis.Header.DataHash = protoutil.BlockDataHash(genesis.Data)
+
+	net := &network{chains: make(map[uint64]*bdlsbft.Chain), missed: make(map[uint64][]missedMessage)}
+	var nodes []*testNode
+	for i := 0; i < size; i++ {
+		id := uint64(i + 1)
+		remoteNodes, err := bdlsbft.RemoteNodesFromConsenters(consenters, id, flogging.MustGetLogger("test"))
+		require.NoError(t, err)
+
+		support, l := newSupport(proto.Clone(genesis).(*cb.Block), protoutil.MarshalOrPanic(metadata))
+		opts := bdlsbft.Options{
+			SelfID:       id,
+			Signer:       keys[i],
+			Participants: participants,
+			RemoteNodes:  remoteNodes,
+			PublicKeys:   publicKeys,
+			Logger:       flogging.MustGetLogger("test"),
+		}
+		if walDir != "" {
+			opts.WALDir = filepath.Join(walDir, fmt.Sprintf("node%d", id), "wal")
+			opts.SnapDir = filepath.Join(walDir, fmt.Sprintf("node%d", id), "snap")
+		}
+		// blocks are pulled from the ledgers of all the other nodes
+		createPuller := func() (bdlsbft.BlockPuller, error) {
+			p := &puller{}
+			for _, n := range nodes {
+				if n.opts.SelfID != id {
+					p.ledgers = append(p.ledgers, n.ledger)
+				}
+			}
+			return p, nil
+		}
+		n := &testNode{ledger: l, support: support, opts: opts, net: net, puller: createPuller, removed: make(chan struct{}, 1)}
+		chain, err := bdlsbft.NewChain(support, opts, noopConfigurator{}, &rpc{from: id, net: net}, createPuller, n.haltCallback)
+		require.NoError(t, err)
+		n.chain = chain
+
+		net.lock.Lock()
+		net.chains[id] = chain
+		net.lock.Unlock()
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func TestChainOrdersTransactions(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	for _, n := range nodes {
+		n.chain.Start()
+		defer n.chain.Halt()
+	}
+
+	for i := 0; i < 6; i++ {
+		err := nodes[i%len(nodes)].chain.Order(makeEnvelope(i), 0)
+		require.NoError(t, err)
+	}
+
+	txCount := func(l *ledger) int {
+		count := 0
+		for number := uint64(1); number < l.height(); number++ {
+			count += len(l.block(number).Data.Data)
+		}
+		return count
+	}
+
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return txCount(n.ledger) == 6 }, 60*time.Second, 50*time.Millisecond)
+	}
+
+	height := nodes[0].ledger.height()
+	for _, n := range nodes {
+		for number := uint64(1); number < height; number++ {
+			proof := &bdls.SignedProto{}
+			require.NoError(t, proof.Unmarshal(n.ledger.consenterMetadata(number)))
+			m := &bdls.Message{}
+			require.NoError(t, m.Unmarshal(proof.Message))
+			assert.Equal(t, bdls.MessageType_Decide, m.Type)
+			assert.Equal(t, number, m.Height)
+		}
+	}
+	for _, n := range nodes[1:] {
+		require.Equal(t, height, n.ledger.height())
+		for number := uint64(0); number < height; number++ {
+			assert.Equal(t, protoutil.BlockHeaderHash(nodes[0].ledger.block(number).Header), protoutil.BlockHeaderHash(n.ledger.block(number).Header))
+		}
+	}
+}
+
+func TestChainDiscardsBadForwardedConfig(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	for _, n := range nodes {
+		n.support.ProcessConfigMsgReturns(nil, 0, errors.New("bad config"))
+		n.chain.Start()
+		defer n.chain.Halt()
+	}
+
+	// the config envelope is forwarded by the first consenter without having been validated
+	config := protoutil.MarshalOrPanic(makeConfigEnvelope(&bdlspb.ConfigMetadata{}))
+	for _, n := range nodes[1:] {
+		n.chain.HandleRequest(1, config)
+	}
+	require.NoError(t, nodes[0].chain.Order(makeEnvelope(0), 0))
+
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 2 }, 60*time.Second, 50*time.Millisecond)
+		assert.False(t, protoutil.IsConfigBlock(n.ledger.block(1)))
+	}
+	for _, n := range nodes[1:] {
+		assert.Equal(t, 1, n.support.ProcessConfigMsgCallCount())
+	}
+	assert.Never(t, func() bool { return nodes[0].ledger.height() > 2 }, time.Second, 50*time.Millisecond)
+}
+
+func TestChainLeaderElection(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	for _, n := range nodes {
+		n.chain.Start()
+		defer n.chain.Halt()
+	}
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, nodes[i].chain.Order(makeEnvelope(i), 0))
+		for _, n := range nodes {
+			assert.Eventually(t, func() bool { return n.ledger.height() == uint64(i+2) }, 60*time.Second, 50*time.Millisecond)
+		}
+	}
+
+	// every block was decided by the leader the random
+	// beacon seeded with the previous block elected
+	participants := nodes[0].opts.Participants
+	curve := nodes[0].opts.PublicKeys[1].Curve
+	var decided bdls.State
+	for number := uint64(1); number < nodes[0].ledger.height(); number++ {
+		proof := &bdls.SignedProto{}
+		require.NoError(t, proof.Unmarshal(nodes[0].ledger.consenterMetadata(number)))
+		m := &bdls.Message{}
+		require.NoError(t, m.Unmarshal(proof.Message))
+
+		leader := bdls.RandomLeader{}.Leader(participants, number, m.Round, blake2b.Sum256(decided))
+		assert.Equal(t, leader, bdls.DefaultPubKeyToIdentity(proof.PublicKey(curve)))
+		decided = m.State
+	}
+}
+
+func TestChainHalt(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	chain := nodes[0].chain
+
+	// halting a chain that was never started is a no-op
+	chain.Halt()
+	assert.NoError(t, chain.WaitReady())
+
+	chain.Start()
+	assert.NoError(t, chain.WaitReady())
+	chain.Halt()
+
+	select {
+	case <-chain.Errored():
+	default:
+		t.Fatal("Errored channel should be closed after halt")
+	}
+	assert.EqualError(t, chain.WaitReady(), "chain is stopped")
+	assert.EqualError(t, chain.Order(makeEnvelope(0), 0), "chain is stopped")
+}
+
+func TestChainRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdls-chain")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	nodes := newTestNetwork(t, 4, dir)
+	for _, n := range nodes {
+		n.chain.Start()
+	}
+	defer func() {
+		for _, n := range nodes {
+			n.chain.Halt()
+		}
+	}()
+
+	require.NoError(t, nodes[0].chain.Order(makeEnvelope(0), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 2 }, 60*time.Second, 50*time.Millisecond)
+	}
+
+	// the restarted node restores its consensus state, and keeps on ordering
+	nodes[0].restart(t)
+	require.NoError(t, nodes[1].chain.Order(makeEnvelope(1), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 3 }, 60*time.Second, 50*time.Millisecond)
+	}
+	for _, n := range nodes[1:] {
+		assert.Equal(t, protoutil.BlockHeaderHash(nodes[0].ledger.block(2).Header), protoutil.BlockHeaderHash(n.ledger.block(2).Header))
+	}
+
+	wals, err := filepath.Glob(filepath.Join(dir, "node1", "wal", "*.wal"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, wals)
+}
+
+func TestChainReconfiguration(t *testing.T) {
+	nodes := newTestNetwork(t, 5, "")
+	for _, n := range nodes {
+		n.chain.Start()
+		defer n.chain.Halt()
+	}
+
+	require.NoError(t, nodes[0].chain.Order(makeEnvelope(0), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 2 }, 60*time.Second, 50*time.Millisecond)
+	}
+
+	// remove the last consenter, and change the timeouts of rounds
+	metadata := &bdlspb.ConfigMetadata{}
+	require.NoError(t, proto.Unmarshal(nodes[0].support.SharedConfig().ConsensusMetadata(), metadata))
+	metadata.Consenters = metadata.Consenters[:4]
+	metadata.Options.CollectTimeout = "300ms"
+	metadata.Options.ViewChangeTimeout = "5s"
+	require.NoError(t, nodes[0].chain.Configure(makeConfigEnvelope(metadata), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 3 }, 60*time.Second, 50*time.Millisecond)
+		assert.True(t, protoutil.IsConfigBlock(n.ledger.block(2)))
+	}
+
+	// the removed consenter halts and hands the channel over, the others keep on ordering
+	assert.Eventually(t, func() bool { return nodes[4].chain.WaitReady() != nil }, 60*time.Second, 50*time.Millisecond)
+	select {
+	case <-nodes[4].removed:
+	case <-time.After(60 * time.Second):
+		t.Fatal("the halt callback of the removed consenter was not called")
+	}
+	for _, n := range nodes[:4] {
+		assert.Empty(t, n.removed)
+	}
+	require.NoError(t, nodes[1].chain.Order(makeEnvelope(1), 0))
+	for _, n := range nodes[:4] {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 4 }, 60*time.Second, 50*time.Millisecond)
+	}
+	assert.Equal(t, uint64(3), nodes[4].ledger.height())
+
+	// the decide proofs after the reconfiguration are of the remaining consenters
+	proof := &bdls.SignedProto{}
+	require.NoError(t, proof.Unmarshal(nodes[0].ledger.consenterMetadata(3)))
+	publicKeys, err := bdlsbft.PublicKeysFromConsenters(metadata.Consenters)
+	require.NoError(t, err)
+	_, isConsenter := bdlsbft.NewIdentities(publicKeys).ConsenterID(proof)
+	assert.True(t, isConsenter)
+}
+
+func TestChainMigration(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	for _, n := range nodes {
+		// the config block migrates the channel to etcdraft
+		sharedConfig := n.support.SharedConfig().(*mocks.OrdererConfig)
+		writeConfigBlock := n.support.WriteConfigBlockStub
+		n.support.WriteConfigBlockStub = func(block *cb.Block, encodedMetadataValue []byte) {
+			writeConfigBlock(block, encodedMetadataValue)
+			sharedConfig.ConsensusTypeReturns("etcdraft")
+		}
+		n.chain.Start()
+		defer n.chain.Halt()
+	}
+
+	require.NoError(t, nodes[0].chain.Order(makeEnvelope(0), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 2 }, 60*time.Second, 50*time.Millisecond)
+	}
+
+	metadata := &bdlspb.ConfigMetadata{}
+	require.NoError(t, proto.Unmarshal(nodes[0].support.SharedConfig().ConsensusMetadata(), metadata))
+	require.NoError(t, nodes[0].chain.Configure(makeConfigEnvelope(metadata), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 3 }, 60*time.Second, 50*time.Millisecond)
+		assert.True(t, protoutil.IsConfigBlock(n.ledger.block(2)))
+	}
+
+	// every chain stops at the migration block, without handing the channel over
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.chain.WaitReady() != nil }, 60*time.Second, 50*time.Millisecond)
+		assert.EqualError(t, n.chain.Order(makeEnvelope(1), 0), "chain is stopped")
+		assert.Empty(t, n.removed)
+	}
+	time.Sleep(time.Second)
+	for _, n := range nodes {
+		assert.Equal(t, uint64(3), n.ledger.height())
+	}
+}
+
+func TestChainMigrationCatchUp(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	for _, n := range nodes {
+		// the config block migrates the channel to etcdraft, and keeps its decide proof
+		sharedConfig := n.support.SharedConfig().(*mocks.OrdererConfig)
+		writeConfigBlock := n.support.WriteConfigBlockStub
+		n.support.WriteConfigBlockStub = func(block *cb.Block, encodedMetadataValue []byte) {
+			writeConfigBlock(block, encodedMetadataValue)
+			sharedConfig.ConsensusTypeReturns("etcdraft")
+		}
+	}
+
+	// the last node is disconnected, while the others migrate the channel
+	lagging := nodes[3]
+	nodes[0].net.lock.Lock()
+	delete(nodes[0].net.chains, lagging.opts.SelfID)
+	nodes[0].net.lock.Unlock()
+	for _, n := range nodes[:3] {
+		n.chain.Start()
+		defer n.chain.Halt()
+	}
+
+	require.NoError(t, nodes[0].chain.Order(makeEnvelope(0), 0))
+	for _, n := range nodes[:3] {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 2 }, 60*time.Second, 50*time.Millisecond)
+	}
+	metadata := &bdlspb.ConfigMetadata{}
+	require.NoError(t, proto.Unmarshal(nodes[0].support.SharedConfig().ConsensusMetadata(), metadata))
+	require.NoError(t, nodes[0].chain.Configure(makeConfigEnvelope(metadata), 0))
+	for _, n := range nodes[:3] {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 3 }, 60*time.Second, 50*time.Millisecond)
+		assert.Eventually(t, func() bool { return n.chain.WaitReady() != nil }, 60*time.Second, 50*time.Millisecond)
+	}
+	assert.Equal(t, uint64(1), lagging.ledger.height())
+
+	// once reconnected, the messages of the migration block reveal that it lags behind,
+	// it pulls the blocks it missed, verifies the decide proof of the migration block,
+	// and stops at it as the other nodes did
+	nodes[0].net.lock.Lock()
+	nodes[0].net.chains[lagging.opts.SelfID] = lagging.chain
+	missed := nodes[0].net.missed[lagging.opts.SelfID]
+	nodes[0].net.lock.Unlock()
+	lagging.chain.Start()
+	defer lagging.chain.Halt()
+	for _, m := range missed {
+		signed, err := bdls.DecodeSignedMessage(m.payload)
+		require.NoError(t, err)
+		decoded, err := bdls.DecodeMessage(signed.Message)
+		require.NoError(t, err)
+		if decoded.Height == 2 {
+			lagging.chain.HandleMessage(m.from, m.payload)
+		}
+	}
+
+	assert.Eventually(t, func() bool { return lagging.ledger.height() == 3 }, 60*time.Second, 50*time.Millisecond)
+	assert.True(t, protoutil.IsConfigBlock(lagging.ledger.block(2)))
+	assert.Equal(t, nodes[0].ledger.consenterMetadata(2), lagging.ledger.consenterMetadata(2))
+	assert.NotEmpty(t, lagging.ledger.consenterMetadata(2))
+	assert.Eventually(t, func() bool { return lagging.chain.WaitReady() != nil }, 60*time.Second, 50*time.Millisecond)
+	assert.EqualError(t, lagging.chain.Order(makeEnvelope(1), 0), "chain is stopped")
+}
+
+func TestChainCatchUp(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+
+	// the last node is disconnected, while the others order several blocks
+	lagging := nodes[3]
+	nodes[0].net.lock.Lock()
+	delete(nodes[0].net.chains, lagging.opts.SelfID)
+	nodes[0].net.lock.Unlock()
+	for _, n := range nodes[:3] {
+		n.chain.Start()
+		defer n.chain.Halt()
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, nodes[i].chain.Order(makeEnvelope(i), 0))
+		for _, n := range nodes[:3] {
+			assert.Eventually(t, func() bool { return n.ledger.height() == uint64(i+2) }, 60*time.Second, 50*time.Millisecond)
+		}
+	}
+	assert.Equal(t, uint64(1), lagging.ledger.height())
+
+	// once reconnected, it pulls the blocks it missed and rejoins the consensus
+	nodes[0].net.lock.Lock()
+	nodes[0].net.chains[lagging.opts.SelfID] = lagging.chain
+	nodes[0].net.lock.Unlock()
+	lagging.chain.Start()
+	defer lagging.chain.Halt()
+
+	require.NoError(t, nodes[0].chain.Order(makeEnvelope(3), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 5 }, 60*time.Second, 50*time.Millisecond)
+	}
+	for number := uint64(1); number < 5; number++ {
+		assert.Equal(t, protoutil.BlockHeaderHash(nodes[0].ledger.block(number).Header), protoutil.BlockHeaderHash(lagging.ledger.block(number).Header))
+		assert.NotEmpty(t, lagging.ledger.consenterMetadata(number))
+	}
+
+	// the lagging node takes part in the consensus again
+	nodes[0].chain.Halt()
+	require.NoError(t, lagging.chain.Order(makeEnvelope(4), 0))
+	for _, n := range nodes[1:] {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 6 }, 60*time.Second, 50*time.Millisecond)
+	}
+}
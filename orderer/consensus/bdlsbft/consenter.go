@@ -0,0 +1,582 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
+	bdlspb "github.com/hyperledger/fabric-protos-go/orderer/bdls"
+	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/common/channelconfig"
+	"github.com/hyperledger/fabric/common/crypto"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/hyperledger/fabric/orderer/common/cluster"
+	"github.com/hyperledger/fabric/orderer/common/localconfig"
+	"github.com/hyperledger/fabric/orderer/common/multichannel"
+	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
+	"github.com/hyperledger/fabric/orderer/consensus/inactive"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// ChainGetter obtains instances of ChainSupport for the given channel
+type ChainGetter interface {
+	// GetChain obtains the ChainSupport for the given channel.
+	// Returns nil, false when the ChainSupport for the given channel
+	// isn't found.
+	GetChain(chainID string) *multichannel.ChainSupport
+}
+
+// InactiveChainRegistry registers chains that are inactive
+type InactiveChainRegistry interface {
+	// TrackChain tracks a chain with the given name, and calls the given callback
+	// when this chain should be created.
+	TrackChain(chainName string, genesisBlock *cb.Block, createChain func())
+	// Stop stops the InactiveChainRegistry. This is used when removing the
+	// system channel.
+	Stop()
+}
+
+// WALConfig consensus specific configuration parameters from orderer.yaml; for BDLS only WALDir, SnapDir, RecordEvidence, AggregateProofs, Pipelining, AdaptiveLatency, MinLatency and MaxLatency are relevant.
+type WALConfig struct {
+	WALDir          string // WAL data of <my-channel> is stored in WALDir/bdls/<my-channel>
+	SnapDir         string // Snapshots of <my-channel> are stored in SnapDir/bdls/<my-channel>
+	RecordEvidence  bool   // Evidence of equivocating consenters is recorded in the blocks proposed
+	AggregateProofs bool   // Proofs of the messages signed are combined into aggregate proofs
+	Pipelining      bool   // The block after next is proposed while the next block is committed
+	AdaptiveLatency bool   // The latency the timeouts of rounds derive from is estimated
+	MinLatency      string // The lower bound of the latency estimated, e.g. 50ms
+	MaxLatency      string // The upper bound of the latency estimated, e.g. 2.5s
+}
+
+// latencyBounds parses the bounds of the latency estimated, which are zero when unset.
+func (c WALConfig) latencyBounds() (min, max time.Duration, err error) {
+	if c.MinLatency != "" {
+		if min, err = time.ParseDuration(c.MinLatency); err != nil {
+			return 0, 0, errors.Wrap(err, "bad MinLatency")
+		}
+	}
+	if c.MaxLatency != "" {
+		if max, err = time.ParseDuration(c.MaxLatency); err != nil {
+			return 0, 0, errors.Wrap(err, "bad MaxLatency")
+		}
+	}
+	return min, max, nil
+}
+
+// Consenter implementation of the BDLS based consenter
+type Consenter struct {
+	CreateChain           func(chainName string)
+	SwitchChainToFollower func(chainName string)
+	InactiveChainRegistry InactiveChainRegistry
+	Logger                *flogging.FabricLogger
+	Cert                  []byte
+	Comm                  *cluster.Comm
+	Chains                ChainGetter
+	Signer                gocrypto.Signer
+	ClusterDialer         *cluster.PredicateDialer
+	Conf                  *localconfig.TopLevel
+	WALConfig             WALConfig
+	Metrics               *Metrics
+	BCCSP                 bccsp.BCCSP
+}
+
+// New creates Consenter of type bdls
+func New(
+	icr InactiveChainRegistry,
+	identitySerializer crypto.IdentitySerializer,
+	clusterDialer *cluster.PredicateDialer,
+	conf *localconfig.TopLevel,
+	srvConf comm.ServerConfig,
+	srv *comm.GRPCServer,
+	r *multichannel.Registrar,
+	metricsProvider metrics.Provider,
+	BCCSP bccsp.BCCSP,
+) *Consenter {
+	signer, err := localSigner(identitySerializer, BCCSP)
+	if err != nil {
+		flogging.MustGetLogger("orderer.consensus.bdls").Panicf("Failed creating a signer for the local signing identity: %v", err)
+	}
+	consenter := newConsenter(icr, signer, clusterDialer, conf, srvConf, r, metricsProvider, BCCSP)
+	logger := consenter.Logger
+
+	metrics := cluster.NewMetrics(metricsProvider)
+
+	compareCert := cluster.CachePublicKeyComparisons(func(a, b []byte) bool {
+		err := crypto.CertificatesWithSamePublicKey(a, b)
+		if err != nil && err != crypto.ErrPubKeyMismatch {
+			crypto.LogNonPubKeyMismatchErr(logger.Errorf, err, a, b)
+		}
+		return err == nil
+	})
+
+	consenter.Comm = &cluster.Comm{
+		MinimumExpirationWarningInterval: cluster.MinimumExpirationWarningInterval,
+		CertExpWarningThreshold:          conf.General.Cluster.CertExpirationWarningThreshold,
+		SendBufferSize:                   conf.General.Cluster.SendBufferSize,
+		Logger:                           flogging.MustGetLogger("orderer.common.cluster"),
+		Chan2Members:                     make(map[string]cluster.MemberMapping),
+		Connections:                      cluster.NewConnectionStore(clusterDialer, metrics.EgressTLSConnectionCount),
+		Metrics:                          metrics,
+		ChanExt:                          consenter,
+		H: &Ingress{
+			Logger:        logger,
+			ChainSelector: consenter,
+		},
+		CompareCertificate: compareCert,
+	}
+
+	svc := &cluster.Service{
+		CertExpWarningThreshold:          conf.General.Cluster.CertExpirationWarningThreshold,
+		MinimumExpirationWarningInterval: cluster.MinimumExpirationWarningInterval,
+		StreamCountReporter: &cluster.StreamCountReporter{
+			Metrics: metrics,
+		},
+		StepLogger: flogging.MustGetLogger("orderer.common.cluster.step"),
+		Logger:     flogging.MustGetLogger("orderer.common.cluster"),
+		Dispatcher: consenter.Comm,
+	}
+
+	ab.RegisterClusterServer(srv.Server(), svc)
+
+	return consenter
+}
+
+// NewWithComm creates Consenter of type bdls which communicates over the cluster communication
+// of another consenter of the orderer, as channels migrate between the two. The cluster service
+// is the one of the other consenter, and the cluster.Handler of the communication is expected to
+// dispatch the messages of the channels of this consenter to an Ingress of it.
+func NewWithComm(
+	icr InactiveChainRegistry,
+	identitySerializer crypto.IdentitySerializer,
+	clusterDialer *cluster.PredicateDialer,
+	conf *localconfig.TopLevel,
+	srvConf comm.ServerConfig,
+	clusterComm *cluster.Comm,
+	r *multichannel.Registrar,
+	metricsProvider metrics.Provider,
+	BCCSP bccsp.BCCSP,
+) *Consenter {
+	signer, err := localSigner(identitySerializer, BCCSP)
+	if err != nil {
+		// the orderer may well only run channels of the other consenter
+		flogging.MustGetLogger("orderer.consensus.bdls").Warningf("Failed creating a signer for the local signing identity, "+
+			"this orderer cannot be a consenter of bdls channels: %v", err)
+	}
+	consenter := newConsenter(icr, signer, clusterDialer, conf, srvConf, r, metricsProvider, BCCSP)
+	consenter.Comm = clusterComm
+	return consenter
+}
+
+func newConsenter(
+	icr InactiveChainRegistry,
+	signer gocrypto.Signer,
+	clusterDialer *cluster.PredicateDialer,
+	conf *localconfig.TopLevel,
+	srvConf comm.ServerConfig,
+	r *multichannel.Registrar,
+	metricsProvider metrics.Provider,
+	BCCSP bccsp.BCCSP,
+) *Consenter {
+	logger := flogging.MustGetLogger("orderer.consensus.bdls")
+
+	var walConfig WALConfig
+	if err := mapstructure.Decode(conf.Consensus, &walConfig); err != nil {
+		logger.Panicf("Failed to decode consensus configuration: %s", err)
+	}
+	if _, _, err := walConfig.latencyBounds(); err != nil {
+		logger.Panicf("Failed to decode consensus configuration: %s", err)
+	}
+	if walConfig.WALDir == "" {
+		logger.Warnf("WALDir is not configured, BDLS consensus state will not be persisted")
+	} else {
+		logger.Infof("WAL Directory is %s", walConfig.WALDir)
+	}
+
+	return &Consenter{
+		InactiveChainRegistry: icr,
+		Conf:                  conf,
+		ClusterDialer:         clusterDialer,
+		Logger:                logger,
+		Cert:                  srvConf.SecOpts.Certificate,
+		Chains:                r,
+		Signer:                signer,
+		CreateChain:           r.CreateChain,
+		SwitchChainToFollower: r.SwitchChainToFollower,
+		WALConfig:             walConfig,
+		Metrics:               NewMetrics(metricsProvider),
+		BCCSP:                 BCCSP,
+	}
+}
+
+// localSigner returns the signer of the local signing identity, whose key is retrieved from the BCCSP.
+func localSigner(identitySerializer crypto.IdentitySerializer, BCCSP bccsp.BCCSP) (gocrypto.Signer, error) {
+	serializedIdentity, err := identitySerializer.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed serializing the local signing identity")
+	}
+	return NewSigner(BCCSP, serializedIdentity)
+}
+
+// ReceiverByChain returns the MessageReceiver for the given channelID or nil if not found.
+func (c *Consenter) ReceiverByChain(channelID string) MessageReceiver {
+	cs := c.Chains.GetChain(channelID)
+	if cs == nil {
+		return nil
+	}
+	if cs.Chain == nil {
+		c.Logger.Panicf("Programming error - Chain %s is nil although it exists in the mapping", channelID)
+	}
+	if bdlsChain, isBdls := cs.Chain.(*Chain); isBdls {
+		return bdlsChain
+	}
+	c.Logger.Warningf("Chain %s is of type %v and not bdls.Chain", channelID, reflect.TypeOf(cs.Chain))
+	return nil
+}
+
+// HandleChain returns a new Chain instance or an error upon failure
+func (c *Consenter) HandleChain(support consensus.ConsenterSupport, metadata *cb.Metadata) (consensus.Chain, error) {
+	m := &bdlspb.ConfigMetadata{}
+	if err := proto.Unmarshal(support.SharedConfig().ConsensusMetadata(), m); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal consensus metadata")
+	}
+
+	selfID, err := c.detectSelfID(m.Consenters)
+	if err != nil {
+		if c.InactiveChainRegistry != nil {
+			c.Logger.Errorf("channel %s is not serviced by me", support.ChannelID())
+			c.InactiveChainRegistry.TrackChain(support.ChannelID(), support.Block(0), func() {
+				c.CreateChain(support.ChannelID())
+			})
+			return &inactive.Chain{Err: errors.Errorf("channel %s is not serviced by me", support.ChannelID())}, nil
+		}
+
+		return nil, errors.Wrap(err, "without a system channel, a follower should have been created")
+	}
+	c.Logger.Infof("Local consenter id is %d", selfID)
+
+	participants, err := Participants(m.Consenters)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed deriving BDLS participants")
+	}
+
+	publicKeys, err := PublicKeysFromConsenters(m.Consenters)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed extracting consenter public keys")
+	}
+
+	if c.Signer == nil {
+		return nil, errors.Errorf("no signer for the local signing identity, required by consenter %d", selfID)
+	}
+	if bdls.DefaultPubKeyToIdentity(publicKeys[selfID]) != bdls.DefaultPubKeyToIdentity(c.Signer.Public().(*ecdsa.PublicKey)) {
+		return nil, errors.Errorf("local signing identity does not match the identity of consenter %d", selfID)
+	}
+
+	curve, err := Curve(m.Consenters)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed determining the curve of consenters")
+	}
+
+	remoteNodes, err := RemoteNodesFromConsenters(m.Consenters, selfID, c.Logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote nodes cannot be computed")
+	}
+
+	minLatency, maxLatency, err := c.WALConfig.latencyBounds()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := Options{
+		SelfID:       selfID,
+		Signer:       c.Signer,
+		Curve:        curve,
+		Participants: participants,
+		RemoteNodes:  remoteNodes,
+		PublicKeys:   publicKeys,
+		TickInterval: DefaultTickInterval,
+		Logger:       flogging.MustGetLogger("orderer.consensus.bdls.chain"),
+		Metrics:      c.Metrics,
+
+		RecordEvidence:  c.WALConfig.RecordEvidence,
+		AggregateProofs: c.WALConfig.AggregateProofs,
+		Pipelining:      c.WALConfig.Pipelining,
+		AdaptiveLatency: c.WALConfig.AdaptiveLatency,
+		MinLatency:      minLatency,
+		MaxLatency:      maxLatency,
+	}
+	if err := optionsFromConfigMetadata(&opts, m.Options); err != nil {
+		return nil, err
+	}
+	if c.WALConfig.WALDir != "" {
+		// BDLS data is kept apart from the data other consensus
+		// types may have stored for the channel in the same directories.
+		opts.WALDir = filepath.Join(c.WALConfig.WALDir, "bdls", support.ChannelID())
+		opts.SnapDir = filepath.Join(c.WALConfig.SnapDir, "bdls", support.ChannelID())
+	}
+
+	rpc := &cluster.RPC{
+		Logger:        flogging.MustGetLogger("orderer.consensus.bdls.rpc").With("channel", support.ChannelID()),
+		Channel:       support.ChannelID(),
+		StreamsByType: cluster.NewStreamsByType(),
+		Comm:          c.Comm,
+		Timeout:       5 * time.Minute, // Externalize configuration
+	}
+
+	// when a consenter lags behind, it pulls the blocks it missed from the others
+	createPuller := func() (BlockPuller, error) {
+		return etcdraft.NewBlockPuller(support, c.ClusterDialer, c.Conf.General.Cluster, c.BCCSP)
+	}
+
+	var haltCallback func() // called after the chain halts when it is removed from the consenters
+	if c.InactiveChainRegistry != nil {
+		haltCallback = func() {
+			c.InactiveChainRegistry.TrackChain(support.ChannelID(), nil, func() { c.CreateChain(support.ChannelID()) })
+		}
+	} else {
+		haltCallback = func() { c.SwitchChainToFollower(support.ChannelID()) }
+	}
+
+	chain, err := NewChain(support, opts, c.Comm, rpc, createPuller, haltCallback)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating a new BDLS chain")
+	}
+
+	return chain, nil
+}
+
+// IsChannelMember returns whether this consenter is one of the consenters
+// of the channel defined by the given join block.
+func (c *Consenter) IsChannelMember(joinBlock *cb.Block) (bool, error) {
+	if joinBlock == nil {
+		return false, errors.New("nil block")
+	}
+	envelopeConfig, err := protoutil.ExtractEnvelope(joinBlock, 0)
+	if err != nil {
+		return false, err
+	}
+	bundle, err := channelconfig.NewBundleFromEnvelope(envelopeConfig, c.BCCSP)
+	if err != nil {
+		return false, err
+	}
+	oc, exists := bundle.OrdererConfig()
+	if !exists {
+		return false, errors.New("no orderer config in bundle")
+	}
+	configMetadata := &bdlspb.ConfigMetadata{}
+	if err := proto.Unmarshal(oc.ConsensusMetadata(), configMetadata); err != nil {
+		return false, err
+	}
+
+	verifyOpts, err := etcdraft.CreateX509VerifyOptions(oc)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to create x509 verify options from orderer config")
+	}
+
+	if err := VerifyConfigMetadata(configMetadata, verifyOpts); err != nil {
+		return false, errors.Wrapf(err, "failed to validate config metadata of ordering config")
+	}
+
+	member := false
+	for _, consenter := range configMetadata.Consenters {
+		if bytes.Equal(c.Cert, consenter.ServerTlsCert) || bytes.Equal(c.Cert, consenter.ClientTlsCert) {
+			member = true
+			break
+		}
+	}
+
+	return member, nil
+}
+
+// VerifyConsensusMetadata verifies the BDLS config metadata of the given orderer config,
+// which is the metadata of a channel migrating to BDLS.
+func (c *Consenter) VerifyConsensusMetadata(ordererConfig channelconfig.Orderer) error {
+	configMetadata := &bdlspb.ConfigMetadata{}
+	if err := proto.Unmarshal(ordererConfig.ConsensusMetadata(), configMetadata); err != nil {
+		return errors.Wrap(err, "failed to unmarshal BDLS metadata configuration")
+	}
+
+	verifyOpts, err := etcdraft.CreateX509VerifyOptions(ordererConfig)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create x509 verify options from orderer config")
+	}
+
+	return VerifyConfigMetadata(configMetadata, verifyOpts)
+}
+
+// RemoveInactiveChainRegistry stops and removes the inactive chain registry.
+// This is used when removing the system channel.
+func (c *Consenter) RemoveInactiveChainRegistry() {
+	if c.InactiveChainRegistry == nil {
+		return
+	}
+	c.InactiveChainRegistry.Stop()
+	c.InactiveChainRegistry = nil
+}
+
+// TargetChannel extracts the channel from the given proto.Message.
+// Returns an empty string on failure.
+func (c *Consenter) TargetChannel(message proto.Message) string {
+	switch req := message.(type) {
+	case *ab.ConsensusRequest:
+		return req.Channel
+	case *ab.SubmitRequest:
+		return req.Channel
+	default:
+		return ""
+	}
+}
+
+func (c *Consenter) detectSelfID(consenters []*bdlspb.Consenter) (uint64, error) {
+	var serverCertificates []string
+	for _, cst := range consenters {
+		serverCertificates = append(serverCertificates, string(cst.ServerTlsCert))
+		if bytes.Equal(c.Cert, cst.ServerTlsCert) {
+			return cst.ConsenterId, nil
+		}
+	}
+
+	c.Logger.Warning("Could not find", string(c.Cert), "among", serverCertificates)
+	return 0, cluster.ErrNotInChannel
+}
+
+// VerifyConfigMetadata validates BDLS config metadata.
+// Note: ignores certificates expiration.
+func VerifyConfigMetadata(metadata *bdlspb.ConfigMetadata, verifyOpts x509.VerifyOptions) error {
+	if metadata == nil {
+		// defensive check. this should not happen as CheckConfigMetadata
+		// should always be called with non-nil config metadata
+		return errors.Errorf("nil BDLS config metadata")
+	}
+
+	if metadata.Options == nil {
+		return errors.Errorf("nil BDLS config metadata options")
+	}
+
+	if len(metadata.Consenters) < bdls.ConfigMinimumParticipants {
+		return errors.Errorf("BDLS requires at least %d consenters, got %d", bdls.ConfigMinimumParticipants, len(metadata.Consenters))
+	}
+
+	// verifying certificates for being signed by CA, expiration is ignored
+	for _, consenter := range metadata.Consenters {
+		if consenter == nil {
+			return errors.Errorf("metadata has nil consenter")
+		}
+		if err := validateConsenterTLSCerts(consenter, verifyOpts, true); err != nil {
+			return err
+		}
+	}
+
+	if _, err := Participants(metadata.Consenters); err != nil {
+		return errors.Wrap(err, "invalid consenter identity")
+	}
+
+	if _, err := Curve(metadata.Consenters); err != nil {
+		return errors.Wrap(err, "invalid consenter curve")
+	}
+
+	ids := make(map[uint64]struct{}, len(metadata.Consenters))
+	identities := make(map[string]uint64, len(metadata.Consenters))
+	for _, consenter := range metadata.Consenters {
+		if _, exists := ids[consenter.ConsenterId]; exists {
+			return errors.Errorf("duplicate consenter id %d", consenter.ConsenterId)
+		}
+		ids[consenter.ConsenterId] = struct{}{}
+
+		if id, exists := identities[string(consenter.Identity)]; exists {
+			return errors.Errorf("consenters %d and %d have the same identity", id, consenter.ConsenterId)
+		}
+		identities[string(consenter.Identity)] = consenter.ConsenterId
+	}
+
+	return optionsFromConfigMetadata(&Options{}, metadata.Options)
+}
+
+// ValidateConsenterChanges checks that a consenter set can replace another one.
+// Consenters are identified by their IDs across config updates, hence a consenter
+// which remains in the set must keep its identity, and a consenter added must have
+// an ID greater than those of the existing consenters, so that IDs are never reused.
+// The consenters keep on signing with the same curve.
+func ValidateConsenterChanges(oldConsenters, newConsenters []*bdlspb.Consenter) error {
+	oldCurve, err := Curve(oldConsenters)
+	if err != nil {
+		return errors.Wrap(err, "invalid existing consenters")
+	}
+	newCurve, err := Curve(newConsenters)
+	if err != nil {
+		return errors.Wrap(err, "invalid consenters")
+	}
+	if len(oldConsenters) > 0 && bdls.CurveName(oldCurve) != bdls.CurveName(newCurve) {
+		return errors.Errorf("consenters cannot change curve from %s to %s", bdls.CurveName(oldCurve), bdls.CurveName(newCurve))
+	}
+
+	oldIdentities := make(map[uint64][]byte, len(oldConsenters))
+	var maxID uint64
+	for _, consenter := range oldConsenters {
+		oldIdentities[consenter.ConsenterId] = consenter.Identity
+		if consenter.ConsenterId > maxID {
+			maxID = consenter.ConsenterId
+		}
+	}
+
+	for _, consenter := range newConsenters {
+		identity, exists := oldIdentities[consenter.ConsenterId]
+		if !exists {
+			if consenter.ConsenterId <= maxID {
+				return errors.Errorf("consenter id %d is not greater than the ids of the existing consenters", consenter.ConsenterId)
+			}
+			continue
+		}
+		if !bytes.Equal(identity, consenter.Identity) {
+			return errors.Errorf("consenter %d cannot change its identity", consenter.ConsenterId)
+		}
+	}
+	return nil
+}
+
+// optionsFromConfigMetadata sets the options of the chain from the BDLS config metadata options.
+func optionsFromConfigMetadata(opts *Options, options *bdlspb.Options) error {
+	if options == nil {
+		return errors.New("config metadata options field is nil")
+	}
+
+	opts.RequestBatchMaxCount = options.RequestBatchMaxCount
+	opts.RequestBatchMaxBytes = options.RequestBatchMaxBytes
+	if options.RequestBatchMaxInterval != "" {
+		interval, err := time.ParseDuration(options.RequestBatchMaxInterval)
+		if err != nil {
+			return errors.Wrap(err, "bad config metadata option RequestBatchMaxInterval")
+		}
+		opts.RequestBatchMaxInterval = interval
+	}
+	if _, exists := bdlspb.Options_Rotation_name[int32(options.LeaderRotation)]; !exists {
+		return errors.Errorf("bad config metadata option LeaderRotation: %d", options.LeaderRotation)
+	}
+	opts.LeaderElection = LeaderElection(options)
+
+	timeouts, err := Timeouts(options)
+	if err != nil {
+		return err
+	}
+	opts.Timeouts = timeouts
+
+	return nil
+}
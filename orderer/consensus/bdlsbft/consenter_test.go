@@ -0,0 +1,268 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	bdlspb "github.com/hyperledger/fabric-protos-go/orderer/bdls"
+	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/bccsp/sw"
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/ledger/testutil"
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/core/config/configtest"
+	"github.com/hyperledger/fabric/internal/configtxgen/encoder"
+	"github.com/hyperledger/fabric/internal/configtxgen/genesisconfig"
+	"github.com/hyperledger/fabric/orderer/common/cluster"
+	"github.com/hyperledger/fabric/orderer/common/localconfig"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeConfigBlock creates the genesis block of a BDLS channel whose consenters
+// have the given TLS certificates. The TLS CA is added to the MSP of the orderer
+// organization, so that the certificates it issued pass validation.
+func makeConfigBlock(t *testing.T, dir string, tlsCA tlsgen.CA, certs [][]byte) *cb.Block {
+	conf := genesisconfig.Load(genesisconfig.SampleDevModeBdlsProfile, configtest.GetDevConfigDir())
+	conf.Consortiums = nil
+	conf.Consortium = ""
+
+	// the sample MSP is copied, so that the sampleconfig is left untouched,
+	// and defined under another ID than the one of the application organization
+	mspDir := filepath.Join(dir, "msp")
+	require.NoError(t, testutil.CopyDir(conf.Orderer.Organizations[0].MSPDir, mspDir, true))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(mspDir, "tlscacerts", "bdls-ca.pem"), tlsCA.CertBytes(), 0o644))
+	conf.Orderer.Organizations[0].MSPDir = mspDir
+	conf.Orderer.Organizations[0].ID = "OrdererOrg"
+
+	conf.Orderer.Bdls.Consenters = nil
+	for i, cert := range certs {
+		certPath := filepath.Join(dir, fmt.Sprintf("consenter%d.pem", i+1))
+		require.NoError(t, ioutil.WriteFile(certPath, cert, 0o644))
+		conf.Orderer.Bdls.Consenters = append(conf.Orderer.Bdls.Consenters, &bdlspb.Consenter{
+			ConsenterId:   uint64(i + 1),
+			Host:          "localhost",
+			Port:          uint32(7050 + i),
+			MspId:         conf.Orderer.Organizations[0].ID,
+			Identity:      []byte(certPath),
+			ClientTlsCert: []byte(certPath),
+			ServerTlsCert: []byte(certPath),
+		})
+	}
+
+	bootstrapper, err := encoder.NewBootstrapper(conf)
+	require.NoError(t, err)
+	return bootstrapper.GenesisBlockForChannel(testChannel)
+}
+
+func makeCerts(t *testing.T, tlsCA tlsgen.CA, n int) [][]byte {
+	var certs [][]byte
+	for i := 0; i < n; i++ {
+		kp, err := tlsCA.NewServerCertKeyPair("localhost")
+		require.NoError(t, err)
+		certs = append(certs, kp.Cert)
+	}
+	return certs
+}
+
+func newCryptoProvider(t *testing.T) bccsp.BCCSP {
+	cryptoProvider, err := sw.NewDefaultSecurityLevelWithKeystore(sw.NewDummyKeyStore())
+	require.NoError(t, err)
+	return cryptoProvider
+}
+
+func TestConsenterIsChannelMember(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdls-consenter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tlsCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	certs := makeCerts(t, tlsCA, 5)
+	block := makeConfigBlock(t, filepath.Join(dir, "channel"), tlsCA, certs[:4])
+
+	// certificates issued by a CA that is not in the MSP of any orderer organization
+	foreignCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	foreignBlock := makeConfigBlock(t, filepath.Join(dir, "foreign"), tlsCA, makeCerts(t, foreignCA, 4))
+
+	for _, testCase := range []struct {
+		name           string
+		cert           []byte
+		block          *cb.Block
+		expectedMember bool
+		expectedErr    string
+	}{
+		{
+			name:        "nil block",
+			cert:        certs[0],
+			expectedErr: "nil block",
+		},
+		{
+			name:           "member",
+			cert:           certs[2],
+			block:          block,
+			expectedMember: true,
+		},
+		{
+			name:  "not a member",
+			cert:  certs[4],
+			block: block,
+		},
+		{
+			name:        "consenters of a foreign CA",
+			cert:        certs[0],
+			block:       foreignBlock,
+			expectedErr: "failed to validate config metadata of ordering config",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			consenter := &bdlsbft.Consenter{Cert: testCase.cert, BCCSP: newCryptoProvider(t)}
+			member, err := consenter.IsChannelMember(testCase.block)
+			assert.Equal(t, testCase.expectedMember, member)
+			if testCase.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testCase.expectedErr)
+		})
+	}
+}
+
+func TestConsenterCertificateIsConsenterOfChannel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdls-consenter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tlsCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	certs := makeCerts(t, tlsCA, 5)
+	block := makeConfigBlock(t, dir, tlsCA, certs[:4])
+
+	member := bdlsbft.ConsenterCertificate{ConsenterCertificate: certs[0], CryptoProvider: newCryptoProvider(t)}
+	assert.NoError(t, member.IsConsenterOfChannel(block))
+
+	nonMember := bdlsbft.ConsenterCertificate{ConsenterCertificate: certs[4], CryptoProvider: newCryptoProvider(t)}
+	assert.Equal(t, cluster.ErrNotInChannel, nonMember.IsConsenterOfChannel(block))
+}
+
+// newComm creates a cluster communication that cannot reach any remote node.
+func newComm() *cluster.Comm {
+	metrics := cluster.NewMetrics(&disabled.Provider{})
+	return &cluster.Comm{
+		Logger:             flogging.MustGetLogger("test"),
+		Chan2Members:       make(map[string]cluster.MemberMapping),
+		Connections:        cluster.NewConnectionStore(&cluster.PredicateDialer{}, metrics.EgressTLSConnectionCount),
+		Metrics:            metrics,
+		CompareCertificate: bytes.Equal,
+	}
+}
+
+func TestConsenterHaltCallback(t *testing.T) {
+	nodes := newTestNetwork(t, 5, "")
+	node := nodes[4]
+	metadata := &bdlspb.ConfigMetadata{}
+	require.NoError(t, proto.Unmarshal(node.support.SharedConfig().ConsensusMetadata(), metadata))
+
+	// the chain of the last node is created by the consenter, which switches
+	// the chain to a follower once the node is removed from the consenters
+	followers := make(chan string, 1)
+	consenter := &bdlsbft.Consenter{
+		SwitchChainToFollower: func(channel string) { followers <- channel },
+		Logger:                flogging.MustGetLogger("test"),
+		Cert:                  metadata.Consenters[4].ServerTlsCert,
+		Comm:                  newComm(),
+		Signer:                node.opts.Signer,
+		ClusterDialer:         &cluster.PredicateDialer{},
+		Conf:                  &localconfig.TopLevel{},
+		BCCSP:                 newCryptoProvider(t),
+	}
+	handleChain := func(id uint64) {
+		chain, err := consenter.HandleChain(node.support, nil)
+		require.NoError(t, err)
+		node.chain = chain.(*bdlsbft.Chain)
+		node.net.lock.Lock()
+		node.net.chains[id] = node.chain
+		node.net.lock.Unlock()
+	}
+	handleChain(5)
+
+	for _, n := range nodes {
+		n.chain.Start()
+	}
+	defer func() {
+		for _, n := range nodes {
+			n.chain.Halt()
+		}
+	}()
+
+	require.NoError(t, nodes[0].chain.Order(makeEnvelope(0), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 2 }, 60*time.Second, 50*time.Millisecond)
+	}
+
+	// the node is removed from the consenters, and its chain is switched to a follower
+	require.NoError(t, nodes[0].chain.Configure(makeConfigEnvelope(&bdlspb.ConfigMetadata{Consenters: metadata.Consenters[:4], Options: metadata.Options}), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 3 }, 60*time.Second, 50*time.Millisecond)
+	}
+	select {
+	case channel := <-followers:
+		assert.Equal(t, testChannel, channel)
+	case <-time.After(60 * time.Second):
+		t.Fatal("the chain of the removed consenter was not switched to a follower")
+	}
+	assert.Error(t, node.chain.WaitReady())
+
+	// the node is added back under a new id, the follower pulls the config block
+	// that adds it, and its chain is switched back to a consenter
+	readded := proto.Clone(metadata.Consenters[4]).(*bdlspb.Consenter)
+	readded.ConsenterId = 6
+	require.NoError(t, nodes[1].chain.Configure(makeConfigEnvelope(&bdlspb.ConfigMetadata{Consenters: append(metadata.Consenters[:4:4], readded), Options: metadata.Options}), 0))
+	for _, n := range nodes[:4] {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 4 }, 60*time.Second, 50*time.Millisecond)
+	}
+	node.support.WriteConfigBlock(proto.Clone(nodes[0].ledger.block(3)).(*cb.Block), nodes[0].ledger.consenterMetadata(3))
+	handleChain(6)
+	node.chain.Start()
+
+	require.NoError(t, nodes[2].chain.Order(makeEnvelope(1), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 5 }, 60*time.Second, 50*time.Millisecond)
+	}
+	assert.Empty(t, followers)
+}
+
+func TestConsenterHandleChainWithoutSigner(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	node := nodes[0]
+	metadata := &bdlspb.ConfigMetadata{}
+	require.NoError(t, proto.Unmarshal(node.support.SharedConfig().ConsensusMetadata(), metadata))
+
+	// the consenter of an orderer whose signing key is not held by the BCCSP
+	consenter := &bdlsbft.Consenter{
+		Logger: flogging.MustGetLogger("test"),
+		Cert:   metadata.Consenters[0].ServerTlsCert,
+		Comm:   newComm(),
+		Conf:   &localconfig.TopLevel{},
+		BCCSP:  newCryptoProvider(t),
+	}
+	_, err := consenter.HandleChain(node.support, nil)
+	require.EqualError(t, err, "no signer for the local signing identity, required by consenter 1")
+}
@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"net"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric/orderer/common/cluster"
+)
+
+// RPC sends a consensus and submits a request
+type RPC interface {
+	SendConsensus(dest uint64, msg *ab.ConsensusRequest) error
+	SendSubmit(dest uint64, request *ab.SubmitRequest) error
+}
+
+// Logger specifies the logger
+type Logger interface {
+	Warnf(template string, args ...interface{})
+	Panicf(template string, args ...interface{})
+}
+
+// Egress is the bdls.PeerInterface of a remote consenter.
+// It carries the BDLS messages to the consenter over the cluster communication.
+type Egress struct {
+	Channel   string
+	ID        uint64
+	Endpoint  string
+	PublicKey *ecdsa.PublicKey
+	RPC       RPC
+	Logger    Logger
+}
+
+// NewEgresses creates an Egress for each of the remote nodes, using the
+// public keys of the remote nodes mapped by their IDs.
+func NewEgresses(channel string, remoteNodes []cluster.RemoteNode, publicKeys map[uint64]*ecdsa.PublicKey, rpc RPC, logger Logger) []*Egress {
+	var egresses []*Egress
+	for _, node := range remoteNodes {
+		egresses = append(egresses, &Egress{
+			Channel:   channel,
+			ID:        node.ID,
+			Endpoint:  node.Endpoint,
+			PublicKey: publicKeys[node.ID],
+			RPC:       rpc,
+			Logger:    logger,
+		})
+	}
+	return egresses
+}
+
+// GetPublicKey returns the public key of the remote consenter.
+func (e *Egress) GetPublicKey() *ecdsa.PublicKey {
+	return e.PublicKey
+}
+
+// RemoteAddr returns the address of the remote consenter.
+func (e *Egress) RemoteAddr() net.Addr {
+	return &clusterAddr{id: e.ID, endpoint: e.Endpoint}
+}
+
+// Send sends the signed BDLS message to the remote consenter.
+func (e *Egress) Send(msg []byte) error {
+	err := e.RPC.SendConsensus(e.ID, &ab.ConsensusRequest{
+		Channel: e.Channel,
+		Payload: msg,
+	})
+	if err != nil {
+		e.Logger.Warnf("Failed sending to %d: %v", e.ID, err)
+	}
+	return err
+}
+
+// SendTransaction forwards the envelope to the remote consenter.
+func (e *Egress) SendTransaction(env *cb.Envelope) {
+	err := e.RPC.SendSubmit(e.ID, &ab.SubmitRequest{
+		Channel: e.Channel,
+		Payload: env,
+	})
+	if err != nil {
+		e.Logger.Warnf("Failed forwarding transaction to %d: %v", e.ID, err)
+	}
+}
+
+// clusterAddr identifies a consenter by its cluster ID.
+type clusterAddr struct {
+	id       uint64
+	endpoint string
+}
+
+func (a *clusterAddr) Network() string { return "cluster" }
+
+func (a *clusterAddr) String() string { return fmt.Sprintf("%d@%s", a.id, a.endpoint) }
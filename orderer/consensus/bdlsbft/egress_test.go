@@ -0,0 +1,81 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/orderer/common/cluster"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentConsensus struct {
+	dest uint64
+	msg  *ab.ConsensusRequest
+}
+
+type sentSubmit struct {
+	dest uint64
+	req  *ab.SubmitRequest
+}
+
+type recordingRPC struct {
+	consensus []sentConsensus
+	submits   []sentSubmit
+	err       error
+}
+
+func (r *recordingRPC) SendConsensus(dest uint64, msg *ab.ConsensusRequest) error {
+	r.consensus = append(r.consensus, sentConsensus{dest: dest, msg: msg})
+	return r.err
+}
+
+func (r *recordingRPC) SendSubmit(dest uint64, request *ab.SubmitRequest) error {
+	r.submits = append(r.submits, sentSubmit{dest: dest, req: request})
+	return r.err
+}
+
+func TestEgresses(t *testing.T) {
+	key2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	key3, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	rpc := &recordingRPC{}
+	remoteNodes := []cluster.RemoteNode{
+		{ID: 2, Endpoint: "node2:7050"},
+		{ID: 3, Endpoint: "node3:7050"},
+	}
+	publicKeys := map[uint64]*ecdsa.PublicKey{2: &key2.PublicKey, 3: &key3.PublicKey}
+	egresses := bdlsbft.NewEgresses("mychannel", remoteNodes, publicKeys, rpc, flogging.MustGetLogger("test"))
+	require.Len(t, egresses, 2)
+
+	assert.Equal(t, &key2.PublicKey, egresses[0].GetPublicKey())
+	assert.Equal(t, &key3.PublicKey, egresses[1].GetPublicKey())
+	assert.Equal(t, "2@node2:7050", egresses[0].RemoteAddr().String())
+	assert.Equal(t, "3@node3:7050", egresses[1].RemoteAddr().String())
+	assert.NotEqual(t, egresses[0].RemoteAddr().String(), egresses[1].RemoteAddr().String())
+
+	assert.NoError(t, egresses[1].Send([]byte{1, 2, 3}))
+	assert.Equal(t, []sentConsensus{{dest: 3, msg: &ab.ConsensusRequest{Channel: "mychannel", Payload: []byte{1, 2, 3}}}}, rpc.consensus)
+
+	env := &cb.Envelope{Payload: []byte{4, 5, 6}}
+	egresses[0].SendTransaction(env)
+	assert.Equal(t, []sentSubmit{{dest: 2, req: &ab.SubmitRequest{Channel: "mychannel", Payload: env}}}, rpc.submits)
+
+	rpc.err = errors.New("stream aborted")
+	assert.EqualError(t, egresses[0].Send([]byte{1}), "stream aborted")
+}
@@ -0,0 +1,135 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/Sperax/bdls"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/pkg/errors"
+)
+
+// equivocation identifies the messages a consenter has equivocated on.
+type equivocation struct {
+	identity bdls.Identity
+	msgType  bdls.MessageType
+	height   uint64
+	round    uint64
+}
+
+// equivocationOf returns the equivocation the evidence proves,
+// along with the first message of the evidence.
+func equivocationOf(e *bdls.Evidence) (equivocation, *bdls.Message, error) {
+	if e.First == nil {
+		return equivocation{}, nil, bdls.ErrEvidenceIncomplete
+	}
+	m, err := bdls.DecodeMessage(e.First.Message)
+	if err != nil {
+		return equivocation{}, nil, err
+	}
+	var identity bdls.Identity
+	copy(identity[:bdls.SizeAxis], e.First.X[:])
+	copy(identity[bdls.SizeAxis:], e.First.Y[:])
+	return equivocation{identity: identity, msgType: m.Type, height: m.Height, round: m.Round}, m, nil
+}
+
+// EvidenceFromBlock returns the evidence of equivocating consenters recorded
+// in the orderer metadata of the block, if any.
+func EvidenceFromBlock(block *cb.Block) ([]*bdls.Evidence, error) {
+	metadata, err := OrdererMetadataFromBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.Evidence) == 0 {
+		return nil, nil
+	}
+
+	evidence := make([]*bdls.Evidence, 0, len(metadata.Evidence))
+	for i, bts := range metadata.Evidence {
+		e, err := bdls.DecodeEvidence(bts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed decoding evidence %d", i)
+		}
+		evidence = append(evidence, e)
+	}
+	return evidence, nil
+}
+
+// recordEvidence records the encoded evidence in the orderer metadata,
+// in a deterministic order.
+func recordEvidence(metadata *OrdererMetadata, evidence map[equivocation][]byte) {
+	encoded := make([][]byte, 0, len(evidence))
+	for _, bts := range evidence {
+		encoded = append(encoded, bts)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	metadata.Evidence = encoded
+}
+
+// onEvidence is called by the consensus core with the evidence of a consenter
+// which has signed conflicting messages. The evidence is kept to be recorded
+// in the next block this consenter proposes, if evidence is recorded at all.
+func (c *Chain) onEvidence(e *bdls.Evidence) {
+	key, m, err := equivocationOf(e)
+	if err != nil {
+		c.logger.Errorf("Failed decoding evidence of equivocation: %v", err)
+		return
+	}
+	id, _ := c.identities.ConsenterID(e.First)
+	c.logger.Warningf("Consenter %d has signed conflicting %s messages at height %d and round %d", id, m.Type, m.Height, m.Round)
+
+	if !c.opts.RecordEvidence {
+		return
+	}
+	bts, err := e.Marshal()
+	if err != nil {
+		c.logger.Errorf("Failed marshaling evidence of equivocation: %v", err)
+		return
+	}
+	c.evidence[key] = bts
+}
+
+// verifyEvidence checks that the evidence recorded in a candidate block
+// proves the equivocations of consenters.
+func (c *Chain) verifyEvidence(block *cb.Block) error {
+	evidence, err := EvidenceFromBlock(block)
+	if err != nil {
+		return err
+	}
+	for i, e := range evidence {
+		if e.First == nil {
+			return errors.Wrapf(bdls.ErrEvidenceIncomplete, "evidence %d", i)
+		}
+		id, exists := c.identities.ConsenterID(e.First)
+		if !exists {
+			return errors.Errorf("evidence %d is not signed by a consenter", i)
+		}
+		if _, err := e.Verify(c.opts.PublicKeys[id].Curve); err != nil {
+			return errors.Wrapf(err, "evidence %d", i)
+		}
+	}
+	return nil
+}
+
+// removeRecordedEvidence drops the evidence recorded in the given block.
+func (c *Chain) removeRecordedEvidence(block *cb.Block) {
+	if len(c.evidence) == 0 {
+		return
+	}
+	evidence, err := EvidenceFromBlock(block)
+	if err != nil {
+		c.logger.Warnf("Failed extracting evidence from block [%d]: %v", block.Header.Number, err)
+		return
+	}
+	for _, e := range evidence {
+		if key, _, err := equivocationOf(e); err == nil {
+			delete(c.evidence, key)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvidenceFromBlock(t *testing.T) {
+	block := protoutil.NewBlock(1, nil)
+	evidence, err := bdlsbft.EvidenceFromBlock(block)
+	assert.NoError(t, err)
+	assert.Empty(t, evidence)
+
+	block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER] = []byte("garbage")
+	_, err = bdlsbft.EvidenceFromBlock(block)
+	assert.Contains(t, err.Error(), "failed unmarshaling orderer metadata")
+
+	block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER] = protoutil.MarshalOrPanic(&cb.Metadata{Value: []byte("garbage")})
+	_, err = bdlsbft.EvidenceFromBlock(block)
+	assert.Contains(t, err.Error(), "failed unmarshaling BDLS orderer metadata")
+
+	block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER] = protoutil.MarshalOrPanic(&cb.Metadata{Value: []byte("[garbage")})
+	_, err = bdlsbft.EvidenceFromBlock(block)
+	assert.Contains(t, err.Error(), "failed unmarshaling evidence")
+
+	block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER] = protoutil.MarshalOrPanic(&cb.Metadata{Value: []byte(`["Z2FyYmFnZQ=="]`)})
+	_, err = bdlsbft.EvidenceFromBlock(block)
+	assert.Contains(t, err.Error(), "failed decoding evidence 0")
+}
+
+// signRoundChange signs a <roundchange> with the key of a consenter.
+func signRoundChange(t *testing.T, n *testNode, height uint64, round uint64, state bdls.State) []byte {
+	sp := &bdls.SignedProto{}
+	sp.Sign(&bdls.Message{Type: bdls.MessageType_RoundChange, Height: height, Round: round, State: state}, n.opts.Signer.(*ecdsa.PrivateKey))
+	bts, err := sp.Marshal()
+	require.NoError(t, err)
+	return bts
+}
+
+func TestChainRecordsEvidence(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	for _, n := range nodes {
+		n.opts.RecordEvidence = true
+		n.restart(t)
+		defer n.chain.Halt()
+	}
+
+	// the last consenter equivocates on its <roundchange>
+	equivocator := nodes[3]
+	first := signRoundChange(t, equivocator, 1, 0, bdls.State("first"))
+	second := signRoundChange(t, equivocator, 1, 0, bdls.State("second"))
+	for _, n := range nodes {
+		n.chain.HandleMessage(equivocator.opts.SelfID, first)
+		n.chain.HandleMessage(equivocator.opts.SelfID, second)
+	}
+
+	require.NoError(t, nodes[0].chain.Order(makeEnvelope(0), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 2 }, 60*time.Second, 50*time.Millisecond)
+	}
+
+	evidence, err := bdlsbft.EvidenceFromBlock(nodes[0].ledger.block(1))
+	require.NoError(t, err)
+	require.Len(t, evidence, 1)
+	publicKey := equivocator.opts.PublicKeys[equivocator.opts.SelfID]
+	m, err := evidence[0].Verify(publicKey.Curve)
+	require.NoError(t, err)
+	assert.Equal(t, bdls.MessageType_RoundChange, m.Type)
+	assert.Equal(t, uint64(1), m.Height)
+	assert.Equal(t, bdls.DefaultPubKeyToIdentity(publicKey), bdls.DefaultPubKeyToIdentity(evidence[0].First.PublicKey(publicKey.Curve)))
+
+	// evidence is recorded only once
+	require.NoError(t, nodes[1].chain.Order(makeEnvelope(1), 0))
+	for _, n := range nodes {
+		assert.Eventually(t, func() bool { return n.ledger.height() == 3 }, 60*time.Second, 50*time.Millisecond)
+	}
+	evidence, err = bdlsbft.EvidenceFromBlock(nodes[0].ledger.block(2))
+	require.NoError(t, err)
+	assert.Empty(t, evidence)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+
+	"github.com/Sperax/bdls"
+	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/bccsp/signer"
+	"github.com/pkg/errors"
+)
+
+// NewSigner returns a crypto.Signer that signs BDLS messages with the private key
+// of the given serialized MSP identity. The private key is looked up in the BCCSP
+// by the subject key identifier of the identity's public key, hence it never needs
+// to be loaded into memory and may reside in an HSM.
+func NewSigner(csp bccsp.BCCSP, serializedIdentity []byte) (crypto.Signer, error) {
+	pk, err := PublicKeyFromIdentity(serializedIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := csp.KeyImport(pk, &bccsp.ECDSAGoPublicKeyImportOpts{Temporary: true})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed importing public key")
+	}
+
+	key, err := csp.GetKey(pubKey.SKI())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed retrieving signing key")
+	}
+	if !key.Private() {
+		return nil, errors.New("signing key not found, only the public key is available")
+	}
+
+	return signer.New(csp, key)
+}
+
+// Identities maps the BDLS identities of the consenters to their IDs.
+type Identities map[bdls.Identity]uint64
+
+// NewIdentities returns the BDLS identities of the consenters with the given public keys.
+func NewIdentities(publicKeys map[uint64]*ecdsa.PublicKey) Identities {
+	identities := make(Identities, len(publicKeys))
+	for id, pk := range publicKeys {
+		identities[bdls.DefaultPubKeyToIdentity(pk)] = id
+	}
+	return identities
+}
+
+// PubKeyToIdentity derives the BDLS identity of a public key.
+func (i Identities) PubKeyToIdentity(pk *ecdsa.PublicKey) bdls.Identity {
+	return bdls.DefaultPubKeyToIdentity(pk)
+}
+
+// ConsenterID returns the ID of the consenter which signed the message,
+// and false if the signer is not a consenter.
+func (i Identities) ConsenterID(sp *bdls.SignedProto) (uint64, bool) {
+	var identity bdls.Identity
+	copy(identity[:bdls.SizeAxis], sp.X[:])
+	copy(identity[bdls.SizeAxis:], sp.Y[:])
+	id, exists := i[identity]
+	return id, exists
+}
+
+// MessageValidator rejects messages which are not signed by a consenter.
+func (i Identities) MessageValidator(c *bdls.Consensus, m *bdls.Message, sp *bdls.SignedProto) bool {
+	_, exists := i.ConsenterID(sp)
+	return exists
+}
@@ -0,0 +1,106 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Sperax/bdls"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/bccsp/sw"
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdls-keystore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ks, err := sw.NewFileBasedKeyStore(nil, dir, false)
+	require.NoError(t, err)
+	csp, err := sw.NewDefaultSecurityLevelWithKeystore(ks)
+	require.NoError(t, err)
+
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	kp, err := ca.NewServerCertKeyPair("localhost")
+	require.NoError(t, err)
+	serializedIdentity := protoutil.MarshalOrPanic(&msp.SerializedIdentity{Mspid: "OrdererOrg", IdBytes: kp.Cert})
+
+	t.Run("key not in keystore", func(t *testing.T) {
+		_, err := bdlsbft.NewSigner(csp, serializedIdentity)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid identity", func(t *testing.T) {
+		_, err := bdlsbft.NewSigner(csp, protoutil.MarshalOrPanic(&msp.SerializedIdentity{Mspid: "OrdererOrg", IdBytes: []byte("garbage")}))
+		assert.EqualError(t, err, "invalid PEM block in identity of OrdererOrg")
+	})
+
+	t.Run("key in keystore", func(t *testing.T) {
+		bl, _ := pem.Decode(kp.Key)
+		require.NotNil(t, bl)
+		_, err := csp.KeyImport(bl.Bytes, &bccsp.ECDSAPrivateKeyImportOpts{Temporary: false})
+		require.NoError(t, err)
+
+		signer, err := bdlsbft.NewSigner(csp, serializedIdentity)
+		require.NoError(t, err)
+		assert.Equal(t, publicKey(t, kp.Cert), signer.Public())
+
+		sp := &bdls.SignedProto{}
+		err = sp.SignWithSigner(&bdls.Message{Type: bdls.MessageType_RoundChange, Height: 1, State: []byte("state")}, signer)
+		require.NoError(t, err)
+		assert.True(t, sp.Verify(elliptic.P256()))
+	})
+}
+
+func TestIdentities(t *testing.T) {
+	publicKeys := make(map[uint64]*ecdsa.PublicKey)
+	for i := 1; i <= 4; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		publicKeys[uint64(i)] = &key.PublicKey
+	}
+	identities := bdlsbft.NewIdentities(publicKeys)
+
+	stranger, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signedBy := func(signer *ecdsa.PrivateKey) *bdls.SignedProto {
+		sp := &bdls.SignedProto{}
+		sp.Sign(&bdls.Message{Type: bdls.MessageType_RoundChange, Height: 1}, signer)
+		return sp
+	}
+
+	sp := signedBy(stranger)
+	_, exists := identities.ConsenterID(sp)
+	assert.False(t, exists)
+	assert.False(t, identities.MessageValidator(nil, nil, sp))
+
+	member, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKeys[5] = &member.PublicKey
+	identities = bdlsbft.NewIdentities(publicKeys)
+
+	sp = signedBy(member)
+	id, exists := identities.ConsenterID(sp)
+	assert.True(t, exists)
+	assert.Equal(t, uint64(5), id)
+	assert.True(t, identities.MessageValidator(nil, nil, sp))
+	assert.Equal(t, bdls.DefaultPubKeyToIdentity(&member.PublicKey), identities.PubKeyToIdentity(&member.PublicKey))
+}
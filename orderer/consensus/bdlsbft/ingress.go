@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// MessageReceiver receives messages
+type MessageReceiver interface {
+	// HandleMessage handles a serialized BDLS consensus message from the given sender
+	HandleMessage(sender uint64, m []byte)
+	// HandleRequest handles a serialized envelope forwarded by the given sender
+	HandleRequest(sender uint64, req []byte)
+}
+
+// ReceiverGetter obtains instances of MessageReceiver given a channel ID
+type ReceiverGetter interface {
+	// ReceiverByChain returns the MessageReceiver if it exists, or nil if it doesn't
+	ReceiverByChain(channelID string) MessageReceiver
+}
+
+// WarningLogger logs warnings
+type WarningLogger interface {
+	Warningf(template string, args ...interface{})
+}
+
+// Ingress dispatches Submit and Step requests to the designated per chain instances
+type Ingress struct {
+	Logger        WarningLogger
+	ChainSelector ReceiverGetter
+}
+
+// OnConsensus notifies the Ingress for a reception of a StepRequest from a given sender on a given channel
+func (in *Ingress) OnConsensus(channel string, sender uint64, request *ab.ConsensusRequest) error {
+	receiver := in.ChainSelector.ReceiverByChain(channel)
+	if receiver == nil {
+		in.Logger.Warningf("An attempt to send a consensus request to a non existing channel (%s) was made by %d", channel, sender)
+		return errors.Errorf("channel %s doesn't exist", channel)
+	}
+	receiver.HandleMessage(sender, request.Payload)
+	return nil
+}
+
+// OnSubmit notifies the Ingress for a reception of a SubmitRequest from a given sender on a given channel
+func (in *Ingress) OnSubmit(channel string, sender uint64, request *ab.SubmitRequest) error {
+	receiver := in.ChainSelector.ReceiverByChain(channel)
+	if receiver == nil {
+		in.Logger.Warningf("An attempt to submit a transaction to a non existing channel (%s) was made by %d", channel, sender)
+		return errors.Errorf("channel %s doesn't exist", channel)
+	}
+	receiver.HandleRequest(sender, protoutil.MarshalOrPanic(request.Payload))
+	return nil
+}
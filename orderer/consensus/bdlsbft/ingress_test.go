@@ -0,0 +1,99 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"testing"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	ab "github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type receivedMessage struct {
+	sender  uint64
+	payload []byte
+}
+
+type fakeReceiver struct {
+	messages []receivedMessage
+	requests []receivedMessage
+}
+
+func (r *fakeReceiver) HandleMessage(sender uint64, m []byte) {
+	r.messages = append(r.messages, receivedMessage{sender: sender, payload: m})
+}
+
+func (r *fakeReceiver) HandleRequest(sender uint64, req []byte) {
+	r.requests = append(r.requests, receivedMessage{sender: sender, payload: req})
+}
+
+type fakeReceiverGetter map[string]bdlsbft.MessageReceiver
+
+func (g fakeReceiverGetter) ReceiverByChain(channelID string) bdlsbft.MessageReceiver {
+	return g[channelID]
+}
+
+func TestDispatchConsensus(t *testing.T) {
+	t.Run("Channel exists", func(t *testing.T) {
+		receiver := &fakeReceiver{}
+		ingress := &bdlsbft.Ingress{
+			ChainSelector: fakeReceiverGetter{"mychannel": receiver},
+			Logger:        flogging.MustGetLogger("test"),
+		}
+
+		err := ingress.OnConsensus("mychannel", 1, &ab.ConsensusRequest{
+			Channel: "mychannel",
+			Payload: []byte{1, 2, 3},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []receivedMessage{{sender: 1, payload: []byte{1, 2, 3}}}, receiver.messages)
+		assert.Empty(t, receiver.requests)
+	})
+
+	t.Run("Channel does not exist", func(t *testing.T) {
+		ingress := &bdlsbft.Ingress{
+			ChainSelector: fakeReceiverGetter{},
+			Logger:        flogging.MustGetLogger("test"),
+		}
+
+		err := ingress.OnConsensus("notmychannel", 1, nil)
+		assert.EqualError(t, err, "channel notmychannel doesn't exist")
+	})
+}
+
+func TestDispatchSubmit(t *testing.T) {
+	t.Run("Channel exists", func(t *testing.T) {
+		receiver := &fakeReceiver{}
+		ingress := &bdlsbft.Ingress{
+			ChainSelector: fakeReceiverGetter{"mychannel": receiver},
+			Logger:        flogging.MustGetLogger("test"),
+		}
+
+		env := &cb.Envelope{Payload: []byte{1, 2, 3}}
+		err := ingress.OnSubmit("mychannel", 2, &ab.SubmitRequest{
+			Channel: "mychannel",
+			Payload: env,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []receivedMessage{{sender: 2, payload: protoutil.MarshalOrPanic(env)}}, receiver.requests)
+		assert.Empty(t, receiver.messages)
+	})
+
+	t.Run("Channel does not exist", func(t *testing.T) {
+		ingress := &bdlsbft.Ingress{
+			ChainSelector: fakeReceiverGetter{},
+			Logger:        flogging.MustGetLogger("test"),
+		}
+
+		err := ingress.OnSubmit("notmychannel", 2, nil)
+		assert.EqualError(t, err, "channel notmychannel doesn't exist")
+	})
+}
@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"github.com/Sperax/bdls"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/pkg/errors"
+)
+
+// recordLatency records the latency estimated by the consensus core in
+// the metadata of a candidate block, when the latency is adaptive.
+func (c *Chain) recordLatency(metadata *OrdererMetadata) {
+	if !c.opts.AdaptiveLatency {
+		return
+	}
+	metadata.Latency = c.consensus.EstimatedLatency()
+}
+
+// adoptLatency sets the latency of the consensus core to the latency recorded
+// in a decided block, within the latency bounds, when the latency is adaptive.
+// The consenters adopt the latency of the same blocks, whoever proposed them,
+// hence their timeouts converge.
+func (c *Chain) adoptLatency(block *cb.Block) {
+	if !c.opts.AdaptiveLatency {
+		return
+	}
+	metadata, err := OrdererMetadataFromBlock(block)
+	if err != nil {
+		c.logger.Warnf("Failed extracting the latency recorded in block [%d]: %v", block.Header.Number, err)
+		return
+	}
+	if metadata.Latency == 0 {
+		return
+	}
+
+	latency := c.consensus.BoundedLatency(metadata.Latency)
+	if latency != c.consensus.Latency() {
+		c.logger.Debugf("Adopting latency %v recorded in block [%d]", latency, block.Header.Number)
+		c.consensus.SetLatency(latency)
+	}
+}
+
+// verifyLatency checks that the latency recorded in a candidate
+// block, if any, is within 0 and bdls.MaxConsensusLatency.
+func verifyLatency(block *cb.Block) error {
+	metadata, err := OrdererMetadataFromBlock(block)
+	if err != nil {
+		return err
+	}
+	if metadata.Latency < 0 || metadata.Latency > bdls.MaxConsensusLatency {
+		return errors.Errorf("latency %v is out of range", metadata.Latency)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// OrdererMetadata is the BDLS metadata a consenter records in the
+// orderer metadata of the blocks it proposes.
+type OrdererMetadata struct {
+	// Evidence of consenters which have signed conflicting messages,
+	// each marshaled by bdls.Evidence.Marshal.
+	Evidence [][]byte `json:"evidence,omitempty"`
+	// Latency is the propagation latency estimated by the proposer, the
+	// timeouts of rounds derive from it once the block is decided.
+	Latency time.Duration `json:"latency,omitempty"`
+}
+
+func (m *OrdererMetadata) isEmpty() bool {
+	return len(m.Evidence) == 0 && m.Latency == 0
+}
+
+// OrdererMetadataFromBlock returns the BDLS metadata recorded in the orderer
+// metadata of the block, which is empty if none is. Blocks which only record
+// evidence may carry it as a JSON array.
+func OrdererMetadataFromBlock(block *cb.Block) (*OrdererMetadata, error) {
+	m := &OrdererMetadata{}
+	if block.Metadata == nil || len(block.Metadata.Metadata) <= int(cb.BlockMetadataIndex_ORDERER) {
+		return m, nil
+	}
+	encodedMetadata := block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER]
+	if len(encodedMetadata) == 0 {
+		return m, nil
+	}
+
+	metadata := &cb.Metadata{}
+	if err := proto.Unmarshal(encodedMetadata, metadata); err != nil {
+		return nil, errors.Wrap(err, "failed unmarshaling orderer metadata")
+	}
+	if len(metadata.Value) == 0 {
+		return m, nil
+	}
+
+	if metadata.Value[0] == '[' {
+		if err := json.Unmarshal(metadata.Value, &m.Evidence); err != nil {
+			return nil, errors.Wrap(err, "failed unmarshaling evidence")
+		}
+		return m, nil
+	}
+	if err := json.Unmarshal(metadata.Value, m); err != nil {
+		return nil, errors.Wrap(err, "failed unmarshaling BDLS orderer metadata")
+	}
+	return m, nil
+}
+
+// recordOrdererMetadata records the BDLS metadata in the orderer
+// metadata of the block, unless there is nothing to record.
+func recordOrdererMetadata(block *cb.Block, m *OrdererMetadata) {
+	if m.isEmpty() {
+		return
+	}
+	value, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER] = protoutil.MarshalOrPanic(&cb.Metadata{Value: value})
+}
@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"testing"
+	"time"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrdererMetadataFromBlock(t *testing.T) {
+	block := protoutil.NewBlock(1, nil)
+	metadata, err := bdlsbft.OrdererMetadataFromBlock(block)
+	require.NoError(t, err)
+	assert.Equal(t, &bdlsbft.OrdererMetadata{}, metadata)
+
+	// evidence alone may be recorded as an array
+	block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER] = protoutil.MarshalOrPanic(&cb.Metadata{Value: []byte(`["Z2FyYmFnZQ=="]`)})
+	metadata, err = bdlsbft.OrdererMetadataFromBlock(block)
+	require.NoError(t, err)
+	assert.Equal(t, &bdlsbft.OrdererMetadata{Evidence: [][]byte{[]byte("garbage")}}, metadata)
+
+	block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER] = protoutil.MarshalOrPanic(&cb.Metadata{Value: []byte(`{"evidence":["Z2FyYmFnZQ=="],"latency":250000000}`)})
+	metadata, err = bdlsbft.OrdererMetadataFromBlock(block)
+	require.NoError(t, err)
+	assert.Equal(t, &bdlsbft.OrdererMetadata{Evidence: [][]byte{[]byte("garbage")}, Latency: 250 * time.Millisecond}, metadata)
+
+	block.Metadata.Metadata[cb.BlockMetadataIndex_ORDERER] = protoutil.MarshalOrPanic(&cb.Metadata{Value: []byte(`{"latency":"soon"}`)})
+	_, err = bdlsbft.OrdererMetadataFromBlock(block)
+	assert.Contains(t, err.Error(), "failed unmarshaling BDLS orderer metadata")
+}
+
+func TestChainRecordsLatency(t *testing.T) {
+	nodes := newTestNetwork(t, 4, "")
+	for _, n := range nodes {
+		n.opts.AdaptiveLatency = true
+		n.opts.MinLatency = time.Millisecond
+		n.opts.MaxLatency = time.Second
+		n.restart(t)
+		defer n.chain.Halt()
+	}
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, nodes[0].chain.Order(makeEnvelope(i), 0))
+		for _, n := range nodes {
+			assert.Eventually(t, func() bool { return n.ledger.height() == uint64(i+2) }, 60*time.Second, 50*time.Millisecond)
+		}
+
+		metadata, err := bdlsbft.OrdererMetadataFromBlock(nodes[0].ledger.block(uint64(i + 1)))
+		require.NoError(t, err)
+		assert.True(t, metadata.Latency >= time.Millisecond && metadata.Latency <= time.Second, "latency %v is out of bounds", metadata.Latency)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"github.com/Sperax/bdls"
+	"github.com/hyperledger/fabric/common/metrics"
+)
+
+var (
+	heightOpts = metrics.GaugeOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "height",
+		Help:         "The latest height decided by the BDLS consensus.",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+	}
+	roundOpts = metrics.GaugeOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "round",
+		Help:         "The round the BDLS consensus is working on at the next height.",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+	}
+	roundsPerDecisionOpts = metrics.HistogramOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "rounds_per_decision",
+		Help:         "The number of rounds needed to decide a height.",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+		Buckets:      []float64{1, 2, 3, 4, 6, 8, 12, 16},
+	}
+	stageDurationOpts = metrics.HistogramOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "stage_duration",
+		Help:         "The time spent in a stage of a BDLS round (in seconds).",
+		LabelNames:   []string{"channel", "stage"},
+		StatsdFormat: "%{#fqname}.%{channel}.%{stage}",
+	}
+	messagesReceivedOpts = metrics.CounterOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "messages_received",
+		Help:         "The number of BDLS messages received from other consenters.",
+		LabelNames:   []string{"channel", "type"},
+		StatsdFormat: "%{#fqname}.%{channel}.%{type}",
+	}
+	messagesSentOpts = metrics.CounterOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "messages_sent",
+		Help:         "The number of BDLS messages sent to other consenters.",
+		LabelNames:   []string{"channel", "type"},
+		StatsdFormat: "%{#fqname}.%{channel}.%{type}",
+	}
+	verificationFailuresOpts = metrics.CounterOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "verification_failures",
+		Help:         "The number of BDLS messages rejected, by reason.",
+		LabelNames:   []string{"channel", "reason"},
+		StatsdFormat: "%{#fqname}.%{channel}.%{reason}",
+	}
+	decideLatencyOpts = metrics.HistogramOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "decide_latency",
+		Help:         "The time from proposing a block to the decision of its height (in seconds).",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+	}
+	latencyOpts = metrics.GaugeOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "latency",
+		Help:         "The propagation latency the timeouts of BDLS rounds derive from (in seconds).",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+	}
+	estimatedLatencyOpts = metrics.GaugeOpts{
+		Namespace:    "consensus",
+		Subsystem:    "bdls",
+		Name:         "estimated_latency",
+		Help:         "The propagation latency estimated by the BDLS consensus (in seconds).",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+	}
+)
+
+// Metrics of the BDLS consensus.
+type Metrics struct {
+	Height               metrics.Gauge
+	Round                metrics.Gauge
+	RoundsPerDecision    metrics.Histogram
+	StageDuration        metrics.Histogram
+	MessagesReceived     metrics.Counter
+	MessagesSent         metrics.Counter
+	VerificationFailures metrics.Counter
+	DecideLatency        metrics.Histogram
+	Latency              metrics.Gauge
+	EstimatedLatency     metrics.Gauge
+}
+
+// NewMetrics creates the BDLS metrics with the given provider.
+func NewMetrics(p metrics.Provider) *Metrics {
+	return &Metrics{
+		Height:               p.NewGauge(heightOpts),
+		Round:                p.NewGauge(roundOpts),
+		RoundsPerDecision:    p.NewHistogram(roundsPerDecisionOpts),
+		StageDuration:        p.NewHistogram(stageDurationOpts),
+		MessagesReceived:     p.NewCounter(messagesReceivedOpts),
+		MessagesSent:         p.NewCounter(messagesSentOpts),
+		VerificationFailures: p.NewCounter(verificationFailuresOpts),
+		DecideLatency:        p.NewHistogram(decideLatencyOpts),
+		Latency:              p.NewGauge(latencyOpts),
+		EstimatedLatency:     p.NewGauge(estimatedLatencyOpts),
+	}
+}
+
+// failureReasons groups the errors of message verification
+// into the reasons reported by the verification failures metric.
+var failureReasons = map[error]string{
+	bdls.ErrMessageVersion:            "version",
+	bdls.ErrMessageValidator:          "rejected",
+	bdls.ErrMessageSignature:          "signature",
+	bdls.ErrMessageUnknownParticipant: "unknown_participant",
+
+	bdls.ErrRoundChangeHeightMismatch: "height",
+	bdls.ErrLockHeightMismatch:        "height",
+	bdls.ErrSelectHeightMismatch:      "height",
+	bdls.ErrDecideHeightLower:         "height",
+	bdls.ErrCommitHeightMismatch:      "height",
+
+	bdls.ErrRoundChangeRoundLower: "round",
+	bdls.ErrLockRoundLower:        "round",
+	bdls.ErrSelectRoundLower:      "round",
+	bdls.ErrCommitRoundMismatch:   "round",
+
+	bdls.ErrLockReleaseStatus: "stage",
+	bdls.ErrCommitStatus:      "stage",
+
+	bdls.ErrLockNotSignedByLeader:   "leader",
+	bdls.ErrSelectNotSignedByLeader: "leader",
+	bdls.ErrDecideNotSignedByLeader: "leader",
+
+	bdls.ErrRoundChangeStateValidation: "state",
+	bdls.ErrLockEmptyState:             "state",
+	bdls.ErrLockStateValidation:        "state",
+	bdls.ErrSelectStateValidation:      "state",
+	bdls.ErrSelectStateMismatch:        "state",
+	bdls.ErrDecideEmptyState:           "state",
+	bdls.ErrDecideStateValidation:      "state",
+	bdls.ErrCommitEmptyState:           "state",
+	bdls.ErrCommitStateMismatch:        "state",
+	bdls.ErrCommitStateValidation:      "state",
+
+	bdls.ErrLockProofUnknownParticipant:   "proof",
+	bdls.ErrLockProofTypeMismatch:         "proof",
+	bdls.ErrLockProofHeightMismatch:       "proof",
+	bdls.ErrLockProofRoundMismatch:        "proof",
+	bdls.ErrLockProofStateValidation:      "proof",
+	bdls.ErrLockProofInsufficient:         "proof",
+	bdls.ErrSelectProofUnknownParticipant: "proof",
+	bdls.ErrSelectProofTypeMismatch:       "proof",
+	bdls.ErrSelectProofHeightMismatch:     "proof",
+	bdls.ErrSelectProofRoundMismatch:      "proof",
+	bdls.ErrSelectProofStateValidation:    "proof",
+	bdls.ErrSelectProofNotTheMaximal:      "proof",
+	bdls.ErrSelectProofInsufficient:       "proof",
+	bdls.ErrSelectProofExceeded:           "proof",
+	bdls.ErrDecideProofUnknownParticipant: "proof",
+	bdls.ErrDecideProofTypeMismatch:       "proof",
+	bdls.ErrDecideProofHeightMismatch:     "proof",
+	bdls.ErrDecideProofRoundMismatch:      "proof",
+	bdls.ErrDecideProofStateValidation:    "proof",
+	bdls.ErrDecideProofInsufficient:       "proof",
+	bdls.ErrAggregateProofSigners:         "proof",
+	bdls.ErrAggregateProofSignatures:      "proof",
+}
+
+// failureReason returns the reason a message was rejected with the given error.
+// Messages which cannot be decoded are reported as malformed.
+func failureReason(err error) string {
+	if reason, exists := failureReasons[err]; exists {
+		return reason
+	}
+	return "malformed"
+}
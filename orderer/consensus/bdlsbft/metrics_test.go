@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeGauge() *metricsfakes.Gauge {
+	fakeGauge := &metricsfakes.Gauge{}
+	fakeGauge.WithReturns(fakeGauge)
+	return fakeGauge
+}
+
+func newFakeCounter() *metricsfakes.Counter {
+	fakeCounter := &metricsfakes.Counter{}
+	fakeCounter.WithReturns(fakeCounter)
+	return fakeCounter
+}
+
+func newFakeHistogram() *metricsfakes.Histogram {
+	fakeHistogram := &metricsfakes.Histogram{}
+	fakeHistogram.WithReturns(fakeHistogram)
+	return fakeHistogram
+}
+
+// labelValues returns the values of the given label the metric was scoped with.
+func labelValues(callCount func() int, argsForCall func(int) []string, label string) map[string]bool {
+	values := make(map[string]bool)
+	for i := 0; i < callCount(); i++ {
+		args := argsForCall(i)
+		for j := 0; j+1 < len(args); j += 2 {
+			if args[j] == label {
+				values[args[j+1]] = true
+			}
+		}
+	}
+	return values
+}
+
+func TestNewMetrics(t *testing.T) {
+	fakeProvider := &metricsfakes.Provider{}
+	fakeGauge := &metricsfakes.Gauge{}
+	fakeCounter := &metricsfakes.Counter{}
+	fakeHistogram := &metricsfakes.Histogram{}
+	fakeProvider.NewGaugeReturns(fakeGauge)
+	fakeProvider.NewCounterReturns(fakeCounter)
+	fakeProvider.NewHistogramReturns(fakeHistogram)
+
+	metrics := bdlsbft.NewMetrics(fakeProvider)
+	assert.Equal(t, fakeGauge, metrics.Height)
+	assert.Equal(t, fakeGauge, metrics.Round)
+	assert.Equal(t, fakeHistogram, metrics.RoundsPerDecision)
+	assert.Equal(t, fakeHistogram, metrics.StageDuration)
+	assert.Equal(t, fakeCounter, metrics.MessagesReceived)
+	assert.Equal(t, fakeCounter, metrics.MessagesSent)
+	assert.Equal(t, fakeCounter, metrics.VerificationFailures)
+	assert.Equal(t, fakeHistogram, metrics.DecideLatency)
+	assert.Equal(t, fakeGauge, metrics.Latency)
+	assert.Equal(t, fakeGauge, metrics.EstimatedLatency)
+	assert.Equal(t, 4, fakeProvider.NewGaugeCallCount())
+	assert.Equal(t, 3, fakeProvider.NewCounterCallCount())
+	assert.Equal(t, 3, fakeProvider.NewHistogramCallCount())
+}
+
+func TestChainMetrics(t *testing.T) {
+	height, round, latency, estimatedLatency := newFakeGauge(), newFakeGauge(), newFakeGauge(), newFakeGauge()
+	roundsPerDecision, stageDuration, decideLatency := newFakeHistogram(), newFakeHistogram(), newFakeHistogram()
+	received, sent, failures := newFakeCounter(), newFakeCounter(), newFakeCounter()
+
+	nodes := newTestNetwork(t, 4, "")
+	nodes[0].opts.Metrics = &bdlsbft.Metrics{
+		Height:               height,
+		Round:                round,
+		RoundsPerDecision:    roundsPerDecision,
+		StageDuration:        stageDuration,
+		MessagesReceived:     received,
+		MessagesSent:         sent,
+		VerificationFailures: failures,
+		DecideLatency:        decideLatency,
+		Latency:              latency,
+		EstimatedLatency:     estimatedLatency,
+	}
+	// restarting the chain starts it with the metrics
+	nodes[0].restart(t)
+	defer nodes[0].chain.Halt()
+	for _, n := range nodes[1:] {
+		n.chain.Start()
+		defer n.chain.Halt()
+	}
+
+	assert.Equal(t, []string{"channel", testChannel}, height.WithArgsForCall(0))
+
+	assert.NoError(t, nodes[0].chain.Order(makeEnvelope(0), 0))
+	assert.Eventually(t, func() bool { return nodes[0].ledger.height() == 2 }, 60*time.Second, 50*time.Millisecond)
+	nodes[0].chain.HandleMessage(2, []byte("garbage"))
+
+	assert.Eventually(t, func() bool {
+		return failures.AddCallCount() > 0 && height.SetArgsForCall(height.SetCallCount()-1) == 1
+	}, 60*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, 1, roundsPerDecision.ObserveCallCount())
+	assert.Equal(t, float64(1), roundsPerDecision.ObserveArgsForCall(0))
+	assert.Equal(t, 1, decideLatency.ObserveCallCount())
+	assert.True(t, stageDuration.ObserveCallCount() > 0)
+	assert.Equal(t, bdls.DefaultConsensusLatency.Seconds(), latency.SetArgsForCall(latency.SetCallCount()-1))
+	assert.True(t, estimatedLatency.SetCallCount() > 0)
+	assert.True(t, labelValues(stageDuration.WithCallCount, stageDuration.WithArgsForCall, "stage")["roundchange"])
+	assert.True(t, labelValues(received.WithCallCount, received.WithArgsForCall, "type")["RoundChange"])
+	assert.True(t, labelValues(sent.WithCallCount, sent.WithArgsForCall, "type")["RoundChange"])
+	assert.True(t, labelValues(failures.WithCallCount, failures.WithArgsForCall, "reason")["malformed"])
+}
@@ -0,0 +1,412 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Sperax/bdls"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/etcdserver/api/snap"
+	"go.etcd.io/etcd/pkg/fileutil"
+	"go.etcd.io/etcd/raft/raftpb"
+	"go.etcd.io/etcd/wal"
+	"go.etcd.io/etcd/wal/walpb"
+)
+
+// MaxSnapshotFiles defines max number of snapshot files to retain on
+// filesystem. Snapshot files are read from newest to oldest, until first
+// intact file is found. This MUST be greater equal than 1.
+var MaxSnapshotFiles = 4
+
+// Storage is a write-ahead log of the BDLS consensus state of a consenter.
+// It persists the signed messages the consenter sent and the <lock> messages
+// it committed to, along with its current height and round, so that a restarted
+// consenter never contradicts what it has sent before the restart.
+//
+// The messages are stored as WAL entries whose term is the height of the message.
+// The hard state holds the height as its term and the round as its vote.
+// Whenever the height advances, a snapshot is taken at the last entry of the
+// confirmed heights, so that their messages can be purged.
+type Storage struct {
+	walDir  string
+	snapDir string
+
+	lg *flogging.FabricLogger
+
+	wal  *wal.WAL
+	snap *snap.Snapshotter
+
+	height    uint64
+	round     uint64
+	lastIndex uint64
+
+	// the entries logged since the last snapshot
+	unreleased []raftpb.Entry
+
+	// a queue that keeps track of indices of snapshots on disk
+	snapshotIndex []uint64
+}
+
+// CreateStorage attempts to create a storage to persist the BDLS consensus state.
+// If data presents in specified disk, the height and round are loaded along
+// with the messages logged at the next height, in their logged order.
+func CreateStorage(lg *flogging.FabricLogger, walDir string, snapDir string) (*Storage, [][]byte, error) {
+	if err := os.MkdirAll(snapDir, os.ModePerm); err != nil {
+		return nil, nil, errors.Errorf("failed to mkdir '%s' for snapshot: %s", snapDir, err)
+	}
+	sn := snap.New(lg.Zap(), snapDir)
+
+	snapshot, err := sn.Load()
+	if err != nil {
+		if err != snap.ErrNoSnapshot {
+			return nil, nil, errors.Errorf("failed to load snapshot: %s", err)
+		}
+		lg.Debugf("No snapshot found at %s", snapDir)
+	}
+
+	w, st, ents, err := createOrReadWAL(lg, walDir, snapshot)
+	if err != nil {
+		return nil, nil, errors.Errorf("failed to create or read WAL: %s", err)
+	}
+
+	s := &Storage{
+		walDir:        walDir,
+		snapDir:       snapDir,
+		lg:            lg,
+		wal:           w,
+		snap:          sn,
+		height:        st.Term,
+		round:         st.Vote,
+		snapshotIndex: listSnapshots(lg, snapDir),
+	}
+	if snapshot != nil {
+		s.lastIndex = snapshot.Metadata.Index
+	}
+
+	var logged [][]byte
+	for _, e := range ents {
+		s.lastIndex = e.Index
+		s.unreleased = append(s.unreleased, raftpb.Entry{Term: e.Term, Index: e.Index})
+		if e.Term > s.height {
+			logged = append(logged, e.Data)
+		}
+	}
+	lg.Debugf("Loaded %d messages logged at height %d and round %d", len(logged), s.height+1, s.round)
+
+	return s, logged, nil
+}
+
+func createOrReadWAL(lg *flogging.FabricLogger, walDir string, snapshot *raftpb.Snapshot) (w *wal.WAL, st raftpb.HardState, ents []raftpb.Entry, err error) {
+	if !wal.Exist(walDir) {
+		lg.Infof("No WAL data found, creating new WAL at path '%s'", walDir)
+		w, err := wal.Create(lg.Zap(), walDir, nil)
+		if err == os.ErrExist {
+			lg.Fatalf("programming error, we've just checked that WAL does not exist")
+		}
+
+		if err != nil {
+			return nil, st, nil, errors.Errorf("failed to initialize WAL: %s", err)
+		}
+
+		if err = w.Close(); err != nil {
+			return nil, st, nil, errors.Errorf("failed to close the WAL just created: %s", err)
+		}
+	} else {
+		lg.Infof("Found WAL data at path '%s', replaying it", walDir)
+	}
+
+	walsnap := walpb.Snapshot{}
+	if snapshot != nil {
+		walsnap.Index, walsnap.Term = snapshot.Metadata.Index, snapshot.Metadata.Term
+	}
+
+	lg.Debugf("Loading WAL at Term %d and Index %d", walsnap.Term, walsnap.Index)
+
+	var repaired bool
+	for {
+		if w, err = wal.Open(lg.Zap(), walDir, walsnap); err != nil {
+			return nil, st, nil, errors.Errorf("failed to open WAL: %s", err)
+		}
+
+		if _, st, ents, err = w.ReadAll(); err != nil {
+			lg.Warnf("Failed to read WAL: %s", err)
+
+			if errc := w.Close(); errc != nil {
+				return nil, st, nil, errors.Errorf("failed to close erroneous WAL: %s", errc)
+			}
+
+			// only repair UnexpectedEOF and only repair once
+			if repaired || err != io.ErrUnexpectedEOF {
+				return nil, st, nil, errors.Errorf("failed to read WAL and cannot repair: %s", err)
+			}
+
+			if !wal.Repair(lg.Zap(), walDir) {
+				return nil, st, nil, errors.Errorf("failed to repair WAL: %s", err)
+			}
+
+			repaired = true
+			// next loop should be able to open WAL and return
+			continue
+		}
+
+		// successfully opened WAL and read all entries, break
+		break
+	}
+
+	return w, st, ents, nil
+}
+
+// Height returns the last height persisted.
+func (s *Storage) Height() uint64 {
+	return s.height
+}
+
+// Round returns the last round persisted.
+func (s *Storage) Round() uint64 {
+	return s.round
+}
+
+// Store appends the signed message to the log. The message
+// is synced to disk before Store returns.
+func (s *Storage) Store(m *bdls.Message, signed *bdls.SignedProto) error {
+	bts, err := signed.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal signed message")
+	}
+
+	entry := raftpb.Entry{Term: m.Height, Index: s.lastIndex + 1, Type: raftpb.EntryNormal, Data: bts}
+	if err := s.wal.Save(s.hardState(), []raftpb.Entry{entry}); err != nil {
+		return err
+	}
+	s.lastIndex = entry.Index
+	s.unreleased = append(s.unreleased, raftpb.Entry{Term: entry.Term, Index: entry.Index})
+	return nil
+}
+
+// SetState persists the height and round of the consensus. Once the height
+// advances, the messages logged at the previous heights are released.
+func (s *Storage) SetState(height uint64, round uint64) error {
+	if height == s.height && round == s.round {
+		return nil
+	}
+
+	heightChanged := height != s.height
+	s.height, s.round = height, round
+	if err := s.wal.Save(s.hardState(), nil); err != nil {
+		return err
+	}
+
+	if heightChanged {
+		return s.takeSnapshot()
+	}
+	return nil
+}
+
+// Close closes the storage.
+func (s *Storage) Close() error {
+	if err := s.wal.Close(); err != nil {
+		return errors.Errorf("failed to close WAL: %s", err)
+	}
+	return nil
+}
+
+func (s *Storage) hardState() raftpb.HardState {
+	return raftpb.HardState{Term: s.height, Vote: s.round}
+}
+
+// takeSnapshot persists a snapshot at the last entry logged at a confirmed
+// height, which releases the entries logged up to it.
+func (s *Storage) takeSnapshot() error {
+	var index uint64
+	released := 0
+	for released < len(s.unreleased) && s.unreleased[released].Term <= s.height {
+		index = s.unreleased[released].Index
+		released++
+	}
+	if released == 0 {
+		// nothing was logged since the last snapshot
+		return nil
+	}
+	snapshot := raftpb.Snapshot{Metadata: raftpb.SnapshotMetadata{Index: index, Term: s.height}}
+
+	s.lg.Debugf("Persisting snapshot (height: %d, index: %d) to WAL and disk", s.height, index)
+
+	// must save the snapshot index to the WAL before saving the
+	// snapshot to maintain the invariant that we only Open the
+	// wal at previously-saved snapshot indexes.
+	walsnap := walpb.Snapshot{
+		Index: snapshot.Metadata.Index,
+		Term:  snapshot.Metadata.Term,
+	}
+	if err := s.wal.SaveSnapshot(walsnap); err != nil {
+		return errors.Errorf("failed to save snapshot to WAL: %s", err)
+	}
+
+	if err := s.snap.SaveSnap(snapshot); err != nil {
+		return errors.Errorf("failed to save snapshot to disk: %s", err)
+	}
+
+	if err := s.wal.ReleaseLockTo(snapshot.Metadata.Index); err != nil {
+		return err
+	}
+
+	s.unreleased = s.unreleased[released:]
+	s.snapshotIndex = append(s.snapshotIndex, snapshot.Metadata.Index)
+	s.gc()
+	return nil
+}
+
+// listSnapshots returns a list of indices of snapshots stored on disk.
+// If a file is corrupted, rename the file.
+func listSnapshots(logger *flogging.FabricLogger, snapDir string) []uint64 {
+	dir, err := os.Open(snapDir)
+	if err != nil {
+		logger.Errorf("Failed to open snapshot directory %s: %s", snapDir, err)
+		return nil
+	}
+	defer dir.Close()
+
+	filenames, err := dir.Readdirnames(-1)
+	if err != nil {
+		logger.Errorf("Failed to read snapshot files: %s", err)
+		return nil
+	}
+
+	snapfiles := []string{}
+	for i := range filenames {
+		if strings.HasSuffix(filenames[i], ".snap") {
+			snapfiles = append(snapfiles, filenames[i])
+		}
+	}
+	sort.Strings(snapfiles)
+
+	var snapshots []uint64
+	for _, snapfile := range snapfiles {
+		fpath := filepath.Join(snapDir, snapfile)
+		s, err := snap.Read(logger.Zap(), fpath)
+		if err != nil {
+			logger.Errorf("Snapshot file %s is corrupted: %s", fpath, err)
+
+			broken := fpath + ".broken"
+			if err = os.Rename(fpath, broken); err != nil {
+				logger.Errorf("Failed to rename corrupted snapshot file %s to %s: %s", fpath, broken, err)
+			} else {
+				logger.Debugf("Renaming corrupted snapshot file %s to %s", fpath, broken)
+			}
+
+			continue
+		}
+
+		snapshots = append(snapshots, s.Metadata.Index)
+	}
+
+	return snapshots
+}
+
+// gc collects garbage files, namely wal and snapshot files
+func (s *Storage) gc() {
+	if len(s.snapshotIndex) < MaxSnapshotFiles {
+		return
+	}
+
+	s.snapshotIndex = s.snapshotIndex[len(s.snapshotIndex)-MaxSnapshotFiles:]
+
+	s.purgeWAL()
+	s.purgeSnap()
+}
+
+func (s *Storage) purgeWAL() {
+	retain := s.snapshotIndex[0]
+
+	var files []string
+	err := filepath.Walk(s.walDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(path, ".wal") {
+			return nil
+		}
+
+		var seq, index uint64
+		_, f := filepath.Split(path)
+		fmt.Sscanf(f, "%016x-%016x.wal", &seq, &index)
+
+		// Only purge WAL with index lower than oldest snapshot.
+		// filepath.SkipDir seizes Walk without returning error.
+		if index >= retain {
+			return filepath.SkipDir
+		}
+
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		s.lg.Errorf("Failed to read WAL directory %s: %s", s.walDir, err)
+	}
+
+	if len(files) <= 1 {
+		// we need to keep one wal segment with index smaller than snapshot.
+		// see comment on wal.ReleaseLockTo for the more details.
+		return
+	}
+
+	s.purge(files[:len(files)-1])
+}
+
+func (s *Storage) purgeSnap() {
+	var files []string
+	err := filepath.Walk(s.snapDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".snap") {
+			files = append(files, path)
+		} else if strings.HasSuffix(path, ".broken") {
+			s.lg.Warnf("Found broken snapshot file %s, it can be removed manually", path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		s.lg.Errorf("Failed to read Snapshot directory %s: %s", s.snapDir, err)
+		return
+	}
+
+	l := len(files)
+	if l <= MaxSnapshotFiles {
+		return
+	}
+
+	s.purge(files[:l-MaxSnapshotFiles]) // retain last MaxSnapshotFiles snapshot files
+}
+
+func (s *Storage) purge(files []string) {
+	for _, file := range files {
+		l, err := fileutil.TryLockFile(file, os.O_WRONLY, fileutil.PrivateFileMode)
+		if err != nil {
+			s.lg.Debugf("Failed to lock %s, abort purging", file)
+			break
+		}
+
+		if err = os.Remove(file); err != nil {
+			s.lg.Errorf("Failed to remove %s: %s", file, err)
+		} else {
+			s.lg.Debugf("Purged file %s", file)
+		}
+
+		if err = l.Close(); err != nil {
+			s.lg.Errorf("Failed to close file lock %s: %s", l.Name(), err)
+		}
+	}
+}
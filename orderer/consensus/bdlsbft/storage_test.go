@@ -0,0 +1,105 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Sperax/bdls"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signedMessage(t *testing.T, key *ecdsa.PrivateKey, typ bdls.MessageType, height, round uint64) []byte {
+	sp := &bdls.SignedProto{}
+	sp.Sign(&bdls.Message{Type: typ, Height: height, Round: round, State: []byte("state")}, key)
+	bts, err := sp.Marshal()
+	require.NoError(t, err)
+	return bts
+}
+
+func TestStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdls-storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	walDir, snapDir := filepath.Join(dir, "wal"), filepath.Join(dir, "snap")
+	logger := flogging.MustGetLogger("test")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	store := func(s *bdlsbft.Storage, typ bdls.MessageType, height, round uint64) []byte {
+		bts := signedMessage(t, key, typ, height, round)
+		sp := &bdls.SignedProto{}
+		require.NoError(t, sp.Unmarshal(bts))
+		m := &bdls.Message{}
+		require.NoError(t, m.Unmarshal(sp.Message))
+		require.NoError(t, s.Store(m, sp))
+		return bts
+	}
+
+	s, logged, err := bdlsbft.CreateStorage(logger, walDir, snapDir)
+	require.NoError(t, err)
+	assert.Empty(t, logged)
+	assert.Equal(t, uint64(0), s.Height())
+	assert.Equal(t, uint64(0), s.Round())
+
+	store(s, bdls.MessageType_Commit, 1, 0)
+	store(s, bdls.MessageType_Decide, 1, 0)
+	require.NoError(t, s.SetState(1, 0))
+	lock := store(s, bdls.MessageType_Lock, 2, 3)
+	commit := store(s, bdls.MessageType_Commit, 2, 3)
+	require.NoError(t, s.SetState(1, 3))
+	require.NoError(t, s.Close())
+
+	// only the messages of the next height are restored
+	s, logged, err = bdlsbft.CreateStorage(logger, walDir, snapDir)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{lock, commit}, logged)
+	assert.Equal(t, uint64(1), s.Height())
+	assert.Equal(t, uint64(3), s.Round())
+
+	// logging continues after the restored messages
+	decide := store(s, bdls.MessageType_Decide, 2, 3)
+	require.NoError(t, s.Close())
+
+	s, logged, err = bdlsbft.CreateStorage(logger, walDir, snapDir)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{lock, commit, decide}, logged)
+
+	// messages of confirmed heights are released
+	for height := uint64(2); height < 10; height++ {
+		require.NoError(t, s.SetState(height, 0))
+		store(s, bdls.MessageType_Commit, height+1, 0)
+	}
+	require.NoError(t, s.Close())
+
+	snapshots, err := filepath.Glob(filepath.Join(snapDir, "*.snap"))
+	require.NoError(t, err)
+	assert.Len(t, snapshots, bdlsbft.MaxSnapshotFiles)
+
+	s, logged, err = bdlsbft.CreateStorage(logger, walDir, snapDir)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Len(t, logged, 1)
+	sp := &bdls.SignedProto{}
+	require.NoError(t, sp.Unmarshal(logged[0]))
+	m := &bdls.Message{}
+	require.NoError(t, m.Unmarshal(sp.Message))
+	assert.Equal(t, uint64(10), m.Height)
+	assert.Equal(t, uint64(9), s.Height())
+	assert.Equal(t, uint64(0), s.Round())
+}
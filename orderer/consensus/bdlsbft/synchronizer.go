@@ -0,0 +1,131 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"sort"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// BlockPuller is used to pull blocks from other OSN
+type BlockPuller interface {
+	PullBlock(seq uint64) *cb.Block
+	HeightsByEndpoints() (map[string]uint64, error)
+	Close()
+}
+
+// CreateBlockPuller is a function to create BlockPuller on demand.
+// It is passed into chain initializer so that tests could mock this.
+type CreateBlockPuller func() (BlockPuller, error)
+
+// Synchronizer catches a lagging consenter up with the other consenters,
+// by pulling the decided blocks it missed from them.
+type Synchronizer struct {
+	Support     consensus.ConsenterSupport
+	BlockPuller BlockPuller
+	ClusterSize uint64
+	Logger      *flogging.FabricLogger
+
+	// VerifyBlock verifies the decide proof embedded in a pulled block,
+	// and returns the proof to be written along with the block.
+	VerifyBlock func(*cb.Block) ([]byte, error)
+	// OnCommit is called after a pulled block is written to the ledger.
+	OnCommit func(*cb.Block)
+	// Done, if set, reports whether no further block should be pulled,
+	// such as once the channel migrated to another consensus type.
+	Done func() bool
+}
+
+// Sync pulls the blocks this consenter is missing, up to the height reached
+// by at least f+1 consenters, and writes them to the ledger after verifying
+// their decide proofs. It returns the last block written.
+func (s *Synchronizer) Sync() (*cb.Block, error) {
+	defer s.BlockPuller.Close()
+
+	heightByEndpoint, err := s.BlockPuller.HeightsByEndpoints()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get HeightsByEndpoints")
+	}
+
+	s.Logger.Infof("HeightsByEndpoints: %v", heightByEndpoint)
+
+	if len(heightByEndpoint) == 0 {
+		return nil, errors.New("no cluster members to synchronize with")
+	}
+
+	var heights []uint64
+	for _, value := range heightByEndpoint {
+		heights = append(heights, value)
+	}
+
+	targetHeight := s.computeTargetHeight(heights)
+	startHeight := s.Support.Height()
+	if startHeight >= targetHeight {
+		return nil, errors.Errorf("already at height of %d", targetHeight)
+	}
+
+	s.Logger.Debugf("Will fetch sequences [%d-%d]", startHeight, targetHeight-1)
+
+	var lastPulledBlock *cb.Block
+	for seq := startHeight; seq < targetHeight; seq++ {
+		block := s.BlockPuller.PullBlock(seq)
+		if block == nil {
+			s.Logger.Debugf("Failed to fetch block [%d] from cluster", seq)
+			break
+		}
+
+		proof, err := s.VerifyBlock(block)
+		if err != nil {
+			s.Logger.Warnf("Pulled block [%d] has an invalid decide proof: %v", seq, err)
+			break
+		}
+
+		if protoutil.IsConfigBlock(block) {
+			s.Support.WriteConfigBlock(block, proof)
+		} else {
+			s.Support.WriteBlock(block, proof)
+		}
+		s.Logger.Debugf("Fetched and committed block [%d] from cluster", seq)
+		lastPulledBlock = block
+		s.OnCommit(block)
+		if s.Done != nil && s.Done() {
+			break
+		}
+	}
+
+	if lastPulledBlock == nil {
+		return nil, errors.Errorf("failed pulling block %d", startHeight)
+	}
+
+	s.Logger.Infof("Finished synchronizing with cluster, fetched %d blocks, starting from block [%d], up until and including block [%d]",
+		lastPulledBlock.Header.Number-startHeight+1, startHeight, lastPulledBlock.Header.Number)
+	return lastPulledBlock, nil
+}
+
+// computeTargetHeight compute the target height to synchronize to.
+//
+// heights: a slice containing the heights of accessible peers, length must be >0.
+// clusterSize: the cluster size, must be >0.
+func (s *Synchronizer) computeTargetHeight(heights []uint64) uint64 {
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] }) // Descending
+	f := uint64(s.ClusterSize-1) / 3                                            // The number of tolerated byzantine faults
+	lenH := uint64(len(heights))
+
+	s.Logger.Debugf("Heights: %v", heights)
+
+	if lenH < f+1 {
+		s.Logger.Debugf("Returning %d", heights[lenH-1])
+		return heights[lenH-1]
+	}
+	s.Logger.Debugf("Returning %d", heights[f])
+	return heights[f]
+}
@@ -0,0 +1,88 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSynchronizer(t *testing.T) {
+	// a remote ledger of 6 blocks
+	genesis := protoutil.NewBlock(0, nil)
+	remote := &ledger{blocks: []*cb.Block{genesis}, last: genesis, metadata: make(map[uint64][]byte)}
+	for i := 1; i < 6; i++ {
+		remote.write(remote.createNextBlock([]*cb.Envelope{makeEnvelope(i)}), []byte{byte(i)})
+	}
+	// and a shorter one
+	short := &ledger{blocks: remote.blocks[:3], last: remote.blocks[2], metadata: remote.metadata}
+
+	newSynchronizer := func(ledgers ...*ledger) (*bdlsbft.Synchronizer, *ledger, *[]uint64) {
+		support, l := newSupport(proto.Clone(genesis).(*cb.Block), nil)
+		var committed []uint64
+		return &bdlsbft.Synchronizer{
+			Support:     support,
+			BlockPuller: &puller{ledgers: ledgers},
+			ClusterSize: 4,
+			Logger:      flogging.MustGetLogger("test"),
+			VerifyBlock: func(block *cb.Block) ([]byte, error) {
+				return []byte{byte(block.Header.Number)}, nil
+			},
+			OnCommit: func(block *cb.Block) {
+				committed = append(committed, block.Header.Number)
+			},
+		}, l, &committed
+	}
+
+	t.Run("pulls up to the height of f+1 consenters", func(t *testing.T) {
+		s, l, committed := newSynchronizer(remote, short, short)
+		last, err := s.Sync()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), last.Header.Number)
+		assert.Equal(t, uint64(3), l.height())
+		assert.Equal(t, []uint64{1, 2}, *committed)
+		assert.Equal(t, []byte{2}, l.consenterMetadata(2))
+	})
+
+	t.Run("stops at the first invalid block", func(t *testing.T) {
+		s, l, committed := newSynchronizer(remote, remote)
+		s.VerifyBlock = func(block *cb.Block) ([]byte, error) {
+			if block.Header.Number == 4 {
+				return nil, errors.New("forged proof")
+			}
+			return []byte{byte(block.Header.Number)}, nil
+		}
+		last, err := s.Sync()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), last.Header.Number)
+		assert.Equal(t, uint64(4), l.height())
+		assert.Equal(t, []uint64{1, 2, 3}, *committed)
+	})
+
+	t.Run("already at the target height", func(t *testing.T) {
+		s, _, committed := newSynchronizer(short, remote)
+		s.Support.WriteBlock(proto.Clone(remote.block(1)).(*cb.Block), nil)
+		s.Support.WriteBlock(proto.Clone(remote.block(2)).(*cb.Block), nil)
+		_, err := s.Sync()
+		assert.EqualError(t, err, "already at height of 3")
+		assert.Empty(t, *committed)
+	})
+
+	t.Run("no consenters to pull from", func(t *testing.T) {
+		s, _, _ := newSynchronizer()
+		_, err := s.Sync()
+		assert.EqualError(t, err, "no cluster members to synchronize with")
+	})
+}
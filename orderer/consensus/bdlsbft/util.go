@@ -0,0 +1,291 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	bdlspb "github.com/hyperledger/fabric-protos-go/orderer/bdls"
+	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/common/channelconfig"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/orderer/common/cluster"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// PublicKeyFromIdentity extracts the ECDSA public key from the certificate
+// of a serialized MSP identity.
+func PublicKeyFromIdentity(serializedIdentity []byte) (*ecdsa.PublicKey, error) {
+	sID := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(serializedIdentity, sID); err != nil {
+		return nil, errors.Wrap(err, "failed unmarshaling serialized identity")
+	}
+	bl, _ := pem.Decode(sID.IdBytes)
+	if bl == nil {
+		return nil, errors.Errorf("invalid PEM block in identity of %s", sID.Mspid)
+	}
+	cert, err := x509.ParseCertificate(bl.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing certificate in identity of %s", sID.Mspid)
+	}
+	pk, isECDSA := cert.PublicKey.(*ecdsa.PublicKey)
+	if !isECDSA {
+		return nil, errors.Errorf("identity of %s does not contain an ECDSA public key", sID.Mspid)
+	}
+	return pk, nil
+}
+
+// Participants returns the BDLS participant identities of the given consenters,
+// in the order they appear in the config metadata.
+func Participants(consenters []*bdlspb.Consenter) ([]bdls.Identity, error) {
+	var participants []bdls.Identity
+	for _, consenter := range consenters {
+		pk, err := PublicKeyFromIdentity(consenter.Identity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "consenter %d", consenter.ConsenterId)
+		}
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(pk))
+	}
+	return participants, nil
+}
+
+// Curve returns the elliptic curve the given consenters sign BDLS messages with,
+// which is the curve of their public keys. All the consenters must have keys on
+// the same curve, and BDLS supports P-256, the curve of most MSP identities.
+func Curve(consenters []*bdlspb.Consenter) (elliptic.Curve, error) {
+	var name string
+	for _, consenter := range consenters {
+		pk, err := PublicKeyFromIdentity(consenter.Identity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "consenter %d", consenter.ConsenterId)
+		}
+		curveName := bdls.CurveName(pk.Curve)
+		if curveName == "" {
+			return nil, errors.Errorf("consenter %d has a key on unsupported curve %s", consenter.ConsenterId, pk.Curve.Params().Name)
+		}
+		if name != "" && curveName != name {
+			return nil, errors.Errorf("consenter %d has a key on curve %s while others have keys on curve %s", consenter.ConsenterId, curveName, name)
+		}
+		name = curveName
+	}
+	return bdls.CurveByName(name)
+}
+
+// LeaderElection returns the election of BDLS round leaders the options call for.
+// By default leaders are elected by a random beacon seeded with the previous block,
+// with LeaderRotation ON they take turns after DecisionsPerLeader blocks (1 if unset),
+// and with LeaderRotation OFF a leader is only replaced when its round fails.
+func LeaderElection(options *bdlspb.Options) bdls.LeaderElection {
+	switch options.GetLeaderRotation() {
+	case bdlspb.Options_OFF:
+		return bdls.RoundRobinLeader{}
+	case bdlspb.Options_ON:
+		decisionsPerLeader := options.DecisionsPerLeader
+		if decisionsPerLeader == 0 {
+			decisionsPerLeader = 1
+		}
+		return bdls.RoundRobinLeader{DecisionsPerLeader: decisionsPerLeader}
+	default:
+		return bdls.RandomLeader{}
+	}
+}
+
+// Timeouts returns the base durations of the stages of BDLS rounds the options call for.
+// A consenter waits ViewChangeResendInterval for a round to be locked before it moves
+// to the next round, the leader of a round collects <roundchange> messages for up to
+// CollectTimeout, and the durations double with every round up to ViewChangeTimeout.
+// The durations of the other stages, and those left unset, derive from the latency.
+func Timeouts(options *bdlspb.Options) (bdls.Timeouts, error) {
+	var timeouts bdls.Timeouts
+	for _, option := range []struct {
+		name     string
+		value    string
+		duration *time.Duration
+	}{
+		{name: "ViewChangeResendInterval", value: options.GetViewChangeResendInterval(), duration: &timeouts.RoundChange},
+		{name: "CollectTimeout", value: options.GetCollectTimeout(), duration: &timeouts.Collect},
+		{name: "ViewChangeTimeout", value: options.GetViewChangeTimeout(), duration: &timeouts.MaxBackoff},
+	} {
+		if option.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(option.value)
+		if err != nil {
+			return bdls.Timeouts{}, errors.Wrapf(err, "bad config metadata option %s", option.name)
+		}
+		if d < 0 {
+			return bdls.Timeouts{}, errors.Errorf("bad config metadata option %s: negative duration %s", option.name, option.value)
+		}
+		*option.duration = d
+	}
+
+	if err := bdls.VerifyTimeouts(&timeouts); err != nil {
+		maxBackoff := timeouts.MaxBackoff
+		if maxBackoff == 0 {
+			maxBackoff = bdls.MaxConsensusLatency
+		}
+		return bdls.Timeouts{}, errors.Errorf("bad config metadata options: ViewChangeResendInterval and CollectTimeout cannot exceed ViewChangeTimeout %s", maxBackoff)
+	}
+	return timeouts, nil
+}
+
+// PublicKeysFromConsenters returns the public keys of the given consenters, mapped by their IDs.
+func PublicKeysFromConsenters(consenters []*bdlspb.Consenter) (map[uint64]*ecdsa.PublicKey, error) {
+	publicKeys := make(map[uint64]*ecdsa.PublicKey, len(consenters))
+	for _, consenter := range consenters {
+		pk, err := PublicKeyFromIdentity(consenter.Identity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "consenter %d", consenter.ConsenterId)
+		}
+		publicKeys[consenter.ConsenterId] = pk
+	}
+	return publicKeys, nil
+}
+
+// RemoteNodesFromConsenters returns the cluster members of the given consenters,
+// excluding the consenter with the given self ID.
+func RemoteNodesFromConsenters(consenters []*bdlspb.Consenter, selfID uint64, logger *flogging.FabricLogger) ([]cluster.RemoteNode, error) {
+	var remoteNodes []cluster.RemoteNode
+	for _, consenter := range consenters {
+		// No need to know yourself
+		if selfID == consenter.ConsenterId {
+			continue
+		}
+		serverCertAsDER, err := pemToDER(consenter.ServerTlsCert, consenter.ConsenterId, "server", logger)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		clientCertAsDER, err := pemToDER(consenter.ClientTlsCert, consenter.ConsenterId, "client", logger)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// Validate certificate structure
+		for _, cert := range [][]byte{serverCertAsDER, clientCertAsDER} {
+			if _, err := x509.ParseCertificate(cert); err != nil {
+				pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+				logger.Errorf("Invalid certificate: %s", string(pemBytes))
+				return nil, err
+			}
+		}
+
+		remoteNodes = append(remoteNodes, cluster.RemoteNode{
+			ID:            consenter.ConsenterId,
+			ClientTLSCert: clientCertAsDER,
+			ServerTLSCert: serverCertAsDER,
+			Endpoint:      fmt.Sprintf("%s:%d", consenter.Host, consenter.Port),
+		})
+	}
+	return remoteNodes, nil
+}
+
+func pemToDER(pemBytes []byte, id uint64, certType string, logger *flogging.FabricLogger) ([]byte, error) {
+	bl, _ := pem.Decode(pemBytes)
+	if bl == nil {
+		logger.Errorf("Rejecting PEM block of %s TLS cert for node %d, offending PEM is: %s", certType, id, string(pemBytes))
+		return nil, errors.Errorf("invalid PEM block")
+	}
+	return bl.Bytes, nil
+}
+
+func parseCertificateFromBytes(cert []byte) (*x509.Certificate, error) {
+	pemBlock, _ := pem.Decode(cert)
+	if pemBlock == nil {
+		return nil, errors.Errorf("no PEM data found in cert[% x]", cert)
+	}
+
+	certificate, err := x509.ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		return nil, errors.Errorf("%s TLS certificate has invalid ASN1 structure %s", err, string(pemBlock.Bytes))
+	}
+
+	return certificate, nil
+}
+
+// validateConsenterTLSCerts decodes the PEM TLS certificates of the consenter,
+// parses them and verifies them against the given options.
+func validateConsenterTLSCerts(c *bdlspb.Consenter, opts x509.VerifyOptions, ignoreExpiration bool) error {
+	clientCert, err := parseCertificateFromBytes(c.ClientTlsCert)
+	if err != nil {
+		return errors.Wrapf(err, "parsing tls client cert of %s:%d", c.Host, c.Port)
+	}
+
+	serverCert, err := parseCertificateFromBytes(c.ServerTlsCert)
+	if err != nil {
+		return errors.Wrapf(err, "parsing tls server cert of %s:%d", c.Host, c.Port)
+	}
+
+	verify := func(certType string, cert *x509.Certificate, opts x509.VerifyOptions) error {
+		if _, err := cert.Verify(opts); err != nil {
+			if validationRes, ok := err.(x509.CertificateInvalidError); !ok || (!ignoreExpiration || validationRes.Reason != x509.Expired) {
+				return errors.Wrapf(err, "verifying tls %s cert with serial number %d", certType, cert.SerialNumber)
+			}
+		}
+		return nil
+	}
+
+	if err := verify("client", clientCert, opts); err != nil {
+		return err
+	}
+	if err := verify("server", serverCert, opts); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsenterCertificate denotes a TLS certificate of a consenter
+type ConsenterCertificate struct {
+	ConsenterCertificate []byte
+	CryptoProvider       bccsp.BCCSP
+}
+
+// IsConsenterOfChannel returns whether the caller is a consenter of a channel
+// by inspecting the given configuration block.
+// It returns nil if true, else returns an error.
+func (conCert ConsenterCertificate) IsConsenterOfChannel(configBlock *cb.Block) error {
+	if configBlock == nil || configBlock.Header == nil {
+		return errors.New("nil block or nil header")
+	}
+	envelopeConfig, err := protoutil.ExtractEnvelope(configBlock, 0)
+	if err != nil {
+		return err
+	}
+	bundle, err := channelconfig.NewBundleFromEnvelope(envelopeConfig, conCert.CryptoProvider)
+	if err != nil {
+		return err
+	}
+	oc, exists := bundle.OrdererConfig()
+	if !exists {
+		return errors.New("no orderer config in bundle")
+	}
+	if oc.ConsensusType() != "bdls" {
+		return errors.New("not a BDLS config block")
+	}
+	m := &bdlspb.ConfigMetadata{}
+	if err := proto.Unmarshal(oc.ConsensusMetadata(), m); err != nil {
+		return err
+	}
+
+	for _, consenter := range m.Consenters {
+		if bytes.Equal(conCert.ConsenterCertificate, consenter.ServerTlsCert) || bytes.Equal(conCert.ConsenterCertificate, consenter.ClientTlsCert) {
+			return nil
+		}
+	}
+	return cluster.ErrNotInChannel
+}
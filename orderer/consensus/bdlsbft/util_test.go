@@ -0,0 +1,374 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	bdlspb "github.com/hyperledger/fabric-protos-go/orderer/bdls"
+	"github.com/hyperledger/fabric/bccsp/sw"
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/core/config/configtest"
+	"github.com/hyperledger/fabric/internal/configtxgen/encoder"
+	"github.com/hyperledger/fabric/internal/configtxgen/genesisconfig"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeConsenters(t *testing.T, n int) []*bdlspb.Consenter {
+	consenters, _ := makeConsentersWithKeys(t, n)
+	return consenters
+}
+
+// makeConsentersWithKeys creates n consenters along with their private keys.
+func makeConsentersWithKeys(t *testing.T, n int) ([]*bdlspb.Consenter, []*ecdsa.PrivateKey) {
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	return makeConsentersOfCA(t, ca, n)
+}
+
+// makeConsentersOfCA creates n consenters with certificates issued by the given CA,
+// along with their private keys.
+func makeConsentersOfCA(t *testing.T, ca tlsgen.CA, n int) ([]*bdlspb.Consenter, []*ecdsa.PrivateKey) {
+	var consenters []*bdlspb.Consenter
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < n; i++ {
+		kp, err := ca.NewServerCertKeyPair("localhost")
+		require.NoError(t, err)
+		bl, _ := pem.Decode(kp.Key)
+		require.NotNil(t, bl)
+		key, err := x509.ParsePKCS8PrivateKey(bl.Bytes)
+		require.NoError(t, err)
+		keys = append(keys, key.(*ecdsa.PrivateKey))
+		consenters = append(consenters, &bdlspb.Consenter{
+			ConsenterId:   uint64(i + 1),
+			Host:          "localhost",
+			Port:          uint32(7050 + i),
+			MspId:         "OrdererOrg",
+			Identity:      protoutil.MarshalOrPanic(&msp.SerializedIdentity{Mspid: "OrdererOrg", IdBytes: kp.Cert}),
+			ClientTlsCert: kp.Cert,
+			ServerTlsCert: kp.Cert,
+		})
+	}
+	return consenters, keys
+}
+
+func publicKey(t *testing.T, pemCert []byte) *ecdsa.PublicKey {
+	bl, _ := pem.Decode(pemCert)
+	require.NotNil(t, bl)
+	cert, err := x509.ParseCertificate(bl.Bytes)
+	require.NoError(t, err)
+	return cert.PublicKey.(*ecdsa.PublicKey)
+}
+
+func TestParticipants(t *testing.T) {
+	consenters := makeConsenters(t, 4)
+
+	participants, err := bdlsbft.Participants(consenters)
+	require.NoError(t, err)
+	require.Len(t, participants, 4)
+	for i, consenter := range consenters {
+		assert.Equal(t, bdls.DefaultPubKeyToIdentity(publicKey(t, consenter.ServerTlsCert)), participants[i])
+	}
+
+	consenters[2].Identity = protoutil.MarshalOrPanic(&msp.SerializedIdentity{Mspid: "OrdererOrg", IdBytes: []byte("garbage")})
+	_, err = bdlsbft.Participants(consenters)
+	assert.EqualError(t, err, "consenter 3: invalid PEM block in identity of OrdererOrg")
+}
+
+func TestRemoteNodesFromConsenters(t *testing.T) {
+	consenters := makeConsenters(t, 4)
+
+	remoteNodes, err := bdlsbft.RemoteNodesFromConsenters(consenters, 2, flogging.MustGetLogger("test"))
+	require.NoError(t, err)
+	require.Len(t, remoteNodes, 3)
+	for _, node := range remoteNodes {
+		assert.NotEqual(t, uint64(2), node.ID)
+	}
+	assert.Equal(t, "localhost:7050", remoteNodes[0].Endpoint)
+
+	consenters[3].ClientTlsCert = []byte("garbage")
+	_, err = bdlsbft.RemoteNodesFromConsenters(consenters, 2, flogging.MustGetLogger("test"))
+	assert.EqualError(t, err, "invalid PEM block")
+}
+
+func TestVerifyConfigMetadata(t *testing.T) {
+	ca, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	consenters, _ := makeConsentersOfCA(t, ca, 5)
+
+	foreignCA, err := tlsgen.NewCA()
+	require.NoError(t, err)
+	foreignConsenters, _ := makeConsentersOfCA(t, foreignCA, 1)
+	foreignConsenter := proto.Clone(consenters[3]).(*bdlspb.Consenter)
+	foreignConsenter.ServerTlsCert = foreignConsenters[0].ServerTlsCert
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(ca.CertBytes()))
+	verifyOpts := x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+
+	otherConsenter := func(id uint64, identity []byte) *bdlspb.Consenter {
+		consenter := proto.Clone(consenters[4]).(*bdlspb.Consenter)
+		consenter.ConsenterId = id
+		consenter.Identity = identity
+		return consenter
+	}
+
+	for _, testCase := range []struct {
+		name        string
+		metadata    *bdlspb.ConfigMetadata
+		expectedErr string
+	}{
+		{
+			name:        "nil metadata",
+			expectedErr: "nil BDLS config metadata",
+		},
+		{
+			name:        "nil options",
+			metadata:    &bdlspb.ConfigMetadata{Consenters: consenters[:4]},
+			expectedErr: "nil BDLS config metadata options",
+		},
+		{
+			name:        "too few consenters",
+			metadata:    &bdlspb.ConfigMetadata{Consenters: consenters[:3], Options: &bdlspb.Options{}},
+			expectedErr: "BDLS requires at least 4 consenters, got 3",
+		},
+		{
+			name:        "bad batch interval",
+			metadata:    &bdlspb.ConfigMetadata{Consenters: consenters[:4], Options: &bdlspb.Options{RequestBatchMaxInterval: "soon"}},
+			expectedErr: "bad config metadata option RequestBatchMaxInterval: time: invalid duration \"soon\"",
+		},
+		{
+			name:        "bad leader rotation",
+			metadata:    &bdlspb.ConfigMetadata{Consenters: consenters[:4], Options: &bdlspb.Options{LeaderRotation: 3}},
+			expectedErr: "bad config metadata option LeaderRotation: 3",
+		},
+		{
+			name:        "bad collect timeout",
+			metadata:    &bdlspb.ConfigMetadata{Consenters: consenters[:4], Options: &bdlspb.Options{CollectTimeout: "1"}},
+			expectedErr: "bad config metadata option CollectTimeout: time: missing unit in duration \"1\"",
+		},
+		{
+			name:        "negative view change resend interval",
+			metadata:    &bdlspb.ConfigMetadata{Consenters: consenters[:4], Options: &bdlspb.Options{ViewChangeResendInterval: "-1s"}},
+			expectedErr: "bad config metadata option ViewChangeResendInterval: negative duration -1s",
+		},
+		{
+			name: "timeout above view change timeout",
+			metadata: &bdlspb.ConfigMetadata{Consenters: consenters[:4], Options: &bdlspb.Options{
+				ViewChangeResendInterval: "5s",
+				ViewChangeTimeout:        "2s",
+			}},
+			expectedErr: "bad config metadata options: ViewChangeResendInterval and CollectTimeout cannot exceed ViewChangeTimeout 2s",
+		},
+		{
+			name: "duplicate consenter id",
+			metadata: &bdlspb.ConfigMetadata{
+				Consenters: append(consenters[:4:4], otherConsenter(2, consenters[4].Identity)),
+				Options:    &bdlspb.Options{},
+			},
+			expectedErr: "duplicate consenter id 2",
+		},
+		{
+			name: "duplicate consenter identity",
+			metadata: &bdlspb.ConfigMetadata{
+				Consenters: append(consenters[:4:4], otherConsenter(5, consenters[1].Identity)),
+				Options:    &bdlspb.Options{},
+			},
+			expectedErr: "consenters 2 and 5 have the same identity",
+		},
+		{
+			name:        "nil consenter",
+			metadata:    &bdlspb.ConfigMetadata{Consenters: append(consenters[:3:3], nil), Options: &bdlspb.Options{}},
+			expectedErr: "metadata has nil consenter",
+		},
+		{
+			name: "bad tls cert",
+			metadata: &bdlspb.ConfigMetadata{
+				Consenters: append(consenters[:3:3], &bdlspb.Consenter{ConsenterId: 4, Host: "localhost", Port: 7060, ClientTlsCert: []byte("garbage")}),
+				Options:    &bdlspb.Options{},
+			},
+			expectedErr: "parsing tls client cert of localhost:7060: no PEM data found in cert[67 61 72 62 61 67 65]",
+		},
+		{
+			name:     "valid",
+			metadata: &bdlspb.ConfigMetadata{Consenters: consenters[:4], Options: &bdlspb.Options{RequestBatchMaxInterval: "50ms"}},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := bdlsbft.VerifyConfigMetadata(testCase.metadata, verifyOpts)
+			if testCase.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, testCase.expectedErr)
+		})
+	}
+
+	t.Run("tls cert of a foreign CA", func(t *testing.T) {
+		metadata := &bdlspb.ConfigMetadata{Consenters: append(consenters[:3:3], foreignConsenter), Options: &bdlspb.Options{}}
+		err := bdlsbft.VerifyConfigMetadata(metadata, verifyOpts)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "verifying tls server cert with serial number")
+		assert.Contains(t, err.Error(), "certificate signed by unknown authority")
+	})
+}
+
+func TestLeaderElection(t *testing.T) {
+	assert.Equal(t, bdls.RandomLeader{}, bdlsbft.LeaderElection(nil))
+	assert.Equal(t, bdls.RandomLeader{}, bdlsbft.LeaderElection(&bdlspb.Options{DecisionsPerLeader: 3}))
+	assert.Equal(t, bdls.RoundRobinLeader{}, bdlsbft.LeaderElection(&bdlspb.Options{
+		LeaderRotation:     bdlspb.Options_OFF,
+		DecisionsPerLeader: 3,
+	}))
+	assert.Equal(t, bdls.RoundRobinLeader{DecisionsPerLeader: 1}, bdlsbft.LeaderElection(&bdlspb.Options{
+		LeaderRotation: bdlspb.Options_ON,
+	}))
+	assert.Equal(t, bdls.RoundRobinLeader{DecisionsPerLeader: 3}, bdlsbft.LeaderElection(&bdlspb.Options{
+		LeaderRotation:     bdlspb.Options_ON,
+		DecisionsPerLeader: 3,
+	}))
+}
+
+func TestTimeouts(t *testing.T) {
+	timeouts, err := bdlsbft.Timeouts(nil)
+	require.NoError(t, err)
+	assert.Equal(t, bdls.Timeouts{}, timeouts)
+
+	timeouts, err = bdlsbft.Timeouts(&bdlspb.Options{
+		ViewChangeResendInterval: "1s",
+		CollectTimeout:           "200ms",
+		ViewChangeTimeout:        "20s",
+		LeaderHeartbeatTimeout:   "1m",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, bdls.Timeouts{
+		RoundChange: time.Second,
+		Collect:     200 * time.Millisecond,
+		MaxBackoff:  20 * time.Second,
+	}, timeouts)
+
+	// the timeouts are capped by the default maximum backoff
+	_, err = bdlsbft.Timeouts(&bdlspb.Options{CollectTimeout: "1m"})
+	assert.EqualError(t, err, "bad config metadata options: ViewChangeResendInterval and CollectTimeout cannot exceed ViewChangeTimeout 10s")
+}
+
+// makeConsenterOnCurve creates a consenter with a self-signed certificate on the given curve.
+func makeConsenterOnCurve(t *testing.T, id uint64, curve elliptic.Curve) *bdlspb.Consenter {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(id)),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &bdlspb.Consenter{
+		ConsenterId:   id,
+		Host:          "localhost",
+		Port:          7050,
+		MspId:         "OrdererOrg",
+		Identity:      protoutil.MarshalOrPanic(&msp.SerializedIdentity{Mspid: "OrdererOrg", IdBytes: cert}),
+		ClientTlsCert: cert,
+		ServerTlsCert: cert,
+	}
+}
+
+func TestCurve(t *testing.T) {
+	consenters := makeConsenters(t, 4)
+
+	curve, err := bdlsbft.Curve(consenters)
+	assert.NoError(t, err)
+	assert.Equal(t, bdls.P256Curve, curve)
+
+	// a consenter on an unsupported curve
+	_, err = bdlsbft.Curve(append(consenters, makeConsenterOnCurve(t, 5, elliptic.P384())))
+	assert.EqualError(t, err, "consenter 5 has a key on unsupported curve P-384")
+}
+
+func TestValidateConsenterChanges(t *testing.T) {
+	consenters := makeConsenters(t, 6)
+
+	// adding and removing consenters
+	assert.NoError(t, bdlsbft.ValidateConsenterChanges(consenters[:4], consenters[1:5]))
+
+	// adding a consenter with the id of a removed consenter
+	assert.EqualError(t, bdlsbft.ValidateConsenterChanges(consenters[1:5], consenters[:4]),
+		"consenter id 1 is not greater than the ids of the existing consenters")
+
+	// changing the identity of a consenter
+	changed := proto.Clone(consenters[5]).(*bdlspb.Consenter)
+	changed.ConsenterId = 2
+	assert.EqualError(t, bdlsbft.ValidateConsenterChanges(consenters[:4], []*bdlspb.Consenter{consenters[0], changed, consenters[2], consenters[3]}),
+		"consenter 2 cannot change its identity")
+}
+
+func TestIsConsenterOfChannel(t *testing.T) {
+	cryptoProvider, err := sw.NewDefaultSecurityLevelWithKeystore(sw.NewDummyKeyStore())
+	require.NoError(t, err)
+
+	soloConf := genesisconfig.Load(genesisconfig.SampleDevModeSoloProfile, configtest.GetDevConfigDir())
+	bootstrapper, err := encoder.NewBootstrapper(soloConf)
+	require.NoError(t, err)
+	soloBlock := bootstrapper.GenesisBlockForChannel("mychannel")
+
+	for _, testCase := range []struct {
+		name          string
+		expectedError string
+		configBlock   *cb.Block
+	}{
+		{
+			name:          "nil block",
+			expectedError: "nil block or nil header",
+		},
+		{
+			name:          "nil header",
+			expectedError: "nil block or nil header",
+			configBlock:   &cb.Block{},
+		},
+		{
+			name:          "no block data",
+			expectedError: "block data is nil",
+			configBlock:   &cb.Block{Header: &cb.BlockHeader{}},
+		},
+		{
+			name:          "not a BDLS config block",
+			expectedError: "not a BDLS config block",
+			configBlock:   soloBlock,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			consenterCertificate := bdlsbft.ConsenterCertificate{
+				ConsenterCertificate: []byte("cert"),
+				CryptoProvider:       cryptoProvider,
+			}
+			err := consenterCertificate.IsConsenterOfChannel(testCase.configBlock)
+			require.EqualError(t, err, testCase.expectedError)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric/orderer/common/msgprocessor"
+	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// Verifier validates the candidate blocks proposed to the BDLS consensus core.
+type Verifier struct {
+	Support consensus.ConsenterSupport
+}
+
+// VerifyBlock verifies that the block is chained to the given last block, and
+// that its transactions pass the message filters of the channel.
+func (v *Verifier) VerifyBlock(block *cb.Block, lastBlock *cb.Block) error {
+	if block.Header == nil {
+		return errors.New("missing block header")
+	}
+	if block.Data == nil || len(block.Data.Data) == 0 {
+		return errors.New("empty block data")
+	}
+
+	if block.Header.Number != lastBlock.Header.Number+1 {
+		return errors.Errorf("block number is %d but expected %d", block.Header.Number, lastBlock.Header.Number+1)
+	}
+	if err := verifyHashChain(block, protoutil.BlockHeaderHash(lastBlock.Header)); err != nil {
+		return err
+	}
+
+	onlyTransaction := len(block.Data.Data) == 1
+	for i, data := range block.Data.Data {
+		if err := v.verifyTransaction(data, onlyTransaction); err != nil {
+			return errors.Wrapf(err, "transaction %d", i)
+		}
+	}
+	return nil
+}
+
+func (v *Verifier) verifyTransaction(data []byte, onlyTransaction bool) error {
+	env, err := protoutil.UnmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	chdr, err := protoutil.ChannelHeader(env)
+	if err != nil {
+		return err
+	}
+
+	switch class := v.Support.ClassifyMsg(chdr); class {
+	case msgprocessor.NormalMsg:
+		_, err = v.Support.ProcessNormalMsg(env)
+	case msgprocessor.ConfigMsg:
+		if !onlyTransaction {
+			return errors.New("config transaction must be in a block of its own")
+		}
+		var expected *cb.Envelope
+		if expected, _, err = v.Support.ProcessConfigMsg(env); err != nil {
+			return err
+		}
+		return verifyConfig(env, expected)
+	default:
+		return errors.Errorf("transaction of type %s is not allowed to be included in blocks", cb.HeaderType(chdr.Type))
+	}
+	return err
+}
+
+// verifyConfig verifies that the config in the block is the one computed
+// by re-processing its config update against the current config.
+func verifyConfig(env *cb.Envelope, expected *cb.Envelope) error {
+	config, err := configOf(env)
+	if err != nil {
+		return err
+	}
+	expectedConfig, err := configOf(expected)
+	if err != nil {
+		return errors.WithMessage(err, "bad re-processed config")
+	}
+	if !proto.Equal(config, expectedConfig) {
+		return errors.New("pending config does not match calculated expected config")
+	}
+	return nil
+}
+
+// configOf extracts the config of a config envelope, or of the config
+// envelope wrapped by an orderer transaction.
+func configOf(env *cb.Envelope) (*cb.Config, error) {
+	if env == nil {
+		return nil, errors.New("missing config envelope")
+	}
+	payload, err := protoutil.UnmarshalPayload(env.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Header == nil {
+		return nil, errors.New("missing payload header")
+	}
+	chdr, err := protoutil.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	if chdr.Type == int32(cb.HeaderType_ORDERER_TRANSACTION) {
+		inner, err := protoutil.UnmarshalEnvelope(payload.Data)
+		if err != nil {
+			return nil, err
+		}
+		return configOf(inner)
+	}
+
+	configEnvelope := &cb.ConfigEnvelope{}
+	if _, err := protoutil.UnmarshalEnvelopeOfType(env, cb.HeaderType_CONFIG, configEnvelope); err != nil {
+		return nil, err
+	}
+	if configEnvelope.Config == nil {
+		return nil, errors.New("missing config")
+	}
+	return configEnvelope.Config, nil
+}
+
+func verifyHashChain(block *cb.Block, prevHeaderHash []byte) error {
+	if !bytes.Equal(block.Header.PreviousHash, prevHeaderHash) {
+		return errors.Errorf("previous header hash is %x but expected %x", block.Header.PreviousHash, prevHeaderHash)
+	}
+
+	dataHash := protoutil.BlockDataHash(block.Data)
+	if !bytes.Equal(block.Header.DataHash, dataHash) {
+		return errors.Errorf("data hash is %x but expected %x", block.Header.DataHash, dataHash)
+	}
+	return nil
+}
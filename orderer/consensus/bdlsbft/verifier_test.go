@@ -0,0 +1,152 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bdlsbft_test
+
+import (
+	"fmt"
+	"testing"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	bdlspb "github.com/hyperledger/fabric-protos-go/orderer/bdls"
+	"github.com/hyperledger/fabric/orderer/common/msgprocessor"
+	"github.com/hyperledger/fabric/orderer/consensus/bdlsbft"
+	consensusmocks "github.com/hyperledger/fabric/orderer/consensus/mocks"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifierVerifyBlock(t *testing.T) {
+	lastBlock := protoutil.NewBlock(4, []byte("previous"))
+	lastBlock.Header.DataHash = protoutil.BlockDataHash(lastBlock.Data)
+
+	nextBlock := func(envs ...*cb.Envelope) *cb.Block {
+		block := protoutil.NewBlock(5, protoutil.BlockHeaderHash(lastBlock.Header))
+		for _, env := range envs {
+			block.Data.Data = append(block.Data.Data, protoutil.MarshalOrPanic(env))
+		}
+		block.Header.DataHash = protoutil.BlockDataHash(block.Data)
+		return block
+	}
+
+	configMetadata := &bdlspb.ConfigMetadata{Consenters: makeConsenters(t, 4)}
+	// the tampered config drops a consenter, without the config update doing so
+	tamperedMetadata := &bdlspb.ConfigMetadata{Consenters: configMetadata.Consenters[:3]}
+
+	for _, testCase := range []struct {
+		name        string
+		block       func() *cb.Block
+		classify    msgprocessor.Classification
+		filterErr   error
+		reprocessed *cb.Envelope
+		configErr   error
+		expectedErr string
+	}{
+		{
+			name:  "valid block",
+			block: func() *cb.Block { return nextBlock(makeEnvelope(0), makeEnvelope(1)) },
+		},
+		{
+			name: "missing header",
+			block: func() *cb.Block {
+				block := nextBlock(makeEnvelope(0))
+				block.Header = nil
+				return block
+			},
+			expectedErr: "missing block header",
+		},
+		{
+			name:        "empty block",
+			block:       func() *cb.Block { return nextBlock() },
+			expectedErr: "empty block data",
+		},
+		{
+			name: "wrong number",
+			block: func() *cb.Block {
+				block := nextBlock(makeEnvelope(0))
+				block.Header.Number = 6
+				return block
+			},
+			expectedErr: "block number is 6 but expected 5",
+		},
+		{
+			name: "broken hash chain",
+			block: func() *cb.Block {
+				block := nextBlock(makeEnvelope(0))
+				block.Header.PreviousHash = []byte{1, 2, 3}
+				return block
+			},
+			expectedErr: "previous header hash is 010203 but expected " + hexString(protoutil.BlockHeaderHash(lastBlock.Header)),
+		},
+		{
+			name: "wrong data hash",
+			block: func() *cb.Block {
+				block := nextBlock(makeEnvelope(0))
+				block.Header.DataHash = []byte{1, 2, 3}
+				return block
+			},
+			expectedErr: "data hash is 010203 but expected " + hexString(protoutil.BlockDataHash(nextBlock(makeEnvelope(0)).Data)),
+		},
+		{
+			name:        "filtered transaction",
+			block:       func() *cb.Block { return nextBlock(makeEnvelope(0), makeEnvelope(1)) },
+			filterErr:   errors.New("access denied"),
+			expectedErr: "transaction 0: access denied",
+		},
+		{
+			name:        "config transaction with others",
+			block:       func() *cb.Block { return nextBlock(makeEnvelope(0), makeEnvelope(1)) },
+			classify:    msgprocessor.ConfigMsg,
+			expectedErr: "transaction 0: config transaction must be in a block of its own",
+		},
+		{
+			name:        "config transaction",
+			block:       func() *cb.Block { return nextBlock(makeConfigEnvelope(configMetadata)) },
+			classify:    msgprocessor.ConfigMsg,
+			reprocessed: makeConfigEnvelope(configMetadata),
+		},
+		{
+			name:        "tampered config transaction",
+			block:       func() *cb.Block { return nextBlock(makeConfigEnvelope(tamperedMetadata)) },
+			classify:    msgprocessor.ConfigMsg,
+			reprocessed: makeConfigEnvelope(configMetadata),
+			expectedErr: "transaction 0: pending config does not match calculated expected config",
+		},
+		{
+			name:        "rejected config transaction",
+			block:       func() *cb.Block { return nextBlock(makeConfigEnvelope(configMetadata)) },
+			classify:    msgprocessor.ConfigMsg,
+			configErr:   errors.New("config update is not authorized"),
+			expectedErr: "transaction 0: config update is not authorized",
+		},
+		{
+			name:        "config update transaction",
+			block:       func() *cb.Block { return nextBlock(makeEnvelope(0)) },
+			classify:    msgprocessor.ConfigUpdateMsg,
+			expectedErr: "transaction 0: transaction of type ENDORSER_TRANSACTION is not allowed to be included in blocks",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			support := &consensusmocks.FakeConsenterSupport{}
+			support.ClassifyMsgReturns(testCase.classify)
+			support.ProcessNormalMsgReturns(0, testCase.filterErr)
+			support.ProcessConfigMsgReturns(testCase.reprocessed, 0, testCase.configErr)
+			verifier := &bdlsbft.Verifier{Support: support}
+
+			err := verifier.VerifyBlock(testCase.block(), lastBlock)
+			if testCase.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, testCase.expectedErr)
+		})
+	}
+}
+
+func hexString(b []byte) string {
+	return fmt.Sprintf("%x", b)
+}
@@ -49,6 +49,15 @@ type MetadataValidator interface {
 	ValidateConsensusMetadata(oldOrdererConfig, newOrdererConfig channelconfig.Orderer, newChannel bool) error
 }
 
+// MetadataVerifier verifies the ConsensusMetadata of a channel migrating to the consensus type of a Consenter.
+// NOTE: We expect the MetadataVerifier interface to be optionally implemented by the Consenter implementation.
+// If a Consenter does not implement MetadataVerifier, the ConsensusMetadata is not verified on migration.
+type MetadataVerifier interface {
+	// VerifyConsensusMetadata determines the validity of the ConsensusMetadata of the given orderer config,
+	// which is of the consensus type of the Consenter.
+	VerifyConsensusMetadata(ordererConfig channelconfig.Orderer) error
+}
+
 // Chain defines a way to inject messages for ordering.
 // Note, that in order to allow flexibility in the implementation, it is the responsibility of the implementer
 // to take the ordered messages, send them through the blockcutter.Receiver supplied via HandleChain to cut blocks,
@@ -8,6 +8,7 @@ package etcdraft
 
 import (
 	"bytes"
+	"os"
 	"path"
 	"reflect"
 	"time"
@@ -130,6 +131,66 @@ func (c *Consenter) detectSelfID(consenters map[uint64]*etcdraft.Consenter) (uin
 	return 0, cluster.ErrNotInChannel
 }
 
+// removeStaleRaftData removes the raft data left by a channel which migrated back to raft
+// at the given block, from before it migrated away, which would otherwise restore entries
+// already written to the ledger. The data is stale if all of its blocks precede the migration
+// block, and it was written by the raft cluster started at the migration block if it carries
+// no block or only blocks following the migration block, in which case it is kept. Any other
+// data cannot be told apart, and is left for the operator to remove.
+func (c *Consenter) removeStaleRaftData(migrationBlock uint64, walDir string, snapDir string) error {
+	lowest, highest, found, err := blocksInRaftData(c.Logger, walDir, snapDir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !found || lowest > migrationBlock:
+		return nil
+	case highest < migrationBlock:
+		c.Logger.Infof("Removing raft data of blocks [%d, %d] preceding consensus-type migration block [%d]", lowest, highest, migrationBlock)
+		for _, dir := range []string{walDir, snapDir} {
+			if err := os.RemoveAll(dir); err != nil {
+				return errors.Wrapf(err, "failed to remove raft data in %s", dir)
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("raft data in %s and %s carries blocks [%d, %d] across consensus-type migration block [%d], "+
+			"it must be removed manually if it was written before the channel migrated away from raft", walDir, snapDir, lowest, highest, migrationBlock)
+	}
+}
+
+// migratedAtLastBlock reports whether the last block of the chain is the config block which migrated the channel
+// to etcdraft, that is the config preceding it is of another consensus type.
+func migratedAtLastBlock(support consensus.ConsenterSupport) (bool, error) {
+	lastBlock := support.Block(support.Height() - 1)
+	if lastBlock == nil {
+		return false, errors.Errorf("failed to retrieve block [%d]", support.Height()-1)
+	}
+	if !protoutil.IsConfigBlock(lastBlock) {
+		return false, nil
+	}
+
+	previousBlock := support.Block(support.Height() - 2)
+	if previousBlock == nil {
+		return false, errors.Errorf("failed to retrieve block [%d]", support.Height()-2)
+	}
+	previousConfigIndex, err := protoutil.GetLastConfigIndexFromBlock(previousBlock)
+	if err != nil {
+		return false, errors.WithMessagef(err, "failed to read last config index of block [%d]", previousBlock.Header.Number)
+	}
+	previousConfigBlock := support.Block(previousConfigIndex)
+	if previousConfigBlock == nil {
+		return false, errors.Errorf("failed to retrieve config block [%d]", previousConfigIndex)
+	}
+
+	consensusType, err := ConsensusTypeFromConfigBlock(previousConfigBlock)
+	if err != nil {
+		return false, errors.WithMessagef(err, "failed to read consensus type of config block [%d]", previousConfigIndex)
+	}
+	return consensusType != "etcdraft", nil
+}
+
 // HandleChain returns a new Chain instance or an error upon failure
 func (c *Consenter) HandleChain(support consensus.ConsenterSupport, metadata *common.Metadata) (consensus.Chain, error) {
 	m := &etcdraft.ConfigMetadata{}
@@ -141,9 +202,27 @@ func (c *Consenter) HandleChain(support consensus.ConsenterSupport, metadata *co
 		return nil, errors.New("etcdraft options have not been provided")
 	}
 
+	walDir := path.Join(c.EtcdRaftConfig.WALDir, support.ChannelID())
+	snapDir := path.Join(c.EtcdRaftConfig.SnapDir, support.ChannelID())
+
 	isMigration := (metadata == nil || len(metadata.Value) == 0) && (support.Height() > 1)
+	if !isMigration && support.Height() > 1 {
+		// The block migrating the channel from bdls keeps the bdls decide proof as its block metadata,
+		// so the migration is told from the consensus type of the config preceding the block.
+		migrated, err := migratedAtLastBlock(support)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to detect consensus-type migration of channel %s", support.ChannelID())
+		}
+		if migrated {
+			isMigration = true
+			metadata = nil
+		}
+	}
 	if isMigration {
-		c.Logger.Debugf("Block metadata is nil at block height=%d, it is consensus-type migration", support.Height())
+		c.Logger.Debugf("Block metadata is not raft metadata at block height=%d, it is consensus-type migration", support.Height())
+		if err := c.removeStaleRaftData(support.Height()-1, walDir, snapDir); err != nil {
+			return nil, errors.Wrapf(err, "failed to inspect raft data of channel %s", support.ChannelID())
+		}
 	}
 
 	// determine raft replica set mapping for each node to its id
@@ -217,8 +296,8 @@ func (c *Consenter) HandleChain(support consensus.ConsenterSupport, metadata *co
 
 		MigrationInit: isMigration,
 
-		WALDir:            path.Join(c.EtcdRaftConfig.WALDir, support.ChannelID()),
-		SnapDir:           path.Join(c.EtcdRaftConfig.SnapDir, support.ChannelID()),
+		WALDir:            walDir,
+		SnapDir:           snapDir,
 		EvictionSuspicion: evictionSuspicion,
 		Cert:              c.Cert,
 		Metrics:           c.Metrics,
@@ -301,6 +380,22 @@ func (c *Consenter) IsChannelMember(joinBlock *common.Block) (bool, error) {
 	return member, nil
 }
 
+// VerifyConsensusMetadata verifies the Raft config metadata of the given orderer config,
+// which is the metadata of a channel migrating to etcdraft.
+func (c *Consenter) VerifyConsensusMetadata(ordererConfig channelconfig.Orderer) error {
+	configMetadata := &etcdraft.ConfigMetadata{}
+	if err := proto.Unmarshal(ordererConfig.ConsensusMetadata(), configMetadata); err != nil {
+		return errors.Wrap(err, "failed to unmarshal etcdraft metadata configuration")
+	}
+
+	verifyOpts, err := CreateX509VerifyOptions(ordererConfig)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create x509 verify options from orderer config")
+	}
+
+	return VerifyConfigMetadata(configMetadata, verifyOpts)
+}
+
 // RemoveInactiveChainRegistry stops and removes the inactive chain registry.
 // This is used when removing the system channel.
 func (c *Consenter) RemoveInactiveChainRegistry() {
@@ -362,6 +362,55 @@ var _ = Describe("Consenter", func() {
 		Expect(trackChainCallback).To(BeTrue())
 	})
 
+	When("the last block is a config block carrying the metadata of another consensus type", func() {
+		var consenter *consenter
+
+		BeforeEach(func() {
+			m := &etcdraftproto.ConfigMetadata{
+				Consenters: []*etcdraftproto.Consenter{
+					{ServerTlsCert: certAsPEM},
+				},
+				Options: &etcdraftproto.Options{
+					TickInterval:      "500ms",
+					ElectionTick:      10,
+					HeartbeatTick:     1,
+					MaxInflightBlocks: 5,
+				},
+			}
+			mockOrderer := &mocks.OrdererConfig{}
+			mockOrderer.ConsensusMetadataReturns(protoutil.MarshalOrPanic(m))
+			mockOrderer.BatchSizeReturns(
+				&orderer.BatchSize{
+					PreferredMaxBytes: 2 * 1024 * 1024,
+				},
+			)
+			support.SharedConfigReturns(mockOrderer)
+			support.HeightReturns(2)
+
+			consenter = newConsenter(chainManager, tlsCA.CertBytes(), certAsPEM)
+			consenter.EtcdRaftConfig.WALDir = walDir
+			consenter.EtcdRaftConfig.SnapDir = snapDir
+			consenter.Metrics = newFakeMetrics(newFakeMetricsFields())
+		})
+
+		It("detects the migration from bdls, whose block keeps the decide proof", func() {
+			blocks := []*common.Block{configBlockOfType(0, 0, "bdls"), configBlockOfType(1, 1, "etcdraft")}
+			support.BlockStub = func(number uint64) *common.Block { return blocks[number] }
+
+			chain, err := consenter.HandleChain(support, &common.Metadata{Value: []byte("bdls decide proof")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chain).NotTo(BeNil())
+		})
+
+		It("reads the block metadata as raft metadata if the channel was already of type etcdraft", func() {
+			blocks := []*common.Block{configBlockOfType(0, 0, "etcdraft"), configBlockOfType(1, 1, "etcdraft")}
+			support.BlockStub = func(number uint64) *common.Block { return blocks[number] }
+
+			_, err := consenter.HandleChain(support, &common.Metadata{Value: []byte("bdls decide proof")})
+			Expect(err).To(MatchError(ContainSubstring("failed to read Raft metadata")))
+		})
+	})
+
 	It("successfully constructs a Chain without a system channel", func() {
 		// We append a line feed to our cert, just to ensure that we can still consume it and ignore.
 		certAsPEMWithLineFeed := certAsPEM
@@ -624,6 +673,46 @@ func newConsenter(chainManager *mocks.ChainManager, caCert, cert []byte) *consen
 	}
 }
 
+// configBlockOfType creates a config block of a channel of the given consensus type,
+// whose last config is the block at the given index.
+func configBlockOfType(number, lastConfig uint64, consensusType string) *common.Block {
+	configEnvelope := &common.ConfigEnvelope{
+		Config: &common.Config{
+			ChannelGroup: &common.ConfigGroup{
+				Groups: map[string]*common.ConfigGroup{
+					channelconfig.OrdererGroupKey: {
+						Values: map[string]*common.ConfigValue{
+							channelconfig.ConsensusTypeKey: {
+								Value: protoutil.MarshalOrPanic(&orderer.ConsensusType{Type: consensusType}),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	envelope := &common.Envelope{
+		Payload: protoutil.MarshalOrPanic(&common.Payload{
+			Header: &common.Header{
+				ChannelHeader: protoutil.MarshalOrPanic(&common.ChannelHeader{
+					Type:      int32(common.HeaderType_CONFIG),
+					ChannelId: "foo",
+				}),
+			},
+			Data: protoutil.MarshalOrPanic(configEnvelope),
+		}),
+	}
+
+	block := protoutil.NewBlock(number, nil)
+	block.Data.Data = [][]byte{protoutil.MarshalOrPanic(envelope)}
+	block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES] = protoutil.MarshalOrPanic(&common.Metadata{
+		Value: protoutil.MarshalOrPanic(&common.OrdererBlockMetadata{
+			LastConfig: &common.LastConfig{Index: lastConfig},
+		}),
+	})
+	return block
+}
+
 func generateCertificates(confAppRaft *genesisconfig.Profile, tlsCA tlsgen.CA, certDir string) [][]byte {
 	certificates := [][]byte{}
 	for i, c := range confAppRaft.Orderer.EtcdRaft.Consenters {
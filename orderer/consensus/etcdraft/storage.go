@@ -15,6 +15,7 @@ import (
 	"strings"
 
 	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/protoutil"
 	"github.com/pkg/errors"
 	"go.etcd.io/etcd/etcdserver/api/snap"
 	"go.etcd.io/etcd/pkg/fileutil"
@@ -234,6 +235,69 @@ func createOrReadWAL(lg *flogging.FabricLogger, walDir string, snapshot *raftpb.
 	return w, st, ents, nil
 }
 
+// blocksInRaftData returns the lowest and highest numbers of the blocks carried by the
+// etcd/raft data on disk, in the latest snapshot and in the WAL entries following it.
+// found is false if there is no such data, or if it carries no block.
+func blocksInRaftData(lg *flogging.FabricLogger, walDir string, snapDir string) (lowest, highest uint64, found bool, err error) {
+	addBlock := func(data []byte) error {
+		block, err := protoutil.UnmarshalBlock(data)
+		if err != nil {
+			return err
+		}
+		if block.Header == nil {
+			return errors.New("block has no header")
+		}
+		if !found || block.Header.Number < lowest {
+			lowest = block.Header.Number
+		}
+		if !found || block.Header.Number > highest {
+			highest = block.Header.Number
+		}
+		found = true
+		return nil
+	}
+
+	walsnap := walpb.Snapshot{}
+	if fileutil.Exist(snapDir) {
+		snapshot, err := snap.New(lg.Zap(), snapDir).Load()
+		switch {
+		case err == snap.ErrNoSnapshot:
+		case err != nil:
+			return 0, 0, false, errors.Errorf("failed to load snapshot: %s", err)
+		default:
+			if err := addBlock(snapshot.Data); err != nil {
+				return 0, 0, false, errors.Errorf("failed to unmarshal block of snapshot at index %d: %s", snapshot.Metadata.Index, err)
+			}
+			walsnap.Index, walsnap.Term = snapshot.Metadata.Index, snapshot.Metadata.Term
+		}
+	}
+
+	if !wal.Exist(walDir) {
+		return lowest, highest, found, nil
+	}
+
+	w, err := wal.OpenForRead(lg.Zap(), walDir, walsnap)
+	if err != nil {
+		return 0, 0, false, errors.Errorf("failed to open WAL: %s", err)
+	}
+	defer w.Close()
+
+	_, _, ents, err := w.ReadAll()
+	if err != nil {
+		return 0, 0, false, errors.Errorf("failed to read WAL: %s", err)
+	}
+	for _, ent := range ents {
+		if ent.Type != raftpb.EntryNormal || len(ent.Data) == 0 {
+			continue
+		}
+		if err := addBlock(ent.Data); err != nil {
+			return 0, 0, false, errors.Errorf("failed to unmarshal block of WAL entry at index %d: %s", ent.Index, err)
+		}
+	}
+
+	return lowest, highest, found, nil
+}
+
 // Snapshot returns the latest snapshot stored in memory
 func (rs *RaftStorage) Snapshot() raftpb.Snapshot {
 	sn, _ := rs.ram.Snapshot() // Snapshot always returns nil error
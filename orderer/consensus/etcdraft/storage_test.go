@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package etcdraft
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -16,6 +17,7 @@ import (
 	"testing"
 
 	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/protoutil"
 	"github.com/stretchr/testify/require"
 	"go.etcd.io/etcd/pkg/fileutil"
 	"go.etcd.io/etcd/raft"
@@ -394,3 +396,87 @@ func TestApplyOutOfDateSnapshot(t *testing.T) {
 		assertFileCount(t, 12, 1)
 	})
 }
+
+func TestRemoveStaleRaftData(t *testing.T) {
+	logger := flogging.NewFabricLogger(zap.NewExample())
+	consenter := &Consenter{Logger: logger}
+
+	// writeRaftData persists entries carrying the given blocks after a ConfChange entry
+	// and an empty entry, and takes a snapshot of the first block if snapshot is set.
+	writeRaftData := func(t *testing.T, blocks []uint64, snapshot bool) (string, string) {
+		dataDir, err := ioutil.TempDir("", "etcdraft-")
+		require.NoError(t, err)
+		walDir, snapDir := path.Join(dataDir, "wal"), path.Join(dataDir, "snapshot")
+
+		store, err := CreateStorage(logger, walDir, snapDir, raft.NewMemoryStorage())
+		require.NoError(t, err)
+		cc := raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: 1}
+		entries := []raftpb.Entry{
+			{Index: 1, Term: 1, Type: raftpb.EntryConfChange, Data: protoutil.MarshalOrPanic(&cc)},
+			{Index: 2, Term: 1},
+		}
+		for i, number := range blocks {
+			entries = append(entries, raftpb.Entry{Index: uint64(i + 3), Term: 1, Data: protoutil.MarshalOrPanic(protoutil.NewBlock(number, nil))})
+		}
+		require.NoError(t, store.Store(entries, raftpb.HardState{Term: 1, Vote: 1, Commit: uint64(len(entries))}, raftpb.Snapshot{}))
+		if snapshot {
+			require.NoError(t, store.TakeSnapshot(3, raftpb.ConfState{Nodes: []uint64{1}}, entries[2].Data))
+		}
+		require.NoError(t, store.Close())
+		return walDir, snapDir
+	}
+
+	t.Run("no raft data", func(t *testing.T) {
+		dataDir, err := ioutil.TempDir("", "etcdraft-")
+		require.NoError(t, err)
+		defer os.RemoveAll(dataDir)
+
+		walDir, snapDir := path.Join(dataDir, "wal"), path.Join(dataDir, "snapshot")
+		require.NoError(t, consenter.removeStaleRaftData(8, walDir, snapDir))
+	})
+
+	t.Run("raft data without blocks is kept", func(t *testing.T) {
+		walDir, snapDir := writeRaftData(t, nil, false)
+		defer os.RemoveAll(path.Dir(walDir))
+
+		_, _, found, err := blocksInRaftData(logger, walDir, snapDir)
+		require.NoError(t, err)
+		require.False(t, found)
+
+		require.NoError(t, consenter.removeStaleRaftData(8, walDir, snapDir))
+		require.True(t, wal.Exist(walDir))
+	})
+
+	t.Run("raft data following the migration block is kept", func(t *testing.T) {
+		walDir, snapDir := writeRaftData(t, []uint64{9, 10}, false)
+		defer os.RemoveAll(path.Dir(walDir))
+
+		require.NoError(t, consenter.removeStaleRaftData(8, walDir, snapDir))
+		require.True(t, wal.Exist(walDir))
+	})
+
+	t.Run("raft data preceding the migration block is removed", func(t *testing.T) {
+		walDir, snapDir := writeRaftData(t, []uint64{4, 5, 6}, true)
+		defer os.RemoveAll(path.Dir(walDir))
+
+		lowest, highest, found, err := blocksInRaftData(logger, walDir, snapDir)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, uint64(4), lowest)
+		require.Equal(t, uint64(6), highest)
+
+		require.NoError(t, consenter.removeStaleRaftData(8, walDir, snapDir))
+		require.False(t, wal.Exist(walDir))
+		require.False(t, fileutil.Exist(snapDir))
+	})
+
+	t.Run("raft data across the migration block is refused", func(t *testing.T) {
+		walDir, snapDir := writeRaftData(t, []uint64{7, 8, 9}, false)
+		defer os.RemoveAll(path.Dir(walDir))
+
+		err := consenter.removeStaleRaftData(8, walDir, snapDir)
+		require.EqualError(t, err, fmt.Sprintf("raft data in %s and %s carries blocks [7, 9] across consensus-type migration block [8], "+
+			"it must be removed manually if it was written before the channel migrated away from raft", walDir, snapDir))
+		require.True(t, wal.Exist(walDir))
+	})
+}
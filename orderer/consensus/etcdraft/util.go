@@ -83,13 +83,19 @@ func MetadataHasDuplication(md *etcdraft.ConfigMetadata) error {
 	return nil
 }
 
-// MetadataFromConfigValue reads and translates configuration updates from config value into raft metadata
+// MetadataFromConfigValue reads and translates configuration updates from config value into raft metadata.
+// It returns nil metadata when the config value migrates the channel to another consensus type.
 func MetadataFromConfigValue(configValue *common.ConfigValue) (*etcdraft.ConfigMetadata, error) {
 	consensusTypeValue := &orderer.ConsensusType{}
 	if err := proto.Unmarshal(configValue.Value, consensusTypeValue); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal consensusType config update")
 	}
 
+	// the metadata of the consensus type migrated to is not raft metadata
+	if consensusTypeValue.Type != "" && consensusTypeValue.Type != "etcdraft" {
+		return nil, nil
+	}
+
 	updatedMetadata := &etcdraft.ConfigMetadata{}
 	if err := proto.Unmarshal(consensusTypeValue.Metadata, updatedMetadata); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal updated (new) etcdraft metadata configuration")
@@ -176,6 +182,40 @@ func ConfigEnvelopeFromBlock(block *common.Block) (*common.Envelope, error) {
 	}
 }
 
+// ConsensusTypeFromConfigBlock reads the consensus type of the channel config in the configuration block
+func ConsensusTypeFromConfigBlock(block *common.Block) (string, error) {
+	configEnvelope, err := ConfigEnvelopeFromBlock(block)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read config envelope")
+	}
+
+	payload, err := protoutil.UnmarshalPayload(configEnvelope.Payload)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to extract payload from config envelope")
+	}
+
+	config, err := configtx.UnmarshalConfigEnvelope(payload.Data)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to unmarshal config envelope")
+	}
+
+	if config.Config == nil || config.Config.ChannelGroup == nil || config.Config.ChannelGroup.Groups[channelconfig.OrdererGroupKey] == nil {
+		return "", errors.New("config is missing orderer group")
+	}
+
+	consensusTypeValue, ok := config.Config.ChannelGroup.Groups[channelconfig.OrdererGroupKey].Values[channelconfig.ConsensusTypeKey]
+	if !ok {
+		return "", errors.New("config is missing consensus type")
+	}
+
+	consensusType := &orderer.ConsensusType{}
+	if err := proto.Unmarshal(consensusTypeValue.Value, consensusType); err != nil {
+		return "", errors.Wrap(err, "failed to unmarshal consensus type")
+	}
+
+	return consensusType.Type, nil
+}
+
 // ConsensusMetadataFromConfigBlock reads consensus metadata updates from the configuration block
 func ConsensusMetadataFromConfigBlock(block *common.Block) (*etcdraft.ConfigMetadata, error) {
 	if block == nil {
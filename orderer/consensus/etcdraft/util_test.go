@@ -16,6 +16,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/orderer"
 	etcdraftproto "github.com/hyperledger/fabric-protos-go/orderer/etcdraft"
 	"github.com/hyperledger/fabric/bccsp/sw"
 	"github.com/hyperledger/fabric/common/crypto/tlsgen"
@@ -418,3 +419,26 @@ func TestVerifyConfigMetadata(t *testing.T) {
 
 	require.Nil(t, VerifyConfigMetadata(metadataWithExpiredConsenter, expiredCertVerifyOpts))
 }
+
+func TestMetadataFromConfigValue(t *testing.T) {
+	raftMetadata := &etcdraftproto.ConfigMetadata{
+		Consenters: []*etcdraftproto.Consenter{{Host: "raft1", Port: 7050}},
+	}
+
+	metadata, err := MetadataFromConfigValue(&common.ConfigValue{
+		Value: protoutil.MarshalOrPanic(&orderer.ConsensusType{Type: "etcdraft", Metadata: protoutil.MarshalOrPanic(raftMetadata)}),
+	})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(raftMetadata, metadata))
+
+	// the metadata of the consensus type migrated to is not raft metadata
+	metadata, err = MetadataFromConfigValue(&common.ConfigValue{
+		Value: protoutil.MarshalOrPanic(&orderer.ConsensusType{Type: "bdls", Metadata: []byte{1, 2, 3, 4}}),
+	})
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	_, err = MetadataFromConfigValue(&common.ConfigValue{Value: []byte{1, 2, 3, 4}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to unmarshal consensusType config update")
+}